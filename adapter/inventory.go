@@ -21,6 +21,7 @@ import (
 	"istio.io/mixer/adapter/memQuota"
 	"istio.io/mixer/adapter/prometheus"
 	"istio.io/mixer/adapter/redisquota"
+	"istio.io/mixer/adapter/remote"
 	"istio.io/mixer/adapter/statsd"
 	"istio.io/mixer/adapter/stdioLogger"
 	"istio.io/mixer/pkg/adapter"
@@ -35,6 +36,7 @@ func Inventory() []adapter.RegisterFn {
 		memQuota.Register,
 		prometheus.Register,
 		redisquota.Register,
+		remote.Register,
 		statsd.Register,
 		stdioLogger.Register,
 	}
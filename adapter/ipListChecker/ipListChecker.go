@@ -17,12 +17,14 @@ package ipListChecker
 import (
 	"crypto/sha1"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -36,14 +38,29 @@ type (
 	builder struct{ adapter.DefaultBuilder }
 
 	listChecker struct {
-		log           adapter.Logger
-		providerURL   string
-		atomicList    atomic.Value
-		client        http.Client
-		closing       chan bool
+		log         adapter.Logger
+		providerURL string
+		atomicList  atomic.Value
+		client      http.Client
+		closing     chan bool
+
+		// signals the refresher that a reconfiguration is pending, it holds one signal at most
+		reconfig chan struct{}
+
+		pendingLock sync.Mutex // guards pending
+		pending     *reconfiguration
+
+		// owned by the refresher once it runs
 		refreshTicker *time.Ticker
 		purgeTimer    *time.Timer
 		ttl           time.Duration
+		installed     time.Time
+	}
+
+	// reconfiguration is a configuration the refresher is yet to apply.
+	reconfiguration struct {
+		env adapter.Env
+		cfg *config.Params
 	}
 
 	listState struct {
@@ -109,6 +126,7 @@ func newListCheckerWithTimers(env adapter.Env, c *config.Params,
 		log:           env.Logger(),
 		providerURL:   c.ProviderUrl,
 		closing:       make(chan bool),
+		reconfig:      make(chan struct{}, 1),
 		refreshTicker: refreshTicker,
 		purgeTimer:    purgeTimer,
 		ttl:           ttl,
@@ -127,11 +145,58 @@ func newListCheckerWithTimers(env adapter.Env, c *config.Params,
 
 func (l *listChecker) Close() error {
 	close(l.closing)
-	l.refreshTicker.Stop()
-	l.purgeTimer.Stop()
 	return nil
 }
 
+// Reconfigure applies new refresh settings and env, keeping the list fetched so far. It doesn't
+// wait for a fetch in progress: the refresher applies the latest settings once it's done, and
+// the new TTL counts from the time the list was last installed. A new provider means a new list,
+// so the provider URL can't change.
+func (l *listChecker) Reconfigure(env adapter.Env, c adapter.Config, _ map[string]*adapter.MetricDefinition,
+	_ map[string]*adapter.QuotaDefinition) error {
+	cfg := c.(*config.Params)
+	if cfg.ProviderUrl != l.providerURL {
+		return fmt.Errorf("provider URL can't change from %s to %s", l.providerURL, cfg.ProviderUrl)
+	}
+
+	select {
+	case <-l.closing:
+		return errors.New("list checker is closed")
+	default:
+	}
+
+	l.pendingLock.Lock()
+	l.pending = &reconfiguration{env, cfg}
+	l.pendingLock.Unlock()
+
+	select {
+	case l.reconfig <- struct{}{}:
+	default:
+		// the refresher has yet to pick up a previous signal, it will find this one instead
+	}
+	return nil
+}
+
+// applyPending applies the latest reconfiguration, if it hasn't been applied yet.
+func (l *listChecker) applyPending() {
+	l.pendingLock.Lock()
+	r := l.pending
+	l.pending = nil
+	l.pendingLock.Unlock()
+
+	if r == nil {
+		return
+	}
+
+	l.log = r.env.Logger()
+	l.refreshTicker.Stop()
+	l.refreshTicker = time.NewTicker(r.cfg.RefreshInterval)
+	if r.cfg.Ttl != l.ttl {
+		l.ttl = r.cfg.Ttl
+		l.resetPurgeTimer()
+	}
+}
+
 func (l *listChecker) CheckList(symbol string) (bool, error) {
 	ipa := net.ParseIP(symbol)
 	if ipa == nil {
@@ -175,7 +240,12 @@ func (l *listChecker) listRefresher() {
 		case <-l.purgeTimer.C:
 			l.purgeList()
 
+		case <-l.reconfig:
+			l.applyPending()
+
 		case <-l.closing:
+			l.refreshTicker.Stop()
+			l.purgeTimer.Stop()
 			return
 		}
 	}
@@ -249,7 +319,14 @@ func (l *listChecker) fetchListWithBody(body io.Reader) {
 	ls.entriesSHA = newSHA
 	ls.fetchError = nil
 	l.setListState(ls)
+	l.installed = time.Now()
+
+	// setup the purge timer to clean up the list if it doesn't get refreshed soon enough
+	l.resetPurgeTimer()
+}
 
+// resetPurgeTimer schedules the purge of the list once it has been installed for the TTL.
+func (l *listChecker) resetPurgeTimer() {
 	// prevent the outstanding purge from happening
 	l.purgeTimer.Stop()
 
@@ -259,8 +336,11 @@ func (l *listChecker) fetchListWithBody(body io.Reader) {
 	default:
 	}
 
-	// setup the purge timer to clean up the list if it doesn't get refreshed soon enough
-	l.purgeTimer.Reset(l.ttl)
+	ttl := l.ttl
+	if !l.installed.IsZero() {
+		ttl -= time.Since(l.installed)
+	}
+	l.purgeTimer.Reset(ttl)
 }
 
 func (l *listChecker) purgeList() {
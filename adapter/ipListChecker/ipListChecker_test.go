@@ -18,6 +18,7 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -326,6 +327,114 @@ func TestRefreshAndPurge(t *testing.T) {
 	}
 }
 
+func TestReconfigure(t *testing.T) {
+	var fetches int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		out, _ := yaml.Marshal(listPayload{WhiteList: []string{"10.10.11.2"}})
+		_, _ = w.Write(out)
+	}))
+	defer ts.Close()
+
+	b := newBuilder()
+	cfg := config.Params{
+		ProviderUrl:     ts.URL,
+		RefreshInterval: toDuration(3600),
+		Ttl:             toDuration(360000),
+	}
+	a, err := b.NewListsAspect(test.NewEnv(t), &cfg)
+	if err != nil {
+		t.Fatalf("Unable to create aspect: %v", err)
+	}
+	r := a.(adapter.Reconfigurable)
+
+	slower := cfg
+	slower.RefreshInterval = toDuration(7200)
+	if err = r.Reconfigure(test.NewEnv(t), &slower, nil, nil); err != nil {
+		t.Errorf("Reconfigure() = %v, want no error", err)
+	}
+	if ok, err := a.CheckList("10.10.11.2"); !ok || err != nil {
+		t.Errorf("CheckList() = %t, %v after Reconfigure(), want the list to be kept", ok, err)
+	}
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("list fetched %d times, want 1", n)
+	}
+
+	moved := cfg
+	moved.ProviderUrl = "http://localhost/elsewhere"
+	if err = r.Reconfigure(test.NewEnv(t), &moved, nil, nil); err == nil {
+		t.Error("Reconfigure() with a new provider succeeded, want an error")
+	}
+
+	if err := a.Close(); err != nil {
+		t.Errorf("Unable to close aspect: %v", err)
+	}
+	if err = r.Reconfigure(test.NewEnv(t), &slower, nil, nil); err == nil {
+		t.Error("Reconfigure() after Close() succeeded, want an error")
+	}
+}
+
+func TestReconfigure_DuringFetch(t *testing.T) {
+	var fetches int32
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&fetches, 1) > 1 {
+			<-release
+		}
+		out, _ := yaml.Marshal(listPayload{WhiteList: []string{"10.10.11.2"}})
+		_, _ = w.Write(out)
+	}))
+	defer ts.Close()
+
+	cfg := config.Params{
+		ProviderUrl:     ts.URL,
+		RefreshInterval: toDuration(3600),
+		Ttl:             toDuration(3600),
+	}
+
+	refreshChan := make(chan time.Time)
+	refreshTicker := time.NewTicker(time.Second * 3600)
+	refreshTicker.C = refreshChan
+
+	a, err := newListCheckerWithTimers(test.NewEnv(t), &cfg, refreshTicker, time.NewTimer(cfg.Ttl), cfg.Ttl)
+	if err != nil {
+		t.Fatalf("Unable to create aspect: %v", err)
+	}
+	defer func() { _ = a.Close() }()
+
+	// the refresher is stuck fetching the list
+	refreshChan <- time.Now()
+
+	shorter := cfg
+	shorter.Ttl = time.Millisecond
+	done := make(chan error)
+	go func() {
+		err := a.Reconfigure(test.NewEnv(t), &cfg, nil, nil)
+		if err == nil {
+			err = a.Reconfigure(test.NewEnv(t), &shorter, nil, nil)
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Reconfigure() = %v, want no error", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Reconfigure() waited for the fetch in progress")
+	}
+
+	// once the fetch completes, the list is purged with the latest TTL
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(a.getListState().entries) != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if len(a.getListState().entries) != 0 {
+		t.Error("list wasn't purged once its new TTL elapsed")
+	}
+}
+
 func TestInvariants(t *testing.T) {
 	test.AdapterInvariants(Register, t)
 }
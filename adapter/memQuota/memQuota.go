@@ -45,6 +45,9 @@ type memQuota struct {
 
 	// the rolling windows we track for expiring quotas, protected by lock
 	windows map[string]*rollingWindow
+
+	// stops the reaping of dedup ids on common.Ticker, protected by lock
+	stopReaper chan struct{}
 }
 
 var (
@@ -95,20 +98,51 @@ func newAspectWithDedup(env adapter.Env, ticker *time.Ticker) (adapter.QuotasAsp
 		cells:   make(map[string]int64),
 		windows: make(map[string]*rollingWindow),
 	}
+	mq.stopReaper = mq.startReaper(env, ticker)
 
+	return mq, nil
+}
+
+// startReaper reaps dedup ids on every tick of ticker, until the returned channel is closed.
+func (mq *memQuota) startReaper(env adapter.Env, ticker *time.Ticker) chan struct{} {
+	stop := make(chan struct{})
 	env.ScheduleDaemon(func() {
-		for range mq.common.Ticker.C {
-			mq.common.Lock()
-			mq.common.ReapDedup()
-			mq.common.Unlock()
+		for {
+			select {
+			case <-ticker.C:
+				mq.common.Lock()
+				mq.common.ReapDedup()
+				mq.common.Unlock()
+			case <-stop:
+				return
+			}
 		}
 	})
-
-	return mq, nil
+	return stop
 }
 
 func (mq *memQuota) Close() error {
+	mq.common.Lock()
+	defer mq.common.Unlock()
+
+	mq.common.Ticker.Stop()
+	close(mq.stopReaper)
+	return nil
+}
+
+// Reconfigure applies a new deduplication window, keeping the quotas allocated so far.
+func (mq *memQuota) Reconfigure(env adapter.Env, c adapter.Config, _ map[string]*adapter.MetricDefinition,
+	_ map[string]*adapter.QuotaDefinition) error {
+	ticker := time.NewTicker(c.(*config.Params).MinDeduplicationDuration)
+	stop := mq.startReaper(env, ticker)
+
+	mq.common.Lock()
+	defer mq.common.Unlock()
+
 	mq.common.Ticker.Stop()
+	close(mq.stopReaper)
+	mq.common.Ticker = ticker
+	mq.stopReaper = stop
 	return nil
 }
 
@@ -121,16 +155,24 @@ func (mq *memQuota) AllocBestEffort(args adapter.QuotaArgs) (adapter.QuotaResult
 }
 
 func (mq *memQuota) alloc(args adapter.QuotaArgs, bestEffort bool) (adapter.QuotaResult, error) {
+	// hints are only computed when the operation is actually performed, not when it's deduplicated
+	var remaining int64
+	var retryAfter time.Duration
+	hasHints := false
+
 	amount, exp, err := mq.common.CommonWrapper(args, func(d *adapter.QuotaDefinition, key string, currentTime time.Time, currentTick int64) (int64, time.Time,
 		time.Duration) {
 		result := args.QuotaAmount
+		hasHints = true
 
 		// we optimize storage for non-expiring quotas
 		if d.Expiration == 0 {
 			inUse := mq.cells[key]
 
 			if result > d.MaxAmount-inUse {
+				// non-expiring quota only frees up when released, so there's no retry hint
 				if !bestEffort {
+					remaining = d.MaxAmount - inUse
 					return 0, time.Time{}, 0
 				}
 
@@ -138,6 +180,7 @@ func (mq *memQuota) alloc(args adapter.QuotaArgs, bestEffort bool) (adapter.Quot
 				result = d.MaxAmount - inUse
 			}
 			mq.cells[key] = inUse + result
+			remaining = d.MaxAmount - inUse - result
 			return result, time.Time{}, 0
 		}
 
@@ -150,23 +193,40 @@ func (mq *memQuota) alloc(args adapter.QuotaArgs, bestEffort bool) (adapter.Quot
 
 		if !window.alloc(result, currentTick) {
 			if !bestEffort {
+				remaining = window.available()
+				retryAfter = ticksToDuration(window.ticksUntil(result, currentTick))
 				return 0, time.Time{}, 0
 			}
 
 			// grab as much as we can
 			result = window.available()
 			_ = window.alloc(result, currentTick)
+			retryAfter = ticksToDuration(window.ticksUntil(args.QuotaAmount-result, currentTick))
 		}
 
+		remaining = window.available()
 		return result, currentTime.Add(d.Expiration), d.Expiration
 	})
 
 	return adapter.QuotaResult{
 		Amount:     amount,
 		Expiration: exp,
+		Remaining:  remaining,
+		RetryAfter: retryAfter,
+		HasHints:   hasHints,
 	}, err
 }
 
+// ticksToDuration converts a number of ticks as returned by rollingWindow.ticksUntil into a
+// duration. Whole ticks are counted, so the result errs on the side of waiting too long.
+// A negative tick count means never, which yields 0.
+func ticksToDuration(ticks int64) time.Duration {
+	if ticks <= 0 {
+		return 0
+	}
+	return time.Duration(ticks * util.NanosPerTick)
+}
+
 func (mq *memQuota) ReleaseBestEffort(args adapter.QuotaArgs) (int64, error) {
 	amount, _, err := mq.common.CommonWrapper(args,
 		func(d *adapter.QuotaDefinition, key string, currentTime time.Time, currentTick int64) (int64, time.Time, time.Duration) {
@@ -158,6 +158,80 @@ func TestAllocAndRelease(t *testing.T) {
 	}
 }
 
+func TestAllocHints(t *testing.T) {
+	definitions := map[string]*adapter.QuotaDefinition{
+		"Q1": {Name: "Q1", MaxAmount: 10, Expiration: 0},
+		"Q2": {Name: "Q2", MaxAmount: 10, Expiration: 10 * time.Second},
+	}
+
+	b := newBuilder()
+	c := b.DefaultConfig().(*config.Params)
+	c.MinDeduplicationDuration = time.Duration(3600) * time.Second
+
+	a, err := b.NewQuotasAspect(test.NewEnv(t), c, definitions)
+	if err != nil {
+		t.Fatalf("Unable to create aspect: %v", err)
+	}
+	defer func() { _ = a.Close() }()
+
+	asp := a.(*memQuota)
+
+	cases := []struct {
+		name           string
+		dedup          string
+		amount         int64
+		bestEffort     bool
+		seconds        int64
+		wantAmount     int64
+		wantRemaining  int64
+		wantRetryAfter time.Duration
+		wantHints      bool
+	}{
+		{"Q1", "0", 8, false, 0, 8, 2, 0, true},
+		{"Q1", "1", 5, false, 0, 0, 2, 0, true},
+		{"Q1", "2", 5, true, 0, 2, 0, 0, true},
+		{"Q1", "2", 5, true, 0, 2, 0, 0, false}, // deduplicated, no hints
+
+		{"Q2", "3", 6, false, 0, 6, 4, 0, true},
+		{"Q2", "4", 6, false, 1, 0, 4, 9 * time.Second, true},
+		{"Q2", "5", 20, false, 1, 0, 4, 0, true}, // can never be satisfied
+		{"Q2", "6", 6, true, 2, 4, 0, 8 * time.Second, true},
+	}
+
+	now := time.Unix(1000, 0)
+	for i, c := range cases {
+		asp.common.GetTime = func() time.Time {
+			return now.Add(time.Duration(c.seconds) * time.Second)
+		}
+
+		qa := adapter.QuotaArgs{
+			Definition:      definitions[c.name],
+			DeduplicationID: c.dedup,
+			QuotaAmount:     c.amount,
+		}
+
+		var qr adapter.QuotaResult
+		if c.bestEffort {
+			qr, err = a.AllocBestEffort(qa)
+		} else {
+			qr, err = a.Alloc(qa)
+		}
+
+		if err != nil {
+			t.Errorf("Expecting success, got %v, case %d", err, i)
+		}
+
+		if qr.Amount != c.wantAmount || qr.HasHints != c.wantHints {
+			t.Errorf("Got amount %d and hints %t, expecting %d and %t, case %d", qr.Amount, qr.HasHints, c.wantAmount, c.wantHints, i)
+		}
+
+		if c.wantHints && (qr.Remaining != c.wantRemaining || qr.RetryAfter != c.wantRetryAfter) {
+			t.Errorf("Got remaining %d and retry after %v, expecting %d and %v, case %d",
+				qr.Remaining, qr.RetryAfter, c.wantRemaining, c.wantRetryAfter, i)
+		}
+	}
+}
+
 func TestBadName(t *testing.T) {
 	b := newBuilder()
 	a, err := b.NewQuotasAspect(test.NewEnv(t), b.DefaultConfig(), make(map[string]*adapter.QuotaDefinition))
@@ -365,6 +439,71 @@ func TestReaperTicker(t *testing.T) {
 	}
 }
 
+func TestReconfigure(t *testing.T) {
+	definitions := map[string]*adapter.QuotaDefinition{
+		"Q1": {Name: "Q1", MaxAmount: 10},
+	}
+
+	b := newBuilder()
+	a, err := b.NewQuotasAspect(test.NewEnv(t), b.DefaultConfig(), definitions)
+	if err != nil {
+		t.Fatalf("Unable to create aspect: %v", err)
+	}
+
+	qa := adapter.QuotaArgs{Definition: definitions["Q1"], QuotaAmount: 10, DeduplicationID: "0"}
+	if qr, _ := a.Alloc(qa); qr.Amount != 10 {
+		t.Errorf("Alloc(): expecting 10, got %d", qr.Amount)
+	}
+
+	c := &config.Params{MinDeduplicationDuration: time.Minute}
+	if err = a.(adapter.Reconfigurable).Reconfigure(test.NewEnv(t), c, nil, definitions); err != nil {
+		t.Fatalf("Reconfigure() = %v, want no error", err)
+	}
+
+	// the quota allocated before is still in use
+	qa.DeduplicationID = "1"
+	if qr, _ := a.Alloc(qa); qr.Amount != 0 {
+		t.Errorf("Alloc(): expecting 0, got %d", qr.Amount)
+	}
+
+	if err := a.Close(); err != nil {
+		t.Errorf("Unable to close aspect: %v", err)
+	}
+}
+
+func TestNoDeduplicationID(t *testing.T) {
+	definitions := map[string]*adapter.QuotaDefinition{
+		"Q1": {Name: "Q1", MaxAmount: 10},
+	}
+
+	b := newBuilder()
+	a, err := b.NewQuotasAspect(test.NewEnv(t), b.DefaultConfig(), definitions)
+	if err != nil {
+		t.Fatalf("Unable to create aspect: %v", err)
+	}
+
+	// two batches that fail after allocating, and are rolled back
+	qa := adapter.QuotaArgs{Definition: definitions["Q1"], QuotaAmount: 5}
+	for i := 0; i < 2; i++ {
+		if qr, _ := a.Alloc(qa); qr.Amount != 5 {
+			t.Errorf("Alloc(): expecting 5, got %d, batch %d", qr.Amount, i)
+		}
+		if amount, _ := a.ReleaseBestEffort(qa); amount != 5 {
+			t.Errorf("ReleaseBestEffort(): expecting 5, got %d, batch %d", amount, i)
+		}
+	}
+
+	// both allocations came back
+	qa.QuotaAmount = 10
+	if qr, _ := a.Alloc(qa); qr.Amount != 10 {
+		t.Errorf("Alloc(): expecting 10, got %d", qr.Amount)
+	}
+
+	if err := a.Close(); err != nil {
+		t.Errorf("Unable to close aspect: %v", err)
+	}
+}
+
 func TestInvariants(t *testing.T) {
 	test.AdapterInvariants(Register, t)
 }
@@ -112,3 +112,25 @@ func (w *rollingWindow) roll(currentTick int64) {
 func (w *rollingWindow) available() int64 {
 	return w.avail
 }
+
+// Returns the number of ticks until the given amount becomes available, as units allocated
+// in older ticks roll out of the window. Returns -1 if the amount can never be available,
+// because it's larger than what is left after accounting for the whole window.
+func (w *rollingWindow) ticksUntil(amount int64, currentTick int64) int64 {
+	w.roll(currentTick)
+
+	avail := w.avail
+	if amount <= avail {
+		return 0
+	}
+
+	// the oldest slot is the one right after the current one, it's reclaimed on the next tick
+	for i := 1; i <= len(w.slots); i++ {
+		avail += w.slots[(w.currentSlot+i)%len(w.slots)]
+		if amount <= avail {
+			return int64(i)
+		}
+	}
+
+	return -1
+}
@@ -91,3 +91,32 @@ func TestRelease(t *testing.T) {
 		}
 	}
 }
+
+func TestTicksUntil(t *testing.T) {
+	w := newRollingWindow(5, 3)
+	w.alloc(2, 1)
+	w.alloc(3, 2)
+
+	cases := []struct {
+		amount int64
+		ticks  int64
+	}{
+		{0, 0},
+		{1, 2},
+		{2, 2},
+		{3, 3},
+		{5, 3},
+		{6, -1},
+	}
+
+	for i, c := range cases {
+		if ticks := w.ticksUntil(c.amount, 2); ticks != c.ticks {
+			t.Errorf("Expecting %d ticks, got %d, case %d", c.ticks, ticks, i)
+		}
+	}
+
+	// moving forward frees the units allocated in tick 1
+	if ticks := w.ticksUntil(2, 4); ticks != 0 {
+		t.Errorf("Expecting 0 ticks once the window has rolled, got %d", ticks)
+	}
+}
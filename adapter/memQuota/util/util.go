@@ -88,9 +88,14 @@ func (qu *QuotaUtil) CommonWrapper(args adapter.QuotaArgs, qf quotaFunc) (int64,
 	var t time.Time
 	var exp time.Duration
 
-	result, dup := qu.RecentDedup[args.DeduplicationID]
-	if !dup {
-		result, dup = qu.OldDedup[args.DeduplicationID]
+	// an empty ID identifies no particular call, so it isn't deduplicated
+	var result DedupState
+	var dup bool
+	if args.DeduplicationID != "" {
+		result, dup = qu.RecentDedup[args.DeduplicationID]
+		if !dup {
+			result, dup = qu.OldDedup[args.DeduplicationID]
+		}
 	}
 
 	if dup {
@@ -102,7 +107,9 @@ func (qu *QuotaUtil) CommonWrapper(args adapter.QuotaArgs, qf quotaFunc) (int64,
 		}
 	} else {
 		amount, t, exp = qf(d, key, currentTime, currentTick)
-		qu.RecentDedup[args.DeduplicationID] = DedupState{amount: amount, exp: t}
+		if args.DeduplicationID != "" {
+			qu.RecentDedup[args.DeduplicationID] = DedupState{amount: amount, exp: t}
+		}
 	}
 
 	qu.Unlock()
@@ -0,0 +1,307 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	rpc "github.com/googleapis/googleapis/google/rpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"istio.io/mixer/adapter/remote/plugin"
+	"istio.io/mixer/pkg/adapter"
+)
+
+// aspect forwards its calls to an aspect constructed by a plugin. It implements all the kinds of
+// aspects, the plugin rejects calls that don't match the kind it was constructed for.
+type aspect struct {
+	client  plugin.PluginClient
+	address string
+	timeout time.Duration
+
+	// the call the aspect is bound to, nil if it isn't bound to any
+	ctx context.Context
+
+	// shared with the copies of the aspect bound to a call
+	*aspectState
+}
+
+// aspectState identifies the aspect constructed by the plugin.
+type aspectState struct {
+	// req constructs the aspect again when the plugin loses track of it
+	req *plugin.NewAspectRequest
+
+	// forget drops what the builder knows of the aspect's params once the aspect is closed
+	forget func()
+
+	sync.Mutex
+	id             uint64
+	reconstructing bool
+}
+
+// BindCall returns a copy of the aspect whose calls to the plugin end with the call ctx belongs to,
+// should the mixer give up on it before the aspect's own timeout.
+func (a *aspect) BindCall(ctx context.Context) adapter.Aspect {
+	bound := *a
+	bound.ctx = ctx
+	return &bound
+}
+
+// callContext returns a context for a single call to the plugin.
+func (a *aspect) callContext() (context.Context, context.CancelFunc) {
+	parent := a.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	return context.WithTimeout(parent, a.timeout)
+}
+
+// construct has the plugin construct the aspect and returns its id. It isn't bound to any call,
+// the aspect is shared by all of them.
+func (a *aspect) construct() (uint64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+	defer cancel()
+
+	resp, err := a.client.NewAspect(ctx, a.req)
+	if err != nil {
+		return 0, fmt.Errorf("plugin at %s failed to construct a %s aspect: %s", a.address, a.req.Kind, grpc.ErrorDesc(err))
+	}
+	return resp.AspectId, nil
+}
+
+// invoke calls the plugin with the id of the aspect. When the plugin doesn't know the id, typically
+// because it restarted, the aspect is constructed again and the call retried once.
+func (a *aspect) invoke(call func(ctx context.Context, id uint64) error) error {
+	id, err := a.currentID()
+	if err != nil {
+		return err
+	}
+
+	err = a.call(id, call)
+	if grpc.Code(err) != codes.NotFound {
+		return err
+	}
+
+	if id, err = a.reconstruct(id); err != nil {
+		return err
+	}
+	return a.call(id, call)
+}
+
+// currentID returns the id of the aspect. It fails while the aspect is constructed again, rather
+// than have the calls queue up behind a plugin that may not be reachable.
+func (a *aspect) currentID() (uint64, error) {
+	a.Lock()
+	defer a.Unlock()
+	if a.reconstructing {
+		return 0, a.reconstructingError()
+	}
+	return a.id, nil
+}
+
+func (a *aspect) reconstructingError() error {
+	return grpc.Errorf(codes.Unavailable, "plugin at %s lost the %s aspect, which is being constructed again", a.address, a.req.Kind)
+}
+
+// reconstruct has the plugin construct the aspect again after it lost the one known as lost, and
+// returns the new id. The aspect is constructed by a single goroutine, without holding the lock and
+// with a timeout of its own, so that a call giving up doesn't fail it for the others. The call that
+// started it waits for it as long as the call lasts.
+func (a *aspect) reconstruct(lost uint64) (uint64, error) {
+	a.Lock()
+	if a.reconstructing {
+		a.Unlock()
+		return 0, a.reconstructingError()
+	}
+	if a.id != lost {
+		// another call got there first
+		id := a.id
+		a.Unlock()
+		return id, nil
+	}
+	a.reconstructing = true
+	a.req.Recovering = true
+	a.Unlock()
+
+	glog.Warningf("Plugin at %s lost aspect %d, constructing it again", a.address, lost)
+	type result struct {
+		id  uint64
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		id, err := a.construct()
+		a.Lock()
+		if err == nil {
+			a.id = id
+		}
+		a.reconstructing = false
+		a.Unlock()
+		done <- result{id, err}
+	}()
+
+	ctx, cancel := a.callContext()
+	defer cancel()
+	select {
+	case r := <-done:
+		return r.id, r.err
+	case <-ctx.Done():
+		return 0, grpc.Errorf(codes.DeadlineExceeded, "gave up waiting for plugin at %s to construct the %s aspect again: %v",
+			a.address, a.req.Kind, ctx.Err())
+	}
+}
+
+func (a *aspect) call(id uint64, call func(ctx context.Context, id uint64) error) error {
+	ctx, cancel := a.callContext()
+	defer cancel()
+	return call(ctx, id)
+}
+
+// errorOf turns the errors returned by the plugin into the error of the adapter.
+func errorOf(err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%s", grpc.ErrorDesc(err))
+}
+
+func (a *aspect) Close() error {
+	if a.forget != nil {
+		a.forget()
+	}
+
+	a.Lock()
+	id := a.id
+	a.Unlock()
+
+	err := a.call(id, func(ctx context.Context, id uint64) error {
+		_, err := a.client.CloseAspect(ctx, &plugin.AspectRef{AspectId: id})
+		return err
+	})
+	if grpc.Code(err) == codes.NotFound {
+		return nil
+	}
+	return errorOf(err)
+}
+
+func (a *aspect) CheckList(symbol string) (bool, error) {
+	var found bool
+	err := a.invoke(func(ctx context.Context, id uint64) error {
+		resp, err := a.client.CheckList(ctx, &plugin.CheckListRequest{AspectId: id, Symbol: symbol})
+		if err == nil {
+			found = resp.Found
+		}
+		return err
+	})
+	return found, errorOf(err)
+}
+
+func (a *aspect) Deny() rpc.Status {
+	var status rpc.Status
+	err := a.invoke(func(ctx context.Context, id uint64) error {
+		resp, err := a.client.Deny(ctx, &plugin.AspectRef{AspectId: id})
+		if err == nil {
+			status = *resp
+		}
+		return err
+	})
+	if err != nil {
+		// still deny, the plugin not being able to tell why doesn't make the request acceptable
+		return rpc.Status{Code: int32(rpc.UNAVAILABLE), Message: grpc.ErrorDesc(err)}
+	}
+	return status
+}
+
+func (a *aspect) alloc(args adapter.QuotaArgs, bestEffort bool) (adapter.QuotaResult, error) {
+	var resp *plugin.QuotaResponse
+	err := a.invoke(func(ctx context.Context, id uint64) error {
+		req, err := toQuotaRequest(id, args)
+		if err != nil {
+			return err
+		}
+		if bestEffort {
+			resp, err = a.client.AllocBestEffort(ctx, req)
+		} else {
+			resp, err = a.client.Alloc(ctx, req)
+		}
+		return err
+	})
+	if err != nil {
+		return adapter.QuotaResult{}, errorOf(err)
+	}
+	return fromQuotaResponse(resp)
+}
+
+func (a *aspect) Alloc(args adapter.QuotaArgs) (adapter.QuotaResult, error) {
+	return a.alloc(args, false)
+}
+
+func (a *aspect) AllocBestEffort(args adapter.QuotaArgs) (adapter.QuotaResult, error) {
+	return a.alloc(args, true)
+}
+
+func (a *aspect) ReleaseBestEffort(args adapter.QuotaArgs) (int64, error) {
+	var amount int64
+	err := a.invoke(func(ctx context.Context, id uint64) error {
+		req, err := toQuotaRequest(id, args)
+		if err != nil {
+			return err
+		}
+		resp, err := a.client.ReleaseBestEffort(ctx, req)
+		if err == nil {
+			amount = resp.Amount
+		}
+		return err
+	})
+	return amount, errorOf(err)
+}
+
+func (a *aspect) Record(values []adapter.Value) error {
+	mvs, err := toMetricValues(values)
+	if err != nil {
+		return err
+	}
+	return errorOf(a.invoke(func(ctx context.Context, id uint64) error {
+		_, err := a.client.Record(ctx, &plugin.RecordRequest{AspectId: id, Values: mvs})
+		return err
+	}))
+}
+
+func (a *aspect) Log(entries []adapter.LogEntry) error {
+	les, err := toLogEntries(entries)
+	if err != nil {
+		return err
+	}
+	return errorOf(a.invoke(func(ctx context.Context, id uint64) error {
+		_, err := a.client.Log(ctx, &plugin.LogRequest{AspectId: id, Entries: les})
+		return err
+	}))
+}
+
+func (a *aspect) LogAccess(entries []adapter.LogEntry) error {
+	les, err := toLogEntries(entries)
+	if err != nil {
+		return err
+	}
+	return errorOf(a.invoke(func(ctx context.Context, id uint64) error {
+		_, err := a.client.LogAccess(ctx, &plugin.LogRequest{AspectId: id, Entries: les})
+		return err
+	}))
+}
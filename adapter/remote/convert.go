@@ -0,0 +1,316 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+// Conversions between the types of pkg/adapter and the messages of the plugin protocol.
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gogo/protobuf/types"
+
+	"istio.io/mixer/adapter/remote/plugin"
+	"istio.io/mixer/pkg/adapter"
+)
+
+func toValue(v interface{}) (*plugin.Value, error) {
+	switch t := v.(type) {
+	case string:
+		return &plugin.Value{Kind: &plugin.Value_StringValue{StringValue: t}}, nil
+	case int64:
+		return &plugin.Value{Kind: &plugin.Value_Int64Value{Int64Value: t}}, nil
+	case float64:
+		return &plugin.Value{Kind: &plugin.Value_DoubleValue{DoubleValue: t}}, nil
+	case bool:
+		return &plugin.Value{Kind: &plugin.Value_BoolValue{BoolValue: t}}, nil
+	case time.Time:
+		ts, err := types.TimestampProto(t)
+		if err != nil {
+			return nil, err
+		}
+		return &plugin.Value{Kind: &plugin.Value_TimestampValue{TimestampValue: ts}}, nil
+	case time.Duration:
+		return &plugin.Value{Kind: &plugin.Value_DurationValue{DurationValue: types.DurationProto(t)}}, nil
+	case []byte:
+		return &plugin.Value{Kind: &plugin.Value_BytesValue{BytesValue: t}}, nil
+	case map[string]string:
+		return &plugin.Value{Kind: &plugin.Value_StringMapValue{StringMapValue: &plugin.StringMap{Entries: t}}}, nil
+	}
+	return nil, fmt.Errorf("values of type %T can't be sent to a plugin", v)
+}
+
+func fromValue(v *plugin.Value) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	switch t := v.Kind.(type) {
+	case *plugin.Value_StringValue:
+		return t.StringValue, nil
+	case *plugin.Value_Int64Value:
+		return t.Int64Value, nil
+	case *plugin.Value_DoubleValue:
+		return t.DoubleValue, nil
+	case *plugin.Value_BoolValue:
+		return t.BoolValue, nil
+	case *plugin.Value_TimestampValue:
+		return types.TimestampFromProto(t.TimestampValue)
+	case *plugin.Value_DurationValue:
+		return types.DurationFromProto(t.DurationValue)
+	case *plugin.Value_BytesValue:
+		return t.BytesValue, nil
+	case *plugin.Value_StringMapValue:
+		if t.StringMapValue.Entries == nil {
+			return map[string]string{}, nil
+		}
+		return t.StringMapValue.Entries, nil
+	}
+	return nil, fmt.Errorf("unknown kind of value %T", v.Kind)
+}
+
+func toValues(m map[string]interface{}) (map[string]*plugin.Value, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+	values := make(map[string]*plugin.Value, len(m))
+	for k, v := range m {
+		pv, err := toValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", k, err)
+		}
+		values[k] = pv
+	}
+	return values, nil
+}
+
+func fromValues(m map[string]*plugin.Value) (map[string]interface{}, error) {
+	values := make(map[string]interface{}, len(m))
+	for k, pv := range m {
+		v, err := fromValue(pv)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", k, err)
+		}
+		values[k] = v
+	}
+	return values, nil
+}
+
+func toLabelTypes(m map[string]adapter.LabelType) map[string]plugin.LabelType {
+	labels := make(map[string]plugin.LabelType, len(m))
+	for k, t := range m {
+		labels[k] = plugin.LabelType(t)
+	}
+	return labels
+}
+
+func fromLabelTypes(m map[string]plugin.LabelType) map[string]adapter.LabelType {
+	labels := make(map[string]adapter.LabelType, len(m))
+	for k, t := range m {
+		labels[k] = adapter.LabelType(t)
+	}
+	return labels
+}
+
+func toMetricDefinitions(m map[string]*adapter.MetricDefinition) map[string]*plugin.MetricDefinition {
+	if len(m) == 0 {
+		return nil
+	}
+	defs := make(map[string]*plugin.MetricDefinition, len(m))
+	for k, d := range m {
+		defs[k] = &plugin.MetricDefinition{
+			Name:        d.Name,
+			DisplayName: d.DisplayName,
+			Description: d.Description,
+			Kind:        plugin.MetricKind(d.Kind),
+			Labels:      toLabelTypes(d.Labels),
+		}
+	}
+	return defs
+}
+
+func fromMetricDefinitions(m map[string]*plugin.MetricDefinition) map[string]*adapter.MetricDefinition {
+	defs := make(map[string]*adapter.MetricDefinition, len(m))
+	for k, d := range m {
+		defs[k] = &adapter.MetricDefinition{
+			Name:        d.Name,
+			DisplayName: d.DisplayName,
+			Description: d.Description,
+			Kind:        adapter.MetricKind(d.Kind),
+			Labels:      fromLabelTypes(d.Labels),
+		}
+	}
+	return defs
+}
+
+func toQuotaDefinitions(m map[string]*adapter.QuotaDefinition) map[string]*plugin.QuotaDefinition {
+	if len(m) == 0 {
+		return nil
+	}
+	defs := make(map[string]*plugin.QuotaDefinition, len(m))
+	for k, d := range m {
+		defs[k] = &plugin.QuotaDefinition{
+			Name:        d.Name,
+			DisplayName: d.DisplayName,
+			Description: d.Description,
+			MaxAmount:   d.MaxAmount,
+			Expiration:  types.DurationProto(d.Expiration),
+			Labels:      toLabelTypes(d.Labels),
+		}
+	}
+	return defs
+}
+
+func fromQuotaDefinitions(m map[string]*plugin.QuotaDefinition) (map[string]*adapter.QuotaDefinition, error) {
+	defs := make(map[string]*adapter.QuotaDefinition, len(m))
+	for k, d := range m {
+		expiration, err := fromDuration(d.Expiration)
+		if err != nil {
+			return nil, fmt.Errorf("quota %s: %v", k, err)
+		}
+		defs[k] = &adapter.QuotaDefinition{
+			Name:        d.Name,
+			DisplayName: d.DisplayName,
+			Description: d.Description,
+			MaxAmount:   d.MaxAmount,
+			Expiration:  expiration,
+			Labels:      fromLabelTypes(d.Labels),
+		}
+	}
+	return defs, nil
+}
+
+// fromDuration treats a missing duration as 0.
+func fromDuration(d *types.Duration) (time.Duration, error) {
+	if d == nil {
+		return 0, nil
+	}
+	return types.DurationFromProto(d)
+}
+
+// fromTimestamp treats a missing timestamp as the zero time.
+func fromTimestamp(ts *types.Timestamp) (time.Time, error) {
+	if ts == nil {
+		return time.Time{}, nil
+	}
+	return types.TimestampFromProto(ts)
+}
+
+func toQuotaRequest(id uint64, args adapter.QuotaArgs) (*plugin.QuotaRequest, error) {
+	labels, err := toValues(args.Labels)
+	if err != nil {
+		return nil, err
+	}
+	req := &plugin.QuotaRequest{
+		AspectId:        id,
+		DeduplicationId: args.DeduplicationID,
+		QuotaAmount:     args.QuotaAmount,
+		Labels:          labels,
+	}
+	if args.Definition != nil {
+		req.Definition = args.Definition.Name
+	}
+	return req, nil
+}
+
+func fromQuotaResponse(resp *plugin.QuotaResponse) (adapter.QuotaResult, error) {
+	expiration, err := fromDuration(resp.Expiration)
+	if err != nil {
+		return adapter.QuotaResult{}, err
+	}
+	retryAfter, err := fromDuration(resp.RetryAfter)
+	if err != nil {
+		return adapter.QuotaResult{}, err
+	}
+	return adapter.QuotaResult{
+		Expiration: expiration,
+		Amount:     resp.Amount,
+		Remaining:  resp.Remaining,
+		RetryAfter: retryAfter,
+		HasHints:   resp.HasHints,
+	}, nil
+}
+
+func toMetricValues(values []adapter.Value) ([]*plugin.MetricValue, error) {
+	mvs := make([]*plugin.MetricValue, len(values))
+	for i, v := range values {
+		labels, err := toValues(v.Labels)
+		if err != nil {
+			return nil, err
+		}
+		value, err := toValue(v.MetricValue)
+		if err != nil {
+			return nil, err
+		}
+		start, err := types.TimestampProto(v.StartTime)
+		if err != nil {
+			return nil, err
+		}
+		end, err := types.TimestampProto(v.EndTime)
+		if err != nil {
+			return nil, err
+		}
+		mvs[i] = &plugin.MetricValue{Labels: labels, StartTime: start, EndTime: end, Value: value}
+		if v.Definition != nil {
+			mvs[i].Definition = v.Definition.Name
+		}
+	}
+	return mvs, nil
+}
+
+func toLogEntries(entries []adapter.LogEntry) ([]*plugin.LogEntry, error) {
+	les := make([]*plugin.LogEntry, len(entries))
+	for i, e := range entries {
+		labels, err := toValues(e.Labels)
+		if err != nil {
+			return nil, err
+		}
+		payload, err := toValues(e.StructPayload)
+		if err != nil {
+			return nil, err
+		}
+		les[i] = &plugin.LogEntry{
+			LogName:       e.LogName,
+			Labels:        labels,
+			Timestamp:     e.Timestamp,
+			Severity:      plugin.Severity(e.Severity),
+			TextPayload:   e.TextPayload,
+			StructPayload: payload,
+		}
+	}
+	return les, nil
+}
+
+func fromLogEntries(les []*plugin.LogEntry) ([]adapter.LogEntry, error) {
+	entries := make([]adapter.LogEntry, len(les))
+	for i, e := range les {
+		labels, err := fromValues(e.Labels)
+		if err != nil {
+			return nil, err
+		}
+		entries[i] = adapter.LogEntry{
+			LogName:     e.LogName,
+			Labels:      labels,
+			Timestamp:   e.Timestamp,
+			Severity:    adapter.Severity(e.Severity),
+			TextPayload: e.TextPayload,
+		}
+		if len(e.StructPayload) > 0 {
+			if entries[i].StructPayload, err = fromValues(e.StructPayload); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,108 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"istio.io/mixer/pkg/adapter"
+)
+
+func TestValues(t *testing.T) {
+	cases := []interface{}{
+		"a string",
+		int64(42),
+		float64(4.2),
+		true,
+		time.Unix(1490000000, 123).UTC(),
+		3 * time.Second,
+		[]byte{10, 0, 0, 1},
+		map[string]string{"a": "b"},
+	}
+	for _, c := range cases {
+		pv, err := toValue(c)
+		if err != nil {
+			t.Errorf("toValue(%v) failed: %v", c, err)
+			continue
+		}
+		v, err := fromValue(pv)
+		if err != nil {
+			t.Errorf("fromValue(toValue(%v)) failed: %v", c, err)
+			continue
+		}
+		if !reflect.DeepEqual(v, c) {
+			t.Errorf("fromValue(toValue(%v)) = %#v, want %#v", c, v, c)
+		}
+	}
+
+	if _, err := toValue(struct{}{}); err == nil {
+		t.Error("toValue(struct{}{}) succeeded, want an error")
+	}
+	if _, err := toValues(map[string]interface{}{"bad": int32(1)}); err == nil {
+		t.Error("toValues() with an int32 succeeded, want an error")
+	}
+}
+
+func TestDefinitions(t *testing.T) {
+	metrics := map[string]*adapter.MetricDefinition{
+		"requests": {
+			Name:        "requests",
+			DisplayName: "Requests",
+			Description: "Number of requests",
+			Kind:        adapter.Counter,
+			Labels:      map[string]adapter.LabelType{"source": adapter.String, "ip": adapter.IPAddress},
+		},
+	}
+	if got := fromMetricDefinitions(toMetricDefinitions(metrics)); !reflect.DeepEqual(got, metrics) {
+		t.Errorf("Metric definitions = %v after a round trip, want %v", got, metrics)
+	}
+
+	quotas := map[string]*adapter.QuotaDefinition{
+		"requests": {
+			Name:       "requests",
+			MaxAmount:  100,
+			Expiration: time.Minute,
+			Labels:     map[string]adapter.LabelType{"source": adapter.String},
+		},
+	}
+	got, err := fromQuotaDefinitions(toQuotaDefinitions(quotas))
+	if err != nil || !reflect.DeepEqual(got, quotas) {
+		t.Errorf("Quota definitions = %v, %v after a round trip, want %v", got, err, quotas)
+	}
+}
+
+func TestLogEntries(t *testing.T) {
+	entries := []adapter.LogEntry{
+		{
+			LogName:       "access",
+			Labels:        map[string]interface{}{"code": int64(200)},
+			Timestamp:     "2017-04-01T00:00:00Z",
+			Severity:      adapter.Warning,
+			TextPayload:   "GET /",
+			StructPayload: map[string]interface{}{"latency": 2 * time.Millisecond},
+		},
+		{LogName: "empty", Labels: map[string]interface{}{}},
+	}
+	les, err := toLogEntries(entries)
+	if err != nil {
+		t.Fatalf("toLogEntries() failed: %v", err)
+	}
+	got, err := fromLogEntries(les)
+	if err != nil || !reflect.DeepEqual(got, entries) {
+		t.Errorf("Log entries = %v, %v after a round trip, want %v", got, err, entries)
+	}
+}
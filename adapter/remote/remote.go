@@ -0,0 +1,254 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package remote lets the mixer use adapters running in a separate process.
+//
+// The mixer side is the 'remote' adapter, which forwards the validation of its
+// params and the calls made to its aspects to a plugin implementing the service
+// defined in plugin/plugin.proto. Adapters written against pkg/adapter can be
+// served as a plugin with Serve.
+//
+// Connections to plugins carry no transport security: the mixer and its plugins are expected to
+// talk over loopback, plugins running next to the mixer, and only such deployments are supported.
+package remote
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gogo/protobuf/types"
+	"github.com/golang/glog"
+	multierror "github.com/hashicorp/go-multierror"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"istio.io/mixer/adapter/remote/config"
+	"istio.io/mixer/adapter/remote/plugin"
+	"istio.io/mixer/pkg/adapter"
+)
+
+type builder struct {
+	adapter.DefaultBuilder
+
+	sync.Mutex
+	conns map[string]*grpc.ClientConn // by address
+
+	// the params accepted while their plugin couldn't be reached, by their text
+	unvalidated map[string]bool
+}
+
+var (
+	name = "remote"
+	desc = "Forwards calls to an adapter running in a separate process"
+
+	// defaultAddress is where a plugin running next to the mixer listens by default.
+	defaultAddress = "localhost:9095"
+)
+
+const (
+	// validateTimeout bounds the time a plugin has to validate a configuration.
+	validateTimeout = 5 * time.Second
+
+	// defaultCallTimeout bounds calls to aspects when the mixer doesn't set a call timeout.
+	defaultCallTimeout = 5 * time.Second
+)
+
+// Register records the builders exposed by this adapter.
+func Register(r adapter.Registrar) {
+	b := newBuilder()
+	r.RegisterListsBuilder(b)
+	r.RegisterDenialsBuilder(b)
+	r.RegisterApplicationLogsBuilder(b)
+	r.RegisterAccessLogsBuilder(b)
+	r.RegisterQuotasBuilder(b)
+	r.RegisterMetricsBuilder(b)
+}
+
+func newBuilder() *builder {
+	return &builder{
+		DefaultBuilder: adapter.NewDefaultBuilder(name, desc, nil),
+		conns:          make(map[string]*grpc.ClientConn),
+		unvalidated:    make(map[string]bool),
+	}
+}
+
+func (b *builder) DefaultConfig() adapter.Config {
+	return &config.Params{Address: defaultAddress}
+}
+
+// ValidateConfig checks the address of the plugin, then has the plugin validate the params of
+// the adapter. Plugins are deployed independently of the mixer and may well come up after it, so
+// configs are accepted when the plugin can't be reached. Their params are marked as unvalidated
+// then, and validated by the plugin before it constructs any aspect from them: the aspects fail
+// to construct until the plugin is there and accepts the params.
+func (b *builder) ValidateConfig(c adapter.Config) (ce *adapter.ConfigErrors) {
+	params := c.(*config.Params)
+	if params.Address == "" {
+		return ce.Appendf("address", "the address of the plugin is required")
+	}
+
+	client, err := b.client(params.Address)
+	if err != nil {
+		return ce.Appendf("address", "unable to connect to plugin: %v", err)
+	}
+
+	ce, err = validate(client, params)
+	if code := grpc.Code(err); code == codes.Unavailable || code == codes.DeadlineExceeded {
+		glog.Warningf("Unable to reach plugin at %s to validate the config of adapter '%s', accepting it unvalidated: %v",
+			params.Address, params.Adapter, err)
+		b.Lock()
+		b.unvalidated[params.String()] = true
+		b.Unlock()
+		return nil
+	}
+	if err != nil {
+		return ce.Appendf("params", "plugin at %s failed to validate the config: %s", params.Address, grpc.ErrorDesc(err))
+	}
+	return ce
+}
+
+// validate has the plugin validate params. It returns an error if the plugin couldn't be called.
+func validate(client plugin.PluginClient, params *config.Params) (ce *adapter.ConfigErrors, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), validateTimeout)
+	defer cancel()
+	resp, err := client.ValidateConfig(ctx, &plugin.ValidateConfigRequest{Adapter: params.Adapter, Params: params.Params})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range resp.Errors {
+		ce = ce.Appendf("params."+e.Field, "%s", e.Message)
+	}
+	return ce, nil
+}
+
+// revalidate validates params that were accepted unvalidated, now that their plugin is needed.
+func (b *builder) revalidate(client plugin.PluginClient, params *config.Params) error {
+	key := params.String()
+	b.Lock()
+	pending := b.unvalidated[key]
+	b.Unlock()
+	if !pending {
+		return nil
+	}
+
+	ce, err := validate(client, params)
+	if err != nil {
+		return fmt.Errorf("unable to have plugin at %s validate the config: %s", params.Address, grpc.ErrorDesc(err))
+	}
+	if ce != nil {
+		return fmt.Errorf("plugin at %s rejected the config: %v", params.Address, ce)
+	}
+
+	b.forget(key)
+	return nil
+}
+
+// forget drops the mark of the params whose text is key.
+func (b *builder) forget(key string) {
+	b.Lock()
+	delete(b.unvalidated, key)
+	b.Unlock()
+}
+
+// client returns a client of the plugin at address, sharing connections among aspects. The
+// connections are insecure, see the package doc.
+func (b *builder) client(address string) (plugin.PluginClient, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	conn, found := b.conns[address]
+	if !found {
+		var err error
+		if conn, err = grpc.Dial(address, grpc.WithInsecure()); err != nil {
+			return nil, err
+		}
+		b.conns[address] = conn
+	}
+	return plugin.NewPluginClient(conn), nil
+}
+
+// Close closes the connections to the plugins.
+func (b *builder) Close() error {
+	b.Lock()
+	defer b.Unlock()
+
+	b.unvalidated = make(map[string]bool)
+
+	var result *multierror.Error
+	for address, conn := range b.conns {
+		if err := conn.Close(); err != nil {
+			result = multierror.Append(result, fmt.Errorf("failed to close connection to plugin at %s: %v", address, err))
+		}
+	}
+	b.conns = make(map[string]*grpc.ClientConn)
+	return result.ErrorOrNil()
+}
+
+func (b *builder) newAspect(env adapter.Env, c adapter.Config, req *plugin.NewAspectRequest) (*aspect, error) {
+	params := c.(*config.Params)
+	client, err := b.client(params.Address)
+	if err != nil {
+		return nil, err
+	}
+	if err = b.revalidate(client, params); err != nil {
+		return nil, err
+	}
+
+	timeout := adapter.CallTimeout(env)
+	if timeout <= 0 {
+		timeout = defaultCallTimeout
+	}
+
+	req.Adapter = params.Adapter
+	req.Params = params.Params
+	req.CallTimeout = types.DurationProto(timeout)
+	req.Recovering = adapter.Recovering(env)
+
+	// the params were validated by the plugin to construct the aspect, whatever configs accepted
+	// them since while it was unreachable don't need to be validated again once the aspect is gone
+	key := params.String()
+	a := &aspect{client: client, timeout: timeout, address: params.Address,
+		aspectState: &aspectState{req: req, forget: func() { b.forget(key) }}}
+	if a.id, err = a.construct(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (b *builder) NewListsAspect(env adapter.Env, c adapter.Config) (adapter.ListsAspect, error) {
+	return b.newAspect(env, c, &plugin.NewAspectRequest{Kind: plugin.AspectKind_LISTS})
+}
+
+func (b *builder) NewDenialsAspect(env adapter.Env, c adapter.Config) (adapter.DenialsAspect, error) {
+	return b.newAspect(env, c, &plugin.NewAspectRequest{Kind: plugin.AspectKind_DENIALS})
+}
+
+func (b *builder) NewApplicationLogsAspect(env adapter.Env, c adapter.Config) (adapter.ApplicationLogsAspect, error) {
+	return b.newAspect(env, c, &plugin.NewAspectRequest{Kind: plugin.AspectKind_APPLICATION_LOGS})
+}
+
+func (b *builder) NewAccessLogsAspect(env adapter.Env, c adapter.Config) (adapter.AccessLogsAspect, error) {
+	return b.newAspect(env, c, &plugin.NewAspectRequest{Kind: plugin.AspectKind_ACCESS_LOGS})
+}
+
+func (b *builder) NewQuotasAspect(env adapter.Env, c adapter.Config, quotas map[string]*adapter.QuotaDefinition) (adapter.QuotasAspect, error) {
+	return b.newAspect(env, c, &plugin.NewAspectRequest{Kind: plugin.AspectKind_QUOTAS, Quotas: toQuotaDefinitions(quotas)})
+}
+
+func (b *builder) NewMetricsAspect(env adapter.Env, c adapter.Config, metrics map[string]*adapter.MetricDefinition) (adapter.MetricsAspect, error) {
+	return b.newAspect(env, c, &plugin.NewAspectRequest{Kind: plugin.AspectKind_METRICS, Metrics: toMetricDefinitions(metrics)})
+}
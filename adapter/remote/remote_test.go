@@ -0,0 +1,588 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/types"
+	rpc "github.com/googleapis/googleapis/google/rpc"
+	"google.golang.org/grpc"
+
+	"istio.io/mixer/adapter/remote/config"
+	"istio.io/mixer/adapter/remote/plugin"
+	"istio.io/mixer/pkg/adapter"
+	"istio.io/mixer/pkg/adapter/test"
+)
+
+// fakeBuilder is an adapter of every kind, served by the plugin under test. Its config is a
+// Struct, rejected when it has a 'fail' field.
+type fakeBuilder struct {
+	adapter.DefaultBuilder
+
+	sync.Mutex
+	envs    []adapter.Env
+	metrics map[string]*adapter.MetricDefinition
+	quotas  map[string]*adapter.QuotaDefinition
+	calls   []interface{} // arguments of the calls made to the aspects
+	closed  int
+
+	// constructing, when set, holds the construction of aspects until it is closed
+	constructing chan struct{}
+}
+
+func newFakeBuilder() *fakeBuilder {
+	return &fakeBuilder{DefaultBuilder: adapter.NewDefaultBuilder("fake", "Fake adapter", nil)}
+}
+
+func (b *fakeBuilder) register(r adapter.Registrar) {
+	r.RegisterListsBuilder(b)
+	r.RegisterDenialsBuilder(b)
+	r.RegisterApplicationLogsBuilder(b)
+	r.RegisterAccessLogsBuilder(b)
+	r.RegisterQuotasBuilder(b)
+	r.RegisterMetricsBuilder(b)
+}
+
+func (b *fakeBuilder) DefaultConfig() adapter.Config { return &types.Struct{} }
+
+func (b *fakeBuilder) ValidateConfig(c adapter.Config) (ce *adapter.ConfigErrors) {
+	if _, fail := c.(*types.Struct).Fields["fail"]; fail {
+		ce = ce.Appendf("fail", "must not be set")
+	}
+	return
+}
+
+func (b *fakeBuilder) newAspect(env adapter.Env) (*fakeAspect, error) {
+	b.Lock()
+	constructing := b.constructing
+	b.Unlock()
+	if constructing != nil {
+		<-constructing
+	}
+
+	b.Lock()
+	defer b.Unlock()
+	b.envs = append(b.envs, env)
+	return &fakeAspect{b}, nil
+}
+
+func (b *fakeBuilder) record(call interface{}) {
+	b.Lock()
+	b.calls = append(b.calls, call)
+	b.Unlock()
+}
+
+func (b *fakeBuilder) lastCall() interface{} {
+	b.Lock()
+	defer b.Unlock()
+	if len(b.calls) == 0 {
+		return nil
+	}
+	return b.calls[len(b.calls)-1]
+}
+
+func (b *fakeBuilder) NewListsAspect(env adapter.Env, c adapter.Config) (adapter.ListsAspect, error) {
+	return b.newAspect(env)
+}
+
+func (b *fakeBuilder) NewDenialsAspect(env adapter.Env, c adapter.Config) (adapter.DenialsAspect, error) {
+	return b.newAspect(env)
+}
+
+func (b *fakeBuilder) NewApplicationLogsAspect(env adapter.Env, c adapter.Config) (adapter.ApplicationLogsAspect, error) {
+	return b.newAspect(env)
+}
+
+func (b *fakeBuilder) NewAccessLogsAspect(env adapter.Env, c adapter.Config) (adapter.AccessLogsAspect, error) {
+	return b.newAspect(env)
+}
+
+func (b *fakeBuilder) NewQuotasAspect(env adapter.Env, c adapter.Config, quotas map[string]*adapter.QuotaDefinition) (adapter.QuotasAspect, error) {
+	b.quotas = quotas
+	return b.newAspect(env)
+}
+
+func (b *fakeBuilder) NewMetricsAspect(env adapter.Env, c adapter.Config, metrics map[string]*adapter.MetricDefinition) (adapter.MetricsAspect, error) {
+	b.metrics = metrics
+	return b.newAspect(env)
+}
+
+type fakeAspect struct {
+	b *fakeBuilder
+}
+
+func (a *fakeAspect) Close() error {
+	a.b.Lock()
+	a.b.closed++
+	a.b.Unlock()
+	return nil
+}
+
+func (a *fakeAspect) CheckList(symbol string) (bool, error) {
+	a.b.record(symbol)
+	return symbol == "in", nil
+}
+
+func (a *fakeAspect) Deny() rpc.Status {
+	return rpc.Status{Code: int32(rpc.PERMISSION_DENIED), Message: "go away"}
+}
+
+func (a *fakeAspect) Alloc(args adapter.QuotaArgs) (adapter.QuotaResult, error) {
+	a.b.record(args)
+	return adapter.QuotaResult{Amount: args.QuotaAmount, Expiration: time.Second}, nil
+}
+
+func (a *fakeAspect) AllocBestEffort(args adapter.QuotaArgs) (adapter.QuotaResult, error) {
+	a.b.record(args)
+	return adapter.QuotaResult{Amount: 1, Remaining: 0, RetryAfter: time.Minute, HasHints: true}, nil
+}
+
+func (a *fakeAspect) ReleaseBestEffort(args adapter.QuotaArgs) (int64, error) {
+	a.b.record(args)
+	return args.QuotaAmount, nil
+}
+
+func (a *fakeAspect) Record(values []adapter.Value) error {
+	a.b.record(values)
+	return nil
+}
+
+func (a *fakeAspect) Log(entries []adapter.LogEntry) error {
+	a.b.record(entries)
+	return errors.New("disk full")
+}
+
+func (a *fakeAspect) LogAccess(entries []adapter.LogEntry) error {
+	a.b.record(entries)
+	return nil
+}
+
+// startPlugin serves the fake adapter on a loopback port.
+func startPlugin(t *testing.T) (*Server, *fakeBuilder, *config.Params, func()) {
+	fb := newFakeBuilder()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	s := NewServer([]adapter.RegisterFn{fb.register})
+	gs := grpc.NewServer()
+	plugin.RegisterPluginServer(gs, s)
+	go func() { _ = gs.Serve(lis) }()
+
+	return s, fb, &config.Params{Address: lis.Addr().String()}, func() {
+		gs.Stop()
+		_ = s.Close()
+	}
+}
+
+func TestInvariants(t *testing.T) {
+	test.AdapterInvariants(Register, t)
+}
+
+func TestValidateConfig(t *testing.T) {
+	_, _, params, stop := startPlugin(t)
+	defer stop()
+
+	// an address nothing listens on
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	unreachable := lis.Addr().String()
+	_ = lis.Close()
+
+	failing := &types.Struct{Fields: map[string]*types.Value{"fail": {Kind: &types.Value_BoolValue{BoolValue: true}}}}
+
+	cases := []struct {
+		name   string
+		params *config.Params
+		want   string
+	}{
+		{"valid", &config.Params{Address: params.Address}, ""},
+		{"named", &config.Params{Address: params.Address, Adapter: "fake"}, ""},
+		{"no address", &config.Params{}, "address"},
+		{"unknown adapter", &config.Params{Address: params.Address, Adapter: "other"}, "doesn't serve adapter 'other'"},
+		{"rejected by plugin", &config.Params{Address: params.Address, Params: failing}, "params.fail: must not be set"},
+		{"plugin unreachable", &config.Params{Address: unreachable}, ""},
+	}
+
+	b := newBuilder()
+	defer func() { _ = b.Close() }()
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ce := b.ValidateConfig(c.params)
+			if c.want == "" {
+				if ce != nil {
+					t.Errorf("ValidateConfig() = %v, want no error", ce)
+				}
+			} else if ce == nil || !strings.Contains(ce.Error(), c.want) {
+				t.Errorf("ValidateConfig() = %v, want an error with '%s'", ce, c.want)
+			}
+		})
+	}
+}
+
+func TestValidateConfig_Unvalidated(t *testing.T) {
+	// the plugin comes up after the config was validated
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	address := lis.Addr().String()
+	_ = lis.Close()
+
+	failing := &types.Struct{Fields: map[string]*types.Value{"fail": {Kind: &types.Value_BoolValue{BoolValue: true}}}}
+	valid := &config.Params{Address: address}
+	invalid := &config.Params{Address: address, Params: failing}
+
+	b := newBuilder()
+	defer func() { _ = b.Close() }()
+	for _, params := range []*config.Params{valid, invalid} {
+		if ce := b.ValidateConfig(params); ce != nil {
+			t.Fatalf("ValidateConfig() = %v while the plugin is unreachable, want the params accepted", ce)
+		}
+	}
+
+	if lis, err = net.Listen("tcp", address); err != nil {
+		t.Skipf("Unable to listen on %s again: %v", address, err)
+	}
+	fb := newFakeBuilder()
+	s := NewServer([]adapter.RegisterFn{fb.register})
+	gs := grpc.NewServer()
+	plugin.RegisterPluginServer(gs, s)
+	go func() { _ = gs.Serve(lis) }()
+	defer gs.Stop()
+
+	env := test.NewEnv(t)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, err = b.NewListsAspect(env, valid)
+		if err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("NewListsAspect() = %v once the plugin is up, want the params validated", err)
+	}
+
+	if _, err = b.NewListsAspect(env, invalid); err == nil || !strings.Contains(err.Error(), "params.fail: must not be set") {
+		t.Errorf("NewListsAspect() = %v, want the plugin to reject the params", err)
+	}
+	if len(fb.envs) != 1 {
+		t.Errorf("Plugin constructed %d aspects, want only the one with valid params", len(fb.envs))
+	}
+}
+
+func TestAspects(t *testing.T) {
+	_, fb, params, stop := startPlugin(t)
+	defer stop()
+
+	b := newBuilder()
+	defer func() { _ = b.Close() }()
+	env := test.NewEnv(t)
+
+	la, err := b.NewListsAspect(env, params)
+	if err != nil {
+		t.Fatalf("NewListsAspect() failed: %v", err)
+	}
+	if found, err := la.CheckList("in"); !found || err != nil {
+		t.Errorf("CheckList(in) = %v, %v, want true", found, err)
+	}
+	if found, err := la.CheckList("out"); found || err != nil {
+		t.Errorf("CheckList(out) = %v, %v, want false", found, err)
+	}
+	if err := la.Close(); err != nil {
+		t.Errorf("Close() failed: %v", err)
+	}
+
+	da, err := b.NewDenialsAspect(env, params)
+	if err != nil {
+		t.Fatalf("NewDenialsAspect() failed: %v", err)
+	}
+	if s := da.Deny(); s.Code != int32(rpc.PERMISSION_DENIED) || s.Message != "go away" {
+		t.Errorf("Deny() = %v, want the status of the adapter", s)
+	}
+	// the plugin checks the kind of the aspects it is called on
+	if _, err := da.(adapter.ListsAspect).CheckList("in"); err == nil || !strings.Contains(err.Error(), "DENIALS") {
+		t.Errorf("CheckList() on a denials aspect = %v, want an error", err)
+	}
+
+	quotas := map[string]*adapter.QuotaDefinition{
+		"rq": {Name: "rq", MaxAmount: 10, Expiration: time.Second, Labels: map[string]adapter.LabelType{"source": adapter.String}},
+	}
+	qa, err := b.NewQuotasAspect(env, params, quotas)
+	if err != nil {
+		t.Fatalf("NewQuotasAspect() failed: %v", err)
+	}
+	if !reflect.DeepEqual(fb.quotas, quotas) {
+		t.Errorf("Plugin got quotas %v, want %v", fb.quotas, quotas)
+	}
+	args := adapter.QuotaArgs{
+		Definition:      quotas["rq"],
+		DeduplicationID: "1234",
+		QuotaAmount:     3,
+		Labels:          map[string]interface{}{"source": "a", "ip": []byte{10, 0, 0, 1}},
+	}
+	if qr, err := qa.Alloc(args); err != nil || qr.Amount != 3 || qr.Expiration != time.Second {
+		t.Errorf("Alloc() = %v, %v, want 3 for a second", qr, err)
+	}
+	if got := fb.lastCall(); !reflect.DeepEqual(got, args) {
+		t.Errorf("Plugin got %v, want %v", got, args)
+	}
+	want := adapter.QuotaResult{Amount: 1, RetryAfter: time.Minute, HasHints: true}
+	if qr, err := qa.AllocBestEffort(args); err != nil || qr != want {
+		t.Errorf("AllocBestEffort() = %v, %v, want %v", qr, err, want)
+	}
+	if amount, err := qa.ReleaseBestEffort(args); err != nil || amount != 3 {
+		t.Errorf("ReleaseBestEffort() = %d, %v, want 3", amount, err)
+	}
+
+	metrics := map[string]*adapter.MetricDefinition{
+		"rc": {Name: "rc", Kind: adapter.Counter, Labels: map[string]adapter.LabelType{"code": adapter.Int64}},
+	}
+	ma, err := b.NewMetricsAspect(env, params, metrics)
+	if err != nil {
+		t.Fatalf("NewMetricsAspect() failed: %v", err)
+	}
+	now := time.Unix(1490000000, 0).UTC()
+	values := []adapter.Value{
+		{Definition: metrics["rc"], Labels: map[string]interface{}{"code": int64(200)}, StartTime: now, EndTime: now, MetricValue: int64(1)},
+	}
+	if err := ma.Record(values); err != nil {
+		t.Errorf("Record() failed: %v", err)
+	}
+	if got := fb.lastCall(); !reflect.DeepEqual(got, values) {
+		t.Errorf("Plugin got %v, want %v", got, values)
+	}
+	if err := ma.Record([]adapter.Value{{Definition: metrics["rc"], MetricValue: struct{}{}}}); err == nil {
+		t.Error("Record() of an unsupported value succeeded, want an error")
+	}
+
+	entries := []adapter.LogEntry{{LogName: "access", Labels: map[string]interface{}{}, TextPayload: "GET /"}}
+	ala, err := b.NewAccessLogsAspect(env, params)
+	if err != nil {
+		t.Fatalf("NewAccessLogsAspect() failed: %v", err)
+	}
+	if err := ala.LogAccess(entries); err != nil {
+		t.Errorf("LogAccess() failed: %v", err)
+	}
+	if got := fb.lastCall(); !reflect.DeepEqual(got, entries) {
+		t.Errorf("Plugin got %v, want %v", got, entries)
+	}
+
+	apa, err := b.NewApplicationLogsAspect(env, params)
+	if err != nil {
+		t.Fatalf("NewApplicationLogsAspect() failed: %v", err)
+	}
+	if err := apa.Log(entries); err == nil || err.Error() != "disk full" {
+		t.Errorf("Log() = %v, want the error of the adapter", err)
+	}
+}
+
+func TestAspect_PluginRestart(t *testing.T) {
+	s, fb, params, stop := startPlugin(t)
+	defer stop()
+
+	b := newBuilder()
+	defer func() { _ = b.Close() }()
+
+	la, err := b.NewListsAspect(test.NewEnv(t), params)
+	if err != nil {
+		t.Fatalf("NewListsAspect() failed: %v", err)
+	}
+
+	// the plugin forgets about its aspects, as if it restarted
+	s.Lock()
+	s.aspects = make(map[uint64]*aspectInfo)
+	s.Unlock()
+
+	if found, err := la.CheckList("in"); !found || err != nil {
+		t.Errorf("CheckList() = %v, %v after the plugin lost the aspect, want true", found, err)
+	}
+	if len(fb.envs) != 2 || adapter.Recovering(fb.envs[0]) || !adapter.Recovering(fb.envs[1]) {
+		t.Errorf("Aspect constructed %d times, want twice, the second time recovering", len(fb.envs))
+	}
+	if timeout := adapter.CallTimeout(fb.envs[1]); timeout != defaultCallTimeout {
+		t.Errorf("CallTimeout() = %v, want %v", timeout, defaultCallTimeout)
+	}
+}
+
+func TestAspect_PluginRestartPending(t *testing.T) {
+	s, fb, params, stop := startPlugin(t)
+	defer stop()
+
+	b := newBuilder()
+	defer func() { _ = b.Close() }()
+
+	la, err := b.NewListsAspect(test.NewEnv(t), params)
+	if err != nil {
+		t.Fatalf("NewListsAspect() failed: %v", err)
+	}
+
+	// the plugin restarts and is slow to construct the aspect again
+	constructing := make(chan struct{})
+	fb.Lock()
+	fb.constructing = constructing
+	fb.Unlock()
+	s.Lock()
+	s.aspects = make(map[uint64]*aspectInfo)
+	s.Unlock()
+
+	// the call that finds the aspect lost gives up before it is constructed
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := adapter.BindCall(ctx, la).(adapter.ListsAspect).CheckList("in"); err == nil {
+		t.Error("CheckList() succeeded while the aspect was constructed again, want an error")
+	}
+
+	// calls made meanwhile don't wait for the construction
+	start := time.Now()
+	if _, err := la.CheckList("in"); err == nil || !strings.Contains(err.Error(), "being constructed again") {
+		t.Errorf("CheckList() = %v while the aspect was constructed again, want it to fail", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("CheckList() took %v while the aspect was constructed again, want it to fail fast", elapsed)
+	}
+
+	// the construction outlives the call that started it
+	close(constructing)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		found, err := la.CheckList("in")
+		if err == nil {
+			if !found {
+				t.Error("CheckList() = false once the aspect was constructed again, want true")
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("CheckList() = %v, want the aspect constructed again", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	fb.Lock()
+	constructed := len(fb.envs)
+	fb.Unlock()
+	if constructed != 2 {
+		t.Errorf("Aspect constructed %d times, want twice", constructed)
+	}
+}
+
+func TestAspect_Close(t *testing.T) {
+	_, _, params, stop := startPlugin(t)
+	defer stop()
+
+	b := newBuilder()
+	defer func() { _ = b.Close() }()
+
+	la, err := b.NewListsAspect(test.NewEnv(t), params)
+	if err != nil {
+		t.Fatalf("NewListsAspect() failed: %v", err)
+	}
+
+	// a later config with the same params was accepted while the plugin was unreachable
+	b.Lock()
+	b.unvalidated[params.String()] = true
+	b.Unlock()
+
+	if err := la.Close(); err != nil {
+		t.Errorf("Close() failed: %v", err)
+	}
+	b.Lock()
+	pending := len(b.unvalidated)
+	b.Unlock()
+	if pending != 0 {
+		t.Errorf("%d params left unvalidated once the aspect was closed, want none", pending)
+	}
+}
+
+func TestAspect_BindCall(t *testing.T) {
+	_, _, params, stop := startPlugin(t)
+	defer stop()
+
+	b := newBuilder()
+	defer func() { _ = b.Close() }()
+
+	la, err := b.NewListsAspect(test.NewEnv(t), params)
+	if err != nil {
+		t.Fatalf("NewListsAspect() failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	bound := adapter.BindCall(ctx, la).(adapter.ListsAspect)
+	if found, err := bound.CheckList("in"); !found || err != nil {
+		t.Errorf("CheckList() = %v, %v on a bound aspect, want true", found, err)
+	}
+
+	// the mixer gave up on the call
+	cancel()
+	if _, err := bound.CheckList("in"); err == nil {
+		t.Error("CheckList() succeeded once the call was given up on, want an error")
+	}
+	if found, err := la.CheckList("in"); !found || err != nil {
+		t.Errorf("CheckList() = %v, %v on the unbound aspect, want true", found, err)
+	}
+}
+
+func TestAspect_PluginDown(t *testing.T) {
+	_, _, params, stop := startPlugin(t)
+	b := newBuilder()
+	defer func() { _ = b.Close() }()
+
+	da, err := b.NewDenialsAspect(test.NewEnv(t), params)
+	if err != nil {
+		t.Fatalf("NewDenialsAspect() failed: %v", err)
+	}
+	stop()
+
+	if s := da.Deny(); s.Code != int32(rpc.UNAVAILABLE) {
+		t.Errorf("Deny() = %v once the plugin is down, want UNAVAILABLE", s)
+	}
+	if _, err := b.NewListsAspect(test.NewEnv(t), params); err == nil {
+		t.Error("NewListsAspect() succeeded once the plugin is down, want an error")
+	}
+}
+
+func TestServeLoopback(t *testing.T) {
+	fb := newFakeBuilder()
+	address, stop, err := ServeLoopback([]adapter.RegisterFn{fb.register})
+	if err != nil {
+		t.Fatalf("ServeLoopback() failed: %v", err)
+	}
+
+	b := newBuilder()
+	defer func() { _ = b.Close() }()
+	la, err := b.NewListsAspect(test.NewEnv(t), &config.Params{Address: address})
+	if err != nil {
+		t.Fatalf("NewListsAspect() failed: %v", err)
+	}
+	if found, err := la.CheckList("in"); !found || err != nil {
+		t.Errorf("CheckList() = %v, %v, want true", found, err)
+	}
+
+	stop()
+	if fb.closed != 1 {
+		t.Errorf("%d aspects closed when the plugin stopped, want 1", fb.closed)
+	}
+}
@@ -0,0 +1,527 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/gogo/protobuf/types"
+	"github.com/golang/glog"
+	rpc "github.com/googleapis/googleapis/google/rpc"
+	multierror "github.com/hashicorp/go-multierror"
+	netcontext "golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"istio.io/mixer/adapter/remote/plugin"
+	"istio.io/mixer/pkg/adapter"
+)
+
+type (
+	// Server serves adapters written against pkg/adapter as a plugin, see plugin/plugin.proto.
+	Server struct {
+		builders map[string]*builderInfo
+
+		sync.Mutex
+		aspects map[uint64]*aspectInfo
+		lastID  uint64
+	}
+
+	builderInfo struct {
+		builder adapter.Builder
+		kinds   map[plugin.AspectKind]bool
+	}
+
+	aspectInfo struct {
+		kind    plugin.AspectKind
+		aspect  adapter.Aspect
+		metrics map[string]*adapter.MetricDefinition
+		quotas  map[string]*adapter.QuotaDefinition
+	}
+)
+
+// NewServer returns a server of the adapters of the given inventory.
+func NewServer(inventory []adapter.RegisterFn) *Server {
+	s := &Server{
+		builders: make(map[string]*builderInfo),
+		aspects:  make(map[uint64]*aspectInfo),
+	}
+	for _, register := range inventory {
+		register(s)
+	}
+	return s
+}
+
+// Serve serves the adapters of the given inventory as a plugin on lis, until lis fails.
+func Serve(lis net.Listener, inventory []adapter.RegisterFn) error {
+	s := NewServer(inventory)
+	defer func() { _ = s.Close() }()
+
+	gs := grpc.NewServer()
+	plugin.RegisterPluginServer(gs, s)
+	return gs.Serve(lis)
+}
+
+// ServeLoopback serves the adapters of the given inventory on a free port of the loopback
+// interface, for tests to point remote adapters at. It returns the address of the plugin, and a
+// function stopping it.
+func ServeLoopback(inventory []adapter.RegisterFn) (address string, stop func(), err error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, err
+	}
+
+	s := NewServer(inventory)
+	gs := grpc.NewServer()
+	plugin.RegisterPluginServer(gs, s)
+	go func() { _ = gs.Serve(lis) }()
+
+	return lis.Addr().String(), func() {
+		gs.Stop()
+		_ = s.Close()
+	}, nil
+}
+
+// Close closes the aspects still open, then the builders.
+func (s *Server) Close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	var result *multierror.Error
+	for id, ai := range s.aspects {
+		if err := ai.aspect.Close(); err != nil {
+			result = multierror.Append(result, fmt.Errorf("failed to close aspect %d: %v", id, err))
+		}
+	}
+	s.aspects = make(map[uint64]*aspectInfo)
+
+	for name, bi := range s.builders {
+		if err := bi.builder.Close(); err != nil {
+			result = multierror.Append(result, fmt.Errorf("failed to close adapter '%s': %v", name, err))
+		}
+	}
+	return result.ErrorOrNil()
+}
+
+// RegisterListsBuilder registers a new ListChecker builder.
+func (s *Server) RegisterListsBuilder(b adapter.ListsBuilder) {
+	s.insert(plugin.AspectKind_LISTS, b)
+}
+
+// RegisterDenialsBuilder registers a new DenyChecker builder.
+func (s *Server) RegisterDenialsBuilder(b adapter.DenialsBuilder) {
+	s.insert(plugin.AspectKind_DENIALS, b)
+}
+
+// RegisterApplicationLogsBuilder registers a new Logger builder.
+func (s *Server) RegisterApplicationLogsBuilder(b adapter.ApplicationLogsBuilder) {
+	s.insert(plugin.AspectKind_APPLICATION_LOGS, b)
+}
+
+// RegisterAccessLogsBuilder registers a new AccessLogger builder.
+func (s *Server) RegisterAccessLogsBuilder(b adapter.AccessLogsBuilder) {
+	s.insert(plugin.AspectKind_ACCESS_LOGS, b)
+}
+
+// RegisterQuotasBuilder registers a new Quotas builder.
+func (s *Server) RegisterQuotasBuilder(b adapter.QuotasBuilder) {
+	s.insert(plugin.AspectKind_QUOTAS, b)
+}
+
+// RegisterMetricsBuilder registers a new Metrics builder.
+func (s *Server) RegisterMetricsBuilder(b adapter.MetricsBuilder) {
+	s.insert(plugin.AspectKind_METRICS, b)
+}
+
+func (s *Server) insert(k plugin.AspectKind, b adapter.Builder) {
+	bi := s.builders[b.Name()]
+	if bi == nil {
+		bi = &builderInfo{builder: b, kinds: make(map[plugin.AspectKind]bool)}
+		s.builders[b.Name()] = bi
+	} else if bi.builder != b {
+		panic(fmt.Errorf("duplicate registration for '%s' : old = %v new = %v", b.Name(), bi.builder, b))
+	}
+	bi.kinds[k] = true
+}
+
+// find returns the builder of the named adapter, or the only one if name is empty.
+func (s *Server) find(name string) (*builderInfo, error) {
+	if name == "" {
+		if len(s.builders) != 1 {
+			return nil, grpc.Errorf(codes.InvalidArgument, "plugin serves %d adapters, the adapter's name is required", len(s.builders))
+		}
+		for _, bi := range s.builders {
+			return bi, nil
+		}
+	}
+	bi, found := s.builders[name]
+	if !found {
+		return nil, grpc.Errorf(codes.InvalidArgument, "plugin doesn't serve adapter '%s'", name)
+	}
+	return bi, nil
+}
+
+// decode interprets the params sent by the mixer as the config of the builder, the way the mixer
+// interprets the params of the adapters it runs itself.
+func decode(params *types.Struct, b adapter.Builder) (adapter.Config, error) {
+	c := b.DefaultConfig()
+	if params == nil {
+		return c, nil
+	}
+	var buf bytes.Buffer
+	if err := (&jsonpb.Marshaler{}).Marshal(&buf, params); err != nil {
+		return nil, err
+	}
+	if err := jsonpb.Unmarshal(&buf, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ValidateConfig validates the configuration of one of the plugin's adapters.
+func (s *Server) ValidateConfig(ctx netcontext.Context, req *plugin.ValidateConfigRequest) (*plugin.ValidateConfigResponse, error) {
+	bi, err := s.find(req.Adapter)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &plugin.ValidateConfigResponse{}
+	c, err := decode(req.Params, bi.builder)
+	if err != nil {
+		resp.Errors = append(resp.Errors, &plugin.ConfigError{Message: fmt.Sprintf("failed to decode adapter params: %v", err)})
+		return resp, nil
+	}
+	if ce := bi.builder.ValidateConfig(c); ce != nil && ce.Multi != nil {
+		for _, e := range ce.Multi.Errors {
+			if cerr, ok := e.(adapter.ConfigError); ok {
+				resp.Errors = append(resp.Errors, &plugin.ConfigError{Field: cerr.Field, Message: cerr.Underlying.Error()})
+			} else {
+				resp.Errors = append(resp.Errors, &plugin.ConfigError{Message: e.Error()})
+			}
+		}
+	}
+	return resp, nil
+}
+
+// NewAspect constructs an aspect of one of the plugin's adapters.
+func (s *Server) NewAspect(ctx netcontext.Context, req *plugin.NewAspectRequest) (*plugin.NewAspectResponse, error) {
+	bi, err := s.find(req.Adapter)
+	if err != nil {
+		return nil, err
+	}
+	if !bi.kinds[req.Kind] {
+		return nil, grpc.Errorf(codes.InvalidArgument, "adapter '%s' doesn't implement %s aspects", bi.builder.Name(), req.Kind)
+	}
+
+	c, err := decode(req.Params, bi.builder)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "failed to decode adapter params: %v", err)
+	}
+	callTimeout, err := fromDuration(req.CallTimeout)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "invalid call timeout: %v", err)
+	}
+	env := newEnv(bi.builder.Name(), callTimeout, req.Recovering)
+
+	ai := &aspectInfo{kind: req.Kind}
+	switch req.Kind {
+	case plugin.AspectKind_LISTS:
+		ai.aspect, err = bi.builder.(adapter.ListsBuilder).NewListsAspect(env, c)
+	case plugin.AspectKind_DENIALS:
+		ai.aspect, err = bi.builder.(adapter.DenialsBuilder).NewDenialsAspect(env, c)
+	case plugin.AspectKind_APPLICATION_LOGS:
+		ai.aspect, err = bi.builder.(adapter.ApplicationLogsBuilder).NewApplicationLogsAspect(env, c)
+	case plugin.AspectKind_ACCESS_LOGS:
+		ai.aspect, err = bi.builder.(adapter.AccessLogsBuilder).NewAccessLogsAspect(env, c)
+	case plugin.AspectKind_QUOTAS:
+		if ai.quotas, err = fromQuotaDefinitions(req.Quotas); err != nil {
+			return nil, grpc.Errorf(codes.InvalidArgument, "%v", err)
+		}
+		ai.aspect, err = bi.builder.(adapter.QuotasBuilder).NewQuotasAspect(env, c, ai.quotas)
+	case plugin.AspectKind_METRICS:
+		ai.metrics = fromMetricDefinitions(req.Metrics)
+		ai.aspect, err = bi.builder.(adapter.MetricsBuilder).NewMetricsAspect(env, c, ai.metrics)
+	}
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unknown, "%v", err)
+	}
+
+	s.Lock()
+	s.lastID++
+	id := s.lastID
+	s.aspects[id] = ai
+	s.Unlock()
+
+	glog.V(2).Infof("Constructed %s aspect %d of adapter '%s'", req.Kind, id, bi.builder.Name())
+	return &plugin.NewAspectResponse{AspectId: id}, nil
+}
+
+// CloseAspect releases an aspect.
+func (s *Server) CloseAspect(ctx netcontext.Context, req *plugin.AspectRef) (*types.Empty, error) {
+	s.Lock()
+	ai, found := s.aspects[req.AspectId]
+	delete(s.aspects, req.AspectId)
+	s.Unlock()
+
+	if !found {
+		return nil, grpc.Errorf(codes.NotFound, "unknown aspect %d", req.AspectId)
+	}
+	if err := ai.aspect.Close(); err != nil {
+		return nil, grpc.Errorf(codes.Unknown, "%v", err)
+	}
+	return &types.Empty{}, nil
+}
+
+// lookup returns the aspect of the given kind with the given id.
+func (s *Server) lookup(id uint64, kind plugin.AspectKind) (*aspectInfo, error) {
+	s.Lock()
+	ai, found := s.aspects[id]
+	s.Unlock()
+
+	if !found {
+		return nil, grpc.Errorf(codes.NotFound, "unknown aspect %d", id)
+	}
+	if ai.kind != kind {
+		return nil, grpc.Errorf(codes.InvalidArgument, "aspect %d is a %s aspect, not a %s one", id, ai.kind, kind)
+	}
+	return ai, nil
+}
+
+// CheckList forwards a call to adapter.ListsAspect.CheckList.
+func (s *Server) CheckList(ctx netcontext.Context, req *plugin.CheckListRequest) (*plugin.CheckListResponse, error) {
+	ai, err := s.lookup(req.AspectId, plugin.AspectKind_LISTS)
+	if err != nil {
+		return nil, err
+	}
+	found, err := ai.aspect.(adapter.ListsAspect).CheckList(req.Symbol)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unknown, "%v", err)
+	}
+	return &plugin.CheckListResponse{Found: found}, nil
+}
+
+// Deny forwards a call to adapter.DenialsAspect.Deny.
+func (s *Server) Deny(ctx netcontext.Context, req *plugin.AspectRef) (*rpc.Status, error) {
+	ai, err := s.lookup(req.AspectId, plugin.AspectKind_DENIALS)
+	if err != nil {
+		return nil, err
+	}
+	status := ai.aspect.(adapter.DenialsAspect).Deny()
+	return &status, nil
+}
+
+func (ai *aspectInfo) quotaArgs(req *plugin.QuotaRequest) (adapter.QuotaArgs, error) {
+	labels, err := fromValues(req.Labels)
+	if err != nil {
+		return adapter.QuotaArgs{}, grpc.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	def, found := ai.quotas[req.Definition]
+	if !found {
+		return adapter.QuotaArgs{}, grpc.Errorf(codes.InvalidArgument, "unknown quota %s", req.Definition)
+	}
+	return adapter.QuotaArgs{
+		Definition:      def,
+		DeduplicationID: req.DeduplicationId,
+		QuotaAmount:     req.QuotaAmount,
+		Labels:          labels,
+	}, nil
+}
+
+func (s *Server) alloc(req *plugin.QuotaRequest, bestEffort bool) (*plugin.QuotaResponse, error) {
+	ai, err := s.lookup(req.AspectId, plugin.AspectKind_QUOTAS)
+	if err != nil {
+		return nil, err
+	}
+	args, err := ai.quotaArgs(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var qr adapter.QuotaResult
+	if bestEffort {
+		qr, err = ai.aspect.(adapter.QuotasAspect).AllocBestEffort(args)
+	} else {
+		qr, err = ai.aspect.(adapter.QuotasAspect).Alloc(args)
+	}
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unknown, "%v", err)
+	}
+	return &plugin.QuotaResponse{
+		Expiration: types.DurationProto(qr.Expiration),
+		Amount:     qr.Amount,
+		Remaining:  qr.Remaining,
+		RetryAfter: types.DurationProto(qr.RetryAfter),
+		HasHints:   qr.HasHints,
+	}, nil
+}
+
+// Alloc forwards a call to adapter.QuotasAspect.Alloc.
+func (s *Server) Alloc(ctx netcontext.Context, req *plugin.QuotaRequest) (*plugin.QuotaResponse, error) {
+	return s.alloc(req, false)
+}
+
+// AllocBestEffort forwards a call to adapter.QuotasAspect.AllocBestEffort.
+func (s *Server) AllocBestEffort(ctx netcontext.Context, req *plugin.QuotaRequest) (*plugin.QuotaResponse, error) {
+	return s.alloc(req, true)
+}
+
+// ReleaseBestEffort forwards a call to adapter.QuotasAspect.ReleaseBestEffort.
+func (s *Server) ReleaseBestEffort(ctx netcontext.Context, req *plugin.QuotaRequest) (*plugin.ReleaseResponse, error) {
+	ai, err := s.lookup(req.AspectId, plugin.AspectKind_QUOTAS)
+	if err != nil {
+		return nil, err
+	}
+	args, err := ai.quotaArgs(req)
+	if err != nil {
+		return nil, err
+	}
+	amount, err := ai.aspect.(adapter.QuotasAspect).ReleaseBestEffort(args)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unknown, "%v", err)
+	}
+	return &plugin.ReleaseResponse{Amount: amount}, nil
+}
+
+// Record forwards a call to adapter.MetricsAspect.Record.
+func (s *Server) Record(ctx netcontext.Context, req *plugin.RecordRequest) (*types.Empty, error) {
+	ai, err := s.lookup(req.AspectId, plugin.AspectKind_METRICS)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]adapter.Value, len(req.Values))
+	for i, mv := range req.Values {
+		def, found := ai.metrics[mv.Definition]
+		if !found {
+			return nil, grpc.Errorf(codes.InvalidArgument, "unknown metric %s", mv.Definition)
+		}
+		v := adapter.Value{Definition: def}
+		if v.Labels, err = fromValues(mv.Labels); err != nil {
+			return nil, grpc.Errorf(codes.InvalidArgument, "%v", err)
+		}
+		if v.MetricValue, err = fromValue(mv.Value); err != nil {
+			return nil, grpc.Errorf(codes.InvalidArgument, "%v", err)
+		}
+		if v.StartTime, err = fromTimestamp(mv.StartTime); err != nil {
+			return nil, grpc.Errorf(codes.InvalidArgument, "%v", err)
+		}
+		if v.EndTime, err = fromTimestamp(mv.EndTime); err != nil {
+			return nil, grpc.Errorf(codes.InvalidArgument, "%v", err)
+		}
+		values[i] = v
+	}
+
+	if err := ai.aspect.(adapter.MetricsAspect).Record(values); err != nil {
+		return nil, grpc.Errorf(codes.Unknown, "%v", err)
+	}
+	return &types.Empty{}, nil
+}
+
+// Log forwards a call to adapter.ApplicationLogsAspect.Log.
+func (s *Server) Log(ctx netcontext.Context, req *plugin.LogRequest) (*types.Empty, error) {
+	ai, err := s.lookup(req.AspectId, plugin.AspectKind_APPLICATION_LOGS)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := fromLogEntries(req.Entries)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if err := ai.aspect.(adapter.ApplicationLogsAspect).Log(entries); err != nil {
+		return nil, grpc.Errorf(codes.Unknown, "%v", err)
+	}
+	return &types.Empty{}, nil
+}
+
+// LogAccess forwards a call to adapter.AccessLogsAspect.LogAccess.
+func (s *Server) LogAccess(ctx netcontext.Context, req *plugin.LogRequest) (*types.Empty, error) {
+	ai, err := s.lookup(req.AspectId, plugin.AspectKind_ACCESS_LOGS)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := fromLogEntries(req.Entries)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if err := ai.aspect.(adapter.AccessLogsAspect).LogAccess(entries); err != nil {
+		return nil, grpc.Errorf(codes.Unknown, "%v", err)
+	}
+	return &types.Empty{}, nil
+}
+
+// env is the adapter.Env of the aspects served by a plugin.
+type env struct {
+	adapter     string
+	callTimeout time.Duration
+	recovering  bool
+}
+
+func newEnv(adapterName string, callTimeout time.Duration, recovering bool) adapter.Env {
+	return env{adapter: adapterName, callTimeout: callTimeout, recovering: recovering}
+}
+
+func (e env) Logger() adapter.Logger {
+	return e
+}
+
+func (e env) CallTimeout() time.Duration {
+	return e.callTimeout
+}
+
+func (e env) Recovering() bool {
+	return e.recovering
+}
+
+// Monitor returns a monitor discarding the metrics of the adapter: plugins, unlike the
+// mixer, don't export metrics about themselves.
+func (e env) Monitor() adapter.Monitor {
+	return adapter.NopMonitor{}
+}
+
+func (e env) ScheduleWork(fn adapter.WorkFunc) {
+	e.ScheduleDaemon(adapter.DaemonFunc(fn))
+}
+
+func (e env) ScheduleDaemon(fn adapter.DaemonFunc) {
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				_ = e.Errorf("Adapter goroutine failed: %v", r)
+			}
+		}()
+
+		fn()
+	}()
+}
+
+func (e env) Infof(format string, args ...interface{}) {
+	glog.InfoDepth(1, e.adapter+":"+fmt.Sprintf(format, args...))
+}
+
+func (e env) Warningf(format string, args ...interface{}) {
+	glog.WarningDepth(1, e.adapter+":"+fmt.Sprintf(format, args...))
+}
+
+func (e env) Errorf(format string, args ...interface{}) error {
+	s := fmt.Sprintf(format, args...)
+	glog.ErrorDepth(1, e.adapter+":"+s)
+	return errors.New(s)
+}
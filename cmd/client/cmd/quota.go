@@ -16,37 +16,61 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"strconv"
 
 	"github.com/opentracing/opentracing-go/ext"
 	"github.com/spf13/cobra"
+	"google.golang.org/grpc/metadata"
 
 	mixerpb "istio.io/api/mixer/v1"
 	"istio.io/mixer/cmd/shared"
+	"istio.io/mixer/pkg/api/unary"
 )
 
 func quotaCmd(rootArgs *rootArgs, printf, fatalf shared.FormatFn) *cobra.Command {
-	name := ""
+	var names []string
 	amount := int64(1)
 	bestEffort := false
+	release := false
 
 	cmd := &cobra.Command{
 		Use:   "quota",
 		Short: "Invokes the mixer's Quota API.",
 		Run: func(cmd *cobra.Command, args []string) {
-			quota(rootArgs, printf, fatalf, name, amount, bestEffort)
+			if amount < 0 {
+				fatalf("Amount must be >= 0, use --release to give quota back")
+			}
+			if len(names) > 1 {
+				if release {
+					fatalf("Quotas can only be released one at a time")
+				}
+				quotaBatch(rootArgs, printf, fatalf, names, amount, bestEffort)
+				return
+			}
+
+			name := ""
+			if len(names) == 1 {
+				name = names[0]
+			}
+			quota(rootArgs, printf, fatalf, name, amount, bestEffort, release)
 		},
 	}
 
-	cmd.PersistentFlags().StringVarP(&name, "name", "", "", "The name of the quota to allocate")
+	cmd.PersistentFlags().StringSliceVarP(&names, "name", "", nil, "The name of the quota to allocate, or a comma-separated list "+
+		"of quotas to allocate from all at once")
 	cmd.PersistentFlags().Int64VarP(&amount, "amount", "", 1, "The amount of quota to request")
 	cmd.PersistentFlags().BoolVarP(&bestEffort, "bestEffort", "", false, "Whether to use all-or-nothing or best effort semantics")
+	cmd.PersistentFlags().BoolVarP(&release, "release", "", false, "Whether to release the amount of quota instead of allocating it")
 
 	return cmd
 }
 
-func quota(rootArgs *rootArgs, printf, fatalf shared.FormatFn, name string, amount int64, bestEffort bool) {
+// quotaReleaseMetadata has the mixer release quota on the Quota stream, see api.QuotaReleaseMetadata.
+const quotaReleaseMetadata = "istio-mixer-quota-release"
+
+func quota(rootArgs *rootArgs, printf, fatalf shared.FormatFn, name string, amount int64, bestEffort bool, release bool) {
 	var attrs *mixerpb.Attributes
 	var err error
 
@@ -60,7 +84,11 @@ func quota(rootArgs *rootArgs, printf, fatalf shared.FormatFn, name string, amou
 	}
 	defer deleteAPIClient(cs)
 
-	span, ctx := cs.tracer.StartRootSpan(context.Background(), "mixc Quota", ext.SpanKindRPCClient)
+	ctx := context.Background()
+	if release {
+		ctx = metadata.NewContext(ctx, metadata.Pairs(quotaReleaseMetadata, "true"))
+	}
+	span, ctx := cs.tracer.StartRootSpan(ctx, "mixc Quota", ext.SpanKindRPCClient)
 	_, ctx = cs.tracer.PropagateSpan(ctx, span)
 
 	var stream mixerpb.Mixer_QuotaClient
@@ -106,3 +134,50 @@ func quota(rootArgs *rootArgs, printf, fatalf shared.FormatFn, name string, amou
 
 	span.Finish()
 }
+
+// quotaBatch allocates from several quotas at once through the unary API, with all-or-nothing semantics.
+func quotaBatch(rootArgs *rootArgs, printf, fatalf shared.FormatFn, names []string, amount int64, bestEffort bool) {
+	var attrs *mixerpb.Attributes
+	var err error
+
+	if attrs, err = parseAttributes(rootArgs); err != nil {
+		fatalf("%v", err)
+	}
+
+	var cs *clientState
+	if cs, err = createAPIClient(rootArgs.mixerAddress, rootArgs.enableTracing); err != nil {
+		fatalf("Unable to establish connection to %s", rootArgs.mixerAddress)
+	}
+	defer deleteAPIClient(cs)
+
+	span, ctx := cs.tracer.StartRootSpan(context.Background(), "mixc QuotaBatch", ext.SpanKindRPCClient)
+	_, ctx = cs.tracer.PropagateSpan(ctx, span)
+
+	for i := 0; i < rootArgs.repeat; i++ {
+		request := unary.QuotaBatchRequest{
+			RequestIndex:    int64(i),
+			AttributeUpdate: *attrs,
+		}
+		for _, name := range names {
+			request.Quotas = append(request.Quotas, &unary.QuotaBatchRequest_Quota{
+				Quota:           name,
+				Amount:          amount,
+				DeduplicationId: fmt.Sprintf("%d:%s", i, name),
+				BestEffort:      bestEffort,
+			})
+		}
+
+		var response *unary.QuotaBatchResponse
+		if response, err = cs.unaryClient.QuotaBatch(ctx, &request); err != nil {
+			fatalf("QuotaBatch RPC failed: %v", err)
+		}
+
+		printf("QuotaBatch RPC returned %s", decodeStatus(response.Result))
+		for j, q := range response.Quotas {
+			printf("  %s: amount %v, expiration %v", names[j], q.Amount, q.Expiration)
+		}
+		dumpAttributes(printf, fatalf, response.AttributeUpdate)
+	}
+
+	span.Finish()
+}
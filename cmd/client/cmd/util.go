@@ -30,14 +30,16 @@ import (
 
 	mixerpb "istio.io/api/mixer/v1"
 	"istio.io/mixer/cmd/shared"
+	"istio.io/mixer/pkg/api/unary"
 	"istio.io/mixer/pkg/attribute"
 	"istio.io/mixer/pkg/tracing"
 )
 
 type clientState struct {
-	client     mixerpb.MixerClient
-	connection *grpc.ClientConn
-	tracer     tracing.Tracer
+	client      mixerpb.MixerClient
+	unaryClient unary.MixerUnaryClient
+	connection  *grpc.ClientConn
+	tracer      tracing.Tracer
 }
 
 func createAPIClient(port string, enableTracing bool) (*clientState, error) {
@@ -56,6 +58,7 @@ func createAPIClient(port string, enableTracing bool) (*clientState, error) {
 	}
 
 	cs.client = mixerpb.NewMixerClient(cs.connection)
+	cs.unaryClient = unary.NewMixerUnaryClient(cs.connection)
 	return &cs, nil
 }
 
@@ -66,6 +69,7 @@ func deleteAPIClient(cs *clientState) {
 
 	_ = cs.connection.Close()
 	cs.client = nil
+	cs.unaryClient = nil
 	cs.connection = nil
 }
 
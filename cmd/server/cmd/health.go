@@ -0,0 +1,110 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"istio.io/mixer/pkg/adapterManager"
+	"istio.io/mixer/pkg/config"
+	"istio.io/mixer/pkg/pool"
+)
+
+const (
+	// poolProbeTimeout is how long the busy worker pools have to complete some work.
+	poolProbeTimeout = 5 * time.Second
+
+	// healthUpdateInterval is how often the status of the gRPC health service is refreshed.
+	healthUpdateInterval = 5 * time.Second
+)
+
+// mixerHealth implements api.HealthChecker for the mixer server.
+type mixerHealth struct {
+	adapterMgr *adapterManager.Manager
+	configMgr  *config.Manager
+	pools      map[string]*pool.GoroutinePool
+
+	// set once the mixer started shutting down
+	draining int32
+}
+
+// drain makes the mixer report itself as not ready from now on.
+func (h *mixerHealth) drain() {
+	atomic.StoreInt32(&h.draining, 1)
+}
+
+// Ready fails until a valid config has been installed. Once one has, a config that fails to
+// load doesn't make the mixer unready, since it keeps serving the config installed before:
+// Warnings reports the error instead. Ready also fails while some executors crashed and could
+// not be constructed anew, and once the mixer is shutting down.
+func (h *mixerHealth) Ready() error {
+	if atomic.LoadInt32(&h.draining) != 0 {
+		return errors.New("shutting down")
+	}
+
+	if h.adapterMgr.Configured() {
+		return h.adapterMgr.Healthy()
+	}
+
+	if err := h.configMgr.LastError(); err != nil {
+		return fmt.Errorf("no valid config installed yet, last error: %v", err)
+	}
+	return errors.New("no valid config installed yet")
+}
+
+// Warnings reports the error of the latest config, once a valid one has been installed.
+func (h *mixerHealth) Warnings() []string {
+	if !h.adapterMgr.Configured() {
+		return nil
+	}
+	if err := h.configMgr.LastError(); err != nil {
+		return []string{fmt.Sprintf("the latest config could not be installed, the previous one is still in use: %v", err)}
+	}
+	return nil
+}
+
+// Live fails when a worker pool doesn't make progress anymore. The pools are probed
+// concurrently, they all have poolProbeTimeout to respond.
+func (h *mixerHealth) Live() error {
+	var wg sync.WaitGroup
+	unresponsive := make(chan string, len(h.pools))
+	for name, gp := range h.pools {
+		wg.Add(1)
+		go func(name string, gp *pool.GoroutinePool) {
+			defer wg.Done()
+			if !gp.Responsive(poolProbeTimeout) {
+				unresponsive <- name
+			}
+		}(name, gp)
+	}
+	wg.Wait()
+	close(unresponsive)
+
+	var names []string
+	for name := range unresponsive {
+		names = append(names, name)
+	}
+	if len(names) > 0 {
+		sort.Strings(names)
+		return fmt.Errorf("%s worker pool(s) unresponsive", strings.Join(names, ", "))
+	}
+	return nil
+}
@@ -15,15 +15,20 @@
 package cmd
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
 	"io/ioutil"
 	"net"
+	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
+	rpc "github.com/googleapis/googleapis/google/rpc"
 	bt "github.com/opentracing/basictracer-go"
 	"github.com/spf13/cobra"
 	"google.golang.org/grpc"
@@ -34,10 +39,13 @@ import (
 	"istio.io/mixer/cmd/shared"
 	"istio.io/mixer/pkg/adapterManager"
 	"istio.io/mixer/pkg/api"
+	"istio.io/mixer/pkg/api/unary"
 	"istio.io/mixer/pkg/aspect"
 	"istio.io/mixer/pkg/config"
 	"istio.io/mixer/pkg/expr"
+	"istio.io/mixer/pkg/monitoring"
 	"istio.io/mixer/pkg/pool"
+	"istio.io/mixer/pkg/status"
 	"istio.io/mixer/pkg/tracing"
 	"istio.io/mixer/pkg/version"
 )
@@ -47,6 +55,9 @@ type serverArgs struct {
 	maxConcurrentStreams   uint
 	apiWorkerPoolSize      int
 	adapterWorkerPoolSize  int
+	apiQueueDepth          int
+	adapterQueueDepth      int
+	shedLoad               bool
 	port                   uint16
 	singleThreaded         bool
 	compressedPayload      bool
@@ -57,6 +68,35 @@ type serverArgs struct {
 	serviceConfigFile      string
 	globalConfigFile       string
 	configFetchIntervalSec uint
+	eagerExecutors         bool
+
+	httpPort            uint16
+	monitoringPort      uint16
+	debugAddress        string
+	httpServerCertFile  string
+	httpServerKeyFile   string
+	httpClientCertFiles string
+
+	breakerConsecutiveFailures int
+	breakerErrorRate           float64
+	breakerMinRequests         int
+	breakerWindow              time.Duration
+	breakerOpenTimeout         time.Duration
+	breakerHalfOpenProbes      int
+	breakerFallbackCode        string
+
+	executorMaxPanics   int
+	executorPanicWindow time.Duration
+	adapterCallTimeout  time.Duration
+
+	reportBatchSize     int
+	reportFlushInterval time.Duration
+	reportMaxBuffered   int
+
+	metricAggregationWindow   time.Duration
+	metricAggregationMaxCells int
+
+	shutdownTimeout time.Duration
 }
 
 func serverCmd(printf, fatalf shared.FormatFn) *cobra.Command {
@@ -73,6 +113,35 @@ func serverCmd(printf, fatalf shared.FormatFn) *cobra.Command {
 				return fmt.Errorf("adapter worker pool size must be >= 0 and <= 2^31-1, got pool size %d", sa.adapterWorkerPoolSize)
 			}
 
+			if sa.apiQueueDepth < 0 || sa.adapterQueueDepth < 0 {
+				return fmt.Errorf("queue depths must be >= 0, got %d and %d", sa.apiQueueDepth, sa.adapterQueueDepth)
+			}
+
+			if sa.breakerErrorRate < 0 || sa.breakerErrorRate > 1 {
+				return fmt.Errorf("breaker error rate must be between 0 and 1, got %v", sa.breakerErrorRate)
+			}
+
+			if sa.breakerHalfOpenProbes < 1 {
+				return fmt.Errorf("breaker half-open probes must be >= 1, got %d", sa.breakerHalfOpenProbes)
+			}
+
+			if _, found := rpc.Code_value[sa.breakerFallbackCode]; !found {
+				return fmt.Errorf("unknown breaker fallback code %s", sa.breakerFallbackCode)
+			}
+
+			if sa.reportBatchSize > 0 {
+				if sa.reportFlushInterval <= 0 {
+					return fmt.Errorf("report flush interval must be > 0, got %v", sa.reportFlushInterval)
+				}
+				if sa.reportMaxBuffered < sa.reportBatchSize {
+					return fmt.Errorf("report buffer size must be >= the report batch size, got %d", sa.reportMaxBuffered)
+				}
+			}
+
+			if sa.metricAggregationWindow < 0 {
+				return fmt.Errorf("metric aggregation window must be >= 0, got %v", sa.metricAggregationWindow)
+			}
+
 			return nil
 		},
 		Run: func(cmd *cobra.Command, args []string) {
@@ -84,6 +153,11 @@ func serverCmd(printf, fatalf shared.FormatFn) *cobra.Command {
 	serverCmd.PersistentFlags().UintVarP(&sa.maxConcurrentStreams, "maxConcurrentStreams", "", 32, "Maximum supported number of concurrent gRPC streams")
 	serverCmd.PersistentFlags().IntVarP(&sa.apiWorkerPoolSize, "apiWorkerPoolSize", "", 1024, "Max # of goroutines in the API worker pool")
 	serverCmd.PersistentFlags().IntVarP(&sa.adapterWorkerPoolSize, "adapterWorkerPoolSize", "", 1024, "Max # of goroutines in the adapter worker pool")
+	serverCmd.PersistentFlags().IntVarP(&sa.apiQueueDepth, "apiQueueDepth", "", 1024, "Max # of requests waiting for a goroutine of the API worker pool")
+	serverCmd.PersistentFlags().IntVarP(&sa.adapterQueueDepth, "adapterQueueDepth", "", 1024,
+		"Max # of work items waiting for a goroutine of the adapter worker pool")
+	serverCmd.PersistentFlags().BoolVarP(&sa.shedLoad, "shedLoad", "", false, "Whether to fail requests with RESOURCE_EXHAUSTED or "+
+		"UNAVAILABLE rather than wait when the worker pools' queues are full")
 	serverCmd.PersistentFlags().BoolVarP(&sa.singleThreaded, "singleThreaded", "", false, "Whether to run the mixer in single-threaded mode (useful "+
 		"for debugging)")
 	serverCmd.PersistentFlags().BoolVarP(&sa.compressedPayload, "compressedPayload", "", false, "Whether to compress gRPC messages")
@@ -106,6 +180,65 @@ func serverCmd(printf, fatalf shared.FormatFn) *cobra.Command {
 	_ = serverCmd.MarkPersistentFlagFilename("globalConfigFile", "yaml", "yml")
 
 	serverCmd.PersistentFlags().UintVarP(&sa.configFetchIntervalSec, "configFetchInterval", "", 5, "Configuration fetch interval in seconds")
+	serverCmd.PersistentFlags().BoolVarP(&sa.eagerExecutors, "eagerExecutors", "", false, "Whether to construct the executors of a new "+
+		"config before installing it, and keep serving the current config if any of them can't be constructed")
+
+	serverCmd.PersistentFlags().Uint16VarP(&sa.httpPort, "httpPort", "", 0, "TCP port to use for the mixer's HTTP/JSON API, 0 to disable it")
+
+	serverCmd.PersistentFlags().Uint16VarP(&sa.monitoringPort, "monitoringPort", "", 9093,
+		"TCP port to use for the mixer's health and self-monitoring endpoints, 0 to disable them")
+
+	serverCmd.PersistentFlags().StringVarP(&sa.debugAddress, "debugAddress", "", "",
+		"Address to serve the debug endpoints on, which expose the mixer's config, e.g. localhost:9094. Empty to disable them")
+
+	serverCmd.PersistentFlags().StringVarP(&sa.httpServerCertFile, "httpServerCertFile", "", "", "The TLS cert file for the HTTP/JSON API")
+	_ = serverCmd.MarkPersistentFlagFilename("httpServerCertFile")
+
+	serverCmd.PersistentFlags().StringVarP(&sa.httpServerKeyFile, "httpServerKeyFile", "", "", "The TLS key file for the HTTP/JSON API")
+	_ = serverCmd.MarkPersistentFlagFilename("httpServerKeyFile")
+
+	serverCmd.PersistentFlags().StringVarP(&sa.httpClientCertFiles, "httpClientCertFiles", "", "",
+		"A set of comma-separated client X509 cert files for the HTTP/JSON API")
+
+	bc := adapterManager.DefaultBreakerConfig()
+	serverCmd.PersistentFlags().IntVarP(&sa.breakerConsecutiveFailures, "breakerConsecutiveFailures", "", bc.ConsecutiveFailures,
+		"Consecutive adapter failures that trip a circuit breaker, 0 to disable")
+	serverCmd.PersistentFlags().Float64VarP(&sa.breakerErrorRate, "breakerErrorRate", "", bc.ErrorRate,
+		"Adapter error rate that trips a circuit breaker, 0 to disable")
+	serverCmd.PersistentFlags().IntVarP(&sa.breakerMinRequests, "breakerMinRequests", "", bc.MinRequests,
+		"Minimum # of adapter calls in the window before the error rate is considered")
+	serverCmd.PersistentFlags().DurationVarP(&sa.breakerWindow, "breakerWindow", "", bc.Window,
+		"Interval over which the adapter error rate is computed")
+	serverCmd.PersistentFlags().DurationVarP(&sa.breakerOpenTimeout, "breakerOpenTimeout", "", bc.OpenTimeout,
+		"How long a tripped circuit breaker stays open before probing the adapter again")
+	serverCmd.PersistentFlags().IntVarP(&sa.breakerHalfOpenProbes, "breakerHalfOpenProbes", "", bc.HalfOpenProbes,
+		"# of successful probe calls needed to close a circuit breaker")
+	serverCmd.PersistentFlags().StringVarP(&sa.breakerFallbackCode, "breakerFallbackCode", "", rpc.Code(bc.FallbackStatus.Code).String(),
+		"google.rpc.Code returned for calls rejected by an open circuit breaker, OK to fail open")
+
+	cp := adapterManager.DefaultCrashPolicy()
+	serverCmd.PersistentFlags().IntVarP(&sa.executorMaxPanics, "executorMaxPanics", "", cp.MaxPanics,
+		"# of adapter panics within the panic window after which the adapter's executor is constructed anew, 0 to disable")
+	serverCmd.PersistentFlags().DurationVarP(&sa.executorPanicWindow, "executorPanicWindow", "", cp.Window,
+		"Interval over which adapter panics are counted")
+
+	serverCmd.PersistentFlags().DurationVarP(&sa.adapterCallTimeout, "adapterCallTimeout", "", 0,
+		"How long the aspects of a request are given to complete before failing with DEADLINE_EXCEEDED, 0 for as long as the request lasts")
+
+	serverCmd.PersistentFlags().IntVarP(&sa.reportBatchSize, "reportBatchSize", "", 0,
+		"# of buffered metric values or access log entries that triggers a flush to the adapter, 0 to report synchronously")
+	serverCmd.PersistentFlags().DurationVarP(&sa.reportFlushInterval, "reportFlushInterval", "", time.Second,
+		"Longest time a metric value or access log entry stays buffered")
+	serverCmd.PersistentFlags().IntVarP(&sa.reportMaxBuffered, "reportMaxBuffered", "", 10000,
+		"Max # of metric values or access log entries buffered per adapter, beyond which they are dropped")
+
+	serverCmd.PersistentFlags().DurationVarP(&sa.metricAggregationWindow, "metricAggregationWindow", "", 0,
+		"Interval over which counter and gauge values are aggregated before being handed to the adapters, 0 to disable aggregation")
+	serverCmd.PersistentFlags().IntVarP(&sa.metricAggregationMaxCells, "metricAggregationMaxCells", "", 10000,
+		"Max # of distinct metric and label combinations aggregated per adapter before the aggregates are flushed early")
+
+	serverCmd.PersistentFlags().DurationVarP(&sa.shutdownTimeout, "shutdownTimeout", "", 10*time.Second,
+		"How long in-flight requests are given to complete once the mixer is asked to terminate")
 
 	return &serverCmd
 }
@@ -114,42 +247,45 @@ func runServer(sa *serverArgs, printf, fatalf shared.FormatFn) {
 	apiPoolSize := sa.apiWorkerPoolSize
 	adapterPoolSize := sa.adapterWorkerPoolSize
 
-	gp := pool.NewGoroutinePool(apiPoolSize, sa.singleThreaded)
+	gp := pool.NewNamedGoroutinePool("api", sa.apiQueueDepth, sa.singleThreaded)
 	gp.AddWorkers(apiPoolSize)
 	defer gp.Close()
 
-	adapterGP := pool.NewGoroutinePool(adapterPoolSize, sa.singleThreaded)
+	adapterGP := pool.NewNamedGoroutinePool("adapter", sa.adapterQueueDepth, sa.singleThreaded)
 	adapterGP.AddWorkers(adapterPoolSize)
 	defer adapterGP.Close()
 
 	// get aspect registry with proper aspect --> api mappings
 	eval := expr.NewCEXLEvaluator()
-	adapterMgr := adapterManager.NewManager(adapter.Inventory(), aspect.Inventory(), eval, gp, adapterGP)
+	breakerCfg := adapterManager.BreakerConfig{
+		ConsecutiveFailures: sa.breakerConsecutiveFailures,
+		ErrorRate:           sa.breakerErrorRate,
+		MinRequests:         sa.breakerMinRequests,
+		Window:              sa.breakerWindow,
+		OpenTimeout:         sa.breakerOpenTimeout,
+		HalfOpenProbes:      sa.breakerHalfOpenProbes,
+		FallbackStatus:      status.New(rpc.Code(rpc.Code_value[sa.breakerFallbackCode])),
+	}
+	crashPolicy := adapterManager.CrashPolicy{
+		MaxPanics: sa.executorMaxPanics,
+		Window:    sa.executorPanicWindow,
+	}
+	batchCfg := aspect.BatchConfig{
+		MaxBatchSize:  sa.reportBatchSize,
+		FlushInterval: sa.reportFlushInterval,
+		MaxBuffered:   sa.reportMaxBuffered,
+	}
+	aggCfg := aspect.AggregationConfig{
+		Window:   sa.metricAggregationWindow,
+		MaxCells: sa.metricAggregationMaxCells,
+	}
+	adapterMgr := adapterManager.NewManager(adapter.Inventory(), aspect.ReportingInventory(batchCfg, aggCfg), eval, gp, adapterGP,
+		breakerCfg, crashPolicy, sa.adapterCallTimeout, sa.shedLoad, sa.eagerExecutors)
 	configManager := config.NewManager(eval, adapterMgr.AspectValidatorFinder, adapterMgr.BuilderValidatorFinder,
 		adapterMgr.SupportedKinds,
 		sa.globalConfigFile, sa.serviceConfigFile, time.Second*time.Duration(sa.configFetchIntervalSec))
 
-	var serverCert *tls.Certificate
-	var clientCerts *x509.CertPool
-
-	if sa.serverCertFile != "" && sa.serverKeyFile != "" {
-		sc, err := tls.LoadX509KeyPair(sa.serverCertFile, sa.serverKeyFile)
-		if err != nil {
-			fatalf("Failed to load server certificate and server key: %v", err)
-		}
-		serverCert = &sc
-	}
-
-	if sa.clientCertFiles != "" {
-		clientCerts = x509.NewCertPool()
-		for _, clientCertFile := range strings.Split(sa.clientCertFiles, ",") {
-			pem, err := ioutil.ReadFile(clientCertFile)
-			if err != nil {
-				fatalf("Failed to load client certificate: %v", err)
-			}
-			clientCerts.AppendCertsFromPEM(pem)
-		}
-	}
+	serverCert, clientCerts := loadCerts(sa.serverCertFile, sa.serverKeyFile, sa.clientCertFiles, fatalf)
 
 	// get the network stuff setup
 	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", sa.port))
@@ -168,18 +304,7 @@ func runServer(sa *serverArgs, printf, fatalf shared.FormatFn) {
 		grpcOptions = append(grpcOptions, grpc.RPCDecompressor(grpc.NewGZIPDecompressor()))
 	}
 
-	if serverCert != nil {
-		// enable TLS
-		tlsConfig := &tls.Config{}
-		tlsConfig.Certificates = []tls.Certificate{*serverCert}
-
-		if clientCerts != nil {
-			// enable TLS mutual auth
-			tlsConfig.ClientCAs = clientCerts
-			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
-		}
-		tlsConfig.BuildNameToCertificate()
-
+	if tlsConfig := newTLSConfig(serverCert, clientCerts); tlsConfig != nil {
 		grpcOptions = append(grpcOptions, grpc.Creds(credentials.NewTLS(tlsConfig)))
 	}
 
@@ -190,18 +315,203 @@ func runServer(sa *serverArgs, printf, fatalf shared.FormatFn) {
 		tracer = tracing.DisabledTracer()
 	}
 
+	adapterMgr.ReportErrorsTo(configManager.RecordError)
 	configManager.Register(adapterMgr)
 	configManager.Start()
 
 	// get everything wired up
 	gs := grpc.NewServer(grpcOptions...)
-	s := api.NewGRPCServer(adapterMgr, tracer, gp)
+	s := api.NewGRPCServer(adapterMgr, tracer, gp, sa.shedLoad)
 	mixerpb.RegisterMixerServer(gs, s)
+	unary.RegisterMixerUnaryServer(gs, api.NewGRPCUnaryServer(adapterMgr, tracer, gp, sa.shedLoad))
+
+	health := &mixerHealth{
+		adapterMgr: adapterMgr,
+		configMgr:  configManager,
+		pools:      map[string]*pool.GoroutinePool{"api": gp, "adapter": adapterGP},
+	}
+	healthServer := api.NewHealthServer(health)
+	healthServer.Register(gs)
 
 	printf("Istio Mixer: %s", version.Info)
+
+	if sa.monitoringPort != 0 {
+		mux := http.NewServeMux()
+		healthHandler := api.NewHealthHandler(health)
+		mux.Handle("/healthz", healthHandler)
+		mux.Handle("/readyz", healthHandler)
+		mux.Handle("/metrics", monitoring.Handler())
+		startAuxServer("monitoring", fmt.Sprintf(":%d", sa.monitoringPort), mux, printf, fatalf)
+	}
+
+	if sa.debugAddress != "" {
+		startAuxServer("debug", sa.debugAddress, api.NewDebugHandler(configManager, adapterMgr, int64(sa.maxMessageSize)), printf, fatalf)
+	}
+
+	var hs *http.Server
+	if sa.httpPort != 0 {
+		hs = startHTTPServer(sa, api.NewHTTPHandler(adapterMgr, tracer, int64(sa.maxMessageSize)), printf, fatalf)
+	}
+
+	stopping, drained := drainOnSignal(gs, hs, sa.shutdownTimeout, func() {
+		health.drain()
+		healthServer.Update()
+	}, printf)
+	go healthServer.Run(healthUpdateInterval, stopping)
+
 	printf("Starting gRPC server on port %v", sa.port)
 
 	if err = gs.Serve(listener); err != nil {
-		fatalf("Failed serving gRPC server: %v", err)
+		select {
+		case <-stopping:
+			// Serve fails once the listener is closed by the shutdown
+		default:
+			fatalf("Failed serving gRPC server: %v", err)
+		}
 	}
+	<-drained
+
+	// flush whatever the adapters still buffer before the worker pools go away, this waits
+	// for the requests a forced stop left running
+	configManager.Close()
+	if err = adapterMgr.Close(); err != nil {
+		printf("Failed to close adapters cleanly: %v", err)
+	}
+
+	printf("Istio Mixer stopped")
+}
+
+// drainOnSignal stops the servers once the mixer is asked to terminate. onDrain is called
+// first, so that health checks report the mixer as not serving while it drains. The servers
+// stop accepting new streams and connections right away, while in-flight ones are given up to
+// timeout to complete. The stopping channel is closed as soon as the signal is received, the
+// drained channel once the servers are stopped.
+func drainOnSignal(gs *grpc.Server, hs *http.Server, timeout time.Duration, onDrain func(),
+	printf shared.FormatFn) (stopping, drained <-chan struct{}) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, os.Interrupt)
+
+	stoppingC := make(chan struct{})
+	drainedC := make(chan struct{})
+	go func() {
+		sig := <-sigs
+		signal.Stop(sigs)
+		onDrain()
+		close(stoppingC)
+		printf("Received %v, draining in-flight requests for up to %v", sig, timeout)
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		stopped := make(chan struct{})
+		go func() {
+			gs.GracefulStop()
+			close(stopped)
+		}()
+
+		if hs != nil {
+			if err := hs.Shutdown(ctx); err != nil {
+				printf("Failed to drain HTTP server: %v", err)
+			}
+		}
+
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			printf("Timed out draining gRPC streams, closing them")
+			gs.Stop()
+		}
+
+		close(drainedC)
+	}()
+
+	return stoppingC, drainedC
+}
+
+// startHTTPServer starts serving the HTTP/JSON API in the background.
+func startHTTPServer(sa *serverArgs, handler http.Handler, printf, fatalf shared.FormatFn) *http.Server {
+	serverCert, clientCerts := loadCerts(sa.httpServerCertFile, sa.httpServerKeyFile, sa.httpClientCertFiles, fatalf)
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", sa.httpPort))
+	if err != nil {
+		fatalf("Unable to listen on socket: %v", err)
+	}
+
+	if tlsConfig := newTLSConfig(serverCert, clientCerts); tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+
+	printf("Starting HTTP server on port %v", sa.httpPort)
+
+	hs := &http.Server{Handler: handler}
+	go func() {
+		if err := hs.Serve(listener); err != nil && err != http.ErrServerClosed {
+			fatalf("Failed serving HTTP server: %v", err)
+		}
+	}()
+
+	return hs
+}
+
+// startAuxServer starts serving one of the mixer's own sets of endpoints in the background.
+func startAuxServer(name, address string, handler http.Handler, printf, fatalf shared.FormatFn) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		fatalf("Unable to listen on socket: %v", err)
+	}
+
+	printf("Starting %s server on %v", name, address)
+
+	go func() {
+		if err := http.Serve(listener, handler); err != nil {
+			fatalf("Failed serving %s server: %v", name, err)
+		}
+	}()
+}
+
+// loadCerts loads the server's key pair and the client certs to accept, either of which may be nil.
+func loadCerts(serverCertFile, serverKeyFile, clientCertFiles string, fatalf shared.FormatFn) (*tls.Certificate, *x509.CertPool) {
+	var serverCert *tls.Certificate
+	var clientCerts *x509.CertPool
+
+	if serverCertFile != "" && serverKeyFile != "" {
+		sc, err := tls.LoadX509KeyPair(serverCertFile, serverKeyFile)
+		if err != nil {
+			fatalf("Failed to load server certificate and server key: %v", err)
+		}
+		serverCert = &sc
+	}
+
+	if clientCertFiles != "" {
+		clientCerts = x509.NewCertPool()
+		for _, clientCertFile := range strings.Split(clientCertFiles, ",") {
+			pem, err := ioutil.ReadFile(clientCertFile)
+			if err != nil {
+				fatalf("Failed to load client certificate: %v", err)
+			}
+			clientCerts.AppendCertsFromPEM(pem)
+		}
+	}
+
+	return serverCert, clientCerts
+}
+
+// newTLSConfig returns the TLS settings to serve with, or nil when TLS isn't enabled.
+func newTLSConfig(serverCert *tls.Certificate, clientCerts *x509.CertPool) *tls.Config {
+	if serverCert == nil {
+		return nil
+	}
+
+	// enable TLS
+	tlsConfig := &tls.Config{}
+	tlsConfig.Certificates = []tls.Certificate{*serverCert}
+
+	if clientCerts != nil {
+		// enable TLS mutual auth
+		tlsConfig.ClientCAs = clientCerts
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	tlsConfig.BuildNameToCertificate()
+
+	return tlsConfig
 }
@@ -29,6 +29,21 @@ type (
 		io.Closer
 	}
 
+	// Reconfigurable is implemented by aspects that can take a new configuration in place,
+	// keeping the state they built up, such as counters or fetched data. When the config
+	// of an adapter changes, the mixer reconfigures its reconfigurable aspects instead of
+	// constructing new ones. Only lists and quotas aspects are reconfigured at present.
+	Reconfigurable interface {
+		// Reconfigure applies a new adapter configuration to the aspect. metrics and quotas
+		// hold the definitions a metrics or quotas aspect is now handed, and are nil for
+		// the other kinds of aspects. env is the environment to schedule any new work on.
+		//
+		// The aspect keeps serving calls while it is being reconfigured. If it can't take
+		// the configuration it must return an error and carry on with its current one, in
+		// which case the mixer constructs a new aspect.
+		Reconfigure(env Env, c Config, metrics map[string]*MetricDefinition, quotas map[string]*QuotaDefinition) error
+	}
+
 	// Builder represents a factory of aspects. Adapters register builders with the mixer
 	// in order to allow the mixer to instantiate aspects on demand.
 	Builder interface {
@@ -88,10 +103,8 @@ type (
 		// use this method or ScheduleWork instead.
 		ScheduleDaemon(fn DaemonFunc)
 
-		// Possible other features for Env:
-		// Return how much time remains until the mixer considers the aspect call having timed out and kills it
-		// Return true/false to indicate this is a 'recovery mode' execution following a prior crash of the aspect
-		// ?
+		// The environments provided by the mixer also implement TimedEnv,
+		// RecoveringEnv and MonitoredEnv.
 	}
 
 	// Logger defines where aspects should output their log state to.
@@ -0,0 +1,111 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"context"
+	"time"
+)
+
+// The interfaces below extend Env. They are kept apart from it so that the environments
+// implemented outside of the mixer, such as the ones adapters are tested with, keep
+// satisfying Env. Adapters reach them through the functions of the same name, which
+// fall back to a sensible default when env doesn't implement them.
+type (
+	// TimedEnv is implemented by the environments that bound the calls made to aspects.
+	TimedEnv interface {
+		// CallTimeout returns the longest the mixer waits for a call to the
+		// aspect to complete before giving up on it, or 0 if it waits for as
+		// long as the request that triggered the call lasts. It is the same
+		// for every call: the time actually left on a call is the deadline of
+		// the context handed to CallBinder.BindCall.
+		CallTimeout() time.Duration
+	}
+
+	// RecoveringEnv is implemented by the environments that restart crashed aspects.
+	RecoveringEnv interface {
+		// Recovering returns true if the aspect was constructed anew after a
+		// prior instance crashed. Aspects can use it to skip warm-up work, or
+		// to resynchronize state the crashed instance may have left behind.
+		Recovering() bool
+	}
+
+	// MonitoredEnv is implemented by the environments that export the metrics adapters keep about themselves.
+	MonitoredEnv interface {
+		// Monitor returns the registry of the metrics the adapter exports
+		// about itself.
+		Monitor() Monitor
+	}
+
+	// CallBinder is implemented by aspects that want to know about each call made to them,
+	// typically to bound the requests they send to their backend by the deadline of the call.
+	// Before each call, the mixer calls BindCall with the context of the call, and invokes
+	// the aspect it returns instead, which must be of the same kind: the mixer invokes the aspect
+	// itself otherwise. The context is done once the mixer gives up on the call.
+	CallBinder interface {
+		BindCall(ctx context.Context) Aspect
+	}
+)
+
+// CallTimeout returns env's call timeout, 0 if env doesn't implement TimedEnv.
+func CallTimeout(env Env) time.Duration {
+	if e, ok := env.(TimedEnv); ok {
+		return e.CallTimeout()
+	}
+	return 0
+}
+
+// Recovering returns whether the aspect env belongs to recovers from a crash, false if env
+// doesn't implement RecoveringEnv.
+func Recovering(env Env) bool {
+	if e, ok := env.(RecoveringEnv); ok {
+		return e.Recovering()
+	}
+	return false
+}
+
+// MonitorOf returns env's monitor, or one that discards the metrics if env doesn't implement MonitoredEnv.
+func MonitorOf(env Env) Monitor {
+	if e, ok := env.(MonitoredEnv); ok {
+		return e.Monitor()
+	}
+	return NopMonitor{}
+}
+
+// BindCall returns the aspect to invoke for a call made under ctx, see CallBinder.
+func BindCall(ctx context.Context, a Aspect) Aspect {
+	if b, ok := a.(CallBinder); ok {
+		return b.BindCall(ctx)
+	}
+	return a
+}
+
+// NopMonitor is a Monitor whose metrics are discarded, for the environments that don't export them.
+type NopMonitor struct{}
+
+// Counter returns a counter that discards its values.
+func (NopMonitor) Counter(string, string, ...string) (MonitorCounter, error) {
+	return nopMetric{}, nil
+}
+
+// Histogram returns a histogram that discards its observations.
+func (NopMonitor) Histogram(string, string, []float64, ...string) (MonitorHistogram, error) {
+	return nopMetric{}, nil
+}
+
+type nopMetric struct{}
+
+func (nopMetric) Add(float64, ...string)     {}
+func (nopMetric) Observe(float64, ...string) {}
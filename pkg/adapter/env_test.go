@@ -0,0 +1,75 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type bareEnv struct{}
+
+func (bareEnv) Logger() Logger            { return nil }
+func (bareEnv) ScheduleWork(WorkFunc)     {}
+func (bareEnv) ScheduleDaemon(DaemonFunc) {}
+
+type fullEnv struct {
+	bareEnv
+	monitor Monitor
+}
+
+func (fullEnv) CallTimeout() time.Duration { return time.Second }
+func (fullEnv) Recovering() bool           { return true }
+func (e fullEnv) Monitor() Monitor         { return e.monitor }
+
+type plainAspect struct{}
+
+func (*plainAspect) Close() error { return nil }
+
+type bindingAspect struct {
+	ctx context.Context
+}
+
+func (*bindingAspect) Close() error { return nil }
+
+func (a *bindingAspect) BindCall(ctx context.Context) Aspect {
+	return &bindingAspect{ctx}
+}
+
+func TestEnvExtensions(t *testing.T) {
+	if CallTimeout(bareEnv{}) != 0 || Recovering(bareEnv{}) || MonitorOf(bareEnv{}) == nil {
+		t.Error("Got extensions from an env that doesn't implement them, want the defaults")
+	}
+
+	m := NopMonitor{}
+	env := fullEnv{monitor: m}
+	if CallTimeout(env) != time.Second || !Recovering(env) || MonitorOf(env) != m {
+		t.Error("Didn't get the extensions implemented by the env")
+	}
+}
+
+func TestBindCall(t *testing.T) {
+	ctx := context.Background()
+
+	var plain Aspect = &plainAspect{}
+	if BindCall(ctx, plain) != plain {
+		t.Error("BindCall() replaced an aspect that doesn't implement CallBinder")
+	}
+
+	if a := BindCall(ctx, &bindingAspect{}).(*bindingAspect); a.ctx != ctx {
+		t.Errorf("BindCall() = aspect bound to %v, want %v", a.ctx, ctx)
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+type (
+	// Monitor registers metrics about the adapter itself, such as the number of
+	// backend calls it makes or their latency. These are exported along with the
+	// mixer's own metrics, as opposed to the metrics an adapter reports on behalf
+	// of the services the mixer fronts.
+	//
+	// Metric names are namespaced by the name of the adapter. Registering the same
+	// metric again, for example from another instance of the same aspect, returns
+	// the metric registered first as long as the help text and labels match.
+	Monitor interface {
+		// Counter registers a counter with the given label names.
+		Counter(name, help string, labelNames ...string) (MonitorCounter, error)
+
+		// Histogram registers a histogram with the given buckets and label names.
+		// Default buckets are used when buckets is empty.
+		Histogram(name, help string, buckets []float64, labelNames ...string) (MonitorHistogram, error)
+	}
+
+	// MonitorCounter is a metric whose value only ever goes up.
+	MonitorCounter interface {
+		// Add adds v, which must not be negative, to the counter with the given label values.
+		Add(v float64, labelValues ...string)
+	}
+
+	// MonitorHistogram is a metric counting observations in buckets.
+	MonitorHistogram interface {
+		// Observe records v in the histogram with the given label values.
+		Observe(v float64, labelValues ...string)
+	}
+)
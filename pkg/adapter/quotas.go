@@ -69,7 +69,8 @@ type (
 
 		// DeduplicationID is used for deduplicating quota allocation/free calls in the case of
 		// failed RPCs and retries. This should be a UUID per call, where the same
-		// UUID is used for retries of the same quota allocation or release call.
+		// UUID is used for retries of the same quota allocation or release call. Calls
+		// with an empty ID are not deduplicated.
 		DeduplicationID string
 
 		// The amount of quota being allocated or released.
@@ -86,5 +87,16 @@ type (
 
 		// The total amount of quota returned, may be less than requested.
 		Amount int64
+
+		// The amount of quota left once the operation is done. Only meaningful when HasHints is true.
+		Remaining int64
+
+		// How long until the amount requested but not granted becomes available, 0 when it is not
+		// expected to free up by itself. Only meaningful when HasHints is true.
+		RetryAfter time.Duration
+
+		// HasHints is true when the adapter supplied Remaining and RetryAfter. Adapters that can't
+		// tell leave it unset.
+		HasHints bool
 	}
 )
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"sync"
 	"testing"
+	"time"
 
 	"istio.io/mixer/pkg/adapter"
 )
@@ -50,6 +51,21 @@ func (e *Env) ScheduleDaemon(fn adapter.DaemonFunc) {
 	go fn()
 }
 
+// CallTimeout returns 0, calls are not bounded.
+func (e *Env) CallTimeout() time.Duration {
+	return 0
+}
+
+// Recovering returns false.
+func (e *Env) Recovering() bool {
+	return false
+}
+
+// Monitor returns a monitor whose metrics are discarded.
+func (e *Env) Monitor() adapter.Monitor {
+	return adapter.NopMonitor{}
+}
+
 // Infof logs the provided message.
 func (e *Env) Infof(format string, args ...interface{}) {
 	e.log(format, args...)
@@ -0,0 +1,318 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapterManager
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	rpc "github.com/googleapis/googleapis/google/rpc"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"istio.io/mixer/pkg/monitoring"
+	"istio.io/mixer/pkg/status"
+)
+
+// BreakerConfig controls the circuit breakers the manager places around each cached executor.
+//
+// A breaker trips open when either threshold is crossed. While open, calls to the executor
+// are short-circuited and answered with FallbackStatus. Once OpenTimeout has elapsed the
+// breaker lets a limited number of probe calls through; if they all succeed the breaker
+// closes again, otherwise it goes back to being open.
+type BreakerConfig struct {
+	// ConsecutiveFailures trips the breaker after this many back-to-back failures. 0 disables the check.
+	ConsecutiveFailures int
+
+	// ErrorRate trips the breaker when the fraction of failed calls within Window reaches
+	// this value. 0 disables the check.
+	ErrorRate float64
+
+	// MinRequests is the number of calls that must be seen within Window before ErrorRate is considered.
+	MinRequests int
+
+	// Window is the interval over which the error rate is computed.
+	Window time.Duration
+
+	// OpenTimeout is how long the breaker stays open before letting probe calls through.
+	OpenTimeout time.Duration
+
+	// HalfOpenProbes is the number of successful probe calls needed to close the breaker.
+	// It must be at least 1, lower values are treated as 1.
+	HalfOpenProbes int
+
+	// FallbackStatus is returned for calls rejected by an open breaker. An empty message is
+	// replaced by one naming the adapter. Use a code of rpc.OK to fail open, in which case
+	// quota requests are granted the amount they ask for.
+	FallbackStatus rpc.Status
+}
+
+// DefaultBreakerConfig returns the breaker settings used when nothing else is specified.
+func DefaultBreakerConfig() BreakerConfig {
+	return BreakerConfig{
+		ConsecutiveFailures: 5,
+		ErrorRate:           0.5,
+		MinRequests:         20,
+		Window:              10 * time.Second,
+		OpenTimeout:         5 * time.Second,
+		HalfOpenProbes:      1,
+		FallbackStatus:      status.New(rpc.UNAVAILABLE),
+	}
+}
+
+func (c *BreakerConfig) enabled() bool {
+	return c.ConsecutiveFailures > 0 || c.ErrorRate > 0
+}
+
+// probes returns the number of successful probe calls needed to close the breaker.
+func (c *BreakerConfig) probes() int {
+	if c.HalfOpenProbes < 1 {
+		return 1
+	}
+	return c.HalfOpenProbes
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerClosed:
+		return "closed"
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("breakerState(%d)", int(s))
+}
+
+var (
+	breakerTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mixer_adapter_breaker_transitions_total",
+		Help: "Number of circuit breaker state transitions, by the state entered.",
+	}, []string{"adapter", "kind", "state"})
+
+	breakerRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mixer_adapter_breaker_rejections_total",
+		Help: "Number of adapter calls short-circuited by a circuit breaker.",
+	}, []string{"adapter", "kind"})
+
+	breakersTripped = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mixer_adapter_breakers_tripped",
+		Help: "Number of circuit breakers currently open or half-open.",
+	}, []string{"adapter", "kind"})
+)
+
+func init() {
+	monitoring.MustRegister(breakerTransitions, breakerRejections, breakersTripped)
+}
+
+// breaker is a circuit breaker guarding a single executor.
+//
+// A nil *breaker admits every call, which is what the manager uses when breakers are disabled.
+type breaker struct {
+	adapter string
+	kind    string
+	cfg     *BreakerConfig
+	now     func() time.Time
+
+	sync.Mutex          // guards the fields below
+	state               breakerState
+	consecutiveFailures int
+	windowStart         time.Time
+	windowRequests      int
+	windowFailures      int
+	openedAt            time.Time
+	probesInFlight      int
+	probeSuccesses      int
+}
+
+func newBreaker(adapter, kind string, cfg *BreakerConfig) *breaker {
+	if !cfg.enabled() {
+		return nil
+	}
+	return &breaker{
+		adapter: adapter,
+		kind:    kind,
+		cfg:     cfg,
+		now:     time.Now,
+	}
+}
+
+// allow reports whether a call may proceed. probe is true when the call is a half-open
+// probe; it must be handed back to record along with the outcome of the call.
+func (b *breaker) allow() (probe bool, ok bool) {
+	if b == nil {
+		return false, true
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.cfg.OpenTimeout {
+			breakerRejections.WithLabelValues(b.adapter, b.kind).Inc()
+			return false, false
+		}
+		b.setState(breakerHalfOpen)
+		fallthrough
+
+	case breakerHalfOpen:
+		if b.probesInFlight >= b.cfg.probes() {
+			breakerRejections.WithLabelValues(b.adapter, b.kind).Inc()
+			return false, false
+		}
+		b.probesInFlight++
+		return true, true
+	}
+
+	return false, true
+}
+
+// record accounts for the outcome of a call previously admitted by allow.
+func (b *breaker) record(probe bool, failed bool) {
+	if b == nil {
+		return
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	if probe {
+		if b.state != breakerHalfOpen {
+			return
+		}
+
+		if b.probesInFlight > 0 {
+			b.probesInFlight--
+		}
+		if failed {
+			b.trip("half-open probe failed")
+			return
+		}
+
+		b.probeSuccesses++
+		if b.probeSuccesses >= b.cfg.probes() {
+			b.setState(breakerClosed)
+		}
+		return
+	}
+
+	if b.state != breakerClosed {
+		// the call was admitted before the breaker tripped, its outcome no longer matters
+		return
+	}
+
+	now := b.now()
+	if now.Sub(b.windowStart) >= b.cfg.Window {
+		b.windowStart = now
+		b.windowRequests = 0
+		b.windowFailures = 0
+	}
+
+	b.windowRequests++
+	if !failed {
+		b.consecutiveFailures = 0
+		return
+	}
+	b.consecutiveFailures++
+	b.windowFailures++
+
+	if b.cfg.ConsecutiveFailures > 0 && b.consecutiveFailures >= b.cfg.ConsecutiveFailures {
+		b.trip(fmt.Sprintf("%d consecutive failures", b.consecutiveFailures))
+		return
+	}
+
+	if b.cfg.ErrorRate > 0 && b.windowRequests >= b.cfg.MinRequests {
+		rate := float64(b.windowFailures) / float64(b.windowRequests)
+		if rate >= b.cfg.ErrorRate {
+			b.trip(fmt.Sprintf("error rate of %.2f over the last %d calls", rate, b.windowRequests))
+		}
+	}
+}
+
+// fallback returns the status handed out for calls rejected by the breaker.
+func (b *breaker) fallback() rpc.Status {
+	s := b.cfg.FallbackStatus
+	if s.Message == "" && !status.IsOK(s) {
+		s.Message = fmt.Sprintf("adapter '%s' is unavailable: circuit breaker is open", b.adapter)
+	}
+	return s
+}
+
+// trip opens the breaker. Must be called with the lock held.
+func (b *breaker) trip(reason string) {
+	glog.Warningf("Circuit breaker for %s adapter '%s' tripped open: %s", b.kind, b.adapter, reason)
+	b.openedAt = b.now()
+	b.setState(breakerOpen)
+}
+
+// currentState returns the state the breaker is in. A nil breaker is always closed.
+func (b *breaker) currentState() breakerState {
+	if b == nil {
+		return breakerClosed
+	}
+
+	b.Lock()
+	defer b.Unlock()
+	return b.state
+}
+
+// setState transitions the breaker and resets the counters of the state being entered.
+// Must be called with the lock held.
+func (b *breaker) setState(s breakerState) {
+	if b.state == s {
+		return
+	}
+
+	if b.state == breakerClosed {
+		breakersTripped.WithLabelValues(b.adapter, b.kind).Inc()
+	} else if s == breakerClosed {
+		breakersTripped.WithLabelValues(b.adapter, b.kind).Dec()
+		glog.Infof("Circuit breaker for %s adapter '%s' closed", b.kind, b.adapter)
+	}
+
+	if glog.V(2) {
+		glog.Infof("Circuit breaker for %s adapter '%s': %s -> %s", b.kind, b.adapter, b.state, s)
+	}
+
+	b.state = s
+	b.consecutiveFailures = 0
+	b.windowStart = time.Time{}
+	b.windowRequests = 0
+	b.windowFailures = 0
+	b.probesInFlight = 0
+	b.probeSuccesses = 0
+	breakerTransitions.WithLabelValues(b.adapter, b.kind, s.String()).Inc()
+}
+
+// isBackendFailure reports whether a status returned by an executor indicates a failing
+// adapter or backend, as opposed to a legitimate negative answer such as PERMISSION_DENIED
+// from a denials aspect or RESOURCE_EXHAUSTED from a quota.
+func isBackendFailure(s rpc.Status) bool {
+	switch rpc.Code(s.Code) {
+	case rpc.INTERNAL, rpc.UNKNOWN, rpc.UNAVAILABLE, rpc.DEADLINE_EXCEEDED:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,286 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapterManager
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	rpc "github.com/googleapis/googleapis/google/rpc"
+
+	"istio.io/mixer/pkg/aspect"
+	"istio.io/mixer/pkg/attribute"
+	"istio.io/mixer/pkg/config"
+	cpb "istio.io/mixer/pkg/config/proto"
+	"istio.io/mixer/pkg/pool"
+	"istio.io/mixer/pkg/status"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestBreaker(cfg BreakerConfig) (*breaker, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	b := newBreaker("test", "test-kind", &cfg)
+	b.now = clock.now
+	return b, clock
+}
+
+// call runs a single call through the breaker, returning whether it was admitted.
+func call(b *breaker, failed bool) bool {
+	probe, ok := b.allow()
+	if ok {
+		b.record(probe, failed)
+	}
+	return ok
+}
+
+func TestBreaker_Trip(t *testing.T) {
+	cases := []struct {
+		name      string
+		cfg       BreakerConfig
+		calls     []bool // true == failed
+		wantState breakerState
+	}{
+		{"consecutive", BreakerConfig{ConsecutiveFailures: 3, OpenTimeout: time.Second, HalfOpenProbes: 1},
+			[]bool{true, true, true}, breakerOpen},
+		{"consecutive interrupted", BreakerConfig{ConsecutiveFailures: 3, OpenTimeout: time.Second, HalfOpenProbes: 1},
+			[]bool{true, true, false, true, true}, breakerClosed},
+		{"error rate", BreakerConfig{ErrorRate: 0.5, MinRequests: 4, Window: time.Minute, OpenTimeout: time.Second, HalfOpenProbes: 1},
+			[]bool{false, true, false, true}, breakerOpen},
+		{"error rate below min requests", BreakerConfig{ErrorRate: 0.5, MinRequests: 4, Window: time.Minute, OpenTimeout: time.Second, HalfOpenProbes: 1},
+			[]bool{true, true, true}, breakerClosed},
+		{"error rate below threshold", BreakerConfig{ErrorRate: 0.5, MinRequests: 4, Window: time.Minute, OpenTimeout: time.Second, HalfOpenProbes: 1},
+			[]bool{true, false, false, false, true}, breakerClosed},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			b, _ := newTestBreaker(c.cfg)
+			for _, failed := range c.calls {
+				call(b, failed)
+			}
+			if b.state != c.wantState {
+				t.Errorf("state = %v, wanted %v", b.state, c.wantState)
+			}
+		})
+	}
+}
+
+func TestBreaker_Window(t *testing.T) {
+	b, clock := newTestBreaker(BreakerConfig{ErrorRate: 0.5, MinRequests: 2, Window: time.Second, OpenTimeout: time.Second, HalfOpenProbes: 1})
+
+	call(b, true)
+	clock.advance(2 * time.Second)
+	call(b, false)
+	call(b, false)
+	call(b, true)
+	if b.state != breakerClosed {
+		t.Errorf("state = %v, wanted failures from a previous window to be forgotten", b.state)
+	}
+}
+
+func TestBreaker_Recovery(t *testing.T) {
+	cases := []struct {
+		name       string
+		probes     int
+		probeFails bool
+		wantState  breakerState
+	}{
+		{"probe succeeds", 1, false, breakerClosed},
+		{"probe fails", 1, true, breakerOpen},
+		{"no probes configured", 0, false, breakerClosed},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			b, clock := newTestBreaker(BreakerConfig{ConsecutiveFailures: 1, OpenTimeout: time.Second, HalfOpenProbes: c.probes})
+			call(b, true)
+
+			if call(b, false) {
+				t.Fatal("open breaker admitted a call")
+			}
+
+			clock.advance(time.Second)
+			probe, ok := b.allow()
+			if !ok || !probe {
+				t.Fatalf("allow() = %v, %v; wanted a probe after the open timeout", probe, ok)
+			}
+			if b.state != breakerHalfOpen {
+				t.Errorf("state = %v, wanted %v", b.state, breakerHalfOpen)
+			}
+
+			// only a single probe is allowed in flight
+			if call(b, false) {
+				t.Error("half-open breaker admitted more than the configured number of probes")
+			}
+
+			b.record(probe, c.probeFails)
+			if b.state != c.wantState {
+				t.Errorf("state = %v, wanted %v", b.state, c.wantState)
+			}
+		})
+	}
+}
+
+func TestBreaker_StaleRecord(t *testing.T) {
+	b, _ := newTestBreaker(BreakerConfig{ConsecutiveFailures: 1, OpenTimeout: time.Second, HalfOpenProbes: 1})
+
+	probe, _ := b.allow()
+	call(b, true)
+
+	// the outcome of a call admitted before the breaker tripped must not affect it
+	b.record(probe, false)
+	if b.state != breakerOpen {
+		t.Errorf("state = %v, wanted %v", b.state, breakerOpen)
+	}
+}
+
+func TestBreaker_Disabled(t *testing.T) {
+	cfg := BreakerConfig{}
+	b := newBreaker("test", "test-kind", &cfg)
+	if b != nil {
+		t.Fatalf("newBreaker() = %v, wanted nil for a config with no thresholds", b)
+	}
+	for i := 0; i < 10; i++ {
+		if !call(b, true) {
+			t.Fatal("nil breaker rejected a call")
+		}
+	}
+}
+
+func TestBreaker_Fallback(t *testing.T) {
+	cases := []struct {
+		in      rpc.Status
+		want    rpc.Code
+		wantMsg string
+	}{
+		{status.New(rpc.UNAVAILABLE), rpc.UNAVAILABLE, "circuit breaker is open"},
+		{status.WithMessage(rpc.UNAVAILABLE, "go away"), rpc.UNAVAILABLE, "go away"},
+		{status.OK, rpc.OK, ""},
+	}
+
+	for _, c := range cases {
+		b, _ := newTestBreaker(BreakerConfig{ConsecutiveFailures: 1, FallbackStatus: c.in})
+		out := b.fallback()
+		if out.Code != int32(c.want) || !strings.Contains(out.Message, c.wantMsg) {
+			t.Errorf("fallback() = %v, wanted code %v with message containing '%s'", out, c.want, c.wantMsg)
+		}
+	}
+}
+
+func TestIsBackendFailure(t *testing.T) {
+	cases := []struct {
+		code rpc.Code
+		want bool
+	}{
+		{rpc.OK, false},
+		{rpc.PERMISSION_DENIED, false},
+		{rpc.RESOURCE_EXHAUSTED, false},
+		{rpc.INVALID_ARGUMENT, false},
+		{rpc.INTERNAL, true},
+		{rpc.UNKNOWN, true},
+		{rpc.UNAVAILABLE, true},
+		{rpc.DEADLINE_EXCEEDED, true},
+	}
+
+	for _, c := range cases {
+		if got := isBackendFailure(status.New(c.code)); got != c.want {
+			t.Errorf("isBackendFailure(%v) = %v, wanted %v", c.code, got, c.want)
+		}
+	}
+}
+
+func TestManager_Breaker(t *testing.T) {
+	calls := 0
+	mngr := newTestManager("failing", false, func() rpc.Status {
+		calls++
+		return status.WithError(errors.New("backend down"))
+	})
+	mreg := [config.NumKinds]aspect.Manager{}
+	mreg[config.DenialsKind] = mngr
+	breg := &fakeBuilderReg{
+		adp:   mngr.instance,
+		found: true,
+	}
+
+	gp := pool.NewGoroutinePool(1, true)
+	agp := pool.NewGoroutinePool(1, true)
+	m := newManager(breg, mreg, nil, aspect.ManagerInventory{}, gp, agp)
+	m.breakerCfg = BreakerConfig{ConsecutiveFailures: 2, OpenTimeout: time.Hour, HalfOpenProbes: 1, FallbackStatus: status.New(rpc.UNAVAILABLE)}
+
+	cfg := []*cpb.Combined{
+		{Builder: &cpb.Adapter{Name: "failing"}, Aspect: &cpb.Aspect{Kind: config.DenialsKindName}},
+	}
+	_ = m.ConfigChange(&fakeResolver{cfg, nil}, nil)
+
+	for i := 0; i < 2; i++ {
+		if out := m.Check(context.Background(), nil, nil); out.Code != int32(rpc.INTERNAL) {
+			t.Errorf("Check() = %v, wanted the adapter's error", out)
+		}
+	}
+
+	out := m.Check(context.Background(), nil, nil)
+	if out.Code != int32(rpc.UNAVAILABLE) || !strings.Contains(out.Message, "circuit breaker") {
+		t.Errorf("Check() = %v, wanted UNAVAILABLE from the open breaker", out)
+	}
+	if calls != 2 {
+		t.Errorf("adapter was called %d times, wanted 2", calls)
+	}
+
+	gp.Close()
+	agp.Close()
+}
+
+func TestManager_BreakerFailOpenQuota(t *testing.T) {
+	r := getReg(true)
+	gp := pool.NewGoroutinePool(1, true)
+	agp := pool.NewGoroutinePool(1, true)
+	qe := &fakeQuotaExecutor{result: aspect.QuotaMethodResp{Amount: 42}}
+	mgrs := newFakeMgrReg(nil, nil, nil, qe)
+
+	m := newManager(r, mgrs, &fakeEvaluator{}, aspect.ManagerInventory{}, gp, agp)
+	m.breakerCfg = BreakerConfig{ConsecutiveFailures: 1, OpenTimeout: time.Hour, HalfOpenProbes: 1, FallbackStatus: status.OK}
+
+	cfg := []*cpb.Combined{
+		{Aspect: &cpb.Aspect{Kind: config.QuotasKindName}, Builder: &cpb.Adapter{Name: "Foo"}},
+	}
+	_ = m.ConfigChange(&fakeResolver{cfg, nil}, nil)
+
+	qe.broken = true
+	qma := &aspect.QuotaMethodArgs{Quota: "q", Amount: 7}
+	_, _ = m.Quota(context.Background(), attribute.GetMutableBag(nil), attribute.GetMutableBag(nil), qma)
+
+	qmr, out := m.Quota(context.Background(), attribute.GetMutableBag(nil), attribute.GetMutableBag(nil), qma)
+	if !status.IsOK(out) {
+		t.Fatalf("Quota() = %v, wanted the breaker to fail open", out)
+	}
+	if qmr == nil || qmr.Amount != qma.Amount {
+		t.Errorf("Quota() = %v, wanted the requested amount of %d to be granted", qmr, qma.Amount)
+	}
+	if qe.called != 1 {
+		t.Errorf("Executor invoked %d times, wanted once", qe.called)
+	}
+
+	gp.Close()
+	agp.Close()
+}
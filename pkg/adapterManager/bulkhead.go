@@ -0,0 +1,165 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapterManager
+
+import (
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	cpb "istio.io/mixer/pkg/config/proto"
+	"istio.io/mixer/pkg/monitoring"
+	"istio.io/mixer/pkg/pool"
+)
+
+var (
+	adapterInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mixer_adapter_in_flight",
+		Help: "Number of calls running or queued on adapters with concurrency limits, by adapter.",
+	}, []string{"adapter"})
+
+	adapterRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mixer_adapter_rejected_total",
+		Help: "Number of calls turned away by adapter concurrency limits, by adapter.",
+	}, []string{"adapter"})
+)
+
+func init() {
+	monitoring.MustRegister(adapterInFlight, adapterRejected)
+}
+
+// bulkheadKey identifies an adapter of the global config. Adapter names are only unique per implementation.
+type bulkheadKey struct {
+	impl string
+	name string
+}
+
+func bulkheadKeyOf(a *cpb.Adapter) bulkheadKey {
+	return bulkheadKey{impl: a.GetImpl(), name: a.GetName()}
+}
+
+func (k bulkheadKey) String() string {
+	return k.impl + "/" + k.name
+}
+
+// bulkhead bounds the calls in flight to a single adapter, and optionally runs them on a pool
+// of their own, so that a slow adapter doesn't starve the aspects of the others.
+//
+// Calls beyond the limits are rejected right away instead of waiting for the adapter, since
+// waiting would tie up a worker of the shared pool. A nil bulkhead imposes no limit.
+type bulkhead struct {
+	key   bulkheadKey
+	label string
+	cfg   cpb.AdapterConcurrency
+
+	// dedicated pool, nil to use the shared API pool
+	gp *pool.GoroutinePool
+
+	// max # of calls running or queued, 0 for no limit
+	limit    int32
+	inFlight int32
+
+	// # of generations holding the bulkhead
+	owners int32
+}
+
+func newBulkhead(key bulkheadKey, cfg *cpb.AdapterConcurrency, singleThreaded bool) *bulkhead {
+	b := &bulkhead{
+		key:    key,
+		label:  key.String(),
+		cfg:    *cfg,
+		limit:  cfg.MaxConcurrent,
+		owners: 1,
+	}
+	if cfg.PoolSize > 0 {
+		// the limit keeps the pool's queue from filling up, so scheduling onto it never blocks
+		capacity := cfg.PoolSize + cfg.QueueDepth
+		if b.limit == 0 || b.limit > capacity {
+			b.limit = capacity
+		}
+		b.gp = pool.NewNamedGoroutinePool("adapter:"+b.label, int(capacity), singleThreaded)
+		b.gp.AddWorkers(int(cfg.PoolSize) - 1) // the pool starts with one worker
+	}
+	return b
+}
+
+// enter admits a call to the adapter, unless it would exceed the concurrency limit or the
+// queue of the dedicated pool. Every admitted call must be followed by a call to leave.
+func (b *bulkhead) enter() bool {
+	if b == nil {
+		return true
+	}
+
+	if n := atomic.AddInt32(&b.inFlight, 1); b.limit > 0 && n > b.limit {
+		atomic.AddInt32(&b.inFlight, -1)
+		adapterRejected.WithLabelValues(b.label).Inc()
+		return false
+	}
+	adapterInFlight.WithLabelValues(b.label).Inc()
+	return true
+}
+
+// leave records the completion of a call admitted by enter.
+func (b *bulkhead) leave() {
+	if b == nil {
+		return
+	}
+	atomic.AddInt32(&b.inFlight, -1)
+	adapterInFlight.WithLabelValues(b.label).Dec()
+}
+
+// dedicated returns true if the calls to the adapter run on a pool of their own.
+func (b *bulkhead) dedicated() bool {
+	return b != nil && b.gp != nil
+}
+
+// close releases the dedicated pool once no call is running on it anymore.
+func (b *bulkhead) close() {
+	if b.gp != nil {
+		b.gp.Close()
+	}
+}
+
+// newBulkheads returns the bulkheads of the adapters the given configs refer to, taking over the
+// ones of prev whose limits haven't changed.
+func newBulkheads(cfgs []*cpb.Combined, prev map[bulkheadKey]*bulkhead, singleThreaded bool) map[bulkheadKey]*bulkhead {
+	bulkheads := make(map[bulkheadKey]*bulkhead)
+	for _, cfg := range cfgs {
+		// fallbacks run under the limits of their own adapter
+		addBulkhead(bulkheads, cfg.Builder, prev, singleThreaded)
+		for _, fb := range cfg.Fallbacks {
+			addBulkhead(bulkheads, fb, prev, singleThreaded)
+		}
+	}
+	return bulkheads
+}
+
+// addBulkhead adds the bulkhead of adapter a to bulkheads, if it has concurrency limits.
+func addBulkhead(bulkheads map[bulkheadKey]*bulkhead, a *cpb.Adapter, prev map[bulkheadKey]*bulkhead, singleThreaded bool) {
+	c := a.GetConcurrency()
+	if c == nil || (c.MaxConcurrent == 0 && c.PoolSize == 0) {
+		return
+	}
+	key := bulkheadKeyOf(a)
+	if _, dup := bulkheads[key]; dup {
+		return
+	}
+	if b, carried := prev[key]; carried && b.cfg == *c {
+		atomic.AddInt32(&b.owners, 1)
+		bulkheads[key] = b
+		return
+	}
+	bulkheads[key] = newBulkhead(key, c, singleThreaded)
+}
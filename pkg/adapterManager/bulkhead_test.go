@@ -0,0 +1,269 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapterManager
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	rpc "github.com/googleapis/googleapis/google/rpc"
+
+	"istio.io/mixer/pkg/aspect"
+	"istio.io/mixer/pkg/attribute"
+	"istio.io/mixer/pkg/config"
+	cpb "istio.io/mixer/pkg/config/proto"
+	"istio.io/mixer/pkg/expr"
+	"istio.io/mixer/pkg/pool"
+	"istio.io/mixer/pkg/status"
+)
+
+func TestBulkhead_Enter(t *testing.T) {
+	var unlimited *bulkhead
+	if !unlimited.enter() {
+		t.Error("nil bulkhead rejected a call")
+	}
+	unlimited.leave()
+
+	b := newBulkhead(bulkheadKey{"impl", "name"}, &cpb.AdapterConcurrency{MaxConcurrent: 2}, true)
+	if !b.enter() || !b.enter() {
+		t.Fatal("bulkhead rejected calls below its limit")
+	}
+	if b.enter() {
+		t.Error("bulkhead admitted a call beyond its limit")
+	}
+	b.leave()
+	if !b.enter() {
+		t.Error("bulkhead rejected a call after another one left")
+	}
+	if b.dedicated() {
+		t.Error("bulkhead without a pool size has a dedicated pool")
+	}
+
+	cases := []struct {
+		cfg  cpb.AdapterConcurrency
+		want int32
+	}{
+		{cpb.AdapterConcurrency{PoolSize: 2}, 2},
+		{cpb.AdapterConcurrency{PoolSize: 2, QueueDepth: 3}, 5},
+		{cpb.AdapterConcurrency{PoolSize: 2, QueueDepth: 3, MaxConcurrent: 4}, 4},
+		{cpb.AdapterConcurrency{PoolSize: 2, MaxConcurrent: 4}, 2},
+	}
+	for _, c := range cases {
+		d := newBulkhead(bulkheadKey{"impl", "name"}, &c.cfg, true)
+		if !d.dedicated() || d.limit != c.want {
+			t.Errorf("newBulkhead(%v) has a limit of %d, want %d on a dedicated pool", c.cfg, d.limit, c.want)
+		}
+		d.close()
+	}
+}
+
+func TestNewBulkheads(t *testing.T) {
+	adapterWith := func(name string, c *cpb.AdapterConcurrency) *cpb.Combined {
+		return &cpb.Combined{Builder: &cpb.Adapter{Name: name, Impl: "impl", Concurrency: c}, Aspect: &cpb.Aspect{}}
+	}
+
+	prev := newBulkheads([]*cpb.Combined{
+		adapterWith("a", &cpb.AdapterConcurrency{MaxConcurrent: 1}),
+		adapterWith("b", &cpb.AdapterConcurrency{MaxConcurrent: 1}),
+		adapterWith("b", &cpb.AdapterConcurrency{MaxConcurrent: 1}),
+		adapterWith("c", nil),
+		adapterWith("d", &cpb.AdapterConcurrency{}),
+		{
+			Builder:   &cpb.Adapter{Name: "c", Impl: "impl"},
+			Aspect:    &cpb.Aspect{},
+			Fallbacks: []*cpb.Adapter{{Name: "e", Impl: "impl", Concurrency: &cpb.AdapterConcurrency{MaxConcurrent: 1}}},
+		},
+	}, nil, true)
+	if len(prev) != 3 || prev[bulkheadKey{"impl", "e"}] == nil {
+		t.Fatalf("newBulkheads() = %v, want bulkheads for a, b and the fallback e only", prev)
+	}
+
+	next := newBulkheads([]*cpb.Combined{
+		adapterWith("a", &cpb.AdapterConcurrency{MaxConcurrent: 1}),
+		adapterWith("b", &cpb.AdapterConcurrency{MaxConcurrent: 2}),
+	}, prev, true)
+
+	a, b := bulkheadKey{"impl", "a"}, bulkheadKey{"impl", "b"}
+	if next[a] != prev[a] || next[a].owners != 2 {
+		t.Errorf("bulkhead of a wasn't carried over: %+v", next[a])
+	}
+	if next[b] == prev[b] || next[b].cfg.MaxConcurrent != 2 {
+		t.Errorf("bulkhead of b wasn't replaced: %+v", next[b])
+	}
+}
+
+// blockingReportExecutor blocks until unblock is closed.
+type blockingReportExecutor struct {
+	started chan struct{}
+	unblock chan struct{}
+}
+
+func (e *blockingReportExecutor) Execute(context.Context, attribute.Bag, expr.Evaluator) rpc.Status {
+	e.started <- struct{}{}
+	<-e.unblock
+	return status.OK
+}
+func (*blockingReportExecutor) Close() error { return nil }
+
+func TestManager_Bulkhead(t *testing.T) {
+	cases := []struct {
+		name        string
+		concurrency *cpb.AdapterConcurrency
+		wantMsg     string
+	}{
+		{"concurrency", &cpb.AdapterConcurrency{MaxConcurrent: 1}, "concurrency limit"},
+		{"dedicated pool", &cpb.AdapterConcurrency{PoolSize: 1}, "concurrency limit"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			re := &blockingReportExecutor{started: make(chan struct{}, 1), unblock: make(chan struct{})}
+			gp := pool.NewGoroutinePool(4, false)
+			gp.AddWorkers(3)
+			agp := pool.NewGoroutinePool(1, true)
+			mgrs := newFakeMgrReg(nil, nil, nil, nil)
+			mgrs[config.AccessLogsKind] = &fakeReportAspectMgr{kind: config.AccessLogsKind, re: re}
+			m := newManager(getReg(true), mgrs, &fakeEvaluator{}, aspect.ManagerInventory{}, gp, agp)
+
+			cfg := accessLogsConfig(0)
+			cfg.Builder.Concurrency = c.concurrency
+			_ = m.ConfigChange(&fakeResolver{[]*cpb.Combined{cfg}, nil}, nil)
+
+			first := make(chan rpc.Status)
+			go func() { first <- report(m) }()
+			<-re.started
+
+			if out := report(m); out.Code != int32(rpc.UNAVAILABLE) || !strings.Contains(out.Message, c.wantMsg) {
+				t.Errorf("Report() = %v while the adapter is busy, want UNAVAILABLE with '%s'", out, c.wantMsg)
+			}
+
+			close(re.unblock)
+			if out := <-first; !status.IsOK(out) {
+				t.Errorf("Report() = %v, want OK", out)
+			}
+
+			g := m.acquire()
+			b := g.bulkheads[bulkheadKeyOf(cfg.Builder)]
+			m.release(g)
+			if n := atomic.LoadInt32(&b.inFlight); n != 0 {
+				t.Errorf("%d calls in flight once the adapter is idle again, want 0", n)
+			}
+
+			_ = m.Close()
+			m.draining.Wait()
+			if b.owners != 0 {
+				t.Errorf("bulkhead still has %d owners after Close()", b.owners)
+			}
+
+			gp.Close()
+			agp.Close()
+		})
+	}
+}
+
+func TestManager_BulkheadFallback(t *testing.T) {
+	mgr := &orderedCheckMgr{bodies: map[string]rpc.Status{"a": status.OK, "b": status.OK}}
+	mreg := [config.NumKinds]aspect.Manager{}
+	mreg[config.DenialsKind] = mgr
+	breg := &fakeBuilderReg{adp: mgr.instance, found: true}
+
+	gp := pool.NewGoroutinePool(1, true)
+	agp := pool.NewGoroutinePool(1, true)
+	defer gp.Close()
+	defer agp.Close()
+	m := newManager(breg, mreg, nil, aspect.ManagerInventory{}, gp, agp)
+
+	cfg := &cpb.Combined{
+		Builder:   &cpb.Adapter{Name: "a", Impl: "a", Concurrency: &cpb.AdapterConcurrency{MaxConcurrent: 1}},
+		Aspect:    &cpb.Aspect{Kind: config.DenialsKindName},
+		Fallbacks: []*cpb.Adapter{{Name: "b", Impl: "b"}},
+	}
+	_ = m.ConfigChange(&fakeResolver{[]*cpb.Combined{cfg}, nil}, nil)
+
+	// a is busy with another call
+	g := m.acquire()
+	b := g.bulkheads[bulkheadKeyOf(cfg.Builder)]
+	m.release(g)
+	b.enter()
+	defer b.leave()
+
+	before := fallbackCount(config.DenialsKindName, "a/a", "b/b")
+	out := m.Check(context.Background(), attribute.GetMutableBag(nil), attribute.GetMutableBag(nil))
+	if !status.IsOK(out) {
+		t.Errorf("Check() = %v, want the fallback to serve the aspect", out)
+	}
+	if strings.Join(mgr.calls, ",") != "b" {
+		t.Errorf("executors called: %v, wanted only the fallback", mgr.calls)
+	}
+	if got := fallbackCount(config.DenialsKindName, "a/a", "b/b") - before; got != 1 {
+		t.Errorf("%d fallbacks to b counted, wanted 1", int(got))
+	}
+}
+
+func TestManager_FallbackPool(t *testing.T) {
+	mgr := &orderedCheckMgr{bodies: map[string]rpc.Status{"a": status.WithUnavailable("down"), "b": status.OK}}
+	mreg := [config.NumKinds]aspect.Manager{}
+	mreg[config.DenialsKind] = mgr
+	breg := &fakeBuilderReg{adp: mgr.instance, found: true}
+
+	gp := pool.NewGoroutinePool(4, false)
+	gp.AddWorkers(1)
+	agp := pool.NewGoroutinePool(1, true)
+	defer gp.Close()
+	defer agp.Close()
+	m := newManager(breg, mreg, nil, aspect.ManagerInventory{}, gp, agp)
+
+	fallback := &cpb.Adapter{Name: "b", Impl: "b", Concurrency: &cpb.AdapterConcurrency{PoolSize: 1, QueueDepth: 1}}
+	cfg := &cpb.Combined{
+		Builder:   &cpb.Adapter{Name: "a", Impl: "a"},
+		Aspect:    &cpb.Aspect{Kind: config.DenialsKindName},
+		Fallbacks: []*cpb.Adapter{fallback},
+	}
+	_ = m.ConfigChange(&fakeResolver{[]*cpb.Combined{cfg}, nil}, nil)
+
+	// the only worker of b's pool is busy
+	g := m.acquire()
+	b := g.bulkheads[bulkheadKeyOf(fallback)]
+	m.release(g)
+	started, unblock := make(chan struct{}), make(chan struct{})
+	b.gp.ScheduleWork(func() {
+		close(started)
+		<-unblock
+	})
+	<-started
+
+	// so the fallback waits for it rather than run on the worker of a
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if out := m.Check(ctx, attribute.GetMutableBag(nil), attribute.GetMutableBag(nil)); out.Code != int32(rpc.DEADLINE_EXCEEDED) {
+		t.Errorf("Check() = %v, want DEADLINE_EXCEEDED while the pool of the fallback is busy", out)
+	}
+
+	close(unblock)
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&b.inFlight) != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	mgr.lock.Lock()
+	calls := strings.Join(mgr.calls, ",")
+	mgr.lock.Unlock()
+	if calls != "a,b" {
+		t.Errorf("executors called: %s, wanted the fallback to run once its pool was free", calls)
+	}
+	_ = m.Close()
+}
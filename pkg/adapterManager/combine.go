@@ -0,0 +1,203 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapterManager
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gogo/protobuf/types"
+	"github.com/golang/glog"
+	rpc "github.com/googleapis/googleapis/google/rpc"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"istio.io/mixer/pkg/attribute"
+	cpb "istio.io/mixer/pkg/config/proto"
+	"istio.io/mixer/pkg/monitoring"
+	"istio.io/mixer/pkg/status"
+)
+
+// result holds the values returned by the execution of an adapter
+type result struct {
+	index       int // position of cfg in the dispatched configs
+	cfg         *cpb.Combined
+	status      rpc.Status
+	responseBag *attribute.MutableBag
+}
+
+// ok returns true if the result doesn't fail the request, which is also the case
+// for any result returned by a shadow aspect.
+func (r result) ok() bool {
+	return status.IsOK(r.status) || r.cfg.Aspect.GetShadow()
+}
+
+// severity ranks codes for the MOST_SEVERE policy, higher is more severe. Failures of
+// the mixer or its backends outrank answers about the request itself. Codes not listed
+// here rank lowest.
+var severity = map[rpc.Code]int{
+	rpc.CANCELLED:           1,
+	rpc.ALREADY_EXISTS:      2,
+	rpc.NOT_FOUND:           3,
+	rpc.OUT_OF_RANGE:        4,
+	rpc.INVALID_ARGUMENT:    5,
+	rpc.ABORTED:             6,
+	rpc.FAILED_PRECONDITION: 7,
+	rpc.RESOURCE_EXHAUSTED:  8,
+	rpc.PERMISSION_DENIED:   9,
+	rpc.UNAUTHENTICATED:     10,
+	rpc.UNIMPLEMENTED:       11,
+	rpc.DEADLINE_EXCEEDED:   12,
+	rpc.UNAVAILABLE:         13,
+	rpc.UNKNOWN:             14,
+	rpc.INTERNAL:            15,
+	rpc.DATA_LOSS:           16,
+}
+
+// combineResults turns a bunch of distinct results into one single rpc.Status, according to the policy.
+//
+// The status of each failed aspect is attached to the output as a detail, the output message
+// itself is kept short and doesn't expose any config.
+func combineResults(results []result, policy *cpb.ResultPolicy) rpc.Status {
+	var selected *result
+	var details []*types.Any
+
+	for i := range results {
+		r := &results[i]
+		if status.IsOK(r.status) {
+			continue
+		}
+
+		if r.cfg.Aspect.GetShadow() {
+			// shadow aspects never fail the request, we only record what would have happened
+			shadowFailure(*r)
+			continue
+		}
+
+		if selected == nil ||
+			(policy.GetCombine() == cpb.ResultPolicy_MOST_SEVERE &&
+				severity[rpc.Code(r.status.Code)] > severity[rpc.Code(selected.status.Code)]) {
+			selected = r
+		}
+
+		if glog.V(2) {
+			glog.Infof("Aspect %s of adapter %s failed with %v: %s", r.cfg.Aspect.GetKind(), r.cfg.Builder.GetName(),
+				rpc.Code(r.status.Code), r.status.Message)
+		}
+		if d := aspectDetail(*r); d != nil {
+			details = append(details, d)
+		}
+	}
+
+	if selected == nil {
+		return status.OK
+	}
+
+	msg := policy.GetMessage()
+	if msg == "" {
+		msg = selected.status.Message
+	}
+
+	s := status.WithMessage(rpc.Code(selected.status.Code), msg)
+	s.Details = details
+	return s
+}
+
+// aspectDetail describes the outcome of an individual aspect as a google.rpc.Status, whose
+// own details identify the kind of the aspect with a google.rpc.ResourceInfo. The details go
+// to clients, the adapter that served the aspect is config they have no business knowing:
+// it is only logged, and recorded in the metrics.
+func aspectDetail(r result) *types.Any {
+	ri := &rpc.ResourceInfo{
+		ResourceType: r.cfg.Aspect.GetKind(),
+	}
+
+	s := r.status
+	if any, err := types.MarshalAny(ri); err == nil {
+		s.Details = append(s.Details[:len(s.Details):len(s.Details)], any)
+	}
+
+	any, err := types.MarshalAny(&s)
+	if err != nil {
+		glog.Warningf("Unable to marshal the status of aspect %s: %v", r.cfg, err)
+		return nil
+	}
+	return any
+}
+
+var shadowFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "mixer_shadow_aspect_failures_total",
+	Help: "Number of failures returned by aspects running in shadow mode, which were not enforced.",
+}, []string{"kind", "adapter", "code"})
+
+func init() {
+	monitoring.MustRegister(shadowFailures)
+}
+
+// shadowLogInterval is the shortest time between two warnings about the failures of the same shadow aspect.
+const shadowLogInterval = time.Minute
+
+var shadowLog = newLogLimiter(shadowLogInterval)
+
+// shadowFailure logs and counts a failure returned by an aspect that is not being enforced.
+func shadowFailure(r result) {
+	code := rpc.Code(r.status.Code)
+	kind, adapter := r.cfg.Aspect.GetKind(), r.cfg.Builder.GetName()
+	shadowFailures.WithLabelValues(kind, adapter, code.String()).Inc()
+
+	if ok, suppressed := shadowLog.allow(kind+"/"+adapter, time.Now()); ok {
+		glog.Warningf("Shadow aspect %s would have failed the request with %v: %s (%d more failure(s) since the last warning)",
+			r.cfg, code, r.status.Message, suppressed)
+	} else if glog.V(2) {
+		glog.Infof("Shadow aspect %s would have failed the request with %v: %s", r.cfg, code, r.status.Message)
+	}
+}
+
+// logLimiter lets a message be logged at most once per interval for each key.
+type logLimiter struct {
+	interval time.Duration
+
+	lock    sync.Mutex
+	entries map[string]*logLimiterEntry
+}
+
+type logLimiterEntry struct {
+	last       time.Time
+	suppressed int
+}
+
+func newLogLimiter(interval time.Duration) *logLimiter {
+	return &logLimiter{interval: interval, entries: make(map[string]*logLimiterEntry)}
+}
+
+// allow reports whether the message for key may be logged at now, along with the number
+// of messages for key that were not allowed since the last one that was.
+func (l *logLimiter) allow(key string, now time.Time) (bool, int) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	e := l.entries[key]
+	if e == nil {
+		l.entries[key] = &logLimiterEntry{last: now}
+		return true, 0
+	}
+	if now.Sub(e.last) < l.interval {
+		e.suppressed++
+		return false, 0
+	}
+
+	suppressed := e.suppressed
+	e.last, e.suppressed = now, 0
+	return true, suppressed
+}
@@ -0,0 +1,134 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapterManager
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/types"
+	rpc "github.com/googleapis/googleapis/google/rpc"
+
+	cpb "istio.io/mixer/pkg/config/proto"
+	"istio.io/mixer/pkg/status"
+)
+
+func newResult(adapter string, shadow bool, s rpc.Status) result {
+	return result{
+		cfg: &cpb.Combined{
+			Builder: &cpb.Adapter{Name: adapter, Params: "secret"},
+			Aspect:  &cpb.Aspect{Kind: "denials", Shadow: shadow},
+		},
+		status: s,
+	}
+}
+
+func TestCombineResults(t *testing.T) {
+	internal := newResult("a", false, status.WithInternal("broken"))
+	denied := newResult("b", false, status.WithPermissionDenied("denied"))
+	exhausted := newResult("c", false, status.WithResourceExhausted("out of quota"))
+	ok := newResult("d", false, status.OK)
+	shadow := newResult("e", true, status.WithPermissionDenied("shadow denied"))
+
+	requireAll := &cpb.ResultPolicy{Combine: cpb.ResultPolicy_REQUIRE_ALL}
+	mostSevere := &cpb.ResultPolicy{Combine: cpb.ResultPolicy_MOST_SEVERE}
+	withMessage := &cpb.ResultPolicy{Message: "request rejected"}
+
+	cases := []struct {
+		name        string
+		results     []result
+		policy      *cpb.ResultPolicy
+		wantCode    rpc.Code
+		wantMsg     string
+		wantDetails int
+	}{
+		{"empty", nil, nil, rpc.OK, "", 0},
+		{"all ok", []result{ok, ok}, nil, rpc.OK, "", 0},
+		{"shadow only", []result{ok, shadow}, nil, rpc.OK, "", 0},
+		{"first failure", []result{ok, denied, internal}, nil, rpc.PERMISSION_DENIED, "denied", 2},
+		{"require all", []result{ok, denied, internal}, requireAll, rpc.PERMISSION_DENIED, "denied", 2},
+		{"most severe", []result{exhausted, denied, internal}, mostSevere, rpc.INTERNAL, "broken", 3},
+		{"most severe ignores shadow", []result{exhausted, shadow}, mostSevere, rpc.RESOURCE_EXHAUSTED, "out of quota", 1},
+		{"configured message", []result{denied, exhausted}, withMessage, rpc.PERMISSION_DENIED, "request rejected", 2},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			out := combineResults(c.results, c.policy)
+			if out.Code != int32(c.wantCode) || out.Message != c.wantMsg {
+				t.Errorf("combineResults() = %v, wanted code %v and message '%s'", out, c.wantCode, c.wantMsg)
+			}
+			if len(out.Details) != c.wantDetails {
+				t.Errorf("got %d details, wanted %d", len(out.Details), c.wantDetails)
+			}
+			if strings.Contains(out.Message, "secret") {
+				t.Errorf("message '%s' leaks config", out.Message)
+			}
+		})
+	}
+}
+
+func TestCombineResults_Details(t *testing.T) {
+	out := combineResults([]result{newResult("a", false, status.WithPermissionDenied("denied"))}, nil)
+	if len(out.Details) != 1 {
+		t.Fatalf("got %d details, wanted 1", len(out.Details))
+	}
+
+	var s rpc.Status
+	if err := types.UnmarshalAny(out.Details[0], &s); err != nil {
+		t.Fatalf("detail is not a google.rpc.Status: %v", err)
+	}
+	if s.Code != int32(rpc.PERMISSION_DENIED) || s.Message != "denied" {
+		t.Errorf("detail = %v, wanted the aspect's status", s)
+	}
+	if len(s.Details) != 1 {
+		t.Fatalf("got %d nested details, wanted 1", len(s.Details))
+	}
+
+	var ri rpc.ResourceInfo
+	if err := types.UnmarshalAny(s.Details[0], &ri); err != nil {
+		t.Fatalf("nested detail is not a google.rpc.ResourceInfo: %v", err)
+	}
+	if ri.ResourceType != "denials" || ri.ResourceName != "" {
+		t.Errorf("resource info = %v, wanted denials without the name of the adapter", ri)
+	}
+}
+
+func TestLogLimiter(t *testing.T) {
+	start := time.Unix(1000, 0)
+	cases := []struct {
+		key            string
+		at             time.Duration
+		wantOK         bool
+		wantSuppressed int
+	}{
+		{"a", 0, true, 0},
+		{"a", time.Second, false, 0},
+		{"b", time.Second, true, 0},
+		{"a", 2 * time.Second, false, 0},
+		{"a", time.Minute, true, 2},
+		{"a", time.Minute + time.Second, false, 0},
+		{"a", 3 * time.Minute, true, 1},
+	}
+
+	l := newLogLimiter(time.Minute)
+	for idx, c := range cases {
+		ok, suppressed := l.allow(c.key, start.Add(c.at))
+		if ok != c.wantOK || suppressed != c.wantSuppressed {
+			t.Errorf("[%d] allow(%s, +%v) = %v, %d; wanted %v, %d", idx, c.key, c.at, ok, suppressed, c.wantOK, c.wantSuppressed)
+		}
+	}
+}
@@ -15,19 +15,34 @@
 package adapterManager
 
 import (
+	"time"
+
 	"istio.io/mixer/pkg/adapter"
 	"istio.io/mixer/pkg/pool"
 )
 
 type env struct {
-	logger adapter.Logger
-	gp     *pool.GoroutinePool
+	logger        adapter.Logger
+	monitor       adapter.Monitor
+	gp            *pool.GoroutinePool
+	callTimeout   time.Duration
+	recovering    bool
+	onPanic       func(r interface{})
+	onDaemonPanic func(r interface{})
 }
 
-func newEnv(aspect string, gp *pool.GoroutinePool) adapter.Env {
+// newEnv returns the environment of an adapter. onPanic and onDaemonPanic, which may be nil, are
+// told about the panics recovered from the work and the daemons the adapter schedules respectively.
+func newEnv(aspect string, gp *pool.GoroutinePool, callTimeout time.Duration, recovering bool,
+	onPanic func(r interface{}), onDaemonPanic func(r interface{})) adapter.Env {
 	return env{
-		logger: newLogger(aspect),
-		gp:     gp,
+		logger:        newLogger(aspect),
+		monitor:       newMonitor(aspect),
+		gp:            gp,
+		callTimeout:   callTimeout,
+		recovering:    recovering,
+		onPanic:       onPanic,
+		onDaemonPanic: onDaemonPanic,
 	}
 }
 
@@ -35,16 +50,26 @@ func (e env) Logger() adapter.Logger {
 	return e.logger
 }
 
+func (e env) CallTimeout() time.Duration {
+	return e.callTimeout
+}
+
+func (e env) Recovering() bool {
+	return e.recovering
+}
+
+func (e env) Monitor() adapter.Monitor {
+	return e.monitor
+}
+
 func (e env) ScheduleWork(fn adapter.WorkFunc) {
 	e.gp.ScheduleWork(func() {
 		defer func() {
 			if r := recover(); r != nil {
 				_ = e.Logger().Errorf("Adapter worker failed: %v", r)
-
-				// TODO: Beyond logging, we want to do something proactive here.
-				//       For example, we want to probably terminate the originating
-				//       adapter and record the failure so we can count how often
-				//       it happens, etc.
+				if e.onPanic != nil {
+					e.onPanic(r)
+				}
 			}
 		}()
 
@@ -57,11 +82,9 @@ func (e env) ScheduleDaemon(fn adapter.DaemonFunc) {
 		defer func() {
 			if r := recover(); r != nil {
 				_ = e.Logger().Errorf("Adapter daemon failed: %v", r)
-
-				// TODO: Beyond logging, we want to do something proactive here.
-				//       For example, we want to probably terminate the originating
-				//       adapter and record the failure so we can count how often
-				//       it happens, etc.
+				if e.onDaemonPanic != nil {
+					e.onDaemonPanic(r)
+				}
 			}
 		}()
 
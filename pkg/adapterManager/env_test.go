@@ -16,9 +16,11 @@ package adapterManager
 
 import (
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"istio.io/mixer/pkg/adapter"
 	"istio.io/mixer/pkg/pool"
 )
 
@@ -27,7 +29,19 @@ func TestEnv(t *testing.T) {
 		gp := pool.NewGoroutinePool(128, i == 0)
 		gp.AddWorkers(32)
 
-		env := newEnv("Foo", gp)
+		var panics, daemonPanics int32
+		env := newEnv("Foo", gp, time.Second, i == 1, func(interface{}) {
+			atomic.AddInt32(&panics, 1)
+		}, func(interface{}) {
+			atomic.AddInt32(&daemonPanics, 1)
+		})
+		if adapter.CallTimeout(env) != time.Second || adapter.Recovering(env) != (i == 1) {
+			t.Errorf("Got call timeout %v and recovering %t", adapter.CallTimeout(env), adapter.Recovering(env))
+		}
+		if _, ok := env.(adapter.MonitoredEnv); !ok {
+			t.Error("Env doesn't export the adapter's metrics")
+		}
+
 		log := env.Logger()
 		log.Infof("Test%s", "ing")
 		log.Warningf("Test%s", "ing")
@@ -60,6 +74,10 @@ func TestEnv(t *testing.T) {
 		// hack to give time for the panic to 'take hold' if it doesn't get recovered properly
 		time.Sleep(time.Duration(200) * time.Millisecond)
 
+		if n, d := atomic.LoadInt32(&panics), atomic.LoadInt32(&daemonPanics); n != 1 || d != 1 {
+			t.Errorf("Got %d worker and %d daemon panics reported, expected 1 each", n, d)
+		}
+
 		gp.Close()
 	}
 }
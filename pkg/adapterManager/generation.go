@@ -0,0 +1,346 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapterManager
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang/glog"
+	multierror "github.com/hashicorp/go-multierror"
+
+	"istio.io/mixer/pkg/config"
+	"istio.io/mixer/pkg/config/descriptor"
+	cpb "istio.io/mixer/pkg/config/proto"
+)
+
+// generation is an installed config along with the executors built for it.
+//
+// Every request is served by the generation that was current when it arrived, and holds a
+// reference to it until it completes. Once a generation has been replaced and its last
+// request has drained, the executors it doesn't share with a newer generation are closed.
+type generation struct {
+	id       int64
+	resolver config.Resolver
+	df       descriptor.Finder
+
+	// one reference for being the current generation, plus one per request or aspect in flight
+	refs int32
+
+	// concurrency limits of the adapters, immutable once the generation is installed
+	bulkheads map[bulkheadKey]*bulkhead
+
+	lock      sync.RWMutex // guards the fields below
+	executors map[cacheKey]*cacheEntry
+	failures  map[cacheKey]error
+
+	// aspects of the previous generation to reconfigure rather than construct new ones, by the key
+	// of the executor to build. The generation holds a reference to them until they are used.
+	priors map[cacheKey]*sharedAspect
+
+	// the trackers that reconfigured an aspect of the previous generation
+	reconfigured []*aspectTracker
+}
+
+func newGeneration(id int64, resolver config.Resolver, df descriptor.Finder) *generation {
+	return &generation{
+		id:        id,
+		resolver:  resolver,
+		df:        df,
+		refs:      1,
+		priors:    make(map[cacheKey]*sharedAspect),
+		executors: make(map[cacheKey]*cacheEntry),
+		failures:  make(map[cacheKey]error),
+	}
+}
+
+// tryAcquire takes a reference to the generation, unless it has already drained.
+func (g *generation) tryAcquire() bool {
+	for {
+		refs := atomic.LoadInt32(&g.refs)
+		if refs == 0 {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&g.refs, refs, refs+1) {
+			return true
+		}
+	}
+}
+
+// adopt takes over the executors of the previous generation that the config of g still refers to.
+// The reconfigurable aspects of the other executors are set aside for the executors g builds for
+// the new configs of their adapter.
+func (g *generation) adopt(prev *generation) {
+	prev.lock.RLock()
+	defer prev.lock.RUnlock()
+
+	type pending struct {
+		key     cacheKey
+		adapter string
+	}
+	var rest []pending
+
+	for _, cfg := range g.resolver.Combined() {
+		if cfg.Aspect == nil {
+			continue
+		}
+		kind, found := config.ParseKind(cfg.Aspect.Kind)
+		if !found {
+			continue
+		}
+		key, err := newCacheKey(kind, cfg)
+		if err != nil {
+			continue
+		}
+		if _, dup := g.executors[*key]; dup {
+			continue
+		}
+		if entry, carried := prev.executors[*key]; carried {
+			atomic.AddInt32(&entry.owners, 1)
+			g.executors[*key] = entry
+			continue
+		}
+		rest = append(rest, pending{*key, cfg.Builder.GetName()})
+	}
+
+	claimed := make(map[*cacheEntry]bool, len(g.executors))
+	for _, entry := range g.executors {
+		claimed[entry] = true
+	}
+	for _, p := range rest {
+		if _, dup := g.priors[p.key]; dup {
+			continue
+		}
+		entry := prev.priorOf(p.key, p.adapter, claimed)
+		if entry == nil {
+			continue
+		}
+		if s := entry.aspects.latest(); s != nil && s.acquire() {
+			claimed[entry] = true
+			g.priors[p.key] = s
+		}
+	}
+}
+
+// priorOf returns the executor of g, not in claimed, whose aspect can be reconfigured for the config
+// of adapter with the given key. The executor built with the same aspect params is preferred, another
+// one is only returned when it is the only candidate.
+func (g *generation) priorOf(key cacheKey, adapter string, claimed map[*cacheEntry]bool) *cacheEntry {
+	var candidates []*cacheEntry
+	for k, entry := range g.executors {
+		if k.kind != key.kind || k.impl != key.impl || entry.adapter != adapter || claimed[entry] || entry.aspects.latest() == nil {
+			continue
+		}
+		if k.aspectParamsSHA == key.aspectParamsSHA {
+			return entry
+		}
+		candidates = append(candidates, entry)
+	}
+	if len(candidates) != 1 {
+		return nil
+	}
+	return candidates[0]
+}
+
+// revert gives the aspects reconfigured for g their previous configuration back.
+func (g *generation) revert() {
+	g.lock.Lock()
+	reconfigured := g.reconfigured
+	g.reconfigured = nil
+	g.lock.Unlock()
+
+	for _, t := range reconfigured {
+		t.revert()
+	}
+}
+
+// close releases the executors of the generation, closing the ones no other generation holds.
+func (g *generation) close() error {
+	g.lock.Lock()
+	executors := g.executors
+	g.executors = make(map[cacheKey]*cacheEntry)
+	priors := g.priors
+	g.priors = make(map[cacheKey]*sharedAspect)
+	g.lock.Unlock()
+
+	var result *multierror.Error
+	for key, s := range priors {
+		if err := s.Close(); err != nil {
+			result = multierror.Append(result, fmt.Errorf("failed to close %s aspect for adapter '%s': %v", key.kind, key.impl, err))
+		}
+	}
+	for key, entry := range executors {
+		if atomic.AddInt32(&entry.owners, -1) > 0 {
+			continue
+		}
+		if err := entry.executor.Close(); err != nil {
+			result = multierror.Append(result, fmt.Errorf("failed to close %s executor for adapter '%s': %v", key.kind, key.impl, err))
+		}
+		executorCacheSize.Dec()
+	}
+
+	for _, b := range g.bulkheads {
+		if atomic.AddInt32(&b.owners, -1) == 0 {
+			b.close()
+		}
+	}
+
+	if glog.V(2) {
+		glog.Infof("Closed config generation %d: %d executor(s) released", g.id, len(executors))
+	}
+	return result.ErrorOrNil()
+}
+
+// acquire returns the current generation with a reference held, or nil if there is none.
+func (m *Manager) acquire() *generation {
+	for {
+		g, _ := m.gen.Load().(*generation)
+		if g == nil {
+			return nil
+		}
+		if g.tryAcquire() {
+			return g
+		}
+		if cur, _ := m.gen.Load().(*generation); cur == g {
+			// the manager has been closed
+			return nil
+		}
+		// g was replaced while we were acquiring it, try the new one
+	}
+}
+
+// release drops a reference to g, closing it in the background if it was the last one.
+func (m *Manager) release(g *generation) {
+	if atomic.AddInt32(&g.refs, -1) > 0 {
+		return
+	}
+
+	m.draining.Add(1)
+	go func() {
+		defer m.draining.Done()
+		defer m.live.Done()
+		if err := g.close(); err != nil {
+			glog.Warningf("Error closing config generation %d: %v", g.id, err)
+		}
+	}()
+}
+
+// ConfigChange installs a new config generation. The executors of the previous generation
+// that the new config still refers to are carried over, the others are closed once the
+// requests served by the previous generation have completed.
+//
+// The executors built for a new config of an adapter reconfigure the aspect of its previous
+// config in place when the aspect is adapter.Reconfigurable, instead of constructing a new one.
+//
+// When the manager builds executors eagerly, the ones the new config refers to are all
+// constructed first. If any of them fails, the new config is rejected and the previous
+// generation keeps serving, with the aspects reconfigured meanwhile reverted.
+func (m *Manager) ConfigChange(cfg config.Resolver, df descriptor.Finder) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	prev, _ := m.gen.Load().(*generation)
+
+	var id int64 = 1
+	if prev != nil {
+		id = prev.id + 1
+	}
+	g := newGeneration(id, cfg, df)
+	var prevBulkheads map[bulkheadKey]*bulkhead
+	if prev != nil {
+		g.adopt(prev)
+		prevBulkheads = prev.bulkheads
+	}
+	g.bulkheads = newBulkheads(cfg.Combined(), prevBulkheads, m.gp != nil && m.gp.SingleThreaded())
+
+	if m.eagerBuild {
+		if err := m.build(g); err != nil {
+			g.revert()
+			if cerr := g.close(); cerr != nil {
+				glog.Warningf("Error closing rejected config generation %d: %v", g.id, cerr)
+			}
+			return err
+		}
+	}
+
+	m.live.Add(1)
+	m.gen.Store(g)
+	glog.Infof("Installed config generation %d, %d executor(s) carried over", g.id, len(g.executors))
+
+	if prev != nil {
+		m.release(prev)
+	}
+	return nil
+}
+
+// build constructs all the executors the config of g refers to, and returns the construction failures.
+func (m *Manager) build(g *generation) error {
+	var result *multierror.Error
+	for _, cfg := range g.resolver.Combined() {
+		if err := m.buildOne(g, cfg); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+	return result.ErrorOrNil()
+}
+
+func (m *Manager) buildOne(g *generation, cfg *cpb.Combined) (err error) {
+	kind, found := config.ParseKind(cfg.Aspect.Kind)
+	if !found {
+		return fmt.Errorf("invalid aspect %#v", cfg.Aspect.Kind)
+	}
+
+	mgr := m.managers[kind]
+	if mgr == nil {
+		return fmt.Errorf("could not find aspect manager %#v", cfg.Aspect.Kind)
+	}
+
+	builder, found := m.builders.FindBuilder(cfg.Builder.Impl)
+	if !found {
+		return fmt.Errorf("could not find registered adapter %#v", cfg.Builder.Impl)
+	}
+
+	// construction runs adapter-supplied code
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("adapter '%s' panicked with '%v'", builder.Name(), r)
+		}
+	}()
+
+	_, err = m.cacheGet(g, cfg, mgr, builder)
+	return err
+}
+
+// closeExecutors releases the current generation and waits for every generation to be closed.
+func (m *Manager) closeExecutors() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var err error
+	if g, _ := m.gen.Load().(*generation); g != nil && !m.closed {
+		m.closed = true
+		if atomic.AddInt32(&g.refs, -1) == 0 {
+			err = g.close()
+			m.live.Done()
+		}
+	}
+
+	// previous generations may still serve requests, e.g. ones left running by a forced stop
+	// of the servers, their executors are closed once those complete
+	m.live.Wait()
+	m.draining.Wait()
+	return err
+}
@@ -0,0 +1,234 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapterManager
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	rpc "github.com/googleapis/googleapis/google/rpc"
+
+	"istio.io/mixer/pkg/aspect"
+	"istio.io/mixer/pkg/attribute"
+	"istio.io/mixer/pkg/config"
+	cpb "istio.io/mixer/pkg/config/proto"
+	"istio.io/mixer/pkg/pool"
+	"istio.io/mixer/pkg/status"
+)
+
+func newGenerationTestManager(re aspect.ReportExecutor) (*Manager, *fakeReportAspectMgr, func()) {
+	gp := pool.NewGoroutinePool(1, true)
+	agp := pool.NewGoroutinePool(1, true)
+	mgrs := newFakeMgrReg(nil, nil, nil, nil)
+	rm := &fakeReportAspectMgr{kind: config.AccessLogsKind, re: re}
+	mgrs[config.AccessLogsKind] = rm
+
+	m := newManager(getReg(true), mgrs, &fakeEvaluator{}, aspect.ManagerInventory{}, gp, agp)
+	return m, rm, func() {
+		gp.Close()
+		agp.Close()
+	}
+}
+
+func accessLogsConfig(code int32) *cpb.Combined {
+	return &cpb.Combined{
+		Aspect:  &cpb.Aspect{Kind: config.AccessLogsKindName, Params: &rpc.Status{Code: code}},
+		Builder: &cpb.Adapter{Kind: config.AccessLogsKindName, Impl: "k1impl1"},
+	}
+}
+
+func report(m *Manager) rpc.Status {
+	return m.Report(context.Background(), attribute.GetMutableBag(nil), attribute.GetMutableBag(nil))
+}
+
+func TestConfigChange_Generations(t *testing.T) {
+	re := &fakeReportExecutor{}
+	m, rm, done := newGenerationTestManager(re)
+	defer done()
+
+	a, b := accessLogsConfig(1), accessLogsConfig(2)
+
+	_ = m.ConfigChange(&fakeResolver{[]*cpb.Combined{a}, nil}, nil)
+	if out := report(m); !status.IsOK(out) {
+		t.Fatalf("Report failed with %v", out)
+	}
+
+	// a is carried over, only b gets built
+	_ = m.ConfigChange(&fakeResolver{[]*cpb.Combined{a, b}, nil}, nil)
+	if out := report(m); !status.IsOK(out) {
+		t.Fatalf("Report failed with %v", out)
+	}
+	m.draining.Wait()
+	if rm.called != 2 || re.closed != 0 {
+		t.Errorf("%d executors built and %d closed, want 2 and 0", rm.called, re.closed)
+	}
+
+	// a is no longer referenced
+	_ = m.ConfigChange(&fakeResolver{[]*cpb.Combined{b}, nil}, nil)
+	if out := report(m); !status.IsOK(out) {
+		t.Fatalf("Report failed with %v", out)
+	}
+	m.draining.Wait()
+	if rm.called != 2 || re.closed != 1 {
+		t.Errorf("%d executors built and %d closed, want 2 and 1", rm.called, re.closed)
+	}
+	if executors := m.Executors(); len(executors) != 1 {
+		t.Errorf("Executors() = %v, want a single one", executors)
+	}
+
+	if err := m.Close(); err != nil {
+		t.Errorf("Close() = %v, wanted no error", err)
+	}
+	if re.closed != 2 {
+		t.Errorf("%d executors closed, want 2", re.closed)
+	}
+}
+
+func TestManager_CloseWaitsForAllGenerations(t *testing.T) {
+	re := &fakeReportExecutor{}
+	m, _, done := newGenerationTestManager(re)
+	defer done()
+
+	_ = m.ConfigChange(&fakeResolver{[]*cpb.Combined{accessLogsConfig(1)}, nil}, nil)
+	if out := report(m); !status.IsOK(out) {
+		t.Fatalf("Report failed with %v", out)
+	}
+
+	// a request left running by a forced stop, still served by a replaced generation
+	g := m.acquire()
+	_ = m.ConfigChange(&fakeResolver{}, nil)
+
+	closed := make(chan error)
+	go func() {
+		closed <- m.Close()
+	}()
+
+	select {
+	case <-closed:
+		t.Fatal("Close() returned while a request was in flight")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	m.release(g)
+	if err := <-closed; err != nil {
+		t.Errorf("Close() = %v, wanted no error", err)
+	}
+	if re.closed != 1 {
+		t.Errorf("Executor closed %d times, want 1", re.closed)
+	}
+}
+
+func TestConfigChange_DrainsInFlightRequests(t *testing.T) {
+	re := &fakeReportExecutor{}
+	m, _, done := newGenerationTestManager(re)
+	defer done()
+
+	_ = m.ConfigChange(&fakeResolver{[]*cpb.Combined{accessLogsConfig(1)}, nil}, nil)
+	if out := report(m); !status.IsOK(out) {
+		t.Fatalf("Report failed with %v", out)
+	}
+
+	// a request still being served by the first generation
+	g := m.acquire()
+
+	_ = m.ConfigChange(&fakeResolver{}, nil)
+	m.draining.Wait()
+	if re.closed != 0 {
+		t.Fatalf("Executor closed while a request was in flight")
+	}
+
+	m.release(g)
+	m.draining.Wait()
+	if re.closed != 1 {
+		t.Errorf("Executor closed %d times after the request completed, want 1", re.closed)
+	}
+
+	if err := m.Close(); err != nil {
+		t.Errorf("Close() = %v, wanted no error", err)
+	}
+	if g := m.acquire(); g != nil {
+		t.Errorf("acquire() = generation %d after Close(), want nil", g.id)
+	}
+}
+
+func TestConfigChange_ConstructionFailure(t *testing.T) {
+	m, rm, done := newGenerationTestManager(nil)
+	defer done()
+	var reported []error
+	m.ReportErrorsTo(func(err error) { reported = append(reported, err) })
+
+	cfg := &fakeResolver{[]*cpb.Combined{accessLogsConfig(1)}, nil}
+	_ = m.ConfigChange(cfg, nil)
+
+	for i := 0; i < 2; i++ {
+		if out := report(m); status.IsOK(out) || !strings.Contains(out.Message, "unable to configure") {
+			t.Errorf("Report() = %v, want a config error", out)
+		}
+	}
+	if rm.called != 1 {
+		t.Errorf("Executor construction attempted %d times, want once per generation", rm.called)
+	}
+	if len(reported) != 1 || !strings.Contains(reported[0].Error(), "unable to configure") {
+		t.Errorf("Reported errors %v, want the construction failure once", reported)
+	}
+
+	executors := m.Executors()
+	if len(executors) != 1 || !strings.Contains(executors[0].Error, "unable to create aspect") {
+		t.Errorf("Executors() = %v, want the construction failure", executors)
+	}
+
+	// a new generation tries again
+	_ = m.ConfigChange(cfg, nil)
+	_ = report(m)
+	if rm.called != 2 {
+		t.Errorf("Executor construction attempted %d times, want 2", rm.called)
+	}
+}
+
+func TestConfigChange_EagerBuild(t *testing.T) {
+	re := &fakeReportExecutor{}
+	m, rm, done := newGenerationTestManager(re)
+	defer done()
+	m.eagerBuild = true
+
+	a, b := accessLogsConfig(1), accessLogsConfig(2)
+
+	if err := m.ConfigChange(&fakeResolver{[]*cpb.Combined{a}, nil}, nil); err != nil {
+		t.Fatalf("ConfigChange() = %v, want no error", err)
+	}
+	if rm.called != 1 {
+		t.Errorf("%d executors built at install time, want 1", rm.called)
+	}
+
+	// b can't be constructed, the new config must be rejected
+	rm.re = nil
+	err := m.ConfigChange(&fakeResolver{[]*cpb.Combined{a, b}, nil}, nil)
+	if err == nil || !strings.Contains(err.Error(), "unable to create aspect") {
+		t.Fatalf("ConfigChange() = %v, want the construction failure", err)
+	}
+	m.draining.Wait()
+
+	if re.closed != 0 {
+		t.Errorf("Executor of the current config closed %d times", re.closed)
+	}
+	if executors := m.Executors(); len(executors) != 1 || executors[0].Error != "" {
+		t.Errorf("Executors() = %v, want the executor of the previous config", executors)
+	}
+	if out := report(m); !status.IsOK(out) || re.called != 1 {
+		t.Errorf("Report() = %v with %d executor calls, want the previous config to keep serving", out, re.called)
+	}
+}
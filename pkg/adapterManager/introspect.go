@@ -0,0 +1,158 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapterManager
+
+import (
+	"fmt"
+	"sort"
+
+	"istio.io/mixer/pkg/attribute"
+	"istio.io/mixer/pkg/config"
+	cpb "istio.io/mixer/pkg/config/proto"
+)
+
+// ExecutorInfo describes a cached executor.
+type ExecutorInfo struct {
+	Kind             string `json:"kind"`
+	Adapter          string `json:"adapter"`
+	BuilderParamsSHA string `json:"builder_params_sha"`
+	AspectParamsSHA  string `json:"aspect_params_sha"`
+	BreakerState     string `json:"breaker_state,omitempty"`
+	Health           string `json:"health,omitempty"`
+	Panics           int    `json:"panics,omitempty"`
+	Restarts         int    `json:"restarts,omitempty"`
+
+	// Error is set instead of BreakerState when the executor could not be constructed,
+	// and along with it when the executor crashed and could not be constructed anew.
+	Error string `json:"error,omitempty"`
+}
+
+// BuilderSummary describes a registered builder.
+type BuilderSummary struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Kinds       []string `json:"kinds"`
+}
+
+// builderLister is implemented by the builder finders that can enumerate their builders.
+type builderLister interface {
+	// Builders returns all the known builders.
+	Builders() BuildersByName
+}
+
+// Builders returns all the known builders.
+func (r *registry) Builders() BuildersByName {
+	return r.builders
+}
+
+// Executors describes the executors of the current config generation, including the ones
+// that could not be constructed, ordered by kind and adapter.
+func (m *Manager) Executors() []ExecutorInfo {
+	g, _ := m.gen.Load().(*generation)
+	if g == nil {
+		return []ExecutorInfo{}
+	}
+
+	g.lock.RLock()
+	infos := make([]ExecutorInfo, 0, len(g.executors)+len(g.failures))
+	for key, entry := range g.executors {
+		info := key.info()
+		info.BreakerState = entry.breaker.currentState().String()
+		st := entry.executor.status()
+		info.Health, info.Panics, info.Restarts = st.health.String(), st.panics, st.restarts
+		if st.lastError != nil {
+			info.Error = st.lastError.Error()
+		}
+		infos = append(infos, info)
+	}
+	for key, err := range g.failures {
+		info := key.info()
+		info.Error = err.Error()
+		infos = append(infos, info)
+	}
+	g.lock.RUnlock()
+
+	sort.Slice(infos, func(i, j int) bool {
+		a, b := infos[i], infos[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Adapter != b.Adapter {
+			return a.Adapter < b.Adapter
+		}
+		if a.BuilderParamsSHA != b.BuilderParamsSHA {
+			return a.BuilderParamsSHA < b.BuilderParamsSHA
+		}
+		return a.AspectParamsSHA < b.AspectParamsSHA
+	})
+	return infos
+}
+
+func (k cacheKey) info() ExecutorInfo {
+	return ExecutorInfo{
+		Kind:             k.kind.String(),
+		Adapter:          k.impl,
+		BuilderParamsSHA: fmt.Sprintf("%x", k.builderParamsSHA),
+		AspectParamsSHA:  fmt.Sprintf("%x", k.aspectParamsSHA),
+	}
+}
+
+// Builders describes the registered builders and the aspect kinds they support, ordered by name.
+func (m *Manager) Builders() []BuilderSummary {
+	l, ok := m.builders.(builderLister)
+	if !ok {
+		return []BuilderSummary{}
+	}
+
+	builders := l.Builders()
+	summaries := make([]BuilderSummary, 0, len(builders))
+	for name, bi := range builders {
+		s := BuilderSummary{Name: name, Description: bi.Builder.Description(), Kinds: []string{}}
+		for k := config.Kind(0); k < config.NumKinds; k++ {
+			if bi.Kinds.IsSet(k) {
+				s.Kinds = append(s.Kinds, k.String())
+			}
+		}
+		summaries = append(summaries, s)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Name < summaries[j].Name })
+	return summaries
+}
+
+// Resolve returns the configs the given API method would dispatch to for a set of
+// attributes: one of "preprocess", "check", "report" or "quota". Nothing is executed.
+func (m *Manager) Resolve(attrs attribute.Bag, method string) ([]*cpb.Combined, error) {
+	var ks config.KindSet
+	switch method {
+	case "preprocess":
+		ks = m.preprocessKindSet
+	case "check":
+		ks = m.checkKindSet
+	case "report":
+		ks = m.reportKindSet
+	case "quota":
+		ks = m.quotaKindSet
+	default:
+		return nil, fmt.Errorf("unknown method '%s'", method)
+	}
+
+	configs, g, err := m.loadConfigs(attrs, ks, method == "preprocess")
+	if err != nil {
+		return nil, err
+	}
+	m.release(g)
+	return configs, nil
+}
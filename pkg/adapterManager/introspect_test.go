@@ -0,0 +1,123 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapterManager
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	rpc "github.com/googleapis/googleapis/google/rpc"
+
+	"istio.io/mixer/pkg/adapter"
+	"istio.io/mixer/pkg/aspect"
+	"istio.io/mixer/pkg/attribute"
+	"istio.io/mixer/pkg/config"
+	cpb "istio.io/mixer/pkg/config/proto"
+	"istio.io/mixer/pkg/pool"
+	"istio.io/mixer/pkg/status"
+)
+
+func TestManager_Executors(t *testing.T) {
+	gp := pool.NewGoroutinePool(1, true)
+	agp := pool.NewGoroutinePool(1, true)
+	defer gp.Close()
+	defer agp.Close()
+
+	m := newManager(getReg(true), newFakeMgrReg(nil, nil, &fakeReportExecutor{}, nil), &fakeEvaluator{}, aspect.ManagerInventory{}, gp, agp)
+
+	if got := m.Executors(); len(got) != 0 {
+		t.Errorf("Executors() = %v, want none before any request", got)
+	}
+
+	_ = m.ConfigChange(&fakeResolver{[]*cpb.Combined{
+		{
+			Aspect:  &cpb.Aspect{Kind: config.AccessLogsKindName},
+			Builder: &cpb.Adapter{Name: "Foo", Impl: "k1impl1"},
+		},
+	}, nil}, nil)
+	if out := m.Report(context.Background(), attribute.GetMutableBag(nil), attribute.GetMutableBag(nil)); !status.IsOK(out) {
+		t.Fatalf("Report failed with %v", out)
+	}
+
+	got := m.Executors()
+	want := []ExecutorInfo{{
+		Kind:             config.AccessLogsKindName,
+		Adapter:          "k1impl1",
+		BuilderParamsSHA: strings.Repeat("0", 40),
+		AspectParamsSHA:  strings.Repeat("0", 40),
+		BreakerState:     "closed",
+		Health:           "healthy",
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Executors() = %v, want %v", got, want)
+	}
+}
+
+func TestManager_Builders(t *testing.T) {
+	reg := newRegistry([]adapter.RegisterFn{
+		func(r adapter.Registrar) {
+			r.RegisterQuotasBuilder(quotaBuilder{testBuilder{name: "b"}})
+			r.RegisterAccessLogsBuilder(quotaBuilder{testBuilder{name: "b"}})
+			r.RegisterDenialsBuilder(denyBuilder{testBuilder{name: "a"}})
+		},
+	})
+	m := newManager(reg, [config.NumKinds]aspect.Manager{}, &fakeEvaluator{}, aspect.ManagerInventory{}, nil, nil)
+
+	got := m.Builders()
+	want := []BuilderSummary{
+		{Name: "a", Description: "mock builder for testing", Kinds: []string{config.DenialsKindName}},
+		{Name: "b", Description: "mock builder for testing", Kinds: []string{config.AccessLogsKindName, config.QuotasKindName}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Builders() = %v, want %v", got, want)
+	}
+
+	m = newManager(getReg(true), [config.NumKinds]aspect.Manager{}, &fakeEvaluator{}, aspect.ManagerInventory{}, nil, nil)
+	if got := m.Builders(); len(got) != 0 {
+		t.Errorf("Builders() = %v, want none from a finder that can't list its builders", got)
+	}
+}
+
+func TestManager_Resolve(t *testing.T) {
+	cfg := []*cpb.Combined{{
+		Aspect:  &cpb.Aspect{Kind: config.DenialsKindName, Params: &rpc.Status{}},
+		Builder: &cpb.Adapter{Kind: config.DenialsKindName, Impl: "k1impl1"},
+	}}
+	m := newManager(getReg(true), newFakeMgrReg(nil, nil, nil, nil), &fakeEvaluator{}, aspect.ManagerInventory{}, nil, nil)
+
+	if _, err := m.Resolve(attribute.GetMutableBag(nil), "check"); err == nil {
+		t.Error("Resolve() succeeded before any config was installed")
+	}
+
+	_ = m.ConfigChange(&fakeResolver{cfg, nil}, nil)
+	for _, method := range []string{"preprocess", "check", "report", "quota"} {
+		got, err := m.Resolve(attribute.GetMutableBag(nil), method)
+		if err != nil || !reflect.DeepEqual(got, cfg) {
+			t.Errorf("Resolve(%s) = %v, %v, want %v", method, got, err, cfg)
+		}
+	}
+
+	if _, err := m.Resolve(attribute.GetMutableBag(nil), "frobnicate"); err == nil {
+		t.Error("Resolve() succeeded for an unknown method")
+	}
+
+	_ = m.ConfigChange(&fakeResolver{nil, errors.New("resolver failed")}, nil)
+	if _, err := m.Resolve(attribute.GetMutableBag(nil), "check"); err == nil || !strings.Contains(err.Error(), "resolver failed") {
+		t.Errorf("Resolve() = %v, want the resolver's error", err)
+	}
+}
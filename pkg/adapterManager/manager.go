@@ -15,25 +15,28 @@
 package adapterManager
 
 import (
-	"bytes"
 	"context"
 	"crypto/sha1"
 	"encoding/gob"
 	"errors"
 	"fmt"
+	"io"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/golang/glog"
 	rpc "github.com/googleapis/googleapis/google/rpc"
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/prometheus/client_golang/prometheus"
 
 	"istio.io/mixer/pkg/adapter"
 	"istio.io/mixer/pkg/aspect"
 	"istio.io/mixer/pkg/attribute"
 	"istio.io/mixer/pkg/config"
-	"istio.io/mixer/pkg/config/descriptor"
 	cpb "istio.io/mixer/pkg/config/proto"
 	"istio.io/mixer/pkg/expr"
+	"istio.io/mixer/pkg/monitoring"
 	"istio.io/mixer/pkg/pool"
 	"istio.io/mixer/pkg/status"
 )
@@ -54,6 +57,11 @@ type AspectDispatcher interface {
 	// Quota dispatches to the set of aspects associated with the Quota API method
 	Quota(ctx context.Context, requestBag *attribute.MutableBag, responseBag *attribute.MutableBag,
 		qma *aspect.QuotaMethodArgs) (*aspect.QuotaMethodResp, rpc.Status)
+
+	// QuotaBatch dispatches several operations to the set of aspects associated with the Quota API
+	// method, with all-or-nothing semantics.
+	QuotaBatch(ctx context.Context, requestBag *attribute.MutableBag, responseBag *attribute.MutableBag,
+		qmas []*aspect.QuotaMethodArgs) ([]*aspect.QuotaMethodResp, rpc.Status)
 }
 
 // Manager manages all aspects - provides uniform interface to
@@ -69,13 +77,80 @@ type Manager struct {
 	gp                *pool.GoroutinePool
 	adapterGP         *pool.GoroutinePool
 
-	// Configs for the aspects that'll be used to serve each API method.
-	cfg atomic.Value
-	df  atomic.Value
+	// The current config generation, a *generation.
+	gen atomic.Value
+
+	// settings for the breakers guarding each cached executor
+	breakerCfg BreakerConfig
+
+	// when to restart the cached executors whose adapter keeps panicking
+	crashPolicy CrashPolicy
+
+	// how long the aspects of a request are given to complete, 0 for as long as the request lasts
+	callTimeout time.Duration
+
+	// whether to fail aspects with UNAVAILABLE when gp's queue is full rather than wait for room
+	shedLoad bool
+
+	// whether to construct the executors of a new config before installing it
+	eagerBuild bool
+
+	// told about the executors that fail to be constructed on first use, may be nil
+	reportError func(error)
+
+	// serializes config changes and Close
+	lock   sync.Mutex
+	closed bool
+
+	// tracks the generations being closed in the background
+	draining sync.WaitGroup
+
+	// tracks the installed generations that haven't been closed yet
+	live sync.WaitGroup
+}
+
+// cacheEntry is a cached executor along with the circuit breaker guarding it.
+type cacheEntry struct {
+	executor *supervisedExecutor
+	breaker  *breaker
+
+	// the adapter config the executor was built for, and the tracker of its aspect
+	adapter string
+	aspects *aspectTracker
+
+	// number of generations holding the entry, the executor is closed when it drops to 0
+	owners int32
+}
+
+var (
+	adapterCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mixer_adapter_calls_total",
+		Help: "Number of aspects executed, by adapter, aspect kind and result code.",
+	}, []string{"adapter", "kind", "code"})
+
+	adapterDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "mixer_adapter_call_duration_seconds",
+		Help: "Time taken to execute aspects, by adapter and aspect kind.",
+	}, []string{"adapter", "kind"})
+
+	executorCacheSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "mixer_executor_cache_size",
+		Help: "Number of executors currently cached.",
+	})
+
+	executorFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mixer_executor_construction_failures_total",
+		Help: "Number of executors that could not be constructed for a config generation, by adapter and aspect kind.",
+	}, []string{"adapter", "kind"})
+
+	aspectFallbacks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mixer_aspect_fallbacks_total",
+		Help: "Number of aspects that their adapter failed to serve, by aspect kind, adapter and adapter that served them instead, or none.",
+	}, []string{"kind", "adapter", "served_by"})
+)
 
-	// protects cache
-	lock          sync.RWMutex
-	executorCache map[cacheKey]aspect.Executor
+func init() {
+	monitoring.MustRegister(adapterCalls, adapterDuration, executorCacheSize, executorFailures, aspectFallbacks)
 }
 
 // builderFinder finds a builder by name.
@@ -88,23 +163,36 @@ type builderFinder interface {
 	SupportedKinds(builder string) config.KindSet
 }
 
-// NewManager creates a new adapterManager.
+// NewManager creates a new adapterManager. When callTimeout is not 0, aspects that take longer
+// fail with DEADLINE_EXCEEDED. When shedLoad is true, aspects that can't be scheduled right
+// away because gp's queue is full fail with UNAVAILABLE. When eagerBuild is true, the executors
+// of a new config are all constructed before it is installed, and the config is rejected if
+// any of them can't be.
 func NewManager(builders []adapter.RegisterFn, inventory aspect.ManagerInventory,
-	exp expr.Evaluator, gp *pool.GoroutinePool, adapterGP *pool.GoroutinePool) *Manager {
+	exp expr.Evaluator, gp *pool.GoroutinePool, adapterGP *pool.GoroutinePool, breakerCfg BreakerConfig, crashPolicy CrashPolicy,
+	callTimeout time.Duration, shedLoad bool, eagerBuild bool) *Manager {
 	mm := Aspects(inventory)
-	return newManager(newRegistry(builders), mm, exp, inventory, gp, adapterGP)
+	mg := newManager(newRegistry(builders), mm, exp, inventory, gp, adapterGP)
+	mg.breakerCfg = breakerCfg
+	mg.crashPolicy = crashPolicy
+	mg.callTimeout = callTimeout
+	mg.shedLoad = shedLoad
+	mg.eagerBuild = eagerBuild
+	return mg
 }
 
 func newManager(r builderFinder, m [config.NumKinds]aspect.Manager, exp expr.Evaluator,
 	inventory aspect.ManagerInventory, gp *pool.GoroutinePool, adapterGP *pool.GoroutinePool) *Manager {
 
 	mg := &Manager{
-		builders:      r,
-		managers:      m,
-		mapper:        exp,
-		executorCache: make(map[cacheKey]aspect.Executor),
-		gp:            gp,
-		adapterGP:     adapterGP,
+		builders:   r,
+		managers:   m,
+		mapper:     exp,
+		gp:         gp,
+		adapterGP:  adapterGP,
+		breakerCfg: DefaultBreakerConfig(),
+
+		crashPolicy: DefaultCrashPolicy(),
 	}
 
 	for _, m := range inventory.Preprocess {
@@ -128,29 +216,38 @@ func newManager(r builderFinder, m [config.NumKinds]aspect.Manager, exp expr.Eva
 
 // Check dispatches to the set of aspects associated with the Check API method
 func (m *Manager) Check(ctx context.Context, requestBag, responseBag *attribute.MutableBag) rpc.Status {
-	configs, err := m.loadConfigs(requestBag, m.checkKindSet, false)
+	configs, g, err := m.loadConfigs(requestBag, m.checkKindSet, false)
 	if err != nil {
 		glog.Error(err)
 		return status.WithError(err)
 	}
-	return m.dispatch(ctx, requestBag, responseBag, configs,
-		func(executor aspect.Executor, evaluator expr.Evaluator) rpc.Status {
+	defer m.release(g)
+
+	sc := g.resolver.ServiceConfig()
+	dispatch := m.dispatch
+	if sc.GetCheckMode() == cpb.ServiceConfig_ORDERED {
+		dispatch = m.dispatchOrdered
+	}
+	return dispatch(ctx, g, requestBag, responseBag, configs, sc.GetCheckPolicy(),
+		func(ctx context.Context, executor aspect.Executor, evaluator expr.Evaluator) rpc.Status {
 			cw := executor.(aspect.CheckExecutor)
-			return cw.Execute(requestBag, evaluator)
+			return cw.Execute(ctx, requestBag, evaluator)
 		})
 }
 
 // Report dispatches to the set of aspects associated with the Report API method
 func (m *Manager) Report(ctx context.Context, requestBag, responseBag *attribute.MutableBag) rpc.Status {
-	configs, err := m.loadConfigs(requestBag, m.reportKindSet, false)
+	configs, g, err := m.loadConfigs(requestBag, m.reportKindSet, false)
 	if err != nil {
 		glog.Error(err)
 		return status.WithError(err)
 	}
-	return m.dispatch(ctx, requestBag, responseBag, configs,
-		func(executor aspect.Executor, evaluator expr.Evaluator) rpc.Status {
+	defer m.release(g)
+
+	return m.dispatch(ctx, g, requestBag, responseBag, configs, g.resolver.ServiceConfig().GetReportPolicy(),
+		func(ctx context.Context, executor aspect.Executor, evaluator expr.Evaluator) rpc.Status {
 			rw := executor.(aspect.ReportExecutor)
-			return rw.Execute(requestBag, evaluator)
+			return rw.Execute(ctx, requestBag, evaluator)
 		})
 }
 
@@ -160,54 +257,127 @@ func (m *Manager) Quota(ctx context.Context, requestBag, responseBag *attribute.
 
 	var qmr *aspect.QuotaMethodResp
 
-	configs, err := m.loadConfigs(requestBag, m.quotaKindSet, false)
+	configs, g, err := m.loadConfigs(requestBag, m.quotaKindSet, false)
 	if err != nil {
 		glog.Error(err)
 		return qmr, status.WithError(err)
 	}
+	defer m.release(g)
 
-	o := m.dispatch(ctx, requestBag, responseBag, configs,
-		func(executor aspect.Executor, evaluator expr.Evaluator) rpc.Status {
+	executed := false
+	o := m.dispatch(ctx, g, requestBag, responseBag, configs, g.resolver.ServiceConfig().GetQuotaPolicy(),
+		func(ctx context.Context, executor aspect.Executor, evaluator expr.Evaluator) rpc.Status {
 			qw := executor.(aspect.QuotaExecutor)
 			var o rpc.Status
-			o, qmr = qw.Execute(requestBag, evaluator, qma)
+			o, qmr = qw.Execute(ctx, requestBag, evaluator, qma)
+			executed = true
 			return o
 		})
 
+	if status.IsOK(o) && !executed && len(configs) > 0 && qma != nil {
+		// an open breaker failing open grants the request without asking the adapter
+		qmr = &aspect.QuotaMethodResp{Amount: qma.Amount}
+	}
+
 	return qmr, o
 }
 
-func (m *Manager) loadConfigs(attrs attribute.Bag, ks config.KindSet, isPreprocess bool) ([]*cpb.Combined, error) {
-	cfg, _ := m.cfg.Load().(config.Resolver)
-	if cfg == nil {
-		return nil, errors.New("configuration is not yet available")
+// QuotaBatch performs the quota operations one after the other and returns one result per
+// operation. If one of them fails, the allocations already made by the batch are released and
+// the failure is returned. The results then only hold the failed operation's own response, if
+// any, the others are nil. Releases can't be undone, they are always best effort anyway.
+func (m *Manager) QuotaBatch(ctx context.Context, requestBag, responseBag *attribute.MutableBag,
+	qmas []*aspect.QuotaMethodArgs) ([]*aspect.QuotaMethodResp, rpc.Status) {
+
+	qmrs := make([]*aspect.QuotaMethodResp, 0, len(qmas))
+	for i, qma := range qmas {
+		qmr, out := m.Quota(ctx, requestBag, responseBag, qma)
+		if !status.IsOK(out) {
+			m.rollbackQuotas(requestBag, qmas, qmrs)
+
+			failed := make([]*aspect.QuotaMethodResp, len(qmas))
+			failed[i] = qmr
+			return failed, out
+		}
+		qmrs = append(qmrs, qmr)
+	}
+
+	return qmrs, status.OK
+}
+
+// rollbackQuotas releases the amounts granted by the first len(qmrs) operations of a failed batch.
+func (m *Manager) rollbackQuotas(requestBag *attribute.MutableBag, qmas []*aspect.QuotaMethodArgs, qmrs []*aspect.QuotaMethodResp) {
+	for i, qmr := range qmrs {
+		qma := qmas[i]
+		if qma.Release || qmr == nil || qmr.Amount == 0 {
+			continue
+		}
+
+		rel := &aspect.QuotaMethodArgs{
+			DeduplicationID: rollbackID(i, qma),
+			Quota:           qma.Quota,
+			Amount:          qmr.Amount,
+			Release:         true,
+		}
+
+		// the rollback must happen even when the request's context is done, which is a common
+		// cause of batch failures
+		responseBag := attribute.GetMutableBag(nil)
+		if _, out := m.Quota(context.Background(), requestBag, responseBag, rel); !status.IsOK(out) {
+			glog.Warningf("Unable to roll back the allocation of %d units from quota %s: %s", qmr.Amount, qma.Quota, out.Message)
+		}
+		responseBag.Done()
+	}
+}
+
+// rollbackID returns the deduplication ID of the release rolling back the i-th operation of a
+// batch. It must not be mistaken for a retry of the allocation, nor for the rollback of another
+// operation of the batch, which may share its ID. The release of an operation without an ID goes
+// without one too, so that adapters don't deduplicate it.
+func rollbackID(i int, qma *aspect.QuotaMethodArgs) string {
+	if qma.DeduplicationID == "" {
+		return ""
 	}
-	resolveFn := cfg.Resolve
+	return fmt.Sprintf("%s:rollback:%d:%s", qma.DeduplicationID, i, qma.Quota)
+}
+
+// loadConfigs resolves the configs for the given kinds. It also returns the generation
+// that was used, so that callers see a consistent view of the config. The caller must
+// release the generation once done with it.
+func (m *Manager) loadConfigs(attrs attribute.Bag, ks config.KindSet, isPreprocess bool) ([]*cpb.Combined, *generation, error) {
+	g := m.acquire()
+	if g == nil {
+		return nil, nil, errors.New("configuration is not yet available")
+	}
+	resolveFn := g.resolver.Resolve
 	if isPreprocess {
-		resolveFn = cfg.ResolveUnconditional
+		resolveFn = g.resolver.ResolveUnconditional
 	}
 	configs, err := resolveFn(attrs, ks)
 	if err != nil {
-		return nil, fmt.Errorf("unable to resolve config: %v", err)
+		m.release(g)
+		return nil, nil, fmt.Errorf("unable to resolve config: %v", err)
 	}
 	if glog.V(2) {
 		glog.Infof("Resolved [%d] ==> %v ", len(configs), configs)
 	}
-	return configs, nil
+	return configs, g, nil
 }
 
 // Preprocess dispatches to the set of aspects that must run before any other
 // configured aspects.
 func (m *Manager) Preprocess(ctx context.Context, requestBag, responseBag *attribute.MutableBag) rpc.Status {
-	configs, err := m.loadConfigs(requestBag, m.preprocessKindSet, true)
+	configs, g, err := m.loadConfigs(requestBag, m.preprocessKindSet, true)
 	if err != nil {
 		glog.Error(err)
 		return status.WithError(err)
 	}
-	return m.dispatch(ctx, requestBag, responseBag, configs,
-		func(executor aspect.Executor, eval expr.Evaluator) rpc.Status {
+	defer m.release(g)
+
+	return m.dispatch(ctx, g, requestBag, responseBag, configs, nil,
+		func(ctx context.Context, executor aspect.Executor, eval expr.Evaluator) rpc.Status {
 			ppw := executor.(aspect.PreprocessExecutor)
-			result, rpcStatus := ppw.Execute(requestBag, eval)
+			result, rpcStatus := ppw.Execute(ctx, requestBag, eval)
 			if status.IsOK(rpcStatus) {
 				if err := responseBag.Merge(result.Attrs); err != nil {
 					// TODO: better error messages that push internal details into debuginfo messages
@@ -218,53 +388,117 @@ func (m *Manager) Preprocess(ctx context.Context, requestBag, responseBag *attri
 		})
 }
 
-type invokeExecutorFunc func(executor aspect.Executor, evaluator expr.Evaluator) rpc.Status
+type invokeExecutorFunc func(ctx context.Context, executor aspect.Executor, evaluator expr.Evaluator) rpc.Status
 
-// dispatch resolves config and invokes the specific set of aspects necessary to service the current request
-func (m *Manager) dispatch(ctx context.Context, requestBag, responseBag *attribute.MutableBag, cfgs []*cpb.Combined, invokeFunc invokeExecutorFunc) rpc.Status {
+// dispatch resolves config and invokes the specific set of aspects necessary to service the current request.
+// The results are combined according to the given policy, a nil policy selects the default one.
+// The caller must hold a reference to g, each aspect takes one of its own for as long as it runs.
+func (m *Manager) dispatch(ctx context.Context, g *generation, requestBag, responseBag *attribute.MutableBag, cfgs []*cpb.Combined,
+	policy *cpb.ResultPolicy, invokeFunc invokeExecutorFunc) rpc.Status {
+	ctx, cancel := m.callContext(ctx, requestBag)
+	defer cancel()
+
+	return m.dispatchAll(ctx, g, requestBag, responseBag, cfgs, policy, invokeFunc)
+}
+
+// callContext returns the context the aspects of a call run under: ctx with the request's
+// attribute bag attached, and the call timeout applied if there is one.
+func (m *Manager) callContext(ctx context.Context, requestBag *attribute.MutableBag) (context.Context, context.CancelFunc) {
 	// get a new context with the attribute bag attached
 	ctx = attribute.NewContext(ctx, requestBag)
 
-	df, _ := m.df.Load().(descriptor.Finder)
+	if m.callTimeout > 0 {
+		return context.WithTimeout(ctx, m.callTimeout)
+	}
+	return ctx, func() {}
+}
+
+// dispatchAll invokes the aspects of cfgs together, under a context already set up by callContext.
+func (m *Manager) dispatchAll(ctx context.Context, g *generation, requestBag, responseBag *attribute.MutableBag, cfgs []*cpb.Combined,
+	policy *cpb.ResultPolicy, invokeFunc invokeExecutorFunc) rpc.Status {
 	numCfgs := len(cfgs)
 
-	// TODO: consider implementing a fast path when there is only a single config.
-	//       we don't need to schedule goroutines, we could use the incoming attribute
-	//       bags without needing children & merging, etc.
+	// a single aspect of a request without a deadline, nor a call timeout, runs on the calling
+	// goroutine: there is nothing to run alongside it, nor to give up on. An aspect that could
+	// be given up on goes through the pool, for the request not to wait on a hung adapter.
+	// Shedding load is up to the pool as well, so aspects always go through it then.
+	if numCfgs == 1 && ctx.Done() == nil && !m.shedLoad {
+		if out, done := m.dispatchOne(ctx, g, requestBag, responseBag, cfgs[0], policy, invokeFunc); done {
+			return out
+		}
+	}
 
-	// TODO: look into pooling both result array and channel, they're created per-request and are constant size for cfg lifetime.
-	results := make([]result, numCfgs)
-	resultChan := make(chan result, numCfgs)
+	ds := getDispatchState(numCfgs)
+	results, resultChan := ds.results, ds.resultChan
 
 	// schedule all the work that needs to happen
-	for _, cfg := range cfgs {
-		c := cfg // ensure proper capture in the worker func below
-		m.gp.ScheduleWork(func() {
+	for i, cfg := range cfgs {
+		idx, c := i, cfg // ensure proper capture in the worker func below
+		bh := g.bulkheads[bulkheadKeyOf(c.Builder)]
+
+		// an aspect turned away by its adapter may still be served by its fallbacks
+		entered := bh.enter()
+		if !entered && len(c.Fallbacks) == 0 {
+			resultChan <- result{idx, c, rejected(bh, c), responseBag.Child()}
+			continue
+		}
+
+		work := func() {
+			defer m.release(g)
+
 			childRequestBag := requestBag.Child()
 			childResponseBag := responseBag.Child()
 
-			out := m.execute(ctx, c, childRequestBag, childResponseBag, df, invokeFunc)
-			resultChan <- result{c, out, childResponseBag}
+			out := m.execute(ctx, g, c, entered, childRequestBag, childResponseBag, invokeFunc)
+			if entered {
+				bh.leave()
+			}
+			resultChan <- result{idx, c, out, childResponseBag}
 
 			childRequestBag.Done()
-		})
+		}
+
+		// the aspect may outlive the request if it fails fast or gets cancelled
+		atomic.AddInt32(&g.refs, 1)
+
+		if entered && bh.dedicated() {
+			bh.gp.ScheduleWork(work)
+		} else if !m.shedLoad {
+			m.gp.ScheduleWork(work)
+		} else if !m.gp.TrySchedule(work) {
+			if entered {
+				bh.leave()
+			}
+			m.release(g)
+			if glog.V(2) {
+				glog.Infof("Rejected aspect %s: the API worker pool is saturated", c.Aspect.Kind)
+			}
+			out := status.WithUnavailable(fmt.Sprintf("mixer is overloaded, aspect %s was not run", c.Aspect.Kind))
+			resultChan <- result{idx, c, out, responseBag.Child()}
+		}
 	}
 
+	failFast := policy.GetCombine() == cpb.ResultPolicy_FIRST_FAILURE
+
 	// wait for all the work to be done or the context to be cancelled
 	for i := 0; i < numCfgs; i++ {
 		select {
 		case <-ctx.Done():
-			if ctx.Err() == context.Canceled {
-				return status.WithCancelled(fmt.Sprintf("request cancelled: %v", ctx.Err()))
-			}
-			return status.WithDeadlineExceeded(fmt.Sprintf("deadline exceeded waiting for adapter results with err: %v", ctx.Err()))
+			return contextStatus(ctx)
 		case res := <-resultChan:
-			results[i] = res
+			// keep results in config order, independently of the order in which they completed
+			results[res.index] = res
+			if failFast && !res.ok() {
+				// the remaining results are dropped, their response attributes are never merged
+				return combineResults([]result{res}, policy)
+			}
 		}
 	}
 
-	// TODO: look into having a pool of these to avoid frequent allocs
-	bags := make([]*attribute.MutableBag, numCfgs)
+	// every aspect has sent its result, ds can be reused once we're done with it
+	defer putDispatchState(ds)
+
+	bags := ds.bags
 	for i, r := range results {
 		bags[i] = r.responseBag
 	}
@@ -278,80 +512,273 @@ func (m *Manager) dispatch(ctx context.Context, requestBag, responseBag *attribu
 		b.Done()
 	}
 
-	return combineResults(results)
+	return combineResults(results, policy)
 }
 
-// Combines a bunch of distinct result structs and turns 'em into one single rpc.Status
-func combineResults(results []result) rpc.Status {
-	var buf *bytes.Buffer
-	code := rpc.OK
+// dispatchOne runs a single aspect on the calling goroutine, straight on the bags of the request.
+// It returns false, without running the aspect, when the aspect has to run on the dedicated pool
+// of its adapter.
+func (m *Manager) dispatchOne(ctx context.Context, g *generation, requestBag, responseBag *attribute.MutableBag, cfg *cpb.Combined,
+	policy *cpb.ResultPolicy, invokeFunc invokeExecutorFunc) (rpc.Status, bool) {
+	bh := g.bulkheads[bulkheadKeyOf(cfg.Builder)]
+	if bh.dedicated() {
+		return status.OK, false
+	}
+
+	var out rpc.Status
+	if bh.enter() {
+		out = m.execute(ctx, g, cfg, true, requestBag, responseBag, invokeFunc)
+		bh.leave()
+	} else if len(cfg.Fallbacks) > 0 {
+		out = m.execute(ctx, g, cfg, false, requestBag, responseBag, invokeFunc)
+	} else {
+		out = rejected(bh, cfg)
+	}
 
-	for _, r := range results {
-		if !status.IsOK(r.status) {
-			if buf == nil {
-				buf = pool.GetBuffer()
-				// the first failure result's code becomes the result code for the output
-				code = rpc.Code(r.status.Code)
-			} else {
-				buf.WriteString(", ")
+	if status.IsOK(out) {
+		return status.OK, true
+	}
+	return combineResults([]result{{0, cfg, out, nil}}, policy), true
+}
+
+// contextStatus returns the status of a request whose context is done.
+func contextStatus(ctx context.Context) rpc.Status {
+	if ctx.Err() == context.Canceled {
+		return status.WithCancelled(fmt.Sprintf("request cancelled: %v", ctx.Err()))
+	}
+	return status.WithDeadlineExceeded(fmt.Sprintf("deadline exceeded waiting for adapter results with err: %v", ctx.Err()))
+}
+
+// rejected returns the status of an aspect turned away because its adapter is at its concurrency limit.
+func rejected(bh *bulkhead, cfg *cpb.Combined) rpc.Status {
+	if glog.V(2) {
+		glog.Infof("Rejected aspect %s: adapter %s is at its concurrency limit", cfg.Aspect.Kind, bh.key)
+	}
+	return status.WithUnavailable(fmt.Sprintf("adapter %s is at its concurrency limit, aspect %s was not run", bh.key, cfg.Aspect.Kind))
+}
+
+// dispatchState is what dispatch uses to collect the results of the aspects, pooled across requests.
+type dispatchState struct {
+	results    []result
+	resultChan chan result
+	bags       []*attribute.MutableBag
+}
+
+var dispatchStates = sync.Pool{New: func() interface{} { return &dispatchState{} }}
+
+// getDispatchState returns a dispatch state for n aspects from the pool.
+func getDispatchState(n int) *dispatchState {
+	ds := dispatchStates.Get().(*dispatchState)
+	if cap(ds.results) < n {
+		ds.results = make([]result, n)
+		ds.resultChan = make(chan result, n)
+		ds.bags = make([]*attribute.MutableBag, n)
+	}
+	ds.results = ds.results[:n]
+	ds.bags = ds.bags[:n]
+	return ds
+}
+
+// putDispatchState returns ds to the pool. It must only be called once every aspect has sent its
+// result, aspects still running would send theirs to another request otherwise.
+func putDispatchState(ds *dispatchState) {
+	for i := range ds.results {
+		ds.results[i] = result{}
+	}
+	for i := range ds.bags {
+		ds.bags[i] = nil
+	}
+	dispatchStates.Put(ds)
+}
+
+// dispatchOrdered invokes the aspects one stage at a time, in the order in which they were
+// resolved, and stops at the first stage that doesn't return OK. Consecutive configs naming
+// the same stage are dispatched together, every other config is a stage of its own.
+// The call timeout applies to all the stages together.
+func (m *Manager) dispatchOrdered(ctx context.Context, g *generation, requestBag, responseBag *attribute.MutableBag, cfgs []*cpb.Combined,
+	policy *cpb.ResultPolicy, invokeFunc invokeExecutorFunc) rpc.Status {
+	ctx, cancel := m.callContext(ctx, requestBag)
+	defer cancel()
+
+	for len(cfgs) > 0 {
+		n := 1
+		if stage := cfgs[0].Aspect.GetStage(); stage != "" {
+			for n < len(cfgs) && cfgs[n].Aspect.GetStage() == stage {
+				n++
 			}
-			buf.WriteString(r.cfg.String() + ":" + r.status.Message)
 		}
+
+		if out := m.dispatchAll(ctx, g, requestBag, responseBag, cfgs[:n], policy, invokeFunc); !status.IsOK(out) {
+			if glog.V(2) {
+				glog.Infof("Ordered dispatch stopped with %d aspect(s) left to run: %v", len(cfgs)-n, out)
+			}
+			return out
+		}
+		cfgs = cfgs[n:]
 	}
+	return status.OK
+}
 
-	s := status.OK
-	if buf != nil {
-		s = status.WithMessage(code, buf.String())
-		pool.PutBuffer(buf)
+// execute performs action described in the combined config using the attribute bag. When the adapter
+// fails with a backend failure, its breaker is open, or it turned the aspect away at its bulkhead,
+// which entered reports, the aspect runs on the fallback adapters in turn.
+func (m *Manager) execute(ctx context.Context, g *generation, cfg *cpb.Combined, entered bool, requestBag, responseBag *attribute.MutableBag,
+	invokeFunc invokeExecutorFunc) rpc.Status {
+	if len(cfg.Fallbacks) == 0 {
+		out, _ := m.executeOn(ctx, g, cfg, requestBag, responseBag, invokeFunc)
+		return out
 	}
+	return m.executeChain(ctx, g, cfg, entered, requestBag, responseBag, invokeFunc)
+}
+
+// executeChain runs the aspect on its adapter, then on its fallbacks, until one of them serves it or
+// the context is done. Only the response attributes of the adapter that served the aspect are kept.
+func (m *Manager) executeChain(ctx context.Context, g *generation, cfg *cpb.Combined, entered bool, requestBag, responseBag *attribute.MutableBag,
+	invokeFunc invokeExecutorFunc) (out rpc.Status) {
+	primary := bulkheadKeyOf(cfg.Builder).String()
+	served := "none"
+
+	c := cfg
+	for i := 0; ; i++ {
+		bag := responseBag.Child()
+
+		var ran bool
+		if i == 0 && entered {
+			// the primary adapter went through its bulkhead when the aspect was dispatched
+			out, ran = m.executeOn(ctx, g, c, requestBag, bag, invokeFunc)
+		} else if bh := g.bulkheads[bulkheadKeyOf(c.Builder)]; i == 0 || !bh.enter() {
+			out = rejected(bh, c)
+		} else if bh.dedicated() {
+			out, ran = m.executeIsolated(ctx, g, bh, c, requestBag, bag, invokeFunc)
+		} else {
+			out, ran = m.executeOn(ctx, g, c, requestBag, bag, invokeFunc)
+			bh.leave()
+		}
 
-	return s
+		if ran && !isBackendFailure(out) {
+			served = bulkheadKeyOf(c.Builder).String()
+			if err := responseBag.Merge(bag); err != nil {
+				glog.Errorf("Unable to merge response attributes: %v", err)
+				out = status.WithError(err)
+			}
+		}
+		bag.Done()
+
+		if served != "none" || i == len(cfg.Fallbacks) || ctx.Err() != nil {
+			break
+		}
+
+		c = &cpb.Combined{Builder: cfg.Fallbacks[i], Aspect: cfg.Aspect}
+		if glog.V(2) {
+			glog.Infof("Aspect %s failed on adapter %s with %v, falling back to adapter %s",
+				cfg.Aspect.Kind, bulkheadKeyOf(cfg.Builder), out, bulkheadKeyOf(c.Builder))
+		}
+	}
+
+	if served != primary {
+		aspectFallbacks.WithLabelValues(cfg.Aspect.Kind, primary, served).Inc()
+	}
+	return out
 }
 
-// result holds the values returned by the execution of an adapter
-type result struct {
-	cfg         *cpb.Combined
-	status      rpc.Status
-	responseBag *attribute.MutableBag
+// executeIsolated runs the aspect on the dedicated pool of the adapter of cfg, admitted by its
+// bulkhead bh, and waits for it unless ctx is done first. The aspect keeps running on bags of
+// its own then, like the aspects dispatchAll stops waiting for.
+func (m *Manager) executeIsolated(ctx context.Context, g *generation, bh *bulkhead, cfg *cpb.Combined,
+	requestBag, responseBag *attribute.MutableBag, invokeFunc invokeExecutorFunc) (rpc.Status, bool) {
+	type outcome struct {
+		out rpc.Status
+		ran bool
+	}
+	done := make(chan outcome, 1)
+	childRequestBag := requestBag.Child()
+	childResponseBag := responseBag.Child()
+
+	atomic.AddInt32(&g.refs, 1)
+	bh.gp.ScheduleWork(func() {
+		defer m.release(g)
+		out, ran := m.executeOn(ctx, g, cfg, childRequestBag, childResponseBag, invokeFunc)
+		bh.leave()
+		childRequestBag.Done()
+		done <- outcome{out, ran}
+	})
+
+	select {
+	case <-ctx.Done():
+		return contextStatus(ctx), false
+	case o := <-done:
+		if err := responseBag.Merge(childResponseBag); err != nil {
+			glog.Errorf("Unable to merge response attributes: %v", err)
+			o.out = status.WithError(err)
+		}
+		childResponseBag.Done()
+		return o.out, o.ran
+	}
 }
 
-// execute performs action described in the combined config using the attribute bag
-func (m *Manager) execute(ctx context.Context, cfg *cpb.Combined, requestBag, responseBag *attribute.MutableBag,
-	df descriptor.Finder, invokeFunc invokeExecutorFunc) (out rpc.Status) {
+// executeOn runs the aspect on the adapter of cfg. ran is false if the adapter wasn't invoked, because
+// its executor couldn't be constructed or its breaker is open.
+func (m *Manager) executeOn(ctx context.Context, g *generation, cfg *cpb.Combined, requestBag, responseBag *attribute.MutableBag,
+	invokeFunc invokeExecutorFunc) (out rpc.Status, ran bool) {
 	var mgr aspect.Manager
 	var found bool
 
 	kind, found := config.ParseKind(cfg.Aspect.Kind)
 	if !found {
-		return status.WithError(fmt.Errorf("invalid aspect %#v", cfg.Aspect.Kind))
+		return status.WithError(fmt.Errorf("invalid aspect %#v", cfg.Aspect.Kind)), false
 	}
 
 	mgr = m.managers[kind]
 	if mgr == nil {
-		return status.WithError(fmt.Errorf("could not find aspect manager %#v", cfg.Aspect.Kind))
+		return status.WithError(fmt.Errorf("could not find aspect manager %#v", cfg.Aspect.Kind)), false
 	}
 
 	var builder adapter.Builder
 	if builder, found = m.builders.FindBuilder(cfg.Builder.Impl); !found {
-		return status.WithError(fmt.Errorf("could not find registered adapter %#v", cfg.Builder.Impl))
+		return status.WithError(fmt.Errorf("could not find registered adapter %#v", cfg.Builder.Impl)), false
 	}
 
+	// set once the executor's breaker has admitted the call, so that the outcome gets recorded
+	var brk *breaker
+	var probe bool
+
+	// set once the executor is invoked, so that its panics get accounted for
+	var sup *supervisedExecutor
+	var inc *incarnation
+
+	start := time.Now()
+
 	// Both cacheGet and invokeFunc call adapter-supplied code, so we need to guard against both panicking.
 	defer func() {
 		if r := recover(); r != nil {
 			out = status.WithError(fmt.Errorf("adapter '%s' panicked with '%v'", builder.Name(), r))
+			if inc != nil {
+				sup.panicked(inc.id, false)
+			}
+		}
+		if inc != nil {
+			sup.put(inc)
 		}
+		brk.record(probe, isBackendFailure(out))
+
+		adapterCalls.WithLabelValues(builder.Name(), cfg.Aspect.Kind, rpc.Code(out.Code).String()).Inc()
+		adapterDuration.WithLabelValues(builder.Name(), cfg.Aspect.Kind).Observe(time.Since(start).Seconds())
 	}()
 
-	executor, err := m.cacheGet(cfg, mgr, builder, df)
+	entry, err := m.cacheGet(g, cfg, mgr, builder)
 	if err != nil {
-		return status.WithError(err)
+		return status.WithError(err), false
 	}
 
-	// TODO: plumb ctx through asp.Execute
-	_ = ctx
+	var ok bool
+	if probe, ok = entry.breaker.allow(); !ok {
+		return entry.breaker.fallback(), false
+	}
+	brk = entry.breaker
 
-	return invokeFunc(executor, m.mapper)
+	sup = entry.executor
+	inc = sup.get()
+	return invokeFunc(ctx, inc.executor, m.mapper), true
 }
 
 // cacheKey is used to cache fully constructed aspects
@@ -393,55 +820,127 @@ func newCacheKey(kind config.Kind, cfg *cpb.Combined) (*cacheKey, error) {
 	return &ret, nil
 }
 
-// cacheGet gets an aspect executor from the cache, use adapter.Manager to construct an object in case of a cache miss
-func (m *Manager) cacheGet(cfg *cpb.Combined, mgr aspect.Manager, builder adapter.Builder, df descriptor.Finder) (executor aspect.Executor, err error) {
+// cacheGet gets an aspect executor from the cache of g, use adapter.Manager to construct an object in case of a cache miss.
+// A construction failure is a config error: it is recorded, and returned as is for the rest of the generation.
+func (m *Manager) cacheGet(g *generation, cfg *cpb.Combined, mgr aspect.Manager, builder adapter.Builder) (entry *cacheEntry, err error) {
 	var key *cacheKey
 	if key, err = newCacheKey(mgr.Kind(), cfg); err != nil {
 		return nil, err
 	}
 
 	// try fast path with read lock
-	m.lock.RLock()
-	executor, found := m.executorCache[*key]
-	m.lock.RUnlock()
+	g.lock.RLock()
+	entry, found := g.executors[*key]
+	err, failed := g.failures[*key]
+	g.lock.RUnlock()
 
 	if found {
-		return executor, nil
+		return entry, nil
+	}
+	if failed {
+		return nil, err
 	}
 
-	// create an aspect
-	env := newEnv(builder.Name(), m.adapterGP)
+	// create an aspect, and keep what's needed to create it again should it crash. The first
+	// incarnation reconfigures the aspect of the previous config of the adapter when it can.
+	g.lock.Lock()
+	prior := g.priors[*key]
+	delete(g.priors, *key)
+	g.lock.Unlock()
+
+	df := g.df
+	tracker := newAspectTracker(builder, prior)
+	b := builder
+	if reconfigurableKinds.IsSet(mgr.Kind()) {
+		b = tracker
+	}
+	executor, err := newSupervisedExecutor(builder.Name(), mgr.Kind().String(), &m.crashPolicy, m.adapterGP, m.callTimeout,
+		func(env adapter.Env) (executor aspect.Executor, err error) {
+			switch m := mgr.(type) {
+			case aspect.PreprocessManager:
+				executor, err = m.NewPreprocessExecutor(cfg, b, env, df)
+			case aspect.CheckManager:
+				executor, err = m.NewCheckExecutor(cfg, b, env, df)
+			case aspect.ReportManager:
+				executor, err = m.NewReportExecutor(cfg, b, env, df)
+			case aspect.QuotaManager:
+				executor, err = m.NewQuotaExecutor(cfg, b, env, df)
+			}
+			return executor, err
+		})
 
-	switch m := mgr.(type) {
-	case aspect.PreprocessManager:
-		executor, err = m.NewPreprocessExecutor(cfg, builder, env, df)
-	case aspect.CheckManager:
-		executor, err = m.NewCheckExecutor(cfg, builder, env, df)
-	case aspect.ReportManager:
-		executor, err = m.NewReportExecutor(cfg, builder, env, df)
-	case aspect.QuotaManager:
-		executor, err = m.NewQuotaExecutor(cfg, builder, env, df)
+	tracker.release()
+	if err != nil {
+		tracker.abandon()
 	}
 
+	// obtain write lock
+	g.lock.Lock()
+
 	if err != nil {
+		err = fmt.Errorf("unable to configure %s adapter '%s': %v", mgr.Kind(), builder.Name(), err)
+		if _, dup := g.failures[*key]; !dup {
+			g.failures[*key] = err
+			executorFailures.WithLabelValues(builder.Name(), mgr.Kind().String()).Inc()
+			glog.Errorf("Config generation %d: %v", g.id, err)
+			// with eagerBuild, the failure rejects the config and is reported as such
+			if m.reportError != nil && !m.eagerBuild {
+				m.reportError(err)
+			}
+		}
+		g.lock.Unlock()
 		return nil, err
 	}
 
-	// obtain write lock
-	m.lock.Lock()
-
 	// see if someone else beat us to it
-	if other, found := m.executorCache[*key]; found {
+	if other, found := g.executors[*key]; found {
 		defer closeExecutor(executor)
-		executor = other
+		defer tracker.revert()
+		entry = other
 	} else {
 		// we are the first one so save the executor
-		m.executorCache[*key] = executor
+		entry = &cacheEntry{
+			executor: executor,
+			breaker:  newBreaker(builder.Name(), mgr.Kind().String(), &m.breakerCfg),
+			adapter:  cfg.Builder.GetName(),
+			aspects:  tracker,
+			owners:   1,
+		}
+		g.executors[*key] = entry
+		executorCacheSize.Inc()
+		if tracker.reconfigured() {
+			g.reconfigured = append(g.reconfigured, tracker)
+		}
+	}
+
+	g.lock.Unlock()
+
+	return entry, nil
+}
+
+// ReportErrorsTo makes the manager pass the executors that fail to be constructed on first use
+// to fn, typically config.Manager.RecordError. It must be called before the first config change.
+func (m *Manager) ReportErrorsTo(fn func(error)) {
+	m.reportError = fn
+}
+
+// Close closes all the cached executors, which flushes any reports they buffered, and then
+// all the builders. It waits for the requests still being served by any config generation to
+// complete first. The manager must not be used afterwards.
+func (m *Manager) Close() error {
+	var result *multierror.Error
+
+	if err := m.closeExecutors(); err != nil {
+		result = multierror.Append(result, err)
 	}
 
-	m.lock.Unlock()
+	if c, ok := m.builders.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
 
-	return executor, nil
+	return result.ErrorOrNil()
 }
 
 func closeExecutor(executor aspect.Executor) {
@@ -489,8 +988,7 @@ func Aspects(inventory aspect.ManagerInventory) [config.NumKinds]aspect.Manager
 	return r
 }
 
-// ConfigChange listens for config change notifications.
-func (m *Manager) ConfigChange(cfg config.Resolver, df descriptor.Finder) {
-	m.cfg.Store(cfg)
-	m.df.Store(df)
+// Configured returns true once a valid config has been installed through ConfigChange.
+func (m *Manager) Configured() bool {
+	return m.gen.Load() != nil
 }
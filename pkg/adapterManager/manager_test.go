@@ -17,11 +17,14 @@ package adapterManager
 import (
 	"context"
 	"errors"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	rpc "github.com/googleapis/googleapis/google/rpc"
+	dto "github.com/prometheus/client_model/go"
 
 	"istio.io/mixer/pkg/adapter"
 	"istio.io/mixer/pkg/aspect"
@@ -94,11 +97,15 @@ type (
 
 	fakeReportExecutor struct {
 		called int8
+		closed int8
 	}
 
 	fakeQuotaExecutor struct {
 		called int8
 		result aspect.QuotaMethodResp
+		fail   string                    // quota whose allocations fail
+		broken bool                      // whether every operation fails with an internal error
+		args   []*aspect.QuotaMethodArgs // operations seen, in order
 	}
 
 	fakeBuilder struct {
@@ -110,6 +117,21 @@ type (
 		ret []*cpb.Combined
 		err error
 	}
+
+	// fakeResolver with a service config
+	scResolver struct {
+		fakeResolver
+		sc *cpb.ServiceConfig
+	}
+
+	// builds an executor per adapter impl, records the order in which they get called.
+	orderedCheckMgr struct {
+		testManager
+		bodies map[string]rpc.Status
+		block  map[string]chan struct{}
+		lock   sync.Mutex
+		calls  []string
+	}
 )
 
 func (f *fakeResolver) Resolve(bag attribute.Bag, kindSet config.KindSet) ([]*cpb.Combined, error) {
@@ -120,28 +142,63 @@ func (f *fakeResolver) ResolveUnconditional(bag attribute.Bag, kindSet config.Ki
 	return f.ret, f.err
 }
 
+func (f *fakeResolver) Combined() []*cpb.Combined {
+	return f.ret
+}
+
+func (f *fakeResolver) ServiceConfig() *cpb.ServiceConfig {
+	return nil
+}
+
+func (f *scResolver) ServiceConfig() *cpb.ServiceConfig {
+	return f.sc
+}
+
+func (m *orderedCheckMgr) NewCheckExecutor(cfg *cpb.Combined, _ adapter.Builder, _ adapter.Env, _ descriptor.Finder) (aspect.CheckExecutor, error) {
+	name := cfg.Builder.Impl
+	return testAspect{func() rpc.Status {
+		if ch := m.block[name]; ch != nil {
+			<-ch
+		}
+		m.lock.Lock()
+		m.calls = append(m.calls, name)
+		m.lock.Unlock()
+		return m.bodies[name]
+	}}, nil
+}
+
 func (f *fakeBuilder) Name() string { return f.name }
 
-func (f *fakePreprocessExecutor) Execute(attrs attribute.Bag, mapper expr.Evaluator) (*aspect.PreprocessResult, rpc.Status) {
+func (f *fakePreprocessExecutor) Execute(ctx context.Context, attrs attribute.Bag, mapper expr.Evaluator) (*aspect.PreprocessResult, rpc.Status) {
 	f.called++
 	return &aspect.PreprocessResult{}, status.OK
 }
 func (f *fakePreprocessExecutor) Close() error { return nil }
 
-func (f *fakeCheckExecutor) Execute(attrs attribute.Bag, mapper expr.Evaluator) (output rpc.Status) {
+func (f *fakeCheckExecutor) Execute(ctx context.Context, attrs attribute.Bag, mapper expr.Evaluator) (output rpc.Status) {
 	f.called++
 	return
 }
 func (f *fakeCheckExecutor) Close() error { return nil }
 
-func (f *fakeReportExecutor) Execute(attrs attribute.Bag, mapper expr.Evaluator) (output rpc.Status) {
+func (f *fakeReportExecutor) Execute(ctx context.Context, attrs attribute.Bag, mapper expr.Evaluator) (output rpc.Status) {
 	f.called++
 	return
 }
-func (f *fakeReportExecutor) Close() error { return nil }
+func (f *fakeReportExecutor) Close() error {
+	f.closed++
+	return nil
+}
 
-func (f *fakeQuotaExecutor) Execute(attrs attribute.Bag, mapper expr.Evaluator, qma *aspect.QuotaMethodArgs) (output rpc.Status, qmr *aspect.QuotaMethodResp) {
+func (f *fakeQuotaExecutor) Execute(ctx context.Context, attrs attribute.Bag, mapper expr.Evaluator, qma *aspect.QuotaMethodArgs) (output rpc.Status, qmr *aspect.QuotaMethodResp) {
 	f.called++
+	f.args = append(f.args, qma)
+	if f.broken {
+		return status.WithError(errors.New("backend down")), nil
+	}
+	if qma != nil && qma.Quota == f.fail && !qma.Release {
+		return status.WithResourceExhausted("out of " + qma.Quota), nil
+	}
 	return status.OK, &f.result
 }
 func (f *fakeQuotaExecutor) Close() error { return nil }
@@ -224,7 +281,7 @@ func (m testManager) NewDenyChecker(env adapter.Env, c adapter.Config) (adapter.
 }
 
 func (testAspect) Close() error { return nil }
-func (t testAspect) Execute(attrs attribute.Bag, mapper expr.Evaluator) rpc.Status {
+func (t testAspect) Execute(ctx context.Context, attrs attribute.Bag, mapper expr.Evaluator) rpc.Status {
 	return t.body()
 }
 func (testAspect) Deny() rpc.Status                                    { return rpc.Status{Code: int32(rpc.INTERNAL)} }
@@ -320,7 +377,7 @@ func TestManager(t *testing.T) {
 		agp := pool.NewGoroutinePool(1, true)
 		m := newManager(r, mgr, mapper, aspect.ManagerInventory{}, gp, agp)
 
-		m.cfg.Store(&fakeResolver{tt.cfg, nil})
+		_ = m.ConfigChange(&fakeResolver{tt.cfg, nil}, nil)
 
 		out := m.Check(context.Background(), requestBag, responseBag)
 		errStr := out.Message
@@ -377,7 +434,7 @@ func TestManager_Preprocess(t *testing.T) {
 		},
 	}
 
-	m.cfg.Store(&fakeResolver{cfg, nil})
+	_ = m.ConfigChange(&fakeResolver{cfg, nil}, nil)
 
 	out := m.Preprocess(context.Background(), requestBag, responseBag)
 
@@ -393,6 +450,50 @@ func TestManager_Preprocess(t *testing.T) {
 	agp.Close()
 }
 
+func TestManager_Configured(t *testing.T) {
+	m := newManager(getReg(true), newFakeMgrReg(nil, nil, nil, nil), &fakeEvaluator{}, aspect.ManagerInventory{}, nil, nil)
+	if m.Configured() {
+		t.Error("Configured() = true before any config change, wanted false")
+	}
+
+	_ = m.ConfigChange(&fakeResolver{}, descriptor.NewFinder(&cpb.GlobalConfig{}))
+	if !m.Configured() {
+		t.Error("Configured() = false after a config change, wanted true")
+	}
+}
+
+func TestManager_Close(t *testing.T) {
+	gp := pool.NewGoroutinePool(1, true)
+	agp := pool.NewGoroutinePool(1, true)
+	re := &fakeReportExecutor{}
+	m := newManager(getReg(true), newFakeMgrReg(nil, nil, re, nil), &fakeEvaluator{}, aspect.ManagerInventory{}, gp, agp)
+
+	cfg := []*cpb.Combined{
+		{
+			Aspect:  &cpb.Aspect{Kind: config.AccessLogsKindName},
+			Builder: &cpb.Adapter{Name: "Foo"},
+		},
+	}
+	_ = m.ConfigChange(&fakeResolver{cfg, nil}, nil)
+
+	if out := m.Report(context.Background(), attribute.GetMutableBag(nil), attribute.GetMutableBag(nil)); !status.IsOK(out) {
+		t.Fatalf("Report failed with %v", out)
+	}
+
+	if err := m.Close(); err != nil {
+		t.Errorf("Close() = %v, wanted no error", err)
+	}
+	if re.closed != 1 {
+		t.Errorf("Executor closed %d times, want: 1", re.closed)
+	}
+	if executors := m.Executors(); len(executors) != 0 {
+		t.Errorf("%d executors left in the cache after Close()", len(executors))
+	}
+
+	gp.Close()
+	agp.Close()
+}
+
 func TestReport(t *testing.T) {
 	r := getReg(true)
 	requestBag := attribute.GetMutableBag(nil)
@@ -411,7 +512,7 @@ func TestReport(t *testing.T) {
 			Builder: &cpb.Adapter{Name: "Foo"},
 		},
 	}
-	m.cfg.Store(&fakeResolver{cfg, nil})
+	_ = m.ConfigChange(&fakeResolver{cfg, nil}, nil)
 
 	out := m.Report(context.Background(), requestBag, responseBag)
 
@@ -445,7 +546,7 @@ func TestQuota(t *testing.T) {
 			Builder: &cpb.Adapter{Name: "Foo"},
 		},
 	}
-	m.cfg.Store(&fakeResolver{cfg, nil})
+	_ = m.ConfigChange(&fakeResolver{cfg, nil}, nil)
 
 	qmr, out := m.Quota(context.Background(), requestBag, responseBag, nil)
 
@@ -465,6 +566,74 @@ func TestQuota(t *testing.T) {
 	agp.Close()
 }
 
+func TestQuotaBatch(t *testing.T) {
+	cases := []struct {
+		name         string
+		fail         string
+		dedup        string
+		wantCode     rpc.Code
+		wantReleased []string
+	}{
+		{"all granted", "", "id", rpc.OK, nil},
+		{"first fails", "a", "id", rpc.RESOURCE_EXHAUSTED, nil},
+		{"last fails", "c", "id", rpc.RESOURCE_EXHAUSTED, []string{"a", "b"}},
+		{"no deduplication id", "c", "", rpc.RESOURCE_EXHAUSTED, []string{"a", "b"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			requestBag := attribute.GetMutableBag(nil)
+			responseBag := attribute.GetMutableBag(nil)
+			gp := pool.NewGoroutinePool(1, true)
+			agp := pool.NewGoroutinePool(1, true)
+			qe := &fakeQuotaExecutor{result: aspect.QuotaMethodResp{Amount: 5}, fail: c.fail}
+			m := newManager(getReg(true), newFakeMgrReg(nil, nil, nil, qe), &fakeEvaluator{}, aspect.ManagerInventory{}, gp, agp)
+			_ = m.ConfigChange(&fakeResolver{[]*cpb.Combined{
+				{Aspect: &cpb.Aspect{Kind: config.QuotasKindName}, Builder: &cpb.Adapter{Name: "Foo"}},
+			}, nil}, nil)
+
+			// the operations of a batch may well share their ID
+			qmas := []*aspect.QuotaMethodArgs{
+				{Quota: "a", Amount: 5, DeduplicationID: c.dedup},
+				{Quota: "b", Amount: 5, DeduplicationID: c.dedup},
+				{Quota: "c", Amount: 5, DeduplicationID: c.dedup},
+			}
+			qmrs, out := m.QuotaBatch(context.Background(), requestBag, responseBag, qmas)
+
+			if out.Code != int32(c.wantCode) {
+				t.Errorf("QuotaBatch() = %v, wanted %v", out, c.wantCode)
+			}
+			if len(qmrs) != len(qmas) {
+				t.Errorf("got %d results, wanted %d", len(qmrs), len(qmas))
+			}
+
+			var released []string
+			ids := make(map[string]bool)
+			for _, qma := range qe.args {
+				if qma.Release {
+					released = append(released, qma.Quota)
+					if qma.Amount != 5 {
+						t.Errorf("rollback %+v, wanted the granted amount", qma)
+					}
+					if c.dedup == "" && qma.DeduplicationID != "" {
+						t.Errorf("rollback %+v, wanted no deduplication id like the allocation", qma)
+					}
+					if c.dedup != "" && (qma.DeduplicationID == c.dedup || ids[qma.DeduplicationID]) {
+						t.Errorf("rollback %+v, wanted a deduplication id of its own", qma)
+					}
+					ids[qma.DeduplicationID] = true
+				}
+			}
+			if !reflect.DeepEqual(released, c.wantReleased) {
+				t.Errorf("released %v, wanted %v", released, c.wantReleased)
+			}
+
+			gp.Close()
+			agp.Close()
+		})
+	}
+}
+
 func TestManager_BulkExecute(t *testing.T) {
 	goodcfg := &cpb.Combined{
 		Aspect:  &cpb.Aspect{Kind: config.DenialsKindName, Params: &rpc.Status{}},
@@ -503,7 +672,7 @@ func TestManager_BulkExecute(t *testing.T) {
 		agp := pool.NewGoroutinePool(1, true)
 		m := newManager(r, mgr, mapper, aspect.ManagerInventory{}, gp, agp)
 
-		m.cfg.Store(&fakeResolver{c.cfgs, nil})
+		_ = m.ConfigChange(&fakeResolver{c.cfgs, nil}, nil)
 
 		out := m.Check(context.Background(), requestBag, responseBag)
 		errStr := out.Message
@@ -516,6 +685,356 @@ func TestManager_BulkExecute(t *testing.T) {
 	}
 }
 
+func TestManager_CheckOrdered(t *testing.T) {
+	ok := status.OK
+	denied := status.WithPermissionDenied("denied")
+	cases := []struct {
+		name      string
+		stages    []string
+		bodies    map[string]rpc.Status
+		wantCode  rpc.Code
+		wantCalls []string
+	}{
+		{"all ok", []string{"", "", ""},
+			map[string]rpc.Status{"a": ok, "b": ok, "c": ok}, rpc.OK, []string{"a", "b", "c"}},
+		{"stop at first denial", []string{"", "", ""},
+			map[string]rpc.Status{"a": ok, "b": denied, "c": ok}, rpc.PERMISSION_DENIED, []string{"a", "b"}},
+		{"first stage denies", []string{"s1", "s1", ""},
+			map[string]rpc.Status{"a": denied, "b": ok, "c": ok}, rpc.PERMISSION_DENIED, []string{"a", "b"}},
+		{"second stage denies", []string{"", "s2", "s2"},
+			map[string]rpc.Status{"a": ok, "b": ok, "c": denied}, rpc.PERMISSION_DENIED, []string{"a", "b", "c"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mgr := &orderedCheckMgr{bodies: c.bodies}
+			mreg := [config.NumKinds]aspect.Manager{}
+			mreg[config.DenialsKind] = mgr
+			breg := &fakeBuilderReg{adp: mgr.instance, found: true}
+
+			gp := pool.NewGoroutinePool(1, true)
+			agp := pool.NewGoroutinePool(1, true)
+			m := newManager(breg, mreg, nil, aspect.ManagerInventory{}, gp, agp)
+
+			var cfgs []*cpb.Combined
+			for i, name := range []string{"a", "b", "c"} {
+				cfgs = append(cfgs, &cpb.Combined{
+					Builder: &cpb.Adapter{Name: name, Impl: name},
+					Aspect:  &cpb.Aspect{Kind: config.DenialsKindName, Stage: c.stages[i]},
+				})
+			}
+			_ = m.ConfigChange(&scResolver{fakeResolver{cfgs, nil}, &cpb.ServiceConfig{CheckMode: cpb.ServiceConfig_ORDERED}}, nil)
+
+			out := m.Check(context.Background(), attribute.GetMutableBag(nil), attribute.GetMutableBag(nil))
+			if out.Code != int32(c.wantCode) {
+				t.Errorf("Check() = %v, wanted code %v", out, c.wantCode)
+			}
+			if strings.Join(mgr.calls, ",") != strings.Join(c.wantCalls, ",") {
+				t.Errorf("executors called: %v, wanted %v", mgr.calls, c.wantCalls)
+			}
+
+			gp.Close()
+			agp.Close()
+		})
+	}
+}
+
+func TestManager_CheckOrderedTimeout(t *testing.T) {
+	// each stage completes within the call timeout, both together don't
+	mgr := &orderedCheckMgr{
+		bodies: map[string]rpc.Status{"a": status.OK, "b": status.OK},
+		block:  map[string]chan struct{}{"a": make(chan struct{}), "b": make(chan struct{})},
+	}
+	time.AfterFunc(50*time.Millisecond, func() { close(mgr.block["a"]) })
+	time.AfterFunc(100*time.Millisecond, func() { close(mgr.block["b"]) })
+
+	mreg := [config.NumKinds]aspect.Manager{}
+	mreg[config.DenialsKind] = mgr
+	breg := &fakeBuilderReg{adp: mgr.instance, found: true}
+
+	gp := pool.NewGoroutinePool(2, false)
+	gp.AddWorkers(2)
+	agp := pool.NewGoroutinePool(1, true)
+	m := newManager(breg, mreg, nil, aspect.ManagerInventory{}, gp, agp)
+	m.callTimeout = 75 * time.Millisecond
+
+	var cfgs []*cpb.Combined
+	for _, name := range []string{"a", "b"} {
+		cfgs = append(cfgs, &cpb.Combined{
+			Builder: &cpb.Adapter{Name: name, Impl: name},
+			Aspect:  &cpb.Aspect{Kind: config.DenialsKindName},
+		})
+	}
+	_ = m.ConfigChange(&scResolver{fakeResolver{cfgs, nil}, &cpb.ServiceConfig{CheckMode: cpb.ServiceConfig_ORDERED}}, nil)
+
+	if out := m.Check(context.Background(), attribute.GetMutableBag(nil), attribute.GetMutableBag(nil)); out.Code != int32(rpc.DEADLINE_EXCEEDED) {
+		t.Errorf("Check() = %v, wanted DEADLINE_EXCEEDED", out)
+	}
+
+	<-mgr.block["b"]
+	_ = m.Close()
+	gp.Close()
+	agp.Close()
+}
+
+func TestManager_CheckShadow(t *testing.T) {
+	cases := []struct {
+		name     string
+		shadow   []bool
+		wantCode rpc.Code
+	}{
+		{"enforced", []bool{false, false}, rpc.PERMISSION_DENIED},
+		{"denial in shadow", []bool{false, true}, rpc.OK},
+		{"shadow failure is ignored", []bool{true, false}, rpc.PERMISSION_DENIED},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mgr := &orderedCheckMgr{bodies: map[string]rpc.Status{
+				"a": status.WithInternal("broken"),
+				"b": status.WithPermissionDenied("denied"),
+			}}
+			if !c.shadow[0] {
+				mgr.bodies["a"] = status.OK
+			}
+			mreg := [config.NumKinds]aspect.Manager{}
+			mreg[config.DenialsKind] = mgr
+			breg := &fakeBuilderReg{adp: mgr.instance, found: true}
+
+			gp := pool.NewGoroutinePool(1, true)
+			agp := pool.NewGoroutinePool(1, true)
+			m := newManager(breg, mreg, nil, aspect.ManagerInventory{}, gp, agp)
+
+			var cfgs []*cpb.Combined
+			for i, name := range []string{"a", "b"} {
+				cfgs = append(cfgs, &cpb.Combined{
+					Builder: &cpb.Adapter{Name: name, Impl: name},
+					Aspect:  &cpb.Aspect{Kind: config.DenialsKindName, Shadow: c.shadow[i]},
+				})
+			}
+			_ = m.ConfigChange(&fakeResolver{cfgs, nil}, nil)
+
+			out := m.Check(context.Background(), attribute.GetMutableBag(nil), attribute.GetMutableBag(nil))
+			if out.Code != int32(c.wantCode) {
+				t.Errorf("Check() = %v, wanted code %v", out, c.wantCode)
+			}
+			if len(mgr.calls) != 2 {
+				t.Errorf("executors called: %v, wanted both to run", mgr.calls)
+			}
+
+			gp.Close()
+			agp.Close()
+		})
+	}
+}
+
+func fallbackCount(kind, adapter, servedBy string) float64 {
+	m := new(dto.Metric)
+	_ = aspectFallbacks.WithLabelValues(kind, adapter, servedBy).Write(m)
+	return m.GetCounter().GetValue()
+}
+
+func TestManager_Fallbacks(t *testing.T) {
+	cases := []struct {
+		name      string
+		bodies    map[string]rpc.Status
+		wantCode  rpc.Code
+		wantCalls []string
+		servedBy  string // adapter counted as serving the aspect instead of a, if any
+	}{
+		{"served", map[string]rpc.Status{"a": status.OK}, rpc.OK, []string{"a"}, ""},
+		{"denial is not a failure", map[string]rpc.Status{"a": status.WithPermissionDenied("denied")},
+			rpc.PERMISSION_DENIED, []string{"a"}, ""},
+		{"first fallback", map[string]rpc.Status{"a": status.WithInternal("broken"), "b": status.OK},
+			rpc.OK, []string{"a", "b"}, "b/b"},
+		{"second fallback", map[string]rpc.Status{"a": status.WithUnavailable("down"), "b": status.WithDeadlineExceeded("slow"), "c": status.OK},
+			rpc.OK, []string{"a", "b", "c"}, "c/c"},
+		{"fallback denies", map[string]rpc.Status{"a": status.WithUnavailable("down"), "b": status.WithPermissionDenied("denied")},
+			rpc.PERMISSION_DENIED, []string{"a", "b"}, "b/b"},
+		{"all fail", map[string]rpc.Status{"a": status.WithInternal("broken"), "b": status.WithInternal("broken"), "c": status.WithUnavailable("down")},
+			rpc.UNAVAILABLE, []string{"a", "b", "c"}, "none"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mgr := &orderedCheckMgr{bodies: c.bodies}
+			mreg := [config.NumKinds]aspect.Manager{}
+			mreg[config.DenialsKind] = mgr
+			breg := &fakeBuilderReg{adp: mgr.instance, found: true}
+
+			gp := pool.NewGoroutinePool(1, true)
+			agp := pool.NewGoroutinePool(1, true)
+			defer gp.Close()
+			defer agp.Close()
+			m := newManager(breg, mreg, nil, aspect.ManagerInventory{}, gp, agp)
+
+			cfgs := []*cpb.Combined{{
+				Builder:   &cpb.Adapter{Name: "a", Impl: "a"},
+				Aspect:    &cpb.Aspect{Kind: config.DenialsKindName},
+				Fallbacks: []*cpb.Adapter{{Name: "b", Impl: "b"}, {Name: "c", Impl: "c"}},
+			}}
+			_ = m.ConfigChange(&fakeResolver{cfgs, nil}, nil)
+
+			var before float64
+			if c.servedBy != "" {
+				before = fallbackCount(config.DenialsKindName, "a/a", c.servedBy)
+			}
+
+			out := m.Check(context.Background(), attribute.GetMutableBag(nil), attribute.GetMutableBag(nil))
+			if out.Code != int32(c.wantCode) {
+				t.Errorf("Check() = %v, wanted code %v", out, c.wantCode)
+			}
+			if strings.Join(mgr.calls, ",") != strings.Join(c.wantCalls, ",") {
+				t.Errorf("executors called: %v, wanted %v", mgr.calls, c.wantCalls)
+			}
+			if c.servedBy != "" {
+				if got := fallbackCount(config.DenialsKindName, "a/a", c.servedBy) - before; got != 1 {
+					t.Errorf("%d fallbacks to %s counted, wanted 1", int(got), c.servedBy)
+				}
+			}
+		})
+	}
+}
+
+func TestManager_CheckFirstFailure(t *testing.T) {
+	blocked := make(chan struct{})
+	mgr := &orderedCheckMgr{
+		bodies: map[string]rpc.Status{"slow": status.OK, "denied": status.WithPermissionDenied("denied")},
+		block:  map[string]chan struct{}{"slow": blocked},
+	}
+	mreg := [config.NumKinds]aspect.Manager{}
+	mreg[config.DenialsKind] = mgr
+	breg := &fakeBuilderReg{adp: mgr.instance, found: true}
+
+	gp := pool.NewGoroutinePool(4, false)
+	gp.AddWorkers(2)
+	agp := pool.NewGoroutinePool(1, true)
+	m := newManager(breg, mreg, nil, aspect.ManagerInventory{}, gp, agp)
+
+	var cfgs []*cpb.Combined
+	for _, name := range []string{"slow", "denied"} {
+		cfgs = append(cfgs, &cpb.Combined{
+			Builder: &cpb.Adapter{Name: name, Impl: name},
+			Aspect:  &cpb.Aspect{Kind: config.DenialsKindName},
+		})
+	}
+	sc := &cpb.ServiceConfig{CheckPolicy: &cpb.ResultPolicy{Combine: cpb.ResultPolicy_FIRST_FAILURE}}
+	_ = m.ConfigChange(&scResolver{fakeResolver{cfgs, nil}, sc}, nil)
+
+	// returns without waiting for the blocked aspect
+	out := m.Check(context.Background(), attribute.GetMutableBag(nil), attribute.GetMutableBag(nil))
+	if out.Code != int32(rpc.PERMISSION_DENIED) {
+		t.Errorf("Check() = %v, wanted PERMISSION_DENIED", out)
+	}
+
+	close(blocked)
+	gp.Close()
+	agp.Close()
+}
+
+func TestManager_LoadShedding(t *testing.T) {
+	mgr := &orderedCheckMgr{bodies: map[string]rpc.Status{"ok": status.OK}}
+	mreg := [config.NumKinds]aspect.Manager{}
+	mreg[config.DenialsKind] = mgr
+	breg := &fakeBuilderReg{adp: mgr.instance, found: true}
+
+	// a single worker with room for a single queued item, both taken
+	gp := pool.NewGoroutinePool(1, false)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	gp.ScheduleWork(func() {
+		close(started)
+		<-release
+	})
+	<-started
+	gp.ScheduleWork(func() {})
+
+	agp := pool.NewGoroutinePool(1, true)
+	m := newManager(breg, mreg, nil, aspect.ManagerInventory{}, gp, agp)
+	m.shedLoad = true
+
+	cfgs := []*cpb.Combined{{
+		Builder: &cpb.Adapter{Name: "ok", Impl: "ok"},
+		Aspect:  &cpb.Aspect{Kind: config.DenialsKindName},
+	}}
+	_ = m.ConfigChange(&scResolver{fakeResolver{cfgs, nil}, &cpb.ServiceConfig{}}, nil)
+
+	out := m.Check(context.Background(), attribute.GetMutableBag(nil), attribute.GetMutableBag(nil))
+	if out.Code != int32(rpc.UNAVAILABLE) {
+		t.Errorf("Check() = %v, wanted UNAVAILABLE", out)
+	}
+
+	close(release)
+	gp.Close()
+	agp.Close()
+}
+
+func TestManager_SingleConfigInline(t *testing.T) {
+	mgr := &orderedCheckMgr{bodies: map[string]rpc.Status{"ok": status.OK}}
+	mreg := [config.NumKinds]aspect.Manager{}
+	mreg[config.DenialsKind] = mgr
+	breg := &fakeBuilderReg{adp: mgr.instance, found: true}
+
+	// the only worker is busy, a single aspect must not wait for it
+	gp := pool.NewGoroutinePool(1, false)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	gp.ScheduleWork(func() {
+		close(started)
+		<-release
+	})
+	<-started
+	defer gp.Close()
+	defer close(release)
+
+	agp := pool.NewGoroutinePool(1, true)
+	defer agp.Close()
+	m := newManager(breg, mreg, nil, aspect.ManagerInventory{}, gp, agp)
+
+	cfgs := []*cpb.Combined{{
+		Builder: &cpb.Adapter{Name: "ok", Impl: "ok"},
+		Aspect:  &cpb.Aspect{Kind: config.DenialsKindName},
+	}}
+	_ = m.ConfigChange(&fakeResolver{cfgs, nil}, nil)
+
+	done := make(chan rpc.Status, 1)
+	go func() {
+		done <- m.Check(context.Background(), attribute.GetMutableBag(nil), attribute.GetMutableBag(nil))
+	}()
+	select {
+	case out := <-done:
+		if !status.IsOK(out) || len(mgr.calls) != 1 {
+			t.Errorf("Check() = %v with executors %v called, wanted OK from executor ok", out, mgr.calls)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Check() waited for the worker pool")
+	}
+}
+
+func TestManager_SingleConfigDeadline(t *testing.T) {
+	re := &blockingReportExecutor{started: make(chan struct{}, 1), unblock: make(chan struct{})}
+	gp := pool.NewGoroutinePool(4, false)
+	gp.AddWorkers(3)
+	agp := pool.NewGoroutinePool(1, true)
+	mgrs := newFakeMgrReg(nil, nil, nil, nil)
+	mgrs[config.AccessLogsKind] = &fakeReportAspectMgr{kind: config.AccessLogsKind, re: re}
+	m := newManager(getReg(true), mgrs, &fakeEvaluator{}, aspect.ManagerInventory{}, gp, agp)
+	_ = m.ConfigChange(&fakeResolver{[]*cpb.Combined{accessLogsConfig(0)}, nil}, nil)
+
+	// the aspect hangs, the request gives up on it at its deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if out := m.Report(ctx, attribute.GetMutableBag(nil), attribute.GetMutableBag(nil)); out.Code != int32(rpc.DEADLINE_EXCEEDED) {
+		t.Errorf("Report() = %v, wanted DEADLINE_EXCEEDED", out)
+	}
+	close(re.unblock)
+
+	_ = m.Close()
+	m.draining.Wait()
+	gp.Close()
+	agp.Close()
+}
+
 func TestRecovery_NewAspect(t *testing.T) {
 	testRecovery(t, "NewExecutor Throws", true, false, "NewExecutor")
 }
@@ -552,7 +1071,7 @@ func testRecovery(t *testing.T, name string, throwOnNewAspect bool, throwOnExecu
 			Aspect:  &cpb.Aspect{Kind: name},
 		},
 	}
-	m.cfg.Store(&fakeResolver{cfg, nil})
+	_ = m.ConfigChange(&fakeResolver{cfg, nil}, nil)
 
 	out := m.Check(context.Background(), nil, nil)
 	if status.IsOK(out) {
@@ -594,12 +1113,12 @@ func TestExecute(t *testing.T) {
 		m := newManager(breg, mreg, nil, aspect.ManagerInventory{}, gp, agp)
 
 		cfg := []*cpb.Combined{
-			{&cpb.Adapter{Name: c.name}, &cpb.Aspect{Kind: c.name}},
+			{Builder: &cpb.Adapter{Name: c.name}, Aspect: &cpb.Aspect{Kind: c.name}},
 		}
-		m.cfg.Store(&fakeResolver{cfg, nil})
+		_ = m.ConfigChange(&fakeResolver{cfg, nil}, nil)
 
-		o := m.dispatch(context.Background(), nil, nil, cfg,
-			func(executor aspect.Executor, evaluator expr.Evaluator) rpc.Status {
+		o := m.dispatch(context.Background(), m.acquire(), nil, nil, cfg, nil,
+			func(ctx context.Context, executor aspect.Executor, evaluator expr.Evaluator) rpc.Status {
 				return status.OK
 			})
 		if c.inErr != nil && status.IsOK(o) {
@@ -627,14 +1146,14 @@ func TestExecute_Cancellation(t *testing.T) {
 	cancel()
 
 	cfg := []*cpb.Combined{
-		{&cpb.Adapter{Name: ""}, &cpb.Aspect{Kind: ""}},
+		{Builder: &cpb.Adapter{Name: ""}, Aspect: &cpb.Aspect{Kind: ""}},
 	}
-	m.cfg.Store(&fakeResolver{cfg, nil})
+	_ = m.ConfigChange(&fakeResolver{cfg, nil}, nil)
 
 	reqBag := attribute.GetMutableBag(nil)
 	respBag := attribute.GetMutableBag(nil)
 
-	if out := m.dispatch(ctx, reqBag, respBag, cfg, nil); status.IsOK(out) {
+	if out := m.dispatch(ctx, m.acquire(), reqBag, respBag, cfg, nil, nil); status.IsOK(out) {
 		t.Error("m.dispatch(canceledContext, ...) = _, nil; wanted any err")
 	}
 
@@ -672,10 +1191,10 @@ func TestExecute_TimeoutWaitingForResults(t *testing.T) {
 	}()
 
 	cfg := []*cpb.Combined{{
-		&cpb.Adapter{Name: name},
-		&cpb.Aspect{Kind: name},
+		Builder: &cpb.Adapter{Name: name},
+		Aspect:  &cpb.Aspect{Kind: name},
 	}}
-	m.cfg.Store(&fakeResolver{cfg, nil})
+	_ = m.ConfigChange(&fakeResolver{cfg, nil}, nil)
 
 	if out := m.Check(ctx, attribute.GetMutableBag(nil), attribute.GetMutableBag(nil)); status.IsOK(out) {
 		t.Error("handler.Execute(canceledContext, ...) = _, nil; wanted any err")
@@ -685,3 +1204,89 @@ func TestExecute_TimeoutWaitingForResults(t *testing.T) {
 	gp.Close()
 	agp.Close()
 }
+
+func TestManager_CallTimeout(t *testing.T) {
+	cases := []struct {
+		name    string
+		numCfgs int
+	}{
+		{"single aspect", 1},
+		{"several aspects", 2},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			re := &blockingReportExecutor{started: make(chan struct{}, c.numCfgs), unblock: make(chan struct{})}
+			gp := pool.NewGoroutinePool(4, false)
+			gp.AddWorkers(3)
+			agp := pool.NewGoroutinePool(1, true)
+			mgrs := newFakeMgrReg(nil, nil, nil, nil)
+			mgrs[config.AccessLogsKind] = &fakeReportAspectMgr{kind: config.AccessLogsKind, re: re}
+			m := newManager(getReg(true), mgrs, &fakeEvaluator{}, aspect.ManagerInventory{}, gp, agp)
+			m.callTimeout = 10 * time.Millisecond
+
+			var cfgs []*cpb.Combined
+			for i := 0; i < c.numCfgs; i++ {
+				cfgs = append(cfgs, accessLogsConfig(int32(i)))
+			}
+			_ = m.ConfigChange(&fakeResolver{cfgs, nil}, nil)
+
+			// the aspects hang, the request gives up on them at the call timeout
+			if out := report(m); out.Code != int32(rpc.DEADLINE_EXCEEDED) {
+				t.Errorf("Report() = %v, wanted DEADLINE_EXCEEDED", out)
+			}
+			close(re.unblock)
+
+			_ = m.Close()
+			m.draining.Wait()
+			gp.Close()
+			agp.Close()
+		})
+	}
+}
+
+func benchmarkReport(b *testing.B, numCfgs int, callTimeout time.Duration) {
+	gp := pool.NewGoroutinePool(128, false)
+	gp.AddWorkers(32)
+	defer gp.Close()
+
+	agp := pool.NewGoroutinePool(128, false)
+	agp.AddWorkers(32)
+	defer agp.Close()
+
+	mgrs := newFakeMgrReg(nil, nil, nil, nil)
+	mgrs[config.AccessLogsKind] = &fakeReportAspectMgr{kind: config.AccessLogsKind, re: testAspect{func() rpc.Status { return status.OK }}}
+	m := newManager(getReg(true), mgrs, &fakeEvaluator{}, aspect.ManagerInventory{}, gp, agp)
+	m.callTimeout = callTimeout
+
+	var cfgs []*cpb.Combined
+	for i := 0; i < numCfgs; i++ {
+		cfgs = append(cfgs, accessLogsConfig(int32(i)))
+	}
+	_ = m.ConfigChange(&fakeResolver{cfgs, nil}, nil)
+
+	requestBag := attribute.GetMutableBag(nil)
+	responseBag := attribute.GetMutableBag(nil)
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if out := m.Report(ctx, requestBag, responseBag); !status.IsOK(out) {
+			b.Fatalf("Report() = %v", out)
+		}
+	}
+}
+
+func BenchmarkReport_SingleConfig(b *testing.B) {
+	benchmarkReport(b, 1, 0)
+}
+
+// the call timeout gives the request a deadline, which rules out the single config fast path
+func BenchmarkReport_SingleConfigWithTimeout(b *testing.B) {
+	benchmarkReport(b, 1, time.Minute)
+}
+
+func BenchmarkReport_MultipleConfigs(b *testing.B) {
+	benchmarkReport(b, 3, 0)
+}
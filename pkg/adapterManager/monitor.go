@@ -0,0 +1,145 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapterManager
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"istio.io/mixer/pkg/adapter"
+	"istio.io/mixer/pkg/monitoring"
+)
+
+// adapterMetric is a metric registered by an adapter through its adapter.Monitor.
+type adapterMetric struct {
+	help       string
+	labelNames []string
+	buckets    []float64 // nil for counters
+
+	counter   *prometheus.CounterVec
+	histogram *prometheus.HistogramVec
+}
+
+// adapterMetrics holds the metrics registered by all adapters, by fully qualified name.
+// They live for as long as the process, since the same adapter may register them again
+// each time one of its aspects is constructed.
+var adapterMetrics = struct {
+	sync.Mutex
+	byName map[string]*adapterMetric
+}{byName: make(map[string]*adapterMetric)}
+
+// monitor implements adapter.Monitor, registering the metrics of an adapter into the mixer's
+// self-monitoring under the mixer_adapter_<adapter>_ prefix.
+type monitor struct {
+	adapter string
+}
+
+func newMonitor(adapterName string) adapter.Monitor {
+	return monitor{adapter: adapterName}
+}
+
+func (m monitor) Counter(name, help string, labelNames ...string) (adapter.MonitorCounter, error) {
+	metric, err := m.register(name, &adapterMetric{help: help, labelNames: labelNames})
+	if err != nil {
+		return nil, err
+	}
+	return counter{metric.counter}, nil
+}
+
+func (m monitor) Histogram(name, help string, buckets []float64, labelNames ...string) (adapter.MonitorHistogram, error) {
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+	metric, err := m.register(name, &adapterMetric{help: help, labelNames: labelNames, buckets: buckets})
+	if err != nil {
+		return nil, err
+	}
+	return histogram{metric.histogram}, nil
+}
+
+// register returns the metric already registered under name, provided it has the same
+// definition, or registers def.
+func (m monitor) register(name string, def *adapterMetric) (*adapterMetric, error) {
+	fqName := prometheus.BuildFQName("mixer_adapter", sanitizeMetricName(m.adapter), name)
+
+	adapterMetrics.Lock()
+	defer adapterMetrics.Unlock()
+
+	if metric, found := adapterMetrics.byName[fqName]; found {
+		if metric.help != def.help || !reflect.DeepEqual(metric.labelNames, def.labelNames) || !reflect.DeepEqual(metric.buckets, def.buckets) {
+			return nil, fmt.Errorf("metric %s of adapter '%s' is already registered with a different definition", name, m.adapter)
+		}
+		return metric, nil
+	}
+
+	var c prometheus.Collector
+	if def.buckets == nil {
+		def.counter = prometheus.NewCounterVec(prometheus.CounterOpts{Name: fqName, Help: def.help}, def.labelNames)
+		c = def.counter
+	} else {
+		def.histogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: fqName, Help: def.help, Buckets: def.buckets}, def.labelNames)
+		c = def.histogram
+	}
+	if err := monitoring.Register(c); err != nil {
+		return nil, fmt.Errorf("unable to register metric %s of adapter '%s': %v", name, m.adapter, err)
+	}
+	adapterMetrics.byName[fqName] = def
+	return def, nil
+}
+
+// sanitizeMetricName replaces the characters that aren't valid in a metric name.
+func sanitizeMetricName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+type counter struct {
+	vec *prometheus.CounterVec
+}
+
+func (c counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		glog.Warningf("Ignoring negative increment of adapter counter: %v", v)
+		return
+	}
+	m, err := c.vec.GetMetricWithLabelValues(labelValues...)
+	if err != nil {
+		glog.Warningf("Ignoring increment of adapter counter: %v", err)
+		return
+	}
+	m.Add(v)
+}
+
+type histogram struct {
+	vec *prometheus.HistogramVec
+}
+
+func (h histogram) Observe(v float64, labelValues ...string) {
+	m, err := h.vec.GetMetricWithLabelValues(labelValues...)
+	if err != nil {
+		glog.Warningf("Ignoring observation of adapter histogram: %v", err)
+		return
+	}
+	m.Observe(v)
+}
@@ -0,0 +1,102 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapterManager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"istio.io/mixer/pkg/adapter"
+	"istio.io/mixer/pkg/monitoring"
+)
+
+func counterValue(c adapter.MonitorCounter, labelValues ...string) float64 {
+	m := new(dto.Metric)
+	_ = c.(counter).vec.WithLabelValues(labelValues...).Write(m)
+	return m.GetCounter().GetValue()
+}
+
+func histogramCount(h adapter.MonitorHistogram) uint64 {
+	ch := make(chan prometheus.Metric, 1)
+	h.(histogram).vec.Collect(ch)
+	select {
+	case c := <-ch:
+		m := new(dto.Metric)
+		_ = c.Write(m)
+		return m.GetHistogram().GetSampleCount()
+	default:
+		return 0 // nothing observed yet
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	m := newMonitor("my-adapter")
+
+	c, err := m.Counter("calls_total", "Calls made.", "code")
+	if err != nil {
+		t.Fatalf("Counter() failed: %v", err)
+	}
+	before := counterValue(c, "OK")
+	c.Add(2, "OK")
+	c.Add(-1, "OK")     // ignored
+	c.Add(1, "OK", "x") // ignored
+
+	// registering again, for example from another aspect, returns the same metric
+	again, err := newMonitor("my-adapter").Counter("calls_total", "Calls made.", "code")
+	if err != nil {
+		t.Fatalf("Counter() failed to return the existing counter: %v", err)
+	}
+	again.Add(1, "OK")
+	if got := counterValue(c, "OK") - before; got != 3 {
+		t.Errorf("Counter went up by %v, want 3", got)
+	}
+
+	h, err := m.Histogram("latency_seconds", "Call latency.", nil)
+	if err != nil {
+		t.Fatalf("Histogram() failed: %v", err)
+	}
+	count := histogramCount(h)
+	h.Observe(0.2)
+	if got := histogramCount(h) - count; got != 1 {
+		t.Errorf("Histogram recorded %d observations, want 1", got)
+	}
+
+	conflicts := []func() error{
+		func() error { _, err := m.Counter("calls_total", "Other help.", "code"); return err },
+		func() error { _, err := m.Counter("calls_total", "Calls made."); return err },
+		func() error { _, err := m.Histogram("calls_total", "Calls made.", nil, "code"); return err },
+		func() error { _, err := m.Counter("latency_seconds", "Call latency."); return err },
+		func() error { _, err := m.Histogram("latency_seconds", "Call latency.", []float64{1}); return err },
+	}
+	for i, register := range conflicts {
+		if err := register(); err == nil {
+			t.Errorf("[%d] registering a conflicting metric succeeded", i)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	monitoring.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := w.Body.String()
+	for _, want := range []string{`mixer_adapter_my_adapter_calls_total{code="OK"}`, "mixer_adapter_my_adapter_latency_seconds_count"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("GET /metrics did not return %q", want)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapterManager
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"istio.io/mixer/pkg/adapter"
+	"istio.io/mixer/pkg/config"
+	"istio.io/mixer/pkg/monitoring"
+)
+
+var aspectReconfigurations = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "mixer_aspect_reconfigurations_total",
+	Help: "Number of aspects reconfigured in place on a config change, by adapter and result: reconfigured, failed or reverted.",
+}, []string{"adapter", "result"})
+
+func init() {
+	monitoring.MustRegister(aspectReconfigurations)
+}
+
+// reconfigurableKinds are the kinds of aspects that adapters reconfigure in place, the only ones
+// constructed through an aspectTracker.
+var reconfigurableKinds = config.KindSet(0).Set(config.ListsKind).Set(config.QuotasKind)
+
+// aspectConfig is a configuration applied to an aspect.
+type aspectConfig struct {
+	env    adapter.Env
+	config adapter.Config
+	quotas map[string]*adapter.QuotaDefinition
+}
+
+// sharedAspect wraps a reconfigurable aspect. When the config of its adapter changes, the aspect
+// is reconfigured and handed over to the executor built for the new config, while the executor
+// of the previous config may still be serving requests: the aspect is closed along with the last
+// executor built on it.
+//
+// The field of the kind the aspect doesn't implement is nil.
+type sharedAspect struct {
+	adapter.ListsAspect
+	adapter.QuotasAspect
+
+	aspect adapter.Aspect
+
+	// executors built on the aspect, it is closed when it drops to 0
+	refs int32
+
+	lock sync.Mutex // guards cfg
+	cfg  aspectConfig
+}
+
+func newSharedAspect(a adapter.Aspect, cfg aspectConfig) *sharedAspect {
+	s := &sharedAspect{aspect: a, cfg: cfg, refs: 1}
+	s.ListsAspect, _ = a.(adapter.ListsAspect)
+	s.QuotasAspect, _ = a.(adapter.QuotasAspect)
+	return s
+}
+
+// acquire takes a reference to the aspect, unless it has already been closed.
+func (s *sharedAspect) acquire() bool {
+	for {
+		refs := atomic.LoadInt32(&s.refs)
+		if refs == 0 {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&s.refs, refs, refs+1) {
+			return true
+		}
+	}
+}
+
+// reconfigure applies cfg to the aspect, and returns the configuration it replaced.
+func (s *sharedAspect) reconfigure(cfg aspectConfig) (prev aspectConfig, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err = s.aspect.(adapter.Reconfigurable).Reconfigure(cfg.env, cfg.config, nil, cfg.quotas); err != nil {
+		return prev, err
+	}
+	prev = s.cfg
+	s.cfg = cfg
+	return prev, nil
+}
+
+// Close drops the reference of an executor, closing the aspect if it was the last one.
+func (s *sharedAspect) Close() error {
+	if atomic.AddInt32(&s.refs, -1) > 0 {
+		return nil
+	}
+	return s.aspect.Close()
+}
+
+func isReconfigurable(a adapter.Aspect) bool {
+	_, ok := a.(adapter.Reconfigurable)
+	return ok
+}
+
+// aspectTracker is the builder handed to the managers of reconfigurableKinds. It keeps track of the
+// reconfigurable aspects it constructs, and reconfigures the aspect of the previous config of the
+// adapter, if any, rather than constructing a new one.
+type aspectTracker struct {
+	adapter.Builder
+
+	sync.Mutex // guards the fields below
+
+	// the aspect of the previous config, consumed by the first construction. The tracker holds
+	// a reference to it until then.
+	prior *sharedAspect
+
+	// the reconfigurable aspect of the latest construction, nil if the aspect isn't reconfigurable
+	current *sharedAspect
+
+	// the aspect reconfigured by the tracker along with the configuration it replaced, should
+	// the reconfiguration have to be reverted
+	reused   *sharedAspect
+	replaced aspectConfig
+}
+
+// newAspectTracker returns a tracker for the aspects of b, handing it over the reference held to prior, if any.
+func newAspectTracker(b adapter.Builder, prior *sharedAspect) *aspectTracker {
+	return &aspectTracker{Builder: b, prior: prior}
+}
+
+// latest returns the reconfigurable aspect of the latest construction, if any.
+func (t *aspectTracker) latest() *sharedAspect {
+	if t == nil {
+		return nil
+	}
+	t.Lock()
+	defer t.Unlock()
+	return t.current
+}
+
+// reuse reconfigures the aspect of the previous config and returns it, or returns nil if a new
+// aspect has to be constructed.
+func (t *aspectTracker) reuse(cfg aspectConfig) *sharedAspect {
+	t.Lock()
+	s := t.prior
+	t.prior = nil
+	t.Unlock()
+
+	if s == nil {
+		return nil
+	}
+
+	prev, err := s.reconfigure(cfg)
+	if err != nil {
+		aspectReconfigurations.WithLabelValues(t.Name(), "failed").Inc()
+		glog.Warningf("Adapter '%s' failed to reconfigure its aspect, constructing a new one: %v", t.Name(), err)
+		_ = s.Close()
+		return nil
+	}
+	aspectReconfigurations.WithLabelValues(t.Name(), "reconfigured").Inc()
+	if glog.V(2) {
+		glog.Infof("Reconfigured aspect of adapter '%s' in place", t.Name())
+	}
+
+	t.Lock()
+	t.current = s
+	t.reused = s
+	t.replaced = prev
+	t.Unlock()
+	return s
+}
+
+// track records a newly constructed aspect, and wraps it if it is reconfigurable.
+func (t *aspectTracker) track(a adapter.Aspect, cfg aspectConfig) *sharedAspect {
+	var s *sharedAspect
+	if isReconfigurable(a) {
+		s = newSharedAspect(a, cfg)
+	}
+
+	t.Lock()
+	t.current = s
+	t.Unlock()
+	return s
+}
+
+// release drops the reference to the aspect of the previous config, if it hasn't been reconfigured.
+func (t *aspectTracker) release() {
+	t.Lock()
+	s := t.prior
+	t.prior = nil
+	t.Unlock()
+
+	if s != nil {
+		_ = s.Close()
+	}
+}
+
+// abandon reverts the reconfiguration of the tracker, if any, and releases the aspect it
+// reconfigured, when the executor meant to use the aspect couldn't be constructed.
+func (t *aspectTracker) abandon() {
+	t.Lock()
+	s := t.reused
+	t.Unlock()
+
+	if s != nil {
+		t.revert()
+		_ = s.Close()
+	}
+}
+
+// reconfigured returns true if the tracker reconfigured the aspect of the previous config.
+func (t *aspectTracker) reconfigured() bool {
+	t.Lock()
+	defer t.Unlock()
+	return t.reused != nil
+}
+
+// revert gives the aspect reconfigured by the tracker, if any, its previous configuration back.
+func (t *aspectTracker) revert() {
+	t.Lock()
+	s, cfg := t.reused, t.replaced
+	t.reused = nil
+	t.Unlock()
+
+	if s == nil {
+		return
+	}
+	if _, err := s.reconfigure(cfg); err != nil {
+		glog.Warningf("Adapter '%s' failed to revert the configuration of its aspect: %v", t.Name(), err)
+		return
+	}
+	aspectReconfigurations.WithLabelValues(t.Name(), "reverted").Inc()
+}
+
+func (t *aspectTracker) NewListsAspect(env adapter.Env, c adapter.Config) (adapter.ListsAspect, error) {
+	cfg := aspectConfig{env: env, config: c}
+	if s := t.reuse(cfg); s != nil {
+		return s, nil
+	}
+	a, err := t.Builder.(adapter.ListsBuilder).NewListsAspect(env, c)
+	if err != nil {
+		return nil, err
+	}
+	if s := t.track(a, cfg); s != nil {
+		return s, nil
+	}
+	return a, nil
+}
+
+func (t *aspectTracker) NewQuotasAspect(env adapter.Env, c adapter.Config, quotas map[string]*adapter.QuotaDefinition) (adapter.QuotasAspect, error) {
+	cfg := aspectConfig{env: env, config: c, quotas: quotas}
+	if s := t.reuse(cfg); s != nil {
+		return s, nil
+	}
+	a, err := t.Builder.(adapter.QuotasBuilder).NewQuotasAspect(env, c, quotas)
+	if err != nil {
+		return nil, err
+	}
+	if s := t.track(a, cfg); s != nil {
+		return s, nil
+	}
+	return a, nil
+}
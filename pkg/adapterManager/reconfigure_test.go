@@ -0,0 +1,257 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapterManager
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	rpc "github.com/googleapis/googleapis/google/rpc"
+
+	"istio.io/mixer/pkg/adapter"
+	"istio.io/mixer/pkg/aspect"
+	"istio.io/mixer/pkg/attribute"
+	"istio.io/mixer/pkg/config"
+	"istio.io/mixer/pkg/config/descriptor"
+	cpb "istio.io/mixer/pkg/config/proto"
+	"istio.io/mixer/pkg/expr"
+	"istio.io/mixer/pkg/pool"
+	"istio.io/mixer/pkg/status"
+)
+
+type (
+	// a lists aspect that takes new configs in place, its config is the code of an rpc.Status
+	reconfigurableList struct {
+		sync.Mutex
+		code      int32
+		reconfigs int
+		closed    int
+		fail      bool
+	}
+
+	// builds reconfigurableLists, fails for code 99
+	listsBuilder struct {
+		fakeBuilder
+		built []*reconfigurableList
+	}
+
+	// builds executors checking the lists built by the adapter
+	listsMgr struct {
+		aspect.Manager
+	}
+
+	listsExecutor struct {
+		asp adapter.ListsAspect
+	}
+)
+
+func (l *reconfigurableList) Reconfigure(env adapter.Env, c adapter.Config, _ map[string]*adapter.MetricDefinition,
+	_ map[string]*adapter.QuotaDefinition) error {
+	l.Lock()
+	defer l.Unlock()
+	if l.fail {
+		return errors.New("can't do")
+	}
+	l.code = c.(*rpc.Status).Code
+	l.reconfigs++
+	return nil
+}
+
+func (l *reconfigurableList) CheckList(symbol string) (bool, error) { return true, nil }
+
+func (l *reconfigurableList) Close() error {
+	l.Lock()
+	defer l.Unlock()
+	l.closed++
+	return nil
+}
+
+func (l *reconfigurableList) state() (code int32, reconfigs, closed int) {
+	l.Lock()
+	defer l.Unlock()
+	return l.code, l.reconfigs, l.closed
+}
+
+func (b *listsBuilder) NewListsAspect(env adapter.Env, c adapter.Config) (adapter.ListsAspect, error) {
+	code := c.(*rpc.Status).Code
+	if code == 99 {
+		return nil, errors.New("bad config")
+	}
+	l := &reconfigurableList{code: code}
+	b.built = append(b.built, l)
+	return l, nil
+}
+
+func (listsMgr) Kind() config.Kind { return config.ListsKind }
+
+func (listsMgr) NewCheckExecutor(cfg *cpb.Combined, b adapter.Builder, env adapter.Env, _ descriptor.Finder) (aspect.CheckExecutor, error) {
+	asp, err := b.(adapter.ListsBuilder).NewListsAspect(env, cfg.Builder.Params.(adapter.Config))
+	if err != nil {
+		return nil, err
+	}
+	return &listsExecutor{asp}, nil
+}
+
+func (e *listsExecutor) Execute(context.Context, attribute.Bag, expr.Evaluator) rpc.Status {
+	if _, err := e.asp.CheckList("10.0.0.1"); err != nil {
+		return status.WithError(err)
+	}
+	return status.OK
+}
+
+func (e *listsExecutor) Close() error { return e.asp.Close() }
+
+func listsConfig(code int32, aspectParams int32) *cpb.Combined {
+	return &cpb.Combined{
+		Builder: &cpb.Adapter{Name: "ips", Kind: config.ListsKindName, Impl: "lists", Params: &rpc.Status{Code: code}},
+		Aspect:  &cpb.Aspect{Kind: config.ListsKindName, Params: &rpc.Status{Code: aspectParams}},
+	}
+}
+
+func newReconfigureTestManager() (*Manager, *listsBuilder, func()) {
+	gp := pool.NewGoroutinePool(1, true)
+	agp := pool.NewGoroutinePool(1, true)
+	mgrs := [config.NumKinds]aspect.Manager{}
+	mgrs[config.ListsKind] = listsMgr{}
+	b := &listsBuilder{fakeBuilder: fakeBuilder{name: "lists"}}
+
+	m := newManager(&fakeBuilderReg{adp: b, found: true}, mgrs, &fakeEvaluator{}, aspect.ManagerInventory{}, gp, agp)
+	return m, b, func() {
+		gp.Close()
+		agp.Close()
+	}
+}
+
+func check(m *Manager) rpc.Status {
+	return m.Check(context.Background(), attribute.GetMutableBag(nil), attribute.GetMutableBag(nil))
+}
+
+func TestReconfigure_InPlace(t *testing.T) {
+	m, b, done := newReconfigureTestManager()
+	defer done()
+
+	_ = m.ConfigChange(&fakeResolver{[]*cpb.Combined{listsConfig(1, 1)}, nil}, nil)
+	if out := check(m); !status.IsOK(out) {
+		t.Fatalf("Check() = %v, want OK", out)
+	}
+
+	// new adapter params, then new aspect params as well
+	for i, cfg := range []*cpb.Combined{listsConfig(2, 1), listsConfig(3, 2)} {
+		_ = m.ConfigChange(&fakeResolver{[]*cpb.Combined{cfg}, nil}, nil)
+		m.draining.Wait()
+		if out := check(m); !status.IsOK(out) {
+			t.Fatalf("Check() = %v, want OK", out)
+		}
+
+		if len(b.built) != 1 {
+			t.Fatalf("%d aspects constructed, want the first one to be reconfigured", len(b.built))
+		}
+		code, reconfigs, closed := b.built[0].state()
+		if code != cfg.Builder.Params.(*rpc.Status).Code || reconfigs != i+1 || closed != 0 {
+			t.Errorf("aspect has config %d after %d reconfigs and %d closes, want config %d after %d reconfigs and no close",
+				code, reconfigs, closed, cfg.Builder.Params.(*rpc.Status).Code, i+1)
+		}
+	}
+
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	if _, _, closed := b.built[0].state(); closed != 1 {
+		t.Errorf("aspect closed %d times, want 1", closed)
+	}
+}
+
+func TestReconfigure_Failure(t *testing.T) {
+	m, b, done := newReconfigureTestManager()
+	defer done()
+
+	_ = m.ConfigChange(&fakeResolver{[]*cpb.Combined{listsConfig(1, 1)}, nil}, nil)
+	_ = check(m)
+	b.built[0].fail = true
+
+	_ = m.ConfigChange(&fakeResolver{[]*cpb.Combined{listsConfig(2, 1)}, nil}, nil)
+	if out := check(m); !status.IsOK(out) {
+		t.Fatalf("Check() = %v, want OK", out)
+	}
+	m.draining.Wait()
+
+	if len(b.built) != 2 {
+		t.Fatalf("%d aspects constructed, want a new one when the reconfiguration fails", len(b.built))
+	}
+	if code, _, closed := b.built[0].state(); code != 1 || closed != 1 {
+		t.Errorf("previous aspect has config %d and was closed %d times, want config 1 and closed once", code, closed)
+	}
+	_ = m.Close()
+}
+
+func TestReconfigure_EagerBuildRejected(t *testing.T) {
+	m, b, done := newReconfigureTestManager()
+	defer done()
+	m.eagerBuild = true
+
+	if err := m.ConfigChange(&fakeResolver{[]*cpb.Combined{listsConfig(1, 1)}, nil}, nil); err != nil {
+		t.Fatalf("ConfigChange() = %v, want no error", err)
+	}
+
+	// the second aspect can't be constructed, the reconfiguration of the first one must be reverted
+	bad := listsConfig(99, 1)
+	bad.Builder.Name = "bad"
+	if err := m.ConfigChange(&fakeResolver{[]*cpb.Combined{listsConfig(2, 1), bad}, nil}, nil); err == nil {
+		t.Fatal("ConfigChange() succeeded, want the construction failure")
+	}
+	m.draining.Wait()
+
+	code, reconfigs, closed := b.built[0].state()
+	if code != 1 || reconfigs != 2 || closed != 0 {
+		t.Errorf("aspect has config %d after %d reconfigs and %d closes, want config 1 after 2 reconfigs and no close", code, reconfigs, closed)
+	}
+	if out := check(m); !status.IsOK(out) {
+		t.Errorf("Check() = %v, want the previous config to keep serving", out)
+	}
+	_ = m.Close()
+}
+
+// denialsMgr records the builders it constructs executors with.
+type denialsMgr struct {
+	listsMgr
+	builders []adapter.Builder
+}
+
+func (*denialsMgr) Kind() config.Kind { return config.DenialsKind }
+
+func (m *denialsMgr) NewCheckExecutor(_ *cpb.Combined, b adapter.Builder, _ adapter.Env, _ descriptor.Finder) (aspect.CheckExecutor, error) {
+	m.builders = append(m.builders, b)
+	return &listsExecutor{&reconfigurableList{}}, nil
+}
+
+func TestReconfigure_OtherKinds(t *testing.T) {
+	m, b, done := newReconfigureTestManager()
+	defer done()
+	dm := &denialsMgr{}
+	m.managers[config.DenialsKind] = dm
+
+	cfg := listsConfig(1, 1)
+	cfg.Aspect.Kind = config.DenialsKindName
+	_ = m.ConfigChange(&fakeResolver{[]*cpb.Combined{cfg}, nil}, nil)
+	if out := check(m); !status.IsOK(out) {
+		t.Fatalf("Check() = %v, want OK", out)
+	}
+	if len(dm.builders) != 1 || dm.builders[0] != adapter.Builder(b) {
+		t.Errorf("denials executor constructed with %v, want the builder of the adapter itself", dm.builders)
+	}
+	_ = m.Close()
+}
@@ -18,6 +18,7 @@ import (
 	"fmt"
 
 	"github.com/golang/glog"
+	multierror "github.com/hashicorp/go-multierror"
 
 	"istio.io/mixer/pkg/adapter"
 	"istio.io/mixer/pkg/config"
@@ -80,6 +81,17 @@ func (r *registry) SupportedKinds(builder string) config.KindSet {
 	return bi.Kinds
 }
 
+// Close closes all the registered builders.
+func (r *registry) Close() error {
+	var result *multierror.Error
+	for name, bi := range r.builders {
+		if err := bi.Builder.Close(); err != nil {
+			result = multierror.Append(result, fmt.Errorf("failed to close adapter '%s': %v", name, err))
+		}
+	}
+	return result.ErrorOrNil()
+}
+
 // RegisterListsBuilder registers a new ListChecker builder.
 func (r *registry) RegisterListsBuilder(b adapter.ListsBuilder) {
 	r.insert(config.ListsKind, b)
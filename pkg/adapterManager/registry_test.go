@@ -18,6 +18,7 @@ import (
 	"errors"
 	"flag"
 	"reflect"
+	"strings"
 	"testing"
 
 	"istio.io/mixer/pkg/adapter"
@@ -56,6 +57,23 @@ func TestRegisterDenyChecker(t *testing.T) {
 	}
 }
 
+type closeErrBuilder struct{ denyBuilder }
+
+func (closeErrBuilder) Close() error { return errors.New("close failed") }
+
+func TestRegistry_Close(t *testing.T) {
+	reg := newRegistry(nil)
+	reg.RegisterDenialsBuilder(denyBuilder{testBuilder{name: "foo"}})
+	if err := reg.Close(); err != nil {
+		t.Errorf("Close() = %v, wanted no error", err)
+	}
+
+	reg.RegisterDenialsBuilder(closeErrBuilder{denyBuilder{testBuilder{name: "bar"}}})
+	if err := reg.Close(); err == nil || !strings.Contains(err.Error(), "bar") {
+		t.Errorf("Close() = %v, wanted an error for adapter 'bar'", err)
+	}
+}
+
 type listBuilder struct{ testBuilder }
 type listBuilder2 struct{ listBuilder }
 
@@ -0,0 +1,379 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapterManager
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"istio.io/mixer/pkg/adapter"
+	"istio.io/mixer/pkg/aspect"
+	"istio.io/mixer/pkg/monitoring"
+	"istio.io/mixer/pkg/pool"
+)
+
+// CrashPolicy controls the restart of executors whose adapter keeps panicking.
+//
+// Panics are counted per executor, whether they happen while executing a request or in
+// the work and daemons the adapter scheduled through its adapter.Env. Once MaxPanics have
+// been counted within Window, the executor is constructed anew. A panic in a daemon
+// triggers the restart right away, since the daemon is gone for good. Should the
+// construction fail, it is retried with an exponential backoff, and the previous executor
+// keeps serving in the meantime. A replaced executor is closed once the calls still using
+// it have returned.
+type CrashPolicy struct {
+	// MaxPanics is the number of panics that triggers a restart. 0 disables restarts.
+	MaxPanics int
+
+	// Window is the interval over which panics are counted.
+	Window time.Duration
+}
+
+// DefaultCrashPolicy returns the crash policy used when nothing else is specified.
+func DefaultCrashPolicy() CrashPolicy {
+	return CrashPolicy{
+		MaxPanics: 3,
+		Window:    time.Minute,
+	}
+}
+
+const (
+	// initial and maximum delay between attempts at reconstructing an executor
+	minRestartBackoff = time.Second
+	maxRestartBackoff = time.Minute
+)
+
+type executorHealth int
+
+const (
+	executorHealthy executorHealth = iota
+	executorRestarting
+	executorFailed
+)
+
+func (h executorHealth) String() string {
+	switch h {
+	case executorHealthy:
+		return "healthy"
+	case executorRestarting:
+		return "restarting"
+	case executorFailed:
+		return "failed"
+	}
+	return fmt.Sprintf("executorHealth(%d)", int(h))
+}
+
+var (
+	executorPanics = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mixer_executor_panics_total",
+		Help: "Number of panics recovered from adapters, by adapter and aspect kind.",
+	}, []string{"adapter", "kind"})
+
+	executorRestarts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mixer_executor_restarts_total",
+		Help: "Number of attempts at reconstructing a crashed executor, by adapter, aspect kind and result: restarted or failed.",
+	}, []string{"adapter", "kind", "result"})
+
+	executorsUnhealthy = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "mixer_executors_unhealthy",
+		Help: "Number of executors that crashed and could not be constructed anew.",
+	})
+)
+
+func init() {
+	monitoring.MustRegister(executorPanics, executorRestarts, executorsUnhealthy)
+}
+
+// supervisorStatus is a snapshot of the state of a supervised executor.
+type supervisorStatus struct {
+	health    executorHealth
+	lastError error // why the last restart failed
+	panics    int
+	restarts  int
+}
+
+// buildFn constructs an executor that schedules its work through env.
+type buildFn func(env adapter.Env) (aspect.Executor, error)
+
+// incarnation is an executor constructed by a supervisedExecutor.
+type incarnation struct {
+	executor aspect.Executor
+	id       int
+
+	// guarded by the supervisor
+	calls   int  // in flight
+	retired bool // replaced or closed, the executor is closed once calls drops to 0
+}
+
+// supervisedExecutor owns an executor, and constructs it anew when its adapter keeps panicking.
+//
+// Each executor it constructs is an incarnation. Panics are attributed to the incarnation
+// they come from, so that the ones raised by an executor that has already been replaced
+// don't count against its successor.
+type supervisedExecutor struct {
+	adapter     string
+	kind        string
+	policy      *CrashPolicy
+	gp          *pool.GoroutinePool
+	callTimeout time.Duration
+	build       buildFn
+	now         func() time.Time
+
+	// initial delay between attempts at reconstructing the executor
+	minBackoff time.Duration
+
+	sync.Mutex  // guards the fields below
+	current     *incarnation
+	attempts    int // incarnations constructed so far, including failed attempts
+	health      executorHealth
+	lastError   error
+	windowStart time.Time
+	panics      int // within the current window
+	totalPanics int
+	restarts    int
+	backoff     time.Duration
+	retry       *time.Timer
+	closed      bool
+}
+
+// newSupervisedExecutor constructs the first incarnation of an executor.
+func newSupervisedExecutor(adapterName, kind string, policy *CrashPolicy, gp *pool.GoroutinePool, callTimeout time.Duration,
+	build buildFn) (*supervisedExecutor, error) {
+	s := &supervisedExecutor{
+		adapter:     adapterName,
+		kind:        kind,
+		policy:      policy,
+		gp:          gp,
+		callTimeout: callTimeout,
+		build:       build,
+		now:         time.Now,
+
+		minBackoff: minRestartBackoff,
+	}
+
+	s.attempts = 1
+	executor, err := build(s.env(1))
+	if err != nil {
+		return nil, err
+	}
+	s.current = &incarnation{executor: executor, id: 1}
+	return s, nil
+}
+
+// env returns the environment of an incarnation, which reports the panics it recovers. Every
+// incarnation but the first one recovers from a crash.
+func (s *supervisedExecutor) env(id int) adapter.Env {
+	return newEnv(s.adapter, s.gp, s.callTimeout, id > 1,
+		func(interface{}) { s.panicked(id, false) },
+		func(interface{}) { s.panicked(id, true) })
+}
+
+// get returns the current incarnation for a call, which must hand it back to put once done,
+// and to panicked should the executor panic.
+func (s *supervisedExecutor) get() *incarnation {
+	s.Lock()
+	defer s.Unlock()
+	s.current.calls++
+	return s.current
+}
+
+// put ends a call started by get, and closes the incarnation if it was the last call of a retired one.
+func (s *supervisedExecutor) put(inc *incarnation) {
+	s.Lock()
+	inc.calls--
+	last := inc.retired && inc.calls == 0
+	s.Unlock()
+
+	if last {
+		closeExecutor(inc.executor)
+	}
+}
+
+// retire marks inc as replaced, and reports whether it can be closed right away. s must be locked.
+func retire(inc *incarnation) bool {
+	inc.retired = true
+	return inc.calls == 0
+}
+
+// panicked records a panic of the given incarnation, and restarts it if it crossed the policy's
+// threshold or if the panic killed one of its daemons.
+func (s *supervisedExecutor) panicked(id int, daemon bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.closed || id != s.current.id {
+		return
+	}
+
+	s.totalPanics++
+	executorPanics.WithLabelValues(s.adapter, s.kind).Inc()
+
+	if s.policy.MaxPanics <= 0 || s.health != executorHealthy {
+		return
+	}
+
+	now := s.now()
+	if now.Sub(s.windowStart) > s.policy.Window {
+		s.windowStart = now
+		s.panics = 0
+	}
+	s.panics++
+
+	switch {
+	case daemon:
+		glog.Warningf("Restarting %s executor for adapter '%s' after one of its daemons panicked", s.kind, s.adapter)
+	case s.panics >= s.policy.MaxPanics:
+		glog.Warningf("Restarting %s executor for adapter '%s' after %d panics", s.kind, s.adapter, s.panics)
+	default:
+		return
+	}
+	s.health = executorRestarting
+	go s.restart()
+}
+
+// restart constructs a new incarnation and swaps it in for the current one.
+func (s *supervisedExecutor) restart() {
+	s.Lock()
+	if s.closed {
+		s.Unlock()
+		return
+	}
+	s.attempts++
+	id := s.attempts
+	s.Unlock()
+
+	executor, err := s.safeBuild(id)
+
+	s.Lock()
+	if s.closed {
+		s.Unlock()
+		if executor != nil {
+			closeExecutor(executor)
+		}
+		return
+	}
+
+	if err != nil {
+		executorRestarts.WithLabelValues(s.adapter, s.kind, "failed").Inc()
+		if s.health != executorFailed {
+			executorsUnhealthy.Inc()
+		}
+		s.health = executorFailed
+		s.lastError = err
+
+		s.backoff *= 2
+		if s.backoff == 0 {
+			s.backoff = s.minBackoff
+		}
+		if s.backoff > maxRestartBackoff {
+			s.backoff = maxRestartBackoff
+		}
+		s.retry = time.AfterFunc(s.backoff, s.restart)
+		glog.Errorf("Unable to restart %s executor for adapter '%s', retrying in %v: %v", s.kind, s.adapter, s.backoff, err)
+		s.Unlock()
+		return
+	}
+
+	executorRestarts.WithLabelValues(s.adapter, s.kind, "restarted").Inc()
+	if s.health == executorFailed {
+		executorsUnhealthy.Dec()
+	}
+
+	prev := s.current
+	s.current = &incarnation{executor: executor, id: id}
+	s.health = executorHealthy
+	s.lastError = nil
+	s.windowStart = time.Time{}
+	s.panics = 0
+	s.backoff = 0
+	s.restarts++
+	idle := retire(prev)
+	s.Unlock()
+
+	glog.Infof("Restarted %s executor for adapter '%s'", s.kind, s.adapter)
+
+	// otherwise, the last call still using the previous incarnation closes it
+	if idle {
+		closeExecutor(prev.executor)
+	}
+}
+
+// safeBuild constructs an incarnation, turning a panic into an error.
+func (s *supervisedExecutor) safeBuild(id int) (executor aspect.Executor, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			executor, err = nil, fmt.Errorf("adapter '%s' panicked with '%v'", s.adapter, r)
+		}
+	}()
+	return s.build(s.env(id))
+}
+
+// status returns the health of the executor along with its crash accounting.
+func (s *supervisedExecutor) status() supervisorStatus {
+	s.Lock()
+	defer s.Unlock()
+	return supervisorStatus{health: s.health, lastError: s.lastError, panics: s.totalPanics, restarts: s.restarts}
+}
+
+// Close stops the restarts and closes the current incarnation, or leaves it to the last call
+// still using it.
+func (s *supervisedExecutor) Close() error {
+	s.Lock()
+	s.closed = true
+	if s.retry != nil {
+		s.retry.Stop()
+	}
+	if s.health == executorFailed {
+		executorsUnhealthy.Dec()
+	}
+	inc := s.current
+	idle := retire(inc)
+	s.Unlock()
+
+	if !idle {
+		return nil
+	}
+	return inc.executor.Close()
+}
+
+// Healthy returns an error when some executors of the current config crashed and could not be
+// constructed anew.
+func (m *Manager) Healthy() error {
+	g, _ := m.gen.Load().(*generation)
+	if g == nil {
+		return nil
+	}
+
+	var failed []string
+	g.lock.RLock()
+	for key, entry := range g.executors {
+		if st := entry.executor.status(); st.health == executorFailed {
+			failed = append(failed, fmt.Sprintf("%s executor for adapter '%s': %v", key.kind, key.impl, st.lastError))
+		}
+	}
+	g.lock.RUnlock()
+
+	if len(failed) == 0 {
+		return nil
+	}
+	sort.Strings(failed)
+	return fmt.Errorf("unable to restart %d crashed executors: %s", len(failed), strings.Join(failed, "; "))
+}
@@ -0,0 +1,342 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapterManager
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	rpc "github.com/googleapis/googleapis/google/rpc"
+
+	"istio.io/mixer/pkg/adapter"
+	"istio.io/mixer/pkg/aspect"
+	"istio.io/mixer/pkg/attribute"
+	cpb "istio.io/mixer/pkg/config/proto"
+	"istio.io/mixer/pkg/expr"
+)
+
+type closingExecutor struct {
+	sync.Mutex
+	closed int
+}
+
+func (e *closingExecutor) Close() error {
+	e.Lock()
+	e.closed++
+	e.Unlock()
+	return nil
+}
+
+func (e *closingExecutor) closeCount() int {
+	e.Lock()
+	defer e.Unlock()
+	return e.closed
+}
+
+// fakeBuild hands out closingExecutors, or fails while err is set.
+type fakeBuild struct {
+	sync.Mutex
+	built []*closingExecutor
+	envs  []adapter.Env
+	err   error
+}
+
+func (b *fakeBuild) build(env adapter.Env) (aspect.Executor, error) {
+	b.Lock()
+	defer b.Unlock()
+	if b.err != nil {
+		return nil, b.err
+	}
+	e := &closingExecutor{}
+	b.built = append(b.built, e)
+	b.envs = append(b.envs, env)
+	return e, nil
+}
+
+func (b *fakeBuild) setErr(err error) {
+	b.Lock()
+	b.err = err
+	b.Unlock()
+}
+
+func newTestSupervisor(t *testing.T, policy CrashPolicy) (*supervisedExecutor, *fakeBuild, *fakeClock) {
+	b := &fakeBuild{}
+	s, err := newSupervisedExecutor("test", "test-kind", &policy, nil, 0, b.build)
+	if err != nil {
+		t.Fatalf("newSupervisedExecutor() failed: %v", err)
+	}
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	s.now = clock.now
+	s.minBackoff = time.Millisecond
+	return s, b, clock
+}
+
+// waitFor polls the supervisor's status until cond holds.
+func waitFor(t *testing.T, s *supervisedExecutor, cond func(supervisorStatus) bool) supervisorStatus {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		st := s.status()
+		if cond(st) {
+			return st
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for the executor, last status: %+v", st)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSupervisor_Restart(t *testing.T) {
+	s, b, _ := newTestSupervisor(t, CrashPolicy{MaxPanics: 2, Window: time.Minute})
+
+	s.panicked(1, false)
+	if st := s.status(); st.health != executorHealthy || st.panics != 1 {
+		t.Errorf("status() = %+v after one panic, want healthy with 1 panic", st)
+	}
+
+	s.panicked(1, false)
+	waitFor(t, s, func(st supervisorStatus) bool { return st.restarts == 1 })
+
+	inc := s.get()
+	s.put(inc)
+	if inc.id != 2 || inc.executor != b.built[1] {
+		t.Errorf("get() = incarnation %d, want the second executor", inc.id)
+	}
+	if n := b.built[0].closeCount(); n != 1 {
+		t.Errorf("Previous executor closed %d times, want 1", n)
+	}
+	if adapter.Recovering(b.envs[0]) || !adapter.Recovering(b.envs[1]) {
+		t.Error("Only the restarted executor should be told it recovers from a crash")
+	}
+
+	// panics of the previous incarnation don't count against the new one
+	s.panicked(1, false)
+	if st := s.status(); st.panics != 2 || st.health != executorHealthy {
+		t.Errorf("status() = %+v after a stale panic, want it ignored", st)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Errorf("Close() = %v, want no error", err)
+	}
+	if n := b.built[1].closeCount(); n != 1 {
+		t.Errorf("Current executor closed %d times, want 1", n)
+	}
+}
+
+func TestSupervisor_InFlightCalls(t *testing.T) {
+	s, b, _ := newTestSupervisor(t, CrashPolicy{MaxPanics: 1, Window: time.Minute})
+
+	// a call still using the first incarnation when it gets replaced
+	inc := s.get()
+	s.panicked(inc.id, false)
+	waitFor(t, s, func(st supervisorStatus) bool { return st.restarts == 1 })
+
+	if n := b.built[0].closeCount(); n != 0 {
+		t.Fatalf("Previous executor closed %d times while a call was in flight", n)
+	}
+	s.put(inc)
+	if n := b.built[0].closeCount(); n != 1 {
+		t.Errorf("Previous executor closed %d times after its last call, want 1", n)
+	}
+
+	// the same goes for Close
+	inc = s.get()
+	if err := s.Close(); err != nil {
+		t.Errorf("Close() = %v, want no error", err)
+	}
+	if n := b.built[1].closeCount(); n != 0 {
+		t.Fatalf("Current executor closed %d times while a call was in flight", n)
+	}
+	s.put(inc)
+	if n := b.built[1].closeCount(); n != 1 {
+		t.Errorf("Current executor closed %d times after its last call, want 1", n)
+	}
+}
+
+func TestSupervisor_DaemonPanic(t *testing.T) {
+	s, b, _ := newTestSupervisor(t, CrashPolicy{MaxPanics: 3, Window: time.Minute})
+	defer func() { _ = s.Close() }()
+
+	// a dead daemon doesn't wait for the threshold
+	s.panicked(1, true)
+	st := waitFor(t, s, func(st supervisorStatus) bool { return st.restarts == 1 })
+	if st.panics != 1 || st.health != executorHealthy {
+		t.Errorf("status() = %+v, want a restart after a single daemon panic", st)
+	}
+	if n := b.built[0].closeCount(); n != 1 {
+		t.Errorf("Previous executor closed %d times, want 1", n)
+	}
+}
+
+func TestSupervisor_Window(t *testing.T) {
+	s, b, clock := newTestSupervisor(t, CrashPolicy{MaxPanics: 2, Window: time.Minute})
+	defer func() { _ = s.Close() }()
+
+	s.panicked(1, false)
+	clock.advance(2 * time.Minute)
+	s.panicked(1, false)
+	clock.advance(2 * time.Minute)
+	s.panicked(1, false)
+
+	if st := s.status(); st.health != executorHealthy || st.panics != 3 || st.restarts != 0 {
+		t.Errorf("status() = %+v, want no restart for panics spread over several windows", st)
+	}
+	if len(b.built) != 1 {
+		t.Errorf("%d executors built, want 1", len(b.built))
+	}
+}
+
+func TestSupervisor_Disabled(t *testing.T) {
+	s, _, _ := newTestSupervisor(t, CrashPolicy{})
+	defer func() { _ = s.Close() }()
+
+	for i := 0; i < 10; i++ {
+		s.panicked(1, false)
+	}
+	if st := s.status(); st.health != executorHealthy || st.panics != 10 || st.restarts != 0 {
+		t.Errorf("status() = %+v, want panics counted without restarts", st)
+	}
+}
+
+func TestSupervisor_FailedRestart(t *testing.T) {
+	s, b, _ := newTestSupervisor(t, CrashPolicy{MaxPanics: 1, Window: time.Minute})
+
+	b.setErr(errors.New("backend down"))
+	s.panicked(1, false)
+	st := waitFor(t, s, func(st supervisorStatus) bool { return st.health == executorFailed })
+	if st.lastError == nil || !strings.Contains(st.lastError.Error(), "backend down") {
+		t.Errorf("status() = %+v, want the construction error", st)
+	}
+
+	// the previous executor keeps serving in the meantime
+	inc := s.get()
+	s.put(inc)
+	if inc.id != 1 || inc.executor != b.built[0] {
+		t.Errorf("get() = incarnation %d, want the first executor", inc.id)
+	}
+
+	// retries eventually succeed
+	b.setErr(nil)
+	st = waitFor(t, s, func(st supervisorStatus) bool { return st.health == executorHealthy })
+	if st.restarts != 1 || st.lastError != nil {
+		t.Errorf("status() = %+v, want a single successful restart", st)
+	}
+	inc = s.get()
+	s.put(inc)
+	if inc.id <= 1 {
+		t.Errorf("get() = incarnation %d, want a new incarnation", inc.id)
+	}
+
+	_ = s.Close()
+}
+
+func TestSupervisor_CloseStopsRetries(t *testing.T) {
+	s, b, _ := newTestSupervisor(t, CrashPolicy{MaxPanics: 1, Window: time.Minute})
+
+	b.setErr(errors.New("backend down"))
+	s.panicked(1, false)
+	waitFor(t, s, func(st supervisorStatus) bool { return st.health == executorFailed })
+
+	_ = s.Close()
+	b.setErr(nil)
+	time.Sleep(20 * time.Millisecond)
+
+	b.Lock()
+	defer b.Unlock()
+	if len(b.built) != 1 {
+		t.Errorf("%d executors built after Close(), want no more restarts", len(b.built))
+	}
+}
+
+type panickingReportExecutor struct{}
+
+func (panickingReportExecutor) Execute(context.Context, attribute.Bag, expr.Evaluator) rpc.Status {
+	panic("bye!")
+}
+func (panickingReportExecutor) Close() error { return nil }
+
+func TestManager_RestartsPanickingExecutor(t *testing.T) {
+	m, rm, done := newGenerationTestManager(panickingReportExecutor{})
+	defer done()
+	m.breakerCfg = BreakerConfig{}
+	m.crashPolicy = CrashPolicy{MaxPanics: 2, Window: time.Minute}
+
+	_ = m.ConfigChange(&fakeResolver{[]*cpb.Combined{accessLogsConfig(0)}, nil}, nil)
+
+	for i := 0; i < 2; i++ {
+		if out := report(m); !strings.Contains(out.Message, "panicked") {
+			t.Errorf("Report() = %v, want the panic", out)
+		}
+	}
+
+	g := m.acquire()
+	var sup *supervisedExecutor
+	for _, entry := range g.executors {
+		sup = entry.executor
+	}
+	m.release(g)
+
+	waitFor(t, sup, func(st supervisorStatus) bool { return st.restarts == 1 })
+	if rm.called != 2 {
+		t.Errorf("Executor constructed %d times, want 2", rm.called)
+	}
+
+	executors := m.Executors()
+	if len(executors) != 1 || executors[0].Panics != 2 || executors[0].Restarts != 1 || executors[0].Health != "healthy" {
+		t.Errorf("Executors() = %+v, want the crash accounting", executors)
+	}
+	if err := m.Healthy(); err != nil {
+		t.Errorf("Healthy() = %v, want no error", err)
+	}
+
+	_ = m.Close()
+}
+
+func TestManager_Healthy(t *testing.T) {
+	m, rm, done := newGenerationTestManager(panickingReportExecutor{})
+	defer done()
+	m.breakerCfg = BreakerConfig{}
+	m.crashPolicy = CrashPolicy{MaxPanics: 1, Window: time.Minute}
+
+	if err := m.Healthy(); err != nil {
+		t.Errorf("Healthy() = %v before any config, want no error", err)
+	}
+
+	// construct the executor upfront, so that the restart is the only construction that fails
+	m.eagerBuild = true
+	_ = m.ConfigChange(&fakeResolver{[]*cpb.Combined{accessLogsConfig(0)}, nil}, nil)
+
+	g := m.acquire()
+	var sup *supervisedExecutor
+	for _, entry := range g.executors {
+		sup = entry.executor
+	}
+	m.release(g)
+
+	sup.minBackoff = time.Hour
+	rm.re = nil
+	_ = report(m)
+
+	waitFor(t, sup, func(st supervisorStatus) bool { return st.health == executorFailed })
+	if err := m.Healthy(); err == nil || !strings.Contains(err.Error(), "k1impl1") {
+		t.Errorf("Healthy() = %v, want the failed executor", err)
+	}
+
+	_ = m.Close()
+}
@@ -0,0 +1,170 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+// Debug endpoints. They expose the mixer's live state as JSON, to help operators figure out
+// why a request is handled the way it is:
+//
+//     GET  /debug/config     the installed global and service config, with their SHAs and install time
+//     GET  /debug/errors     the most recent config loading errors
+//     GET  /debug/executors  the executors cached by the adapter manager
+//     GET  /debug/builders   the registered builders and the aspect kinds they support
+//     POST /debug/resolve    the configs an API method would dispatch to for a set of attributes
+//
+// The resolve endpoint takes the typed JSON attributes of the HTTP/JSON gateway, along with
+// the method, one of "preprocess", "check", "report" or "quota":
+//
+//     {"method": "check", "attributes": {"target.service": {"string": "reviews"}}}
+//
+// The config may hold credentials, so these endpoints should only be served to trusted clients.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/golang/glog"
+
+	"istio.io/mixer/pkg/adapterManager"
+	"istio.io/mixer/pkg/attribute"
+	"istio.io/mixer/pkg/config"
+	cpb "istio.io/mixer/pkg/config/proto"
+)
+
+type (
+	// ConfigInspector provides the config state exposed by the debug endpoints.
+	ConfigInspector interface {
+		// Current returns the installed config, or nil if there is none yet.
+		Current() *config.Snapshot
+
+		// RecentErrors returns the most recent config loading errors, oldest first.
+		RecentErrors() []config.LoadError
+	}
+
+	// AdapterInspector provides the adapter state exposed by the debug endpoints.
+	AdapterInspector interface {
+		// Executors describes the cached executors.
+		Executors() []adapterManager.ExecutorInfo
+
+		// Builders describes the registered builders.
+		Builders() []adapterManager.BuilderSummary
+
+		// Resolve returns the configs an API method would dispatch to for a set of attributes.
+		Resolve(attrs attribute.Bag, method string) ([]*cpb.Combined, error)
+	}
+
+	debugServer struct {
+		ci             ConfigInspector
+		ai             AdapterInspector
+		maxRequestSize int64
+	}
+
+	resolveRequest struct {
+		Method     string                `json:"method"`
+		Attributes map[string]typedValue `json:"attributes"`
+	}
+
+	debugError struct {
+		Error string `json:"error"`
+	}
+)
+
+// NewDebugHandler returns the http.Handler serving the debug endpoints. Resolve request
+// bodies larger than maxRequestSize bytes are rejected.
+func NewDebugHandler(ci ConfigInspector, ai AdapterInspector, maxRequestSize int64) http.Handler {
+	d := &debugServer{ci: ci, ai: ai, maxRequestSize: maxRequestSize}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/config", d.get(func() (interface{}, error) {
+		if snap := d.ci.Current(); snap != nil {
+			return snap, nil
+		}
+		return nil, errors.New("no config installed yet")
+	}))
+	mux.HandleFunc("/debug/errors", d.get(func() (interface{}, error) {
+		return d.ci.RecentErrors(), nil
+	}))
+	mux.HandleFunc("/debug/executors", d.get(func() (interface{}, error) {
+		return d.ai.Executors(), nil
+	}))
+	mux.HandleFunc("/debug/builders", d.get(func() (interface{}, error) {
+		return d.ai.Builders(), nil
+	}))
+	mux.HandleFunc("/debug/resolve", d.resolve)
+	return mux
+}
+
+// get returns a handler answering GET requests with what fn returns.
+func (d *debugServer) get(fn func() (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeDebugResponse(w, http.StatusMethodNotAllowed, debugError{"only GET is supported"})
+			return
+		}
+
+		v, err := fn()
+		if err != nil {
+			writeDebugResponse(w, http.StatusNotFound, debugError{err.Error()})
+			return
+		}
+		writeDebugResponse(w, http.StatusOK, v)
+	}
+}
+
+func (d *debugServer) resolve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeDebugResponse(w, http.StatusMethodNotAllowed, debugError{"only POST is supported"})
+		return
+	}
+
+	var req resolveRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, d.maxRequestSize)).Decode(&req); err != nil {
+		writeDebugResponse(w, http.StatusBadRequest, debugError{fmt.Sprintf("request could not be decoded: %v", err)})
+		return
+	}
+
+	bag, err := bagFromJSON(req.Attributes)
+	if err != nil {
+		writeDebugResponse(w, http.StatusBadRequest, debugError{fmt.Sprintf("invalid attributes: %v", err)})
+		return
+	}
+	defer bag.Done()
+
+	configs, err := d.ai.Resolve(bag, req.Method)
+	if err != nil {
+		writeDebugResponse(w, http.StatusBadRequest, debugError{err.Error()})
+		return
+	}
+	if configs == nil {
+		configs = []*cpb.Combined{}
+	}
+	writeDebugResponse(w, http.StatusOK, configs)
+}
+
+func writeDebugResponse(w http.ResponseWriter, code int, v interface{}) {
+	body, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		glog.Errorf("Unable to encode debug response: %v", err)
+		code = http.StatusInternalServerError
+		body, _ = json.Marshal(debugError{fmt.Sprintf("response could not be encoded: %v", err)})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_, _ = w.Write(body)
+}
@@ -0,0 +1,123 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"istio.io/mixer/pkg/adapterManager"
+	"istio.io/mixer/pkg/attribute"
+	"istio.io/mixer/pkg/config"
+	cpb "istio.io/mixer/pkg/config/proto"
+)
+
+type (
+	fakeConfigInspector struct {
+		current *config.Snapshot
+		errs    []config.LoadError
+	}
+
+	fakeAdapterInspector struct {
+		executors []adapterManager.ExecutorInfo
+		builders  []adapterManager.BuilderSummary
+		resolved  []*cpb.Combined
+
+		method string
+		target string
+	}
+)
+
+func (f *fakeConfigInspector) Current() *config.Snapshot                  { return f.current }
+func (f *fakeConfigInspector) RecentErrors() []config.LoadError           { return f.errs }
+func (f *fakeAdapterInspector) Executors() []adapterManager.ExecutorInfo  { return f.executors }
+func (f *fakeAdapterInspector) Builders() []adapterManager.BuilderSummary { return f.builders }
+
+func (f *fakeAdapterInspector) Resolve(attrs attribute.Bag, method string) ([]*cpb.Combined, error) {
+	if method != "check" {
+		return nil, errors.New("unknown method '" + method + "'")
+	}
+	f.method = method
+	if v, found := attrs.Get("target.service"); found {
+		f.target = v.(string)
+	}
+	return f.resolved, nil
+}
+
+func TestDebugHandler(t *testing.T) {
+	ci := &fakeConfigInspector{
+		current: &config.Snapshot{ServiceConfig: "subject: namespace:ns", ServiceSHA: "abc123", Installed: time.Now()},
+		errs:    []config.LoadError{{Message: "failed validation", Count: 3}},
+	}
+	ai := &fakeAdapterInspector{
+		executors: []adapterManager.ExecutorInfo{{Kind: config.DenialsKindName, Adapter: "denyChecker", BreakerState: "closed"}},
+		builders:  []adapterManager.BuilderSummary{{Name: "denyChecker", Kinds: []string{config.DenialsKindName}}},
+		resolved:  []*cpb.Combined{{Aspect: &cpb.Aspect{Kind: config.DenialsKindName}, Builder: &cpb.Adapter{Impl: "denyChecker"}}},
+	}
+
+	cases := []struct {
+		method   string
+		path     string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{http.MethodGet, "/debug/config", "", http.StatusOK, `"service_sha": "abc123"`},
+		{http.MethodGet, "/debug/errors", "", http.StatusOK, `"count": 3`},
+		{http.MethodGet, "/debug/executors", "", http.StatusOK, `"adapter": "denyChecker"`},
+		{http.MethodGet, "/debug/builders", "", http.StatusOK, `"name": "denyChecker"`},
+		{http.MethodPost, "/debug/config", "", http.StatusMethodNotAllowed, "only GET"},
+		{http.MethodPost, "/debug/resolve", `{"method": "check", "attributes": {"target.service": {"string": "reviews"}}}`,
+			http.StatusOK, `"impl": "denyChecker"`},
+		{http.MethodPost, "/debug/resolve", `{"method": "frobnicate"}`, http.StatusBadRequest, "unknown method"},
+		{http.MethodPost, "/debug/resolve", `{"method": "check", "attributes": {"a": {}}}`, http.StatusBadRequest, "invalid attributes"},
+		{http.MethodPost, "/debug/resolve", `{`, http.StatusBadRequest, "could not be decoded"},
+		{http.MethodGet, "/debug/resolve", "", http.StatusMethodNotAllowed, "only POST"},
+	}
+
+	h := NewDebugHandler(ci, ai, 1024)
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(c.method, c.path, strings.NewReader(c.body)))
+
+		if w.Code != c.wantCode || !strings.Contains(w.Body.String(), c.wantBody) {
+			t.Errorf("%s %s = %d %q, wanted %d %q", c.method, c.path, w.Code, w.Body.String(), c.wantCode, c.wantBody)
+		}
+	}
+
+	if ai.method != "check" || ai.target != "reviews" {
+		t.Errorf("Resolve called for method %q and target %q, wanted check and reviews", ai.method, ai.target)
+	}
+}
+
+func TestDebugHandler_NoConfig(t *testing.T) {
+	h := NewDebugHandler(&fakeConfigInspector{}, &fakeAdapterInspector{}, 1024)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/config", nil))
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "no config installed") {
+		t.Errorf("/debug/config = %d %q, wanted 404", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/debug/resolve", strings.NewReader(`{"method": "check"}`)))
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Errorf("/debug/resolve = %d %q, wanted 200 []", w.Code, w.Body.String())
+	}
+}
@@ -35,12 +35,15 @@ import (
 	"github.com/golang/protobuf/proto"
 	rpc "github.com/googleapis/googleapis/google/rpc"
 	"github.com/opentracing/opentracing-go/log"
+	"github.com/prometheus/client_golang/prometheus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 
 	mixerpb "istio.io/api/mixer/v1"
 	"istio.io/mixer/pkg/adapterManager"
 	"istio.io/mixer/pkg/aspect"
 	"istio.io/mixer/pkg/attribute"
+	"istio.io/mixer/pkg/monitoring"
 	"istio.io/mixer/pkg/pool"
 	"istio.io/mixer/pkg/status"
 	"istio.io/mixer/pkg/tracing"
@@ -54,6 +57,9 @@ type (
 		tracer           tracing.Tracer
 		gp               *pool.GoroutinePool
 
+		// whether to turn requests away when gp's queue is full rather than wait for room
+		shedLoad bool
+
 		// replaceable sendMsg so we can inject errors in tests
 		sendMsg func(grpc.Stream, proto.Message) error
 	}
@@ -80,13 +86,37 @@ type (
 	dispatchFn    func(ctx context.Context, args dispatchArgs)
 )
 
-// NewGRPCServer creates a gRPC serving stack.
-func NewGRPCServer(aspectDispatcher adapterManager.AspectDispatcher, tracer tracing.Tracer, gp *pool.GoroutinePool) mixerpb.MixerServer {
+var (
+	apiRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mixer_api_requests_total",
+		Help: "Number of API requests handled, by method and result code.",
+	}, []string{"method", "code"})
+
+	apiDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "mixer_api_request_duration_seconds",
+		Help: "Time taken to handle API requests, including the time spent waiting for a worker.",
+	}, []string{"method"})
+)
+
+func init() {
+	monitoring.MustRegister(apiRequests, apiDuration)
+}
+
+// recordRequest updates the API metrics once a request received at start has been handled.
+func recordRequest(method string, start time.Time, result rpc.Status) {
+	apiRequests.WithLabelValues(method, rpc.Code(result.Code).String()).Inc()
+	apiDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+// NewGRPCServer creates a gRPC serving stack. When shedLoad is true, messages that arrive while
+// gp's queue is full are answered with RESOURCE_EXHAUSTED instead of waiting for a worker.
+func NewGRPCServer(aspectDispatcher adapterManager.AspectDispatcher, tracer tracing.Tracer, gp *pool.GoroutinePool, shedLoad bool) mixerpb.MixerServer {
 	return &grpcServer{
 		aspectDispatcher: aspectDispatcher,
 		attrMgr:          attribute.NewManager(),
 		tracer:           tracer,
 		gp:               gp,
+		shedLoad:         shedLoad,
 		sendMsg: func(stream grpc.Stream, m proto.Message) error {
 			return stream.SendMsg(m)
 		},
@@ -124,6 +154,7 @@ func (s *grpcServer) dispatch(stream grpc.Stream, methodName string, getState st
 			glog.Errorf("Reading from gRPC request stream failed: %v", err)
 			return err
 		}
+		start := time.Now()
 		// ensure the indices are matched for processing
 		*dState.responseIndex = *dState.requestIndex
 
@@ -133,6 +164,7 @@ func (s *grpcServer) dispatch(stream grpc.Stream, methodName string, getState st
 			glog.Error(msg, "\n", err)
 			details := status.NewBadRequest("attribute_update", err)
 			*dState.result = status.InvalidWithDetails(msg, details)
+			recordRequest(methodName, start, *dState.result)
 
 			sendLock.Lock()
 			err = s.sendMsg(stream, dState.response)
@@ -147,7 +179,7 @@ func (s *grpcServer) dispatch(stream grpc.Stream, methodName string, getState st
 
 		// throw the message into the work queue
 		wg.Add(1)
-		s.gp.ScheduleWork(func() {
+		work := func() {
 			span, ctx2 := s.tracer.StartSpanFromContext(ctx, "RequestProcessing")
 			span.LogFields(log.Object("gRPC request", dState.request))
 
@@ -164,6 +196,7 @@ func (s *grpcServer) dispatch(stream grpc.Stream, methodName string, getState st
 			}
 
 			worker(ctx2, args)
+			recordRequest(methodName, start, *dState.result)
 
 			sendLock.Lock()
 			if err = respTracker.ApplyBag(responseBag, 0, dState.outAttrs); err != nil {
@@ -184,7 +217,28 @@ func (s *grpcServer) dispatch(stream grpc.Stream, methodName string, getState st
 			span.Finish()
 
 			wg.Done()
-		})
+		}
+
+		if !s.shedLoad {
+			s.gp.ScheduleWork(work)
+		} else if !s.gp.TrySchedule(work) {
+			wg.Done()
+			requestBag.Done()
+
+			if glog.V(2) {
+				glog.Infof("Rejected %s [%x]: the API worker pool is saturated", methodName, *dState.requestIndex)
+			}
+			*dState.result = status.WithResourceExhausted("mixer is overloaded, retry later")
+			recordRequest(methodName, start, *dState.result)
+
+			sendLock.Lock()
+			err = s.sendMsg(stream, dState.response)
+			sendLock.Unlock()
+
+			if err != nil {
+				glog.Errorf("Unable to send gRPC response message: %v", err)
+			}
+		}
 	}
 }
 
@@ -234,7 +288,27 @@ func (s *grpcServer) handleReport(ctx context.Context, args dispatchArgs) {
 	}
 }
 
+// QuotaReleaseMetadata is the gRPC metadata a client sets to "true" when opening a Quota stream
+// to give quota back rather than allocate it. The requests of the stream can't say so themselves,
+// they are defined in istio/api.
+const QuotaReleaseMetadata = "istio-mixer-quota-release"
+
+// releaseRequested returns true when the call ctx belongs to was made to release quota.
+func releaseRequested(ctx context.Context) bool {
+	md, ok := metadata.FromContext(ctx)
+	if !ok {
+		return false
+	}
+	values := md[QuotaReleaseMetadata]
+	return len(values) > 0 && values[0] == "true"
+}
+
 func (s *grpcServer) handleQuota(ctx context.Context, args dispatchArgs) {
+	if releaseRequested(ctx) {
+		s.handleQuotaRelease(ctx, args)
+		return
+	}
+
 	req := args.request.(*mixerpb.QuotaRequest)
 	resp := args.response.(*mixerpb.QuotaResponse)
 
@@ -242,19 +316,19 @@ func (s *grpcServer) handleQuota(ctx context.Context, args dispatchArgs) {
 		glog.Infof("Quota [%x]", req.RequestIndex)
 	}
 
-	qma := &aspect.QuotaMethodArgs{
-		Quota:           req.Quota,
-		Amount:          req.Amount,
-		DeduplicationID: req.DeduplicationId,
-		BestEffort:      req.BestEffort,
+	if req.Amount < 0 {
+		*args.result = status.WithInvalidArgument("quota amount must be >= 0")
+		return
 	}
+
 	var qmr *aspect.QuotaMethodResp
 
-	qmr, *args.result = s.aspectDispatcher.Quota(ctx, args.requestBag, args.responseBag, qma)
+	qmr, *args.result = s.aspectDispatcher.Quota(ctx, args.requestBag, args.responseBag, newQuotaMethodArgs(req))
 
 	if qmr != nil {
 		resp.Amount = qmr.Amount
 		resp.Expiration = qmr.Expiration
+		setQuotaHints(args.responseBag, qmr)
 	}
 
 	if glog.V(2) {
@@ -262,6 +336,58 @@ func (s *grpcServer) handleQuota(ctx context.Context, args dispatchArgs) {
 	}
 }
 
+// handleQuotaRelease gives back the requested amount of quota.
+func (s *grpcServer) handleQuotaRelease(ctx context.Context, args dispatchArgs) {
+	req := args.request.(*mixerpb.QuotaRequest)
+	resp := args.response.(*mixerpb.QuotaResponse)
+
+	if glog.V(2) {
+		glog.Infof("Quota release [%x]", req.RequestIndex)
+	}
+
+	if req.Amount < 0 {
+		*args.result = status.WithInvalidArgument("quota amount must be >= 0")
+		return
+	}
+
+	qma := newQuotaMethodArgs(req)
+	qma.Release = true
+
+	var qmr *aspect.QuotaMethodResp
+	qmr, *args.result = s.aspectDispatcher.Quota(ctx, args.requestBag, args.responseBag, qma)
+	if qmr != nil {
+		resp.Amount = qmr.Amount
+	}
+
+	if glog.V(2) {
+		glog.Infof("Quota release [%x] <-- %s", req.RequestIndex, args.response)
+	}
+}
+
+// setQuotaHints returns the remaining capacity and retry delay reported by the adapter as
+// the quota.remaining and quota.retry_after response attributes, which proxies can turn
+// into X-RateLimit-Remaining and Retry-After headers.
+func setQuotaHints(responseBag *attribute.MutableBag, qmr *aspect.QuotaMethodResp) {
+	if qmr == nil || !qmr.HasHints {
+		return
+	}
+
+	responseBag.Set("quota.remaining", qmr.Remaining)
+	if qmr.RetryAfter > 0 {
+		responseBag.Set("quota.retry_after", qmr.RetryAfter)
+	}
+}
+
+// newQuotaMethodArgs returns the arguments for the operation asked for by req.
+func newQuotaMethodArgs(req *mixerpb.QuotaRequest) *aspect.QuotaMethodArgs {
+	return &aspect.QuotaMethodArgs{
+		Quota:           req.Quota,
+		Amount:          req.Amount,
+		DeduplicationID: req.DeduplicationId,
+		BestEffort:      req.BestEffort,
+	}
+}
+
 func (s *grpcServer) preprocess(dispatch dispatchFn) dispatchFn {
 	return func(ctx context.Context, args dispatchArgs) {
 
@@ -291,7 +417,10 @@ func (s *grpcServer) preprocess(dispatch dispatchFn) dispatchFn {
 }
 
 func getCheckState() dispatchState {
-	request := &mixerpb.CheckRequest{}
+	return newCheckState(&mixerpb.CheckRequest{})
+}
+
+func newCheckState(request *mixerpb.CheckRequest) dispatchState {
 	response := &mixerpb.CheckResponse{}
 	response.AttributeUpdate = &mixerpb.Attributes{}
 	return dispatchState{
@@ -303,7 +432,10 @@ func getCheckState() dispatchState {
 }
 
 func getReportState() dispatchState {
-	request := &mixerpb.ReportRequest{}
+	return newReportState(&mixerpb.ReportRequest{})
+}
+
+func newReportState(request *mixerpb.ReportRequest) dispatchState {
 	response := &mixerpb.ReportResponse{}
 	response.AttributeUpdate = &mixerpb.Attributes{}
 	return dispatchState{
@@ -315,7 +447,10 @@ func getReportState() dispatchState {
 }
 
 func getQuotaState() dispatchState {
-	request := &mixerpb.QuotaRequest{}
+	return newQuotaState(&mixerpb.QuotaRequest{})
+}
+
+func newQuotaState(request *mixerpb.QuotaRequest) dispatchState {
 	response := &mixerpb.QuotaResponse{}
 	response.AttributeUpdate = &mixerpb.Attributes{}
 	return dispatchState{
@@ -23,13 +23,16 @@ import (
 	"net"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 	rpc "github.com/googleapis/googleapis/google/rpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 
 	mixerpb "istio.io/api/mixer/v1"
 	"istio.io/mixer/pkg/adapterManager"
+	"istio.io/mixer/pkg/api/unary"
 	"istio.io/mixer/pkg/aspect"
 	"istio.io/mixer/pkg/attribute"
 	"istio.io/mixer/pkg/pool"
@@ -46,12 +49,28 @@ type testState struct {
 	adapterManager.AspectDispatcher
 
 	client         mixerpb.MixerClient
+	unaryClient    unary.MixerUnaryClient
 	connection     *grpc.ClientConn
 	gs             *grpc.Server
 	gp             *pool.GoroutinePool
 	s              *grpcServer
 	reportBadAttr  bool
 	failPreprocess bool
+
+	// when set, Report signals reportStarted and waits for reportRelease to be closed
+	reportStarted chan struct{}
+	reportRelease chan struct{}
+
+	lock     sync.Mutex // protects lastQMA and lastQMAs
+	lastQMA  *aspect.QuotaMethodArgs
+	lastQMAs []*aspect.QuotaMethodArgs
+
+	// returned by Quota when set
+	qmr    *aspect.QuotaMethodResp
+	qmrOut rpc.Status
+
+	// when set, QuotaBatch fails with this status
+	batchOut *rpc.Status
 }
 
 func (ts *testState) createGRPCServer() (string, error) {
@@ -71,8 +90,9 @@ func (ts *testState) createGRPCServer() (string, error) {
 	ts.gp = pool.NewGoroutinePool(128, false)
 	ts.gp.AddWorkers(32)
 
-	ts.s = NewGRPCServer(ts, tracing.DisabledTracer(), ts.gp).(*grpcServer)
+	ts.s = NewGRPCServer(ts, tracing.DisabledTracer(), ts.gp, false).(*grpcServer)
 	mixerpb.RegisterMixerServer(ts.gs, ts.s)
+	unary.RegisterMixerUnaryServer(ts.gs, NewGRPCUnaryServer(ts, tracing.DisabledTracer(), ts.gp, false))
 
 	go func() {
 		_ = ts.gs.Serve(listener)
@@ -96,12 +116,14 @@ func (ts *testState) createAPIClient(dial string) error {
 	}
 
 	ts.client = mixerpb.NewMixerClient(ts.connection)
+	ts.unaryClient = unary.NewMixerUnaryClient(ts.connection)
 	return nil
 }
 
 func (ts *testState) deleteAPIClient() {
 	_ = ts.connection.Close()
 	ts.client = nil
+	ts.unaryClient = nil
 	ts.connection = nil
 }
 
@@ -130,6 +152,11 @@ func (ts *testState) Check(ctx context.Context, bag *attribute.MutableBag, outpu
 }
 
 func (ts *testState) Report(ctx context.Context, bag *attribute.MutableBag, output *attribute.MutableBag) rpc.Status {
+	if ts.reportStarted != nil {
+		ts.reportStarted <- struct{}{}
+		<-ts.reportRelease
+	}
+
 	if ts.reportBadAttr {
 		// we inject an attribute with an unsupported type to trigger an error path
 		output.Set("BADATTR", 0)
@@ -141,10 +168,32 @@ func (ts *testState) Report(ctx context.Context, bag *attribute.MutableBag, outp
 func (ts *testState) Quota(ctx context.Context, requestBag *attribute.MutableBag, responseBag *attribute.MutableBag,
 	qma *aspect.QuotaMethodArgs) (*aspect.QuotaMethodResp, rpc.Status) {
 
+	ts.lock.Lock()
+	ts.lastQMA = qma
+	ts.lock.Unlock()
+	if ts.qmr != nil {
+		return ts.qmr, ts.qmrOut
+	}
 	qmr := &aspect.QuotaMethodResp{Amount: 42}
 	return qmr, status.OK
 }
 
+func (ts *testState) QuotaBatch(ctx context.Context, requestBag *attribute.MutableBag, responseBag *attribute.MutableBag,
+	qmas []*aspect.QuotaMethodArgs) ([]*aspect.QuotaMethodResp, rpc.Status) {
+
+	ts.lock.Lock()
+	ts.lastQMAs = qmas
+	ts.lock.Unlock()
+	qmrs := make([]*aspect.QuotaMethodResp, len(qmas))
+	if ts.batchOut != nil {
+		return qmrs, *ts.batchOut
+	}
+	for i := range qmas {
+		qmrs[i] = &aspect.QuotaMethodResp{Amount: int64(10 * (i + 1)), Expiration: time.Duration(i+1) * time.Second}
+	}
+	return qmrs, status.OK
+}
+
 func (ts *testState) Preprocess(ctx context.Context, bag, output *attribute.MutableBag) rpc.Status {
 	output.Set("preprocess_attribute", "true")
 	if ts.failPreprocess {
@@ -329,6 +378,131 @@ func TestQuota(t *testing.T) {
 	<-waitc
 }
 
+func TestQuota_Release(t *testing.T) {
+	cases := []struct {
+		name        string
+		release     bool
+		amount      int64
+		wantResult  rpc.Code
+		wantRelease bool
+	}{
+		{"alloc", false, 5, rpc.OK, false},
+		{"release", true, 5, rpc.OK, true},
+		{"negative alloc", false, -5, rpc.INVALID_ARGUMENT, false},
+		{"negative release", true, -5, rpc.INVALID_ARGUMENT, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ts := &testState{}
+			s := NewGRPCServer(ts, tracing.DisabledTracer(), nil, false).(*grpcServer)
+
+			handler := s.handleQuota
+			if c.release {
+				handler = s.handleQuotaRelease
+			}
+
+			var result rpc.Status
+			handler(context.Background(), dispatchArgs{
+				request:  &mixerpb.QuotaRequest{Quota: "q", Amount: c.amount, DeduplicationId: "dedup"},
+				response: &mixerpb.QuotaResponse{},
+				result:   &result,
+			})
+
+			if rpc.Code(result.Code) != c.wantResult {
+				t.Errorf("got result %v, wanted %v", result, c.wantResult)
+			}
+
+			qma := ts.lastQMA
+			if c.wantResult != rpc.OK {
+				if qma != nil {
+					t.Errorf("got quota args %+v for a rejected request", qma)
+				}
+				return
+			}
+			if qma.Amount != c.amount || qma.Release != c.wantRelease || qma.DeduplicationID != "dedup" {
+				t.Errorf("got %+v, wanted amount %d, release %t", qma, c.amount, c.wantRelease)
+			}
+		})
+	}
+}
+
+func TestQuota_ReleaseStream(t *testing.T) {
+	ts, err := prepTestState()
+	if err != nil {
+		t.Fatalf("Unable to prep test state: %v", err)
+	}
+	defer ts.cleanupTestState()
+
+	ctx := metadata.NewContext(context.Background(), metadata.Pairs(QuotaReleaseMetadata, "true"))
+	stream, err := ts.client.Quota(ctx)
+	if err != nil {
+		t.Fatalf("Quota failed %v", err)
+	}
+
+	if err = stream.Send(&mixerpb.QuotaRequest{Quota: "q", Amount: 5, DeduplicationId: "dedup"}); err != nil {
+		t.Fatalf("Quota failed %v", err)
+	}
+	response, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Failed to receive a response : %v", err)
+	}
+	_ = stream.CloseSend()
+
+	if rpc.Code(response.Result.Code) != rpc.OK || response.Amount != 42 {
+		t.Errorf("got %v, wanted OK and an amount of 42", response)
+	}
+	ts.lock.Lock()
+	qma := ts.lastQMA
+	ts.lock.Unlock()
+	if qma == nil || !qma.Release || qma.Amount != 5 {
+		t.Errorf("got quota args %+v, wanted a release of 5 units", qma)
+	}
+}
+
+func TestQuota_Hints(t *testing.T) {
+	cases := []struct {
+		name           string
+		qmr            *aspect.QuotaMethodResp
+		out            rpc.Status
+		wantRemaining  interface{}
+		wantRetryAfter interface{}
+	}{
+		{"no hints", &aspect.QuotaMethodResp{Amount: 5}, status.OK, nil, nil},
+		{"granted", &aspect.QuotaMethodResp{Amount: 5, Remaining: 3, HasHints: true}, status.OK, int64(3), nil},
+		{"exhausted", &aspect.QuotaMethodResp{Remaining: 1, RetryAfter: 2 * time.Second, HasHints: true},
+			status.WithResourceExhausted("out of quota"), int64(1), 2 * time.Second},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ts := &testState{qmr: c.qmr, qmrOut: c.out}
+			s := NewGRPCServer(ts, tracing.DisabledTracer(), nil, false).(*grpcServer)
+
+			var result rpc.Status
+			responseBag := attribute.GetMutableBag(nil)
+			defer responseBag.Done()
+
+			s.handleQuota(context.Background(), dispatchArgs{
+				request:     &mixerpb.QuotaRequest{Quota: "q", Amount: 5},
+				response:    &mixerpb.QuotaResponse{},
+				responseBag: responseBag,
+				result:      &result,
+			})
+
+			if result.Code != c.out.Code {
+				t.Errorf("handleQuota() = %v, wanted %v", result, c.out)
+			}
+			if v, _ := responseBag.Get("quota.remaining"); v != c.wantRemaining {
+				t.Errorf("quota.remaining = %v, wanted %v", v, c.wantRemaining)
+			}
+			if v, _ := responseBag.Get("quota.retry_after"); v != c.wantRetryAfter {
+				t.Errorf("quota.retry_after = %v, wanted %v", v, c.wantRetryAfter)
+			}
+		})
+	}
+}
+
 func TestOverload(t *testing.T) {
 	ts, err := prepTestState()
 	if err != nil {
@@ -384,6 +558,70 @@ func TestOverload(t *testing.T) {
 	<-waitc
 }
 
+func TestLoadShedding(t *testing.T) {
+	ts := &testState{reportStarted: make(chan struct{}, 3), reportRelease: make(chan struct{})}
+
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+
+	// a single worker with room for a single queued message
+	ts.gs = grpc.NewServer()
+	ts.gp = pool.NewGoroutinePool(1, false)
+	ts.s = NewGRPCServer(ts, tracing.DisabledTracer(), ts.gp, true).(*grpcServer)
+	mixerpb.RegisterMixerServer(ts.gs, ts.s)
+	go func() {
+		_ = ts.gs.Serve(listener)
+	}()
+
+	if err = ts.createAPIClient(listener.Addr().String()); err != nil {
+		ts.deleteGRPCServer()
+		t.Fatalf("Unable to create client: %v", err)
+	}
+	defer ts.cleanupTestState()
+
+	stream, err := ts.client.Report(context.Background())
+	if err != nil {
+		t.Fatalf("Report failed %v", err)
+	}
+
+	// the first message occupies the worker, the second one waits in the queue
+	if err = stream.Send(&mixerpb.ReportRequest{RequestIndex: 0}); err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	<-ts.reportStarted
+	for i := int64(1); i < 3; i++ {
+		if err = stream.Send(&mixerpb.ReportRequest{RequestIndex: i}); err != nil {
+			t.Fatalf("Failed to send request %d: %v", i, err)
+		}
+	}
+
+	// the third one is turned away without waiting for the others
+	response, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Failed to receive a response: %v", err)
+	}
+	if response.RequestIndex != 2 || response.Result.Code != int32(rpc.RESOURCE_EXHAUSTED) {
+		t.Errorf("Got response %d with %v, wanted response 2 with RESOURCE_EXHAUSTED", response.RequestIndex, response.Result)
+	}
+
+	close(ts.reportRelease)
+	for i := 0; i < 2; i++ {
+		response, err = stream.Recv()
+		if err != nil {
+			t.Fatalf("Failed to receive a response: %v", err)
+		}
+		if response.Result.Code != int32(rpc.PERMISSION_DENIED) {
+			t.Errorf("Got %v for response %d, wanted PERMISSION_DENIED", response.Result, response.RequestIndex)
+		}
+	}
+
+	if err = stream.CloseSend(); err != nil {
+		t.Errorf("Failed to close gRPC stream: %v", err)
+	}
+}
+
 func TestBadAttr(t *testing.T) {
 	ts, err := prepTestState()
 	if err != nil {
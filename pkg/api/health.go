@@ -0,0 +1,131 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+// Health checking. The mixer's health is reported through the standard grpc.health.v1.Health
+// service on the API port, and through /healthz (liveness) and /readyz (readiness) for
+// orchestrators that probe over HTTP.
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// HealthChecker provides the state the health checks report.
+type HealthChecker interface {
+	// Ready returns nil once the mixer can serve requests, or the reason it can't.
+	Ready() error
+
+	// Live returns nil as long as the mixer makes progress, or the reason it doesn't.
+	Live() error
+
+	// Warnings returns the conditions worth reporting that don't fail the checks.
+	Warnings() []string
+}
+
+// HealthServer serves the standard grpc.health.v1.Health service, Watch included, for the
+// mixer services. Their status is SERVING when the mixer is both live and ready, it is kept
+// up to date by calling Update.
+type HealthServer struct {
+	*health.Server
+	hc HealthChecker
+}
+
+// servedServices are the services whose health can be checked, the empty name stands for the server as a whole.
+var servedServices = []string{
+	"",
+	"istio.mixer.v1.Mixer",
+	"istio.mixer.v1.MixerUnary",
+}
+
+// NewHealthServer returns a HealthServer reporting the health of hc.
+func NewHealthServer(hc HealthChecker) *HealthServer {
+	h := &HealthServer{
+		Server: health.NewServer(),
+		hc:     hc,
+	}
+	h.Update()
+	return h
+}
+
+// Register registers the grpc.health.v1.Health service with a gRPC server.
+func (h *HealthServer) Register(s *grpc.Server) {
+	healthpb.RegisterHealthServer(s, h.Server)
+}
+
+// Update sets the status of the mixer services from the current health of the mixer.
+func (h *HealthServer) Update() {
+	st := healthpb.HealthCheckResponse_SERVING
+	if healthy(h.hc) != nil {
+		st = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	for _, service := range servedServices {
+		h.SetServingStatus(service, st)
+	}
+}
+
+// Run calls Update every interval until stop is closed.
+func (h *HealthServer) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			h.Update()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func healthy(hc HealthChecker) error {
+	if err := hc.Live(); err != nil {
+		return err
+	}
+	return hc.Ready()
+}
+
+// NewHealthHandler returns the http.Handler serving /healthz and /readyz. Both answer
+// 200 when the check passes and 503 along with the reason when it doesn't. /readyz
+// lists the warnings of the mixer after its result.
+func NewHealthHandler(hc HealthChecker) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		writeProbeResult(w, hc.Live(), nil)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		writeProbeResult(w, healthy(hc), hc.Warnings())
+	})
+	return mux
+}
+
+func writeProbeResult(w http.ResponseWriter, err error, warnings []string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = fmt.Fprintln(w, err)
+	} else {
+		_, _ = fmt.Fprintln(w, "ok")
+	}
+	for _, warning := range warnings {
+		_, _ = fmt.Fprintf(w, "warning: %s\n", warning)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+type fakeHealth struct {
+	ready, live error
+	warnings    []string
+}
+
+func (f *fakeHealth) Ready() error       { return f.ready }
+func (f *fakeHealth) Live() error        { return f.live }
+func (f *fakeHealth) Warnings() []string { return f.warnings }
+
+func TestHealthHandler(t *testing.T) {
+	notReady := errors.New("no valid config installed yet")
+	stuck := errors.New("api pool is unresponsive")
+
+	cases := []struct {
+		path     string
+		ready    error
+		live     error
+		warnings []string
+		wantCode int
+		wantBody string
+	}{
+		{"/healthz", nil, nil, nil, http.StatusOK, "ok"},
+		{"/healthz", notReady, nil, nil, http.StatusOK, "ok"},
+		{"/healthz", nil, stuck, nil, http.StatusServiceUnavailable, "unresponsive"},
+		{"/readyz", nil, nil, nil, http.StatusOK, "ok"},
+		{"/readyz", notReady, nil, nil, http.StatusServiceUnavailable, "no valid config"},
+		{"/readyz", nil, stuck, nil, http.StatusServiceUnavailable, "unresponsive"},
+		{"/readyz", nil, nil, []string{"bad config"}, http.StatusOK, "ok\nwarning: bad config"},
+	}
+
+	for _, c := range cases {
+		h := NewHealthHandler(&fakeHealth{ready: c.ready, live: c.live, warnings: c.warnings})
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, c.path, nil))
+
+		if w.Code != c.wantCode || !strings.Contains(w.Body.String(), c.wantBody) {
+			t.Errorf("%s (ready %v, live %v) = %d %q, wanted %d %q", c.path, c.ready, c.live, w.Code, w.Body.String(), c.wantCode, c.wantBody)
+		}
+	}
+}
+
+func TestHealthServer(t *testing.T) {
+	fh := &fakeHealth{ready: errors.New("no valid config installed yet")}
+
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	gs := grpc.NewServer()
+	hs := NewHealthServer(fh)
+	hs.Register(gs)
+	go func() {
+		_ = gs.Serve(listener)
+	}()
+	defer gs.GracefulStop()
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("Unable to dial: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+	client := healthpb.NewHealthClient(conn)
+
+	check := func(service string) healthpb.HealthCheckResponse_ServingStatus {
+		resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			t.Fatalf("Check(%q) failed: %v", service, err)
+		}
+		return resp.Status
+	}
+
+	if got := check(""); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("Check() = %v before the mixer is ready, wanted NOT_SERVING", got)
+	}
+
+	// the status only changes once updated
+	fh.ready = nil
+	if got := check(""); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("Check() = %v before the status is updated, wanted NOT_SERVING", got)
+	}
+
+	hs.Update()
+	for _, service := range []string{"", "istio.mixer.v1.Mixer"} {
+		if got := check(service); got != healthpb.HealthCheckResponse_SERVING {
+			t.Errorf("Check(%q) = %v, wanted SERVING", service, got)
+		}
+	}
+
+	if _, err = client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "unknown"}); grpc.Code(err) != codes.NotFound {
+		t.Errorf("Check(unknown) = %v, wanted NotFound", err)
+	}
+}
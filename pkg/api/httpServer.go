@@ -0,0 +1,336 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+// HTTP/JSON gateway. Exposes Check, Report and Quota to clients that can't easily embed
+// gRPC, as POST /v1/check, /v1/report and /v1/quota. Requests carry their attributes as
+// typed JSON, for example:
+//
+//     {
+//       "attributes": {
+//         "source.name": {"string": "reviews"},
+//         "request.size": {"int64": 1024},
+//         "request.time": {"timestamp": "2017-04-01T10:00:00Z"},
+//         "response.latency": {"duration": "250ms"}
+//       },
+//       "quota": "requestCount",
+//       "amount": 1
+//     }
+//
+// and are dispatched through the same preprocessing and handlers as the gRPC API. The
+// response holds the resulting status and response attributes, and its HTTP status code is
+// derived from the google.rpc.Code of the result.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+	rpc "github.com/googleapis/googleapis/google/rpc"
+
+	mixerpb "istio.io/api/mixer/v1"
+	"istio.io/mixer/pkg/adapterManager"
+	"istio.io/mixer/pkg/attribute"
+	"istio.io/mixer/pkg/status"
+	"istio.io/mixer/pkg/tracing"
+)
+
+type (
+	// httpServer serves the HTTP/JSON gateway.
+	httpServer struct {
+		s              *grpcServer
+		maxRequestSize int64
+	}
+
+	// typedValue is the JSON representation of an attribute value. Exactly one of the fields must be set.
+	typedValue struct {
+		String    *string           `json:"string,omitempty"`
+		Int64     *int64            `json:"int64,omitempty"`
+		Double    *float64          `json:"double,omitempty"`
+		Bool      *bool             `json:"bool,omitempty"`
+		Timestamp *time.Time        `json:"timestamp,omitempty"` // RFC 3339
+		Duration  *string           `json:"duration,omitempty"`  // as understood by time.ParseDuration
+		Bytes     []byte            `json:"bytes,omitempty"`     // base64
+		StringMap map[string]string `json:"string_map,omitempty"`
+	}
+
+	httpRequest struct {
+		Attributes map[string]typedValue `json:"attributes"`
+
+		// Quota only
+		Quota           string `json:"quota,omitempty"`
+		Amount          int64  `json:"amount,omitempty"`
+		DeduplicationID string `json:"deduplication_id,omitempty"`
+		BestEffort      bool   `json:"best_effort,omitempty"`
+		Release         bool   `json:"release,omitempty"` // give amount back instead of allocating it
+	}
+
+	httpStatus struct {
+		Code    string `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+
+	httpResponse struct {
+		Status     httpStatus            `json:"status"`
+		Attributes map[string]typedValue `json:"attributes,omitempty"`
+
+		// Check and Quota only
+		Expiration string `json:"expiration,omitempty"`
+
+		// Quota only
+		Amount int64 `json:"amount,omitempty"`
+	}
+)
+
+// NewHTTPHandler returns the http.Handler serving the HTTP/JSON gateway. Request bodies
+// larger than maxRequestSize bytes are rejected.
+func NewHTTPHandler(aspectDispatcher adapterManager.AspectDispatcher, tracer tracing.Tracer, maxRequestSize int64) http.Handler {
+	h := &httpServer{
+		s: &grpcServer{
+			aspectDispatcher: aspectDispatcher,
+			attrMgr:          attribute.NewManager(),
+			tracer:           tracer,
+		},
+		maxRequestSize: maxRequestSize,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/check", h.check)
+	mux.HandleFunc("/v1/report", h.report)
+	mux.HandleFunc("/v1/quota", h.quota)
+	return mux
+}
+
+func (h *httpServer) check(w http.ResponseWriter, r *http.Request) {
+	h.serve(w, r, "/v1/check", func(ctx context.Context, _ *httpRequest, args dispatchArgs) *httpResponse {
+		args.request = &mixerpb.CheckRequest{}
+		resp := &mixerpb.CheckResponse{}
+		args.response = resp
+
+		h.s.preprocess(h.s.handleCheck)(ctx, args)
+		return &httpResponse{Expiration: durationString(resp.Expiration)}
+	})
+}
+
+func (h *httpServer) report(w http.ResponseWriter, r *http.Request) {
+	h.serve(w, r, "/v1/report", func(ctx context.Context, _ *httpRequest, args dispatchArgs) *httpResponse {
+		args.request = &mixerpb.ReportRequest{}
+		args.response = &mixerpb.ReportResponse{}
+
+		h.s.preprocess(h.s.handleReport)(ctx, args)
+		return &httpResponse{}
+	})
+}
+
+func (h *httpServer) quota(w http.ResponseWriter, r *http.Request) {
+	h.serve(w, r, "/v1/quota", func(ctx context.Context, req *httpRequest, args dispatchArgs) *httpResponse {
+		if req.Quota == "" {
+			*args.result = status.WithInvalidArgument("a quota name is required")
+			return &httpResponse{}
+		}
+
+		args.request = &mixerpb.QuotaRequest{
+			Quota:           req.Quota,
+			Amount:          req.Amount,
+			DeduplicationId: req.DeduplicationID,
+			BestEffort:      req.BestEffort,
+		}
+		resp := &mixerpb.QuotaResponse{}
+		args.response = resp
+
+		handler := h.s.handleQuota
+		if req.Release {
+			handler = h.s.handleQuotaRelease
+		}
+		h.s.preprocess(handler)(ctx, args)
+		return &httpResponse{Expiration: durationString(resp.Expiration), Amount: resp.Amount}
+	})
+}
+
+// serve decodes the request, hands it to the method-specific handler and encodes the response.
+func (h *httpServer) serve(w http.ResponseWriter, r *http.Request, methodName string,
+	handler func(ctx context.Context, req *httpRequest, args dispatchArgs) *httpResponse) {
+
+	start := time.Now()
+	var out rpc.Status
+	defer func() { recordRequest(methodName, start, out) }()
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		out = status.WithMessage(rpc.UNIMPLEMENTED, "only POST is supported")
+		writeHTTPResponse(w, &httpResponse{}, out, http.StatusMethodNotAllowed)
+		return
+	}
+
+	root, ctx := h.s.tracer.StartRootSpan(r.Context(), methodName)
+	defer root.Finish()
+
+	var req httpRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, h.maxRequestSize)).Decode(&req); err != nil {
+		out = status.WithInvalidArgument(fmt.Sprintf("request could not be decoded: %v", err))
+		writeHTTPResponse(w, &httpResponse{}, out, status.HTTPStatusCode(out))
+		return
+	}
+
+	requestBag, err := bagFromJSON(req.Attributes)
+	if err != nil {
+		msg := "Request could not be processed due to invalid 'attributes'."
+		glog.Error(msg, "\n", err)
+		out = status.InvalidWithDetails(msg, status.NewBadRequest("attributes", err))
+		writeHTTPResponse(w, &httpResponse{}, out, status.HTTPStatusCode(out))
+		return
+	}
+	responseBag := attribute.GetMutableBag(nil)
+
+	resp := handler(ctx, &req, dispatchArgs{
+		requestBag:  requestBag,
+		responseBag: responseBag,
+		result:      &out,
+	})
+
+	if resp.Attributes, err = bagToJSON(responseBag); err != nil {
+		glog.Errorf("Unable to encode response attributes, sending blank attributes: %v", err)
+	}
+
+	requestBag.Done()
+	responseBag.Done()
+
+	writeHTTPResponse(w, resp, out, status.HTTPStatusCode(out))
+}
+
+func writeHTTPResponse(w http.ResponseWriter, resp *httpResponse, out rpc.Status, code int) {
+	resp.Status = httpStatus{Code: rpc.Code(out.Code).String(), Message: out.Message}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		glog.Errorf("Unable to send HTTP response: %v", err)
+	}
+}
+
+// bagFromJSON builds a bag out of typed JSON attributes.
+func bagFromJSON(attrs map[string]typedValue) (*attribute.MutableBag, error) {
+	bag := attribute.GetMutableBag(nil)
+
+	for name, tv := range attrs {
+		v, err := tv.value()
+		if err != nil {
+			bag.Done()
+			return nil, fmt.Errorf("attribute '%s': %v", name, err)
+		}
+		bag.Set(name, v)
+	}
+
+	return bag, nil
+}
+
+// bagToJSON returns the attributes of a bag as typed JSON.
+func bagToJSON(bag *attribute.MutableBag) (map[string]typedValue, error) {
+	names := bag.Names()
+	if len(names) == 0 {
+		return nil, nil
+	}
+	sort.Strings(names)
+
+	attrs := make(map[string]typedValue, len(names))
+	for _, name := range names {
+		v, _ := bag.Get(name)
+
+		var tv typedValue
+		switch t := v.(type) {
+		case string:
+			tv.String = &t
+		case int64:
+			tv.Int64 = &t
+		case float64:
+			tv.Double = &t
+		case bool:
+			tv.Bool = &t
+		case time.Time:
+			tv.Timestamp = &t
+		case time.Duration:
+			d := t.String()
+			tv.Duration = &d
+		case []byte:
+			tv.Bytes = t
+		case map[string]string:
+			tv.StringMap = t
+		default:
+			return nil, fmt.Errorf("attribute '%s' has unsupported type %T", name, v)
+		}
+		attrs[name] = tv
+	}
+
+	return attrs, nil
+}
+
+// value returns the single value held by tv.
+func (tv typedValue) value() (interface{}, error) {
+	var v interface{}
+	set := 0
+
+	if tv.String != nil {
+		v = *tv.String
+		set++
+	}
+	if tv.Int64 != nil {
+		v = *tv.Int64
+		set++
+	}
+	if tv.Double != nil {
+		v = *tv.Double
+		set++
+	}
+	if tv.Bool != nil {
+		v = *tv.Bool
+		set++
+	}
+	if tv.Timestamp != nil {
+		v = *tv.Timestamp
+		set++
+	}
+	if tv.Duration != nil {
+		d, err := time.ParseDuration(*tv.Duration)
+		if err != nil {
+			return nil, err
+		}
+		v = d
+		set++
+	}
+	if tv.Bytes != nil {
+		v = tv.Bytes
+		set++
+	}
+	if tv.StringMap != nil {
+		v = tv.StringMap
+		set++
+	}
+
+	if set != 1 {
+		return nil, fmt.Errorf("exactly one typed value must be specified, got %d", set)
+	}
+	return v, nil
+}
+
+func durationString(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
@@ -0,0 +1,163 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"istio.io/mixer/pkg/attribute"
+	"istio.io/mixer/pkg/tracing"
+)
+
+func TestHTTPServer(t *testing.T) {
+	cases := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		failPrep   bool
+		wantCode   int
+		wantStatus string
+	}{
+		{"check", "POST", "/v1/check", `{"attributes": {"source.name": {"string": "client"}}}`, false, 403, "PERMISSION_DENIED"},
+		{"report", "POST", "/v1/report", `{}`, false, 403, "PERMISSION_DENIED"},
+		{"quota", "POST", "/v1/quota", `{"quota": "q", "amount": 2}`, false, 200, "OK"},
+		{"quota without name", "POST", "/v1/quota", `{"amount": 2}`, false, 400, "INVALID_ARGUMENT"},
+		{"preprocess failure", "POST", "/v1/report", `{}`, true, 500, "INTERNAL"},
+		{"bad json", "POST", "/v1/check", `{"attributes": `, false, 400, "INVALID_ARGUMENT"},
+		{"untyped attribute", "POST", "/v1/check", `{"attributes": {"a": {}}}`, false, 400, "INVALID_ARGUMENT"},
+		{"ambiguous attribute", "POST", "/v1/check", `{"attributes": {"a": {"string": "x", "bool": true}}}`, false, 400, "INVALID_ARGUMENT"},
+		{"bad duration", "POST", "/v1/check", `{"attributes": {"a": {"duration": "forever"}}}`, false, 400, "INVALID_ARGUMENT"},
+		{"too large", "POST", "/v1/check", `{"attributes": {"a": {"string": "` + strings.Repeat("x", 1024) + `"}}}`, false, 400, "INVALID_ARGUMENT"},
+		{"wrong method", "GET", "/v1/check", ``, false, 405, "UNIMPLEMENTED"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ts := &testState{failPreprocess: c.failPrep}
+			h := NewHTTPHandler(ts, tracing.DisabledTracer(), 1024)
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(c.method, c.path, strings.NewReader(c.body)))
+
+			if w.Code != c.wantCode {
+				t.Errorf("got HTTP status %d, wanted %d", w.Code, c.wantCode)
+			}
+
+			var resp httpResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("unable to decode response: %v", err)
+			}
+			if resp.Status.Code != c.wantStatus {
+				t.Errorf("got status %v, wanted %s", resp.Status, c.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHTTPServer_Quota(t *testing.T) {
+	ts := &testState{}
+	h := NewHTTPHandler(ts, tracing.DisabledTracer(), 1024)
+
+	w := httptest.NewRecorder()
+	body := `{"quota": "q", "amount": 3, "deduplication_id": "dedup", "best_effort": true, "release": true}`
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/v1/quota", strings.NewReader(body)))
+
+	var resp httpResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("unable to decode response: %v", err)
+	}
+	if resp.Amount != 42 {
+		t.Errorf("got amount %d, wanted 42", resp.Amount)
+	}
+
+	qma := ts.lastQMA
+	if qma.Quota != "q" || qma.Amount != 3 || !qma.Release || qma.DeduplicationID != "dedup" || !qma.BestEffort {
+		t.Errorf("got quota args %+v, wanted a best effort release of 3 units", qma)
+	}
+}
+
+func TestHTTPServer_Attributes(t *testing.T) {
+	ts := &testState{}
+	h := NewHTTPHandler(ts, tracing.DisabledTracer(), 1024)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/check", strings.NewReader(`{}`)))
+
+	var resp httpResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("unable to decode response: %v", err)
+	}
+	if v := resp.Attributes["preprocess_attribute"].String; v == nil || *v != "true" {
+		t.Errorf("got response attributes %v, wanted the preprocessing output", resp.Attributes)
+	}
+	if resp.Expiration != "5s" {
+		t.Errorf("got expiration '%s', wanted 5s", resp.Expiration)
+	}
+}
+
+func TestTypedValues(t *testing.T) {
+	ts := time.Date(2017, 4, 1, 10, 0, 0, 0, time.UTC)
+	in := map[string]interface{}{
+		"s":  "str",
+		"i":  int64(42),
+		"d":  3.5,
+		"b":  true,
+		"t":  ts,
+		"du": 250 * time.Millisecond,
+		"by": []byte{1, 2, 3},
+		"m":  map[string]string{"k": "v"},
+	}
+
+	bag := attribute.GetMutableBag(nil)
+	for k, v := range in {
+		bag.Set(k, v)
+	}
+
+	attrs, err := bagToJSON(bag)
+	if err != nil {
+		t.Fatalf("bagToJSON() failed: %v", err)
+	}
+	bag.Done()
+
+	// go through the wire format
+	buf, err := json.Marshal(attrs)
+	if err != nil {
+		t.Fatalf("unable to encode attributes: %v", err)
+	}
+	attrs = nil
+	if err = json.Unmarshal(buf, &attrs); err != nil {
+		t.Fatalf("unable to decode attributes: %v", err)
+	}
+
+	bag, err = bagFromJSON(attrs)
+	if err != nil {
+		t.Fatalf("bagFromJSON() failed: %v", err)
+	}
+	defer bag.Done()
+
+	for k, want := range in {
+		got, _ := bag.Get(k)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("attribute %s = %v, wanted %v", k, got, want)
+		}
+	}
+}
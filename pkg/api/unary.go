@@ -0,0 +1,251 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+// Unary gRPC server. The streaming API keeps attribute dictionaries and request indices
+// alive for the life of a stream, which is efficient for proxies but painful for simple
+// services and scripts. The unary variants take a complete attribute set with every call
+// and return a single response, while going through the same preprocessing and aspect
+// dispatching as the streaming API.
+//
+// Since the unary methods aren't part of the published Mixer service, they are exposed
+// as the separate istio.mixer.v1.MixerUnary service defined in unary/unary.proto, which
+// uses the same messages.
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/opentracing/opentracing-go/log"
+	netcontext "golang.org/x/net/context"
+
+	mixerpb "istio.io/api/mixer/v1"
+	"istio.io/mixer/pkg/adapterManager"
+	"istio.io/mixer/pkg/api/unary"
+	"istio.io/mixer/pkg/aspect"
+	"istio.io/mixer/pkg/attribute"
+	"istio.io/mixer/pkg/pool"
+	"istio.io/mixer/pkg/status"
+	"istio.io/mixer/pkg/tracing"
+)
+
+// unaryServer implements the MixerUnary service on top of the handlers of the streaming server.
+type unaryServer struct {
+	s *grpcServer
+}
+
+// NewGRPCUnaryServer creates a gRPC serving stack for the unary API. Requests are processed
+// by gp, just like the messages of the streaming API, and are turned away with
+// RESOURCE_EXHAUSTED when shedLoad is true and gp's queue is full.
+func NewGRPCUnaryServer(aspectDispatcher adapterManager.AspectDispatcher, tracer tracing.Tracer, gp *pool.GoroutinePool, shedLoad bool) unary.MixerUnaryServer {
+	return &unaryServer{
+		s: &grpcServer{
+			aspectDispatcher: aspectDispatcher,
+			attrMgr:          attribute.NewManager(),
+			tracer:           tracer,
+			gp:               gp,
+			shedLoad:         shedLoad,
+		},
+	}
+}
+
+// Check is the entry point for the external unary Check method
+func (u *unaryServer) Check(ctx netcontext.Context, req *mixerpb.CheckRequest) (*mixerpb.CheckResponse, error) {
+	dState := newCheckState(req)
+	u.dispatch(ctx, "/istio.mixer.v1.MixerUnary/Check", dState, u.s.preprocess(u.s.handleCheck))
+	return dState.response.(*mixerpb.CheckResponse), nil
+}
+
+// Report is the entry point for the external unary Report method
+func (u *unaryServer) Report(ctx netcontext.Context, req *mixerpb.ReportRequest) (*mixerpb.ReportResponse, error) {
+	dState := newReportState(req)
+	u.dispatch(ctx, "/istio.mixer.v1.MixerUnary/Report", dState, u.s.preprocess(u.s.handleReport))
+	return dState.response.(*mixerpb.ReportResponse), nil
+}
+
+// Quota is the entry point for the external unary Quota method
+func (u *unaryServer) Quota(ctx netcontext.Context, req *mixerpb.QuotaRequest) (*mixerpb.QuotaResponse, error) {
+	dState := newQuotaState(req)
+	u.dispatch(ctx, "/istio.mixer.v1.MixerUnary/Quota", dState, u.s.preprocess(u.s.handleQuota))
+	return dState.response.(*mixerpb.QuotaResponse), nil
+}
+
+// ReleaseQuota is the entry point for the external unary ReleaseQuota method
+func (u *unaryServer) ReleaseQuota(ctx netcontext.Context, req *mixerpb.QuotaRequest) (*mixerpb.QuotaResponse, error) {
+	dState := newQuotaState(req)
+	u.dispatch(ctx, "/istio.mixer.v1.MixerUnary/ReleaseQuota", dState, u.s.preprocess(u.s.handleQuotaRelease))
+	return dState.response.(*mixerpb.QuotaResponse), nil
+}
+
+// QuotaBatch is the entry point for the external unary QuotaBatch method
+func (u *unaryServer) QuotaBatch(ctx netcontext.Context, req *unary.QuotaBatchRequest) (*unary.QuotaBatchResponse, error) {
+	dState := newQuotaBatchState(req)
+	u.dispatch(ctx, "/istio.mixer.v1.MixerUnary/QuotaBatch", dState, u.s.preprocess(u.s.handleQuotaBatch))
+	return dState.response.(*unary.QuotaBatchResponse), nil
+}
+
+func newQuotaBatchState(request *unary.QuotaBatchRequest) dispatchState {
+	response := &unary.QuotaBatchResponse{}
+	response.AttributeUpdate = &mixerpb.Attributes{}
+	return dispatchState{
+		request, response,
+		&request.RequestIndex, &response.RequestIndex,
+		&request.AttributeUpdate, response.AttributeUpdate,
+		&response.Result,
+	}
+}
+
+// handleQuotaBatch allocates several quotas at once, with all-or-nothing semantics. The response
+// holds one result per requested quota, the quota.remaining and quota.retry_after response
+// attributes hold the most restrictive hints.
+func (s *grpcServer) handleQuotaBatch(ctx context.Context, args dispatchArgs) {
+	req := args.request.(*unary.QuotaBatchRequest)
+	resp := args.response.(*unary.QuotaBatchResponse)
+
+	if glog.V(2) {
+		glog.Infof("Quota batch [%x]", req.RequestIndex)
+	}
+
+	if len(req.Quotas) == 0 {
+		*args.result = status.WithInvalidArgument("at least one quota is required")
+		return
+	}
+
+	qmas := make([]*aspect.QuotaMethodArgs, len(req.Quotas))
+	for i, q := range req.Quotas {
+		if q.Quota == "" {
+			*args.result = status.WithInvalidArgument(fmt.Sprintf("quota %d has no name", i))
+			return
+		}
+		if q.Amount < 0 {
+			*args.result = status.WithInvalidArgument(fmt.Sprintf("quota '%s': amount must be >= 0", q.Quota))
+			return
+		}
+
+		qmas[i] = &aspect.QuotaMethodArgs{
+			Quota:           q.Quota,
+			Amount:          q.Amount,
+			DeduplicationID: q.DeduplicationId,
+			BestEffort:      q.BestEffort,
+		}
+	}
+
+	var qmrs []*aspect.QuotaMethodResp
+	qmrs, *args.result = s.aspectDispatcher.QuotaBatch(ctx, args.requestBag, args.responseBag, qmas)
+
+	var hints *aspect.QuotaMethodResp
+	resp.Quotas = make([]*unary.QuotaBatchResponse_Quota, len(req.Quotas))
+	for i := range resp.Quotas {
+		resp.Quotas[i] = &unary.QuotaBatchResponse_Quota{}
+
+		var qmr *aspect.QuotaMethodResp
+		if i < len(qmrs) {
+			qmr = qmrs[i]
+		}
+		if qmr == nil {
+			continue
+		}
+
+		resp.Quotas[i].Amount = qmr.Amount
+		resp.Quotas[i].Expiration = qmr.Expiration
+
+		if qmr.HasHints {
+			if hints == nil {
+				hints = &aspect.QuotaMethodResp{Remaining: qmr.Remaining, RetryAfter: qmr.RetryAfter, HasHints: true}
+			}
+			if qmr.Remaining < hints.Remaining {
+				hints.Remaining = qmr.Remaining
+			}
+			if qmr.RetryAfter > hints.RetryAfter {
+				hints.RetryAfter = qmr.RetryAfter
+			}
+		}
+	}
+
+	setQuotaHints(args.responseBag, hints)
+
+	if glog.V(2) {
+		glog.Infof("Quota batch [%x] <-- %s", req.RequestIndex, args.response)
+	}
+}
+
+// dispatch handles a single request. Each request gets its own attribute trackers, so the
+// request must carry the complete attribute set, and the response carries a complete one too.
+func (u *unaryServer) dispatch(ctx netcontext.Context, methodName string, dState dispatchState, worker dispatchFn) {
+	start := time.Now()
+	defer func() { recordRequest(methodName, start, *dState.result) }()
+
+	reqTracker := u.s.attrMgr.NewTracker()
+	respTracker := u.s.attrMgr.NewTracker()
+	defer reqTracker.Done()
+	defer respTracker.Done()
+
+	root, ctx := u.s.tracer.StartRootSpan(ctx, methodName)
+	defer root.Finish()
+
+	*dState.responseIndex = *dState.requestIndex
+
+	requestBag, err := reqTracker.ApplyProto(dState.inAttrs)
+	if err != nil {
+		msg := "Request could not be processed due to invalid 'attribute_update'."
+		glog.Error(msg, "\n", err)
+		details := status.NewBadRequest("attribute_update", err)
+		*dState.result = status.InvalidWithDetails(msg, details)
+		return
+	}
+
+	// the work runs on the API worker pool, we just wait for it to be done
+	done := make(chan struct{})
+	work := func() {
+		root.LogFields(log.Object("gRPC request", dState.request))
+
+		responseBag := attribute.GetMutableBag(nil)
+
+		worker(ctx, dispatchArgs{
+			dState.request,
+			dState.response,
+			*dState.requestIndex,
+			requestBag,
+			responseBag,
+			dState.result,
+		})
+
+		if err := respTracker.ApplyBag(responseBag, 0, dState.outAttrs); err != nil {
+			*dState.outAttrs = mixerpb.Attributes{}
+			glog.Errorf("Unable to apply response attribute bag, sending blank attributes: %v", err)
+		}
+
+		requestBag.Done()
+		responseBag.Done()
+
+		root.LogFields(log.Object("gRPC response", dState.response))
+		close(done)
+	}
+
+	if !u.s.shedLoad {
+		u.s.gp.ScheduleWork(work)
+	} else if !u.s.gp.TrySchedule(work) {
+		requestBag.Done()
+
+		if glog.V(2) {
+			glog.Infof("Rejected %s [%x]: the API worker pool is saturated", methodName, *dState.requestIndex)
+		}
+		*dState.result = status.WithResourceExhausted("mixer is overloaded, retry later")
+		return
+	}
+	<-done
+}
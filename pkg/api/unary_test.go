@@ -0,0 +1,234 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	rpc "github.com/googleapis/googleapis/google/rpc"
+
+	mixerpb "istio.io/api/mixer/v1"
+	"istio.io/mixer/pkg/api/unary"
+	"istio.io/mixer/pkg/pool"
+	"istio.io/mixer/pkg/status"
+	"istio.io/mixer/pkg/tracing"
+)
+
+func newTestUnaryServer(ts *testState) unary.MixerUnaryServer {
+	gp := pool.NewGoroutinePool(1, true)
+	return NewGRPCUnaryServer(ts, tracing.DisabledTracer(), gp, false)
+}
+
+func TestUnary(t *testing.T) {
+	ts, err := prepTestState()
+	if err != nil {
+		t.Fatalf("Unable to prep test state: %v", err)
+	}
+	defer ts.cleanupTestState()
+
+	ctx := context.Background()
+
+	check, err := ts.unaryClient.Check(ctx, &mixerpb.CheckRequest{RequestIndex: testRequestID0})
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if check.RequestIndex != testRequestID0 || check.Result.Code != int32(rpc.PERMISSION_DENIED) {
+		t.Errorf("Check() = %v, wanted request index %d and PERMISSION_DENIED", check, testRequestID0)
+	}
+
+	report, err := ts.unaryClient.Report(ctx, &mixerpb.ReportRequest{RequestIndex: testRequestID1})
+	if err != nil {
+		t.Fatalf("Report failed: %v", err)
+	}
+	if report.RequestIndex != testRequestID1 {
+		t.Errorf("Report() = %v, wanted request index %d", report, testRequestID1)
+	}
+
+	quota, err := ts.unaryClient.Quota(ctx, &mixerpb.QuotaRequest{Quota: "q", Amount: 1})
+	if err != nil {
+		t.Fatalf("Quota failed: %v", err)
+	}
+	if quota.Result.Code != int32(rpc.OK) || quota.Amount != 42 {
+		t.Errorf("Quota() = %v, wanted 42 units", quota)
+	}
+
+	quota, err = ts.unaryClient.ReleaseQuota(ctx, &mixerpb.QuotaRequest{Quota: "q", Amount: 1})
+	if err != nil {
+		t.Fatalf("ReleaseQuota failed: %v", err)
+	}
+	if quota.Result.Code != int32(rpc.OK) || quota.Amount != 42 || !ts.lastQMA.Release {
+		t.Errorf("ReleaseQuota() = %v with quota args %+v, wanted a release of 42 units", quota, ts.lastQMA)
+	}
+}
+
+func TestUnary_Attributes(t *testing.T) {
+	ts := &testState{}
+	u := newTestUnaryServer(ts)
+
+	// every call stands alone, so each response carries the complete set of response attributes
+	for i := 0; i < 2; i++ {
+		resp, err := u.Check(context.Background(), &mixerpb.CheckRequest{
+			AttributeUpdate: mixerpb.Attributes{
+				Dictionary:       map[int32]string{1: "source.name"},
+				StringAttributes: map[int32]string{1: "client"},
+			},
+		})
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+
+		found := false
+		for idx, name := range resp.AttributeUpdate.Dictionary {
+			if name == "preprocess_attribute" {
+				found = resp.AttributeUpdate.StringAttributes[idx] == "true"
+			}
+		}
+		if !found {
+			t.Errorf("call %d: response attributes %v are missing the preprocessing output", i, resp.AttributeUpdate)
+		}
+	}
+}
+
+func TestUnary_PreprocessFailure(t *testing.T) {
+	ts := &testState{failPreprocess: true}
+	u := newTestUnaryServer(ts)
+
+	resp, err := u.Report(context.Background(), &mixerpb.ReportRequest{})
+	if err != nil {
+		t.Fatalf("Report failed: %v", err)
+	}
+	if resp.Result.Code != int32(rpc.INTERNAL) {
+		t.Errorf("Report() = %v, wanted the preprocessing failure", resp)
+	}
+}
+
+func TestUnary_BadAttributes(t *testing.T) {
+	ts := &testState{}
+	u := newTestUnaryServer(ts)
+
+	// attribute index 1 isn't in the dictionary
+	resp, err := u.Quota(context.Background(), &mixerpb.QuotaRequest{
+		AttributeUpdate: mixerpb.Attributes{StringAttributes: map[int32]string{1: "client"}},
+	})
+	if err != nil {
+		t.Fatalf("Quota failed: %v", err)
+	}
+	if resp.Result.Code != int32(rpc.INVALID_ARGUMENT) {
+		t.Errorf("Quota() = %v, wanted INVALID_ARGUMENT", resp)
+	}
+}
+
+func TestUnary_LoadShedding(t *testing.T) {
+	ts := &testState{reportStarted: make(chan struct{}, 1), reportRelease: make(chan struct{})}
+
+	// a single worker and no room in the queue, shared by both servers
+	gp := pool.NewGoroutinePool(0, false)
+	defer gp.Close()
+	waiting := NewGRPCUnaryServer(ts, tracing.DisabledTracer(), gp, false)
+	u := NewGRPCUnaryServer(ts, tracing.DisabledTracer(), gp, true)
+
+	done := make(chan *mixerpb.ReportResponse)
+	go func() {
+		resp, _ := waiting.Report(context.Background(), &mixerpb.ReportRequest{RequestIndex: 0})
+		done <- resp
+	}()
+	<-ts.reportStarted
+
+	// the worker is busy, so this one is turned away
+	resp, err := u.Report(context.Background(), &mixerpb.ReportRequest{RequestIndex: 1})
+	if err != nil {
+		t.Fatalf("Report failed: %v", err)
+	}
+	if resp.RequestIndex != 1 || resp.Result.Code != int32(rpc.RESOURCE_EXHAUSTED) {
+		t.Errorf("Report() = %v, wanted request index 1 and RESOURCE_EXHAUSTED", resp)
+	}
+
+	close(ts.reportRelease)
+	if resp = <-done; resp.Result.Code != int32(rpc.PERMISSION_DENIED) {
+		t.Errorf("Report() = %v, wanted PERMISSION_DENIED", resp)
+	}
+}
+
+func TestUnary_QuotaBatch(t *testing.T) {
+	exhausted := status.WithResourceExhausted("out of b")
+
+	cases := []struct {
+		name       string
+		quotas     []*unary.QuotaBatchRequest_Quota
+		batchOut   *rpc.Status
+		wantResult rpc.Code
+		wantQuotas []unary.QuotaBatchResponse_Quota
+	}{
+		{"granted", []*unary.QuotaBatchRequest_Quota{
+			{Quota: "a", Amount: 5, DeduplicationId: "a1"},
+			{Quota: "b", Amount: 5, DeduplicationId: "b1", BestEffort: true},
+		}, nil, rpc.OK, []unary.QuotaBatchResponse_Quota{
+			{Amount: 10, Expiration: time.Second},
+			{Amount: 20, Expiration: 2 * time.Second},
+		}},
+		{"failed", []*unary.QuotaBatchRequest_Quota{
+			{Quota: "a", Amount: 5},
+			{Quota: "b", Amount: 5},
+		}, &exhausted, rpc.RESOURCE_EXHAUSTED, []unary.QuotaBatchResponse_Quota{{}, {}}},
+		{"no quotas", nil, nil, rpc.INVALID_ARGUMENT, nil},
+		{"no name", []*unary.QuotaBatchRequest_Quota{
+			{Quota: "a", Amount: 5},
+			{Amount: 5},
+		}, nil, rpc.INVALID_ARGUMENT, nil},
+		{"negative amount", []*unary.QuotaBatchRequest_Quota{
+			{Quota: "a", Amount: -5},
+		}, nil, rpc.INVALID_ARGUMENT, nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ts := &testState{batchOut: c.batchOut}
+			u := newTestUnaryServer(ts)
+
+			resp, err := u.QuotaBatch(context.Background(), &unary.QuotaBatchRequest{RequestIndex: 3, Quotas: c.quotas})
+			if err != nil {
+				t.Fatalf("QuotaBatch failed: %v", err)
+			}
+			if resp.RequestIndex != 3 || rpc.Code(resp.Result.Code) != c.wantResult {
+				t.Errorf("QuotaBatch() = %v, wanted request index 3 and %v", resp, c.wantResult)
+			}
+
+			if len(resp.Quotas) != len(c.wantQuotas) {
+				t.Fatalf("got %d quota results, wanted %d", len(resp.Quotas), len(c.wantQuotas))
+			}
+			for i, q := range resp.Quotas {
+				if q.Amount != c.wantQuotas[i].Amount || q.Expiration != c.wantQuotas[i].Expiration {
+					t.Errorf("quota %d: got %v, wanted %v", i, q, &c.wantQuotas[i])
+				}
+			}
+
+			if c.wantResult == rpc.INVALID_ARGUMENT {
+				if ts.lastQMAs != nil {
+					t.Errorf("got quota operations %v for an invalid batch", ts.lastQMAs)
+				}
+				return
+			}
+			for i, q := range c.quotas {
+				qma := ts.lastQMAs[i]
+				if qma.Quota != q.Quota || qma.Amount != q.Amount || qma.DeduplicationID != q.DeduplicationId ||
+					qma.BestEffort != q.BestEffort || qma.Release {
+					t.Errorf("operation %d = %+v, wanted %v", i, qma, q)
+				}
+			}
+		})
+	}
+}
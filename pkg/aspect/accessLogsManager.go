@@ -15,6 +15,7 @@
 package aspect
 
 import (
+	"context"
 	"fmt"
 	"text/template"
 	"time"
@@ -37,7 +38,9 @@ import (
 // - if we get a label or template param named exactly "timestamp" we populate the value with time.Now()
 
 type (
-	accessLogsManager struct{}
+	accessLogsManager struct {
+		batch BatchConfig
+	}
 
 	accessLogsExecutor struct {
 		name          string
@@ -45,12 +48,13 @@ type (
 		labels        map[string]string // label name -> expression
 		template      *template.Template
 		templateExprs map[string]string // template variable -> expression
+		batch         *batcher          // nil when entries are logged synchronously
 	}
 )
 
 // newAccessLogsManager returns a manager for the access logs aspect.
-func newAccessLogsManager() ReportManager {
-	return accessLogsManager{}
+func newAccessLogsManager(batch BatchConfig) ReportManager {
+	return accessLogsManager{batch}
 }
 
 func (m accessLogsManager) NewReportExecutor(c *cpb.Combined, a adapter.Builder, env adapter.Env, df descriptor.Finder) (ReportExecutor, error) {
@@ -65,13 +69,25 @@ func (m accessLogsManager) NewReportExecutor(c *cpb.Combined, a adapter.Builder,
 		return nil, fmt.Errorf("failed to create aspect for log %s with err: %s", cfg.LogName, err)
 	}
 
-	return &accessLogsExecutor{
+	e := &accessLogsExecutor{
 		name:          cfg.LogName,
 		aspect:        asp,
 		labels:        cfg.Log.Labels,
 		template:      tmpl,
 		templateExprs: cfg.Log.TemplateExpressions,
-	}, nil
+	}
+
+	if m.batch.enabled() {
+		e.batch = newBatcher(config.AccessLogsKind.String(), c.Builder.Name, m.batch, env, func(items []interface{}) error {
+			entries := make([]adapter.LogEntry, len(items))
+			for i, item := range items {
+				entries[i] = item.(adapter.LogEntry)
+			}
+			return asp.LogAccess(entries)
+		})
+	}
+
+	return e, nil
 }
 
 func (accessLogsManager) Kind() config.Kind { return config.AccessLogsKind }
@@ -108,10 +124,13 @@ func (accessLogsManager) ValidateConfig(c config.AspectParams, v expr.Validator,
 }
 
 func (e *accessLogsExecutor) Close() error {
+	if e.batch != nil {
+		e.batch.close()
+	}
 	return e.aspect.Close()
 }
 
-func (e *accessLogsExecutor) Execute(attrs attribute.Bag, mapper expr.Evaluator) rpc.Status {
+func (e *accessLogsExecutor) Execute(ctx context.Context, attrs attribute.Bag, mapper expr.Evaluator) rpc.Status {
 	labels := permissiveEval(e.labels, attrs, mapper)
 	templateVals := permissiveEval(e.templateExprs, attrs, mapper)
 
@@ -128,7 +147,19 @@ func (e *accessLogsExecutor) Execute(attrs attribute.Bag, mapper expr.Evaluator)
 		Labels:      labels,
 		TextPayload: payload,
 	}
-	if err := e.aspect.LogAccess([]adapter.LogEntry{entry}); err != nil {
+
+	if e.batch != nil {
+		if err := e.batch.add(entry); err != nil {
+			return status.WithError(fmt.Errorf("failed to log to %s with err: %s", e.name, err))
+		}
+		return status.OK
+	}
+
+	asp, ok := adapter.BindCall(ctx, e.aspect).(adapter.AccessLogsAspect)
+	if !ok {
+		asp = e.aspect
+	}
+	if err := asp.LogAccess([]adapter.LogEntry{entry}); err != nil {
 		return status.WithError(fmt.Errorf("failed to log to %s with err: %s", e.name, err))
 	}
 	return status.OK
@@ -15,6 +15,7 @@
 package aspect
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
@@ -54,7 +55,7 @@ var (
 )
 
 func TestNewAccessLoggerManager(t *testing.T) {
-	m := newAccessLogsManager()
+	m := newAccessLogsManager(BatchConfig{})
 	if m.Kind() != config.AccessLogsKind {
 		t.Fatalf("Wrong kind of adapter; got %v, want %v", m.Kind(), config.AccessLogsKind)
 	}
@@ -90,7 +91,7 @@ func TestAccessLoggerManager_NewAspect(t *testing.T) {
 		{"combined", combinedStruct, combinedExec},
 	}
 
-	m := newAccessLogsManager()
+	m := newAccessLogsManager(BatchConfig{})
 
 	for idx, v := range newAspectShouldSucceed {
 		t.Run(fmt.Sprintf("[%d] %s", idx, v.name), func(t *testing.T) {
@@ -131,7 +132,7 @@ func TestAccessLoggerManager_NewAspectFailures(t *testing.T) {
 		{"errorLogger", defaultCfg, errLogger},
 	}
 
-	m := newAccessLogsManager()
+	m := newAccessLogsManager(BatchConfig{})
 	for idx, v := range failureCases {
 		t.Run(fmt.Sprintf("[%d] %s", idx, v.name), func(t *testing.T) {
 			if _, err := m.NewReportExecutor(v.cfg, v.adptr, test.Env{}, accesslogsDF); err == nil {
@@ -270,7 +271,7 @@ func TestAccessLoggerExecutor_Execute(t *testing.T) {
 			l := &test.Logger{}
 			v.exec.aspect = l
 
-			if out := v.exec.Execute(v.bag, v.mapper); !status.IsOK(out) {
+			if out := v.exec.Execute(context.Background(), v.bag, v.mapper); !status.IsOK(out) {
 				t.Fatalf("Execute(): should not have received error for %s (%v)", v.name, out)
 			}
 			if l.EntryCount != len(v.wantEntries) {
@@ -319,7 +320,7 @@ func TestAccessLoggerExecutor_ExecuteFailures(t *testing.T) {
 
 	for idx, v := range tests {
 		t.Run(fmt.Sprintf("[%d] %s", idx, v.name), func(t *testing.T) {
-			if out := v.exec.Execute(v.bag, v.mapper); status.IsOK(out) {
+			if out := v.exec.Execute(context.Background(), v.bag, v.mapper); status.IsOK(out) {
 				t.Fatalf("Execute(): expected error for %s", v.name)
 			}
 		})
@@ -0,0 +1,248 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aspect
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	"istio.io/mixer/pkg/adapter"
+	"istio.io/mixer/pkg/config"
+	"istio.io/mixer/pkg/pool"
+)
+
+// AggregationConfig controls the pre-aggregation of metric values within the mixer.
+//
+// When aggregation is enabled, the values produced for a given metric and label set are
+// accumulated over Window and only the aggregate is handed to the adapter: counters are
+// summed, gauges keep their last value.
+type AggregationConfig struct {
+	// Window is the interval over which values are accumulated. 0 disables aggregation.
+	Window time.Duration
+
+	// MaxCells bounds the number of distinct metric and label set combinations accumulated
+	// within a window. Reaching it flushes the aggregates early.
+	MaxCells int
+}
+
+func (c AggregationConfig) enabled() bool {
+	return c.Window > 0
+}
+
+// aggregator accumulates the values produced by a metrics executor and periodically
+// records the aggregates from a daemon of its own.
+type aggregator struct {
+	adapter string
+	cfg     AggregationConfig
+	env     adapter.Env
+	record  func([]adapter.Value) error
+
+	kick    chan struct{}
+	closing chan struct{}
+	closed  chan struct{}
+
+	sync.Mutex // guards cells
+	cells      map[string]*adapter.Value
+}
+
+// newAggregator returns an aggregator handing the aggregates to record. Like for batchers, its
+// loop runs as a daemon of env and each flush as work scheduled through env.
+func newAggregator(adapterName string, cfg AggregationConfig, env adapter.Env, record func([]adapter.Value) error) *aggregator {
+	a := &aggregator{
+		adapter: adapterName,
+		cfg:     cfg,
+		env:     env,
+		record:  record,
+		kick:    make(chan struct{}, 1),
+		closing: make(chan struct{}),
+		closed:  make(chan struct{}),
+		cells:   make(map[string]*adapter.Value),
+	}
+	env.ScheduleDaemon(a.run)
+	return a
+}
+
+// absorb accumulates the values it can aggregate and returns the others, which must be
+// handed to the adapter as usual. Counter values whose numeric type differs from the one
+// accumulated so far for their metric and labels can't be added to it, so they are among
+// the others.
+func (a *aggregator) absorb(values []adapter.Value) []adapter.Value {
+	var rest []adapter.Value
+
+	a.Lock()
+	for _, v := range values {
+		if !aggregatable(v) {
+			rest = append(rest, v)
+			continue
+		}
+
+		key := cellKey(v)
+		cell, found := a.cells[key]
+		if !found {
+			v := v
+			a.cells[key] = &v
+			continue
+		}
+
+		if v.Definition.Kind == adapter.Gauge {
+			cell.MetricValue = v.MetricValue
+			cell.StartTime = v.StartTime
+		} else {
+			total, ok := sum(cell.MetricValue, v.MetricValue)
+			if !ok {
+				rest = append(rest, v)
+				continue
+			}
+			cell.MetricValue = total
+		}
+		cell.EndTime = v.EndTime
+	}
+	full := a.cfg.MaxCells > 0 && len(a.cells) >= a.cfg.MaxCells
+	a.Unlock()
+
+	if full {
+		select {
+		case a.kick <- struct{}{}:
+		default:
+			// a flush is already due
+		}
+	}
+
+	return rest
+}
+
+func (a *aggregator) run() {
+	ticker := time.NewTicker(a.cfg.Window)
+	defer ticker.Stop()
+	defer close(a.closed)
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-a.kick:
+		case <-a.closing:
+			a.flush()
+			return
+		}
+		a.flush()
+	}
+}
+
+// flush records the aggregates accumulated so far and starts a new window.
+func (a *aggregator) flush() {
+	a.Lock()
+	cells := a.cells
+	a.cells = make(map[string]*adapter.Value, len(cells))
+	a.Unlock()
+
+	if len(cells) == 0 {
+		return
+	}
+
+	values := make([]adapter.Value, 0, len(cells))
+	for _, v := range cells {
+		values = append(values, *v)
+	}
+
+	flushThrough(a.env, func() {
+		failed := true
+		defer func() {
+			if failed {
+				batchFlushErrors.WithLabelValues(config.MetricsKind.String(), a.adapter).Inc()
+			}
+		}()
+
+		if err := a.record(values); err != nil {
+			glog.Warningf("Failed to record %d aggregated values to metrics adapter '%s': %v", len(values), a.adapter, err)
+			return
+		}
+		failed = false
+	})
+}
+
+// close records whatever has been accumulated and stops the aggregator.
+func (a *aggregator) close() {
+	close(a.closing)
+	<-a.closed
+}
+
+// aggregatable returns true for the values whose aggregates are meaningful to backends.
+func aggregatable(v adapter.Value) bool {
+	switch v.Definition.Kind {
+	case adapter.Gauge:
+		return true
+	case adapter.Counter:
+		_, ok := sum(v.MetricValue, v.MetricValue)
+		return ok
+	}
+	return false
+}
+
+// sum adds two metric values of the same numeric type.
+func sum(x, y interface{}) (interface{}, bool) {
+	switch a := x.(type) {
+	case int64:
+		if b, ok := y.(int64); ok {
+			return a + b, true
+		}
+	case float64:
+		if b, ok := y.(float64); ok {
+			return a + b, true
+		}
+	case time.Duration:
+		if b, ok := y.(time.Duration); ok {
+			return a + b, true
+		}
+	case int:
+		if b, ok := y.(int); ok {
+			return a + b, true
+		}
+	}
+	return x, false
+}
+
+// cellKey identifies the metric and label set of a value. Each part of the key is prefixed
+// with its length, so that names and values holding separators can't make distinct label
+// sets collide, and label values carry their type, so that 1 and "1" are kept apart.
+func cellKey(v adapter.Value) string {
+	names := make([]string, 0, len(v.Labels))
+	for name := range v.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf := pool.GetBuffer()
+	writeKeyPart(buf, v.Definition.Name)
+	for _, name := range names {
+		value := v.Labels[name]
+		writeKeyPart(buf, name)
+		writeKeyPart(buf, fmt.Sprintf("%T", value))
+		writeKeyPart(buf, fmt.Sprintf("%v", value))
+	}
+	key := buf.String()
+	pool.PutBuffer(buf)
+
+	return key
+}
+
+// writeKeyPart appends s to buf, prefixed with its length.
+func writeKeyPart(buf *bytes.Buffer, s string) {
+	fmt.Fprintf(buf, "%d:%s", len(s), s)
+}
@@ -0,0 +1,262 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aspect
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"istio.io/mixer/pkg/adapter"
+	atest "istio.io/mixer/pkg/adapter/test"
+	aconfig "istio.io/mixer/pkg/aspect/config"
+	"istio.io/mixer/pkg/aspect/test"
+	"istio.io/mixer/pkg/attribute"
+	cpb "istio.io/mixer/pkg/config/proto"
+)
+
+// valueRecorder collects the values handed to it.
+type valueRecorder struct {
+	sync.Mutex
+	values   []adapter.Value
+	recorded chan int
+}
+
+func newValueRecorder() *valueRecorder {
+	return &valueRecorder{recorded: make(chan int, 100)}
+}
+
+func (r *valueRecorder) record(values []adapter.Value) error {
+	r.Lock()
+	r.values = append(r.values, values...)
+	r.Unlock()
+	r.recorded <- len(values)
+	return nil
+}
+
+// byKey returns the recorded values by metric and source label, as in "request_count;source=a".
+func (r *valueRecorder) byKey() map[string]interface{} {
+	r.Lock()
+	defer r.Unlock()
+	out := make(map[string]interface{}, len(r.values))
+	for _, v := range r.values {
+		out[fmt.Sprintf("%s;source=%v", v.Definition.Name, v.Labels["source"])] = v.MetricValue
+	}
+	return out
+}
+
+var (
+	counterDef = &adapter.MetricDefinition{Kind: adapter.Counter, Name: "request_count"}
+	gaugeDef   = &adapter.MetricDefinition{Kind: adapter.Gauge, Name: "queue_depth"}
+)
+
+func val(def *adapter.MetricDefinition, v interface{}, labels map[string]interface{}) adapter.Value {
+	return adapter.Value{Definition: def, MetricValue: v, Labels: labels}
+}
+
+func TestAggregator(t *testing.T) {
+	a := map[string]interface{}{"source": "a"}
+	b := map[string]interface{}{"source": "b"}
+
+	cases := []struct {
+		name   string
+		values []adapter.Value
+		rest   int
+		want   map[string]interface{}
+	}{
+		{"counter sum",
+			[]adapter.Value{val(counterDef, int64(1), a), val(counterDef, int64(2), a), val(counterDef, int64(3), a)},
+			0,
+			map[string]interface{}{"request_count;source=a": int64(6)}},
+		{"float counter sum",
+			[]adapter.Value{val(counterDef, 1.5, a), val(counterDef, 2.0, a)},
+			0,
+			map[string]interface{}{"request_count;source=a": 3.5}},
+		{"gauge last value",
+			[]adapter.Value{val(gaugeDef, int64(7), a), val(gaugeDef, int64(3), a)},
+			0,
+			map[string]interface{}{"queue_depth;source=a": int64(3)}},
+		{"distinct label sets",
+			[]adapter.Value{val(counterDef, int64(1), a), val(counterDef, int64(1), b), val(counterDef, int64(1), a)},
+			0,
+			map[string]interface{}{"request_count;source=a": int64(2), "request_count;source=b": int64(1)}},
+		{"non-summable counter",
+			[]adapter.Value{val(counterDef, "1", a), val(counterDef, int64(1), a)},
+			1,
+			map[string]interface{}{"request_count;source=a": int64(1)}},
+		{"mismatched counter types",
+			[]adapter.Value{val(counterDef, int64(1), a), val(counterDef, 2.5, a), val(counterDef, int64(1), a)},
+			1,
+			map[string]interface{}{"request_count;source=a": int64(2)}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := newValueRecorder()
+			agg := newAggregator("test", AggregationConfig{Window: time.Hour}, atest.NewEnv(t), r.record)
+
+			values := append([]adapter.Value(nil), c.values...)
+			rest := agg.absorb(values)
+			if len(rest) != c.rest {
+				t.Errorf("absorb() left %d values, wanted %d", len(rest), c.rest)
+			}
+			if !reflect.DeepEqual(values, c.values) {
+				t.Errorf("absorb() changed the values it was given to %v", values)
+			}
+
+			agg.close()
+
+			got := r.byKey()
+			if len(got) != len(c.want) {
+				t.Errorf("recorded %v, wanted %v", got, c.want)
+			}
+			for k, v := range c.want {
+				if got[k] != v {
+					t.Errorf("recorded %v for %s, wanted %v", got[k], k, v)
+				}
+			}
+		})
+	}
+}
+
+func TestAggregator_MaxCells(t *testing.T) {
+	r := newValueRecorder()
+	agg := newAggregator("test", AggregationConfig{Window: time.Hour, MaxCells: 2}, atest.NewEnv(t), r.record)
+	defer agg.close()
+
+	agg.absorb([]adapter.Value{
+		val(counterDef, int64(1), map[string]interface{}{"source": "a"}),
+		val(counterDef, int64(1), map[string]interface{}{"source": "b"}),
+	})
+
+	select {
+	case n := <-r.recorded:
+		if n != 2 {
+			t.Errorf("recorded %d values, wanted 2", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("aggregates were not recorded once the cell limit was reached")
+	}
+}
+
+func TestAggregator_Window(t *testing.T) {
+	r := newValueRecorder()
+	agg := newAggregator("test", AggregationConfig{Window: time.Millisecond}, atest.NewEnv(t), r.record)
+	defer agg.close()
+
+	agg.absorb([]adapter.Value{val(gaugeDef, int64(1), nil)})
+
+	select {
+	case n := <-r.recorded:
+		if n != 1 {
+			t.Errorf("recorded %d values, wanted 1", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("aggregates were not recorded at the end of the window")
+	}
+}
+
+func TestCellKey(t *testing.T) {
+	x := val(counterDef, int64(1), map[string]interface{}{"source": "a", "target": "b", "code": int64(200)})
+	y := val(counterDef, int64(1), map[string]interface{}{"target": "b", "code": int64(200), "source": "a"})
+	z := val(gaugeDef, int64(1), map[string]interface{}{"target": "b", "code": int64(200), "source": "a"})
+
+	if cellKey(x) != cellKey(y) {
+		t.Errorf("cellKey() = %s and %s for the same label set", cellKey(x), cellKey(y))
+	}
+	if cellKey(x) == cellKey(z) {
+		t.Errorf("cellKey() = %s for distinct metrics", cellKey(x))
+	}
+
+	// label sets that would collide if the parts of the key were merely joined
+	distinct := []struct {
+		name string
+		a, b map[string]interface{}
+	}{
+		{"separator in value", map[string]interface{}{"a": "x;b=y"}, map[string]interface{}{"a": "x", "b": "y"}},
+		{"separator in name", map[string]interface{}{"a=x;b": "y"}, map[string]interface{}{"a": "x", "b": "y"}},
+		{"value types", map[string]interface{}{"code": int64(200)}, map[string]interface{}{"code": "200"}},
+	}
+	for _, c := range distinct {
+		a := val(counterDef, int64(1), c.a)
+		b := val(counterDef, int64(1), c.b)
+		if cellKey(a) == cellKey(b) {
+			t.Errorf("%s: cellKey() = %s for both %v and %v", c.name, cellKey(a), c.a, c.b)
+		}
+	}
+}
+
+func TestMetricsExecutor_Aggregated(t *testing.T) {
+	var lock sync.Mutex
+	var recorded [][]adapter.Value
+	asp := &fakeaspect{body: func(v []adapter.Value) error {
+		lock.Lock()
+		recorded = append(recorded, v)
+		lock.Unlock()
+		return nil
+	}}
+
+	builder := &fakeBuilder{name: "test", body: func() (adapter.MetricsAspect, error) { return asp, nil }}
+	m := newMetricsManager(BatchConfig{}, AggregationConfig{Window: time.Hour})
+	conf := &cpb.Combined{
+		Aspect: &cpb.Aspect{
+			Params: &aconfig.MetricsParams{
+				Metrics: []*aconfig.MetricsParams_Metric{
+					{DescriptorName: "request_count", Value: "value", Labels: map[string]string{"source": "source"}},
+				},
+			},
+		},
+		Builder: &cpb.Adapter{Name: "test", Params: &aconfig.MetricsParams{}},
+	}
+	e, err := m.NewReportExecutor(conf, builder, atest.NewEnv(t), df)
+	if err != nil {
+		t.Fatalf("NewReportExecutor() failed: %v", err)
+	}
+
+	eval := test.NewFakeEval(func(exp string, _ attribute.Bag) (interface{}, error) {
+		if exp == "value" {
+			return int64(2), nil
+		}
+		return "reviews", nil
+	})
+	for i := 0; i < 3; i++ {
+		if out := e.Execute(context.Background(), test.NewBag(), eval); out.Code != 0 {
+			t.Errorf("Execute() = %v, wanted OK", out)
+		}
+	}
+
+	lock.Lock()
+	if len(recorded) != 0 {
+		t.Errorf("values were recorded before the end of the window")
+	}
+	lock.Unlock()
+
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+
+	if len(recorded) != 1 || len(recorded[0]) != 1 {
+		t.Fatalf("recorded %v, wanted a single aggregate", recorded)
+	}
+	if v := recorded[0][0].MetricValue; v != int64(6) {
+		t.Errorf("recorded %v, wanted 6", v)
+	}
+	if !asp.closed {
+		t.Error("aspect was not closed")
+	}
+}
@@ -15,6 +15,7 @@
 package aspect
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"text/template"
@@ -142,7 +143,7 @@ func (applicationLogsManager) ValidateConfig(c config.AspectParams, v expr.Valid
 
 func (e *applicationLogsExecutor) Close() error { return e.aspect.Close() }
 
-func (e *applicationLogsExecutor) Execute(attrs attribute.Bag, mapper expr.Evaluator) rpc.Status {
+func (e *applicationLogsExecutor) Execute(ctx context.Context, attrs attribute.Bag, mapper expr.Evaluator) rpc.Status {
 	result := &multierror.Error{}
 	var entries []adapter.LogEntry
 
@@ -206,7 +207,11 @@ func (e *applicationLogsExecutor) Execute(attrs attribute.Bag, mapper expr.Evalu
 		entries = append(entries, entry)
 	}
 	if len(entries) > 0 {
-		if err := e.aspect.Log(entries); err != nil {
+		asp, ok := adapter.BindCall(ctx, e.aspect).(adapter.ApplicationLogsAspect)
+		if !ok {
+			asp = e.aspect
+		}
+		if err := asp.Log(entries); err != nil {
 			return status.WithError(err)
 		}
 	}
@@ -0,0 +1,211 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aspect
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"istio.io/mixer/pkg/adapter"
+	"istio.io/mixer/pkg/monitoring"
+)
+
+// BatchConfig controls the asynchronous report pipeline of the metrics and access logs aspects.
+//
+// When batching is enabled, a report is acknowledged as soon as its attributes have been
+// evaluated. The resulting values and log entries are buffered per executor and handed to
+// the adapter in batches, once MaxBatchSize items are buffered or FlushInterval has elapsed,
+// whichever comes first.
+type BatchConfig struct {
+	// MaxBatchSize is the number of buffered items that triggers a flush. 0 disables batching,
+	// in which case every report is sent to the adapters synchronously.
+	MaxBatchSize int
+
+	// FlushInterval is the longest an item stays buffered.
+	FlushInterval time.Duration
+
+	// MaxBuffered bounds the number of items an executor holds, including the ones being
+	// flushed. Items reported while the buffer is full are dropped.
+	MaxBuffered int
+}
+
+func (c BatchConfig) enabled() bool {
+	return c.MaxBatchSize > 0
+}
+
+var (
+	batchDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mixer_report_batch_dropped_total",
+		Help: "Number of report items dropped because the executor's buffer was full.",
+	}, []string{"kind", "adapter"})
+
+	batchFlushErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mixer_report_batch_flush_errors_total",
+		Help: "Number of batches of report items the adapter failed to handle.",
+	}, []string{"kind", "adapter"})
+)
+
+func init() {
+	monitoring.MustRegister(batchDropped, batchFlushErrors)
+}
+
+// errBatcherClosed is returned for items handed to a batcher that has been closed.
+var errBatcherClosed = errors.New("the executor is closed")
+
+// batcher buffers the items produced by a report executor and flushes them to the adapter
+// from a daemon of its own.
+type batcher struct {
+	kind    string
+	adapter string
+	cfg     BatchConfig
+	env     adapter.Env
+	flush   func(items []interface{}) error
+
+	kick    chan struct{}
+	closing chan struct{}
+	closed  chan struct{}
+
+	sync.Mutex // guards the fields below
+	pending    []interface{}
+	inFlight   int
+	stopped    bool
+}
+
+// newBatcher returns a batcher handing items to flush. Its loop runs as a daemon of env, and each
+// flush as work scheduled through env, so that a panicking adapter is accounted for like any
+// other failure of the executor.
+func newBatcher(kind, adapterName string, cfg BatchConfig, env adapter.Env, flush func(items []interface{}) error) *batcher {
+	b := &batcher{
+		kind:    kind,
+		adapter: adapterName,
+		cfg:     cfg,
+		env:     env,
+		flush:   flush,
+		kick:    make(chan struct{}, 1),
+		closing: make(chan struct{}),
+		closed:  make(chan struct{}),
+	}
+	env.ScheduleDaemon(b.run)
+	return b
+}
+
+// add buffers items for the next flush, dropping them if the buffer is full. Items handed to
+// a closed batcher would never be flushed, they are rejected with errBatcherClosed.
+func (b *batcher) add(items ...interface{}) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	b.Lock()
+	if b.stopped {
+		b.Unlock()
+		return errBatcherClosed
+	}
+	if len(b.pending)+b.inFlight+len(items) > b.cfg.MaxBuffered {
+		b.Unlock()
+		batchDropped.WithLabelValues(b.kind, b.adapter).Add(float64(len(items)))
+		if glog.V(2) {
+			glog.Infof("Dropped %d report items for %s adapter '%s': buffer is full", len(items), b.kind, b.adapter)
+		}
+		return nil
+	}
+
+	b.pending = append(b.pending, items...)
+	full := len(b.pending) >= b.cfg.MaxBatchSize
+	b.Unlock()
+
+	if full {
+		select {
+		case b.kick <- struct{}{}:
+		default:
+			// a flush is already due
+		}
+	}
+	return nil
+}
+
+func (b *batcher) run() {
+	ticker := time.NewTicker(b.cfg.FlushInterval)
+	defer ticker.Stop()
+	defer close(b.closed)
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-b.kick:
+		case <-b.closing:
+			b.flushPending()
+			return
+		}
+		b.flushPending()
+	}
+}
+
+// flushPending hands everything buffered so far to the adapter.
+func (b *batcher) flushPending() {
+	b.Lock()
+	items := b.pending
+	b.pending = nil
+	b.inFlight = len(items)
+	b.Unlock()
+
+	if len(items) == 0 {
+		return
+	}
+
+	flushThrough(b.env, func() {
+		failed := true
+		defer func() {
+			if failed {
+				batchFlushErrors.WithLabelValues(b.kind, b.adapter).Inc()
+			}
+		}()
+
+		if err := b.flush(items); err != nil {
+			glog.Warningf("Failed to flush %d report items to %s adapter '%s': %v", len(items), b.kind, b.adapter, err)
+			return
+		}
+		failed = false
+	})
+
+	b.Lock()
+	b.inFlight = 0
+	b.Unlock()
+}
+
+// close flushes whatever is still buffered and stops the batcher.
+func (b *batcher) close() {
+	b.Lock()
+	b.stopped = true
+	b.Unlock()
+
+	close(b.closing)
+	<-b.closed
+}
+
+// flushThrough runs fn as work scheduled through env and waits for it to be done. A panic in
+// fn is recovered by env, which reports it against the executor's adapter.
+func flushThrough(env adapter.Env, fn func()) {
+	done := make(chan struct{})
+	env.ScheduleWork(func() {
+		defer close(done)
+		fn()
+	})
+	<-done
+}
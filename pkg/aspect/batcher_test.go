@@ -0,0 +1,261 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aspect
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"istio.io/mixer/pkg/adapter"
+	atest "istio.io/mixer/pkg/adapter/test"
+	aconfig "istio.io/mixer/pkg/aspect/config"
+	"istio.io/mixer/pkg/aspect/test"
+	"istio.io/mixer/pkg/attribute"
+	cpb "istio.io/mixer/pkg/config/proto"
+)
+
+// flushRecorder collects the batches handed to it.
+type flushRecorder struct {
+	sync.Mutex
+	batches [][]interface{}
+	flushed chan int
+	block   chan struct{}
+	err     error
+}
+
+func newFlushRecorder() *flushRecorder {
+	return &flushRecorder{flushed: make(chan int, 100)}
+}
+
+func (r *flushRecorder) flush(items []interface{}) error {
+	if r.block != nil {
+		<-r.block
+	}
+	r.Lock()
+	r.batches = append(r.batches, items)
+	r.Unlock()
+	r.flushed <- len(items)
+	return r.err
+}
+
+func (r *flushRecorder) total() int {
+	r.Lock()
+	defer r.Unlock()
+	n := 0
+	for _, b := range r.batches {
+		n += len(b)
+	}
+	return n
+}
+
+func TestBatcher_FlushOnSize(t *testing.T) {
+	r := newFlushRecorder()
+	b := newBatcher("metrics", "test", BatchConfig{MaxBatchSize: 3, FlushInterval: time.Hour, MaxBuffered: 10}, atest.NewEnv(t), r.flush)
+	defer b.close()
+
+	_ = b.add(1, 2)
+	_ = b.add(3)
+
+	select {
+	case n := <-r.flushed:
+		if n != 3 {
+			t.Errorf("flushed %d items, wanted 3", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("batch was not flushed once full")
+	}
+}
+
+func TestBatcher_FlushOnInterval(t *testing.T) {
+	r := newFlushRecorder()
+	b := newBatcher("metrics", "test", BatchConfig{MaxBatchSize: 100, FlushInterval: time.Millisecond, MaxBuffered: 100}, atest.NewEnv(t), r.flush)
+	defer b.close()
+
+	_ = b.add(1)
+
+	select {
+	case n := <-r.flushed:
+		if n != 1 {
+			t.Errorf("flushed %d items, wanted 1", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("batch was not flushed after the interval")
+	}
+}
+
+func TestBatcher_Drop(t *testing.T) {
+	r := newFlushRecorder()
+	r.block = make(chan struct{})
+	b := newBatcher("metrics", "test", BatchConfig{MaxBatchSize: 2, FlushInterval: time.Hour, MaxBuffered: 3}, atest.NewEnv(t), r.flush)
+
+	// the first batch gets stuck in the adapter, and still counts against the buffer
+	_ = b.add(1, 2)
+	for {
+		b.Lock()
+		inFlight := b.inFlight
+		b.Unlock()
+		if inFlight == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	_ = b.add(3)
+	_ = b.add(4) // dropped
+
+	close(r.block)
+	b.close()
+
+	if n := r.total(); n != 3 {
+		t.Errorf("flushed %d items, wanted 3", n)
+	}
+}
+
+func TestBatcher_CloseFlushes(t *testing.T) {
+	r := newFlushRecorder()
+	r.err = errors.New("backend down")
+	b := newBatcher("metrics", "test", BatchConfig{MaxBatchSize: 100, FlushInterval: time.Hour, MaxBuffered: 100}, atest.NewEnv(t), r.flush)
+
+	_ = b.add(1, 2)
+	b.close()
+
+	if n := r.total(); n != 2 {
+		t.Errorf("flushed %d items on close, wanted 2", n)
+	}
+}
+
+func TestBatcher_AddAfterClose(t *testing.T) {
+	r := newFlushRecorder()
+	b := newBatcher("metrics", "test", BatchConfig{MaxBatchSize: 100, FlushInterval: time.Hour, MaxBuffered: 100}, atest.NewEnv(t), r.flush)
+	b.close()
+
+	if err := b.add(1); err != errBatcherClosed {
+		t.Errorf("add() = %v after close, wanted %v", err, errBatcherClosed)
+	}
+	b.Lock()
+	if len(b.pending) != 0 {
+		t.Errorf("%d items buffered after close", len(b.pending))
+	}
+	b.Unlock()
+}
+
+// recoveringEnv recovers from the panics of scheduled work and counts them, like the
+// environment the manager gives adapters.
+type recoveringEnv struct {
+	*atest.Env
+
+	lock   sync.Mutex
+	panics int
+}
+
+func (e *recoveringEnv) ScheduleWork(fn adapter.WorkFunc) {
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				e.lock.Lock()
+				e.panics++
+				e.lock.Unlock()
+			}
+		}()
+		fn()
+	}()
+}
+
+func TestBatcher_FlushPanic(t *testing.T) {
+	env := &recoveringEnv{Env: atest.NewEnv(t)}
+	r := newFlushRecorder()
+	calls := 0
+	b := newBatcher("metrics", "test", BatchConfig{MaxBatchSize: 1, FlushInterval: time.Hour, MaxBuffered: 10}, env,
+		func(items []interface{}) error {
+			calls++
+			if calls == 1 {
+				panic("adapter bug")
+			}
+			return r.flush(items)
+		})
+
+	// the first flush panics, the batcher keeps going with the next one
+	_ = b.add(1)
+	for {
+		env.lock.Lock()
+		panics := env.panics
+		env.lock.Unlock()
+		if panics == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	_ = b.add(2)
+	b.close()
+
+	if n := r.total(); n != 1 {
+		t.Errorf("flushed %d items after the panic, wanted 1", n)
+	}
+}
+
+func TestMetricsExecutor_Batched(t *testing.T) {
+	var lock sync.Mutex
+	var recorded [][]adapter.Value
+	asp := &fakeaspect{body: func(v []adapter.Value) error {
+		lock.Lock()
+		recorded = append(recorded, v)
+		lock.Unlock()
+		return nil
+	}}
+
+	builder := &fakeBuilder{name: "test", body: func() (adapter.MetricsAspect, error) { return asp, nil }}
+	m := newMetricsManager(BatchConfig{MaxBatchSize: 100, FlushInterval: time.Hour, MaxBuffered: 100}, AggregationConfig{})
+	conf := &cpb.Combined{
+		Aspect: &cpb.Aspect{
+			Params: &aconfig.MetricsParams{
+				Metrics: []*aconfig.MetricsParams_Metric{
+					{DescriptorName: "request_count", Value: "value", Labels: map[string]string{"source": "source"}},
+				},
+			},
+		},
+		Builder: &cpb.Adapter{Name: "test", Params: &aconfig.MetricsParams{}},
+	}
+	e, err := m.NewReportExecutor(conf, builder, atest.NewEnv(t), df)
+	if err != nil {
+		t.Fatalf("NewReportExecutor() failed: %v", err)
+	}
+
+	eval := test.NewFakeEval(func(exp string, _ attribute.Bag) (interface{}, error) { return 1, nil })
+	for i := 0; i < 3; i++ {
+		if out := e.Execute(context.Background(), test.NewBag(), eval); out.Code != 0 {
+			t.Errorf("Execute() = %v, wanted OK", out)
+		}
+	}
+
+	lock.Lock()
+	if len(recorded) != 0 {
+		t.Errorf("values were recorded before the batch was flushed")
+	}
+	lock.Unlock()
+
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+
+	if len(recorded) != 1 || len(recorded[0]) != 3 {
+		t.Errorf("recorded %v, wanted a single batch of 3 values", recorded)
+	}
+	if !asp.closed {
+		t.Error("aspect was not closed")
+	}
+}
@@ -15,6 +15,7 @@
 package aspect
 
 import (
+	"context"
 	rpc "github.com/googleapis/googleapis/google/rpc"
 
 	"istio.io/mixer/pkg/adapter"
@@ -60,8 +61,12 @@ func (denialsManager) ValidateConfig(config.AspectParams, expr.Validator, descri
 	return
 }
 
-func (a *denialsExecutor) Execute(attrs attribute.Bag, mapper expr.Evaluator) rpc.Status {
-	return a.aspect.Deny()
+func (a *denialsExecutor) Execute(ctx context.Context, attrs attribute.Bag, mapper expr.Evaluator) rpc.Status {
+	asp, ok := adapter.BindCall(ctx, a.aspect).(adapter.DenialsAspect)
+	if !ok {
+		asp = a.aspect
+	}
+	return asp.Deny()
 }
 
 func (a *denialsExecutor) Close() error { return a.aspect.Close() }
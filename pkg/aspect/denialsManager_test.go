@@ -15,6 +15,7 @@
 package aspect
 
 import (
+	"context"
 	"errors"
 	"testing"
 
@@ -92,7 +93,7 @@ func (d *testDenier) Deny() rpc.Status {
 func TestDenialsExecutor_Execute(t *testing.T) {
 	executor := &denialsExecutor{&testDenier{}}
 
-	got := executor.Execute(test.NewBag(), test.NewIDEval())
+	got := executor.Execute(context.Background(), test.NewBag(), test.NewIDEval())
 	if got.Code != int32(rpc.PERMISSION_DENIED) {
 		t.Errorf("Execute() => %v, wanted %v", got.Code, rpc.PERMISSION_DENIED)
 	}
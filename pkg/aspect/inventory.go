@@ -24,6 +24,13 @@ type ManagerInventory struct {
 
 // Inventory returns the authoritative set of aspect managers used by the mixer.
 func Inventory() ManagerInventory {
+	return ReportingInventory(BatchConfig{}, AggregationConfig{})
+}
+
+// ReportingInventory returns the authoritative set of aspect managers used by the mixer, with
+// the metrics and access logs aspects dispatching reports according to batch, and the metrics
+// aspect pre-aggregating values according to agg.
+func ReportingInventory(batch BatchConfig, agg AggregationConfig) ManagerInventory {
 	return ManagerInventory{
 		Preprocess: []PreprocessManager{},
 		Check: []CheckManager{
@@ -33,8 +40,8 @@ func Inventory() ManagerInventory {
 
 		Report: []ReportManager{
 			newApplicationLogsManager(),
-			newAccessLogsManager(),
-			newMetricsManager(),
+			newAccessLogsManager(batch),
+			newMetricsManager(batch, agg),
 		},
 
 		Quota: []QuotaManager{
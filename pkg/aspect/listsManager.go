@@ -15,6 +15,7 @@
 package aspect
 
 import (
+	"context"
 	"fmt"
 
 	rpc "github.com/googleapis/googleapis/google/rpc"
@@ -81,7 +82,7 @@ func (listsManager) ValidateConfig(c config.AspectParams, v expr.Validator, df d
 	return
 }
 
-func (a *listsExecutor) Execute(attrs attribute.Bag, mapper expr.Evaluator) rpc.Status {
+func (a *listsExecutor) Execute(ctx context.Context, attrs attribute.Bag, mapper expr.Evaluator) rpc.Status {
 	var found bool
 	var err error
 
@@ -97,7 +98,11 @@ func (a *listsExecutor) Execute(attrs attribute.Bag, mapper expr.Evaluator) rpc.
 		return status.WithError(err)
 	}
 
-	if found, err = a.aspect.CheckList(symbol); err != nil {
+	asp, ok := adapter.BindCall(ctx, a.aspect).(adapter.ListsAspect)
+	if !ok {
+		asp = a.aspect
+	}
+	if found, err = asp.CheckList(symbol); err != nil {
 		return status.WithError(err)
 	}
 
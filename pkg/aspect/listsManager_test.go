@@ -15,6 +15,7 @@
 package aspect
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
@@ -151,7 +152,7 @@ func TestListsExecutor_Execute(t *testing.T) {
 	for _, v := range cases {
 		t.Run(v.name, func(t *testing.T) {
 			e := &listsExecutor{v.inputs, v.aspect, v.params}
-			got := e.Execute(test.NewBag(), test.NewIDEval())
+			got := e.Execute(context.Background(), test.NewBag(), test.NewIDEval())
 			if got.Code != int32(rpc.OK) {
 				t.Errorf("Execute() => %v, wanted status with code: %v", got, int32(rpc.OK))
 			}
@@ -159,6 +160,45 @@ func TestListsExecutor_Execute(t *testing.T) {
 	}
 }
 
+// bindingList hands out bound for every call.
+type bindingList struct {
+	testList
+	bound adapter.Aspect
+	ctx   context.Context
+}
+
+func (l *bindingList) BindCall(ctx context.Context) adapter.Aspect {
+	l.ctx = ctx
+	return l.bound
+}
+
+func TestListsExecutor_BindCall(t *testing.T) {
+	l := &bindingList{bound: &testList{inList: true}}
+	e := &listsExecutor{map[string]string{"ipAddr": "source.ip"}, l, &aconfig.ListsParams{CheckExpression: "ipAddr"}}
+
+	ctx := context.WithValue(context.Background(), struct{}{}, "call")
+	if got := e.Execute(ctx, test.NewBag(), test.NewIDEval()); got.Code != int32(rpc.OK) {
+		t.Errorf("Execute() => %v, wanted the bound aspect to find the symbol", got)
+	}
+	if l.ctx != ctx {
+		t.Errorf("Aspect bound to %v, wanted the context of the call", l.ctx)
+	}
+}
+
+// denier is an aspect of another kind than lists.
+type denier struct{ adapter.Aspect }
+
+func (denier) Deny() rpc.Status { return rpc.Status{Code: int32(rpc.PERMISSION_DENIED)} }
+
+func TestListsExecutor_BindCallMismatch(t *testing.T) {
+	l := &bindingList{testList: testList{inList: true}, bound: denier{}}
+	e := &listsExecutor{map[string]string{"ipAddr": "source.ip"}, l, &aconfig.ListsParams{CheckExpression: "ipAddr"}}
+
+	if got := e.Execute(context.Background(), test.NewBag(), test.NewIDEval()); got.Code != int32(rpc.OK) {
+		t.Errorf("Execute() => %v, wanted the aspect itself to be invoked", got)
+	}
+}
+
 func TestListsExecutor_ExecuteErrors(t *testing.T) {
 
 	attrParam := &aconfig.ListsParams{CheckExpression: "ipAddr"}
@@ -182,7 +222,7 @@ func TestListsExecutor_ExecuteErrors(t *testing.T) {
 	for _, v := range cases {
 		t.Run(v.name, func(t *testing.T) {
 			e := &listsExecutor{v.inputs, v.aspect, v.params}
-			got := e.Execute(test.NewBag(), test.NewIDEval())
+			got := e.Execute(context.Background(), test.NewBag(), test.NewIDEval())
 			if got.Code != v.wantCode {
 				t.Errorf("Execute() => %v, wanted status with code: %v", got, v.wantCode)
 			}
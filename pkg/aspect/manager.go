@@ -18,6 +18,7 @@
 package aspect
 
 import (
+	"context"
 	"io"
 	"time"
 
@@ -84,24 +85,24 @@ type (
 	CheckExecutor interface {
 		Executor
 
-		// Execute dispatches to the aspect manager.
-		Execute(attrs attribute.Bag, mapper expr.Evaluator) rpc.Status
+		// Execute dispatches to the aspect manager. ctx is done once the call is given up on.
+		Execute(ctx context.Context, attrs attribute.Bag, mapper expr.Evaluator) rpc.Status
 	}
 
 	// ReportExecutor encapsulates a single ReportManager aspect and allows it to be invoked.
 	ReportExecutor interface {
 		Executor
 
-		// Execute dispatches to the aspect manager.
-		Execute(attrs attribute.Bag, mapper expr.Evaluator) rpc.Status
+		// Execute dispatches to the aspect manager. ctx is done once the call is given up on.
+		Execute(ctx context.Context, attrs attribute.Bag, mapper expr.Evaluator) rpc.Status
 	}
 
 	// QuotaExecutor encapsulates a single QuotaManager aspect and allows it to be invoked.
 	QuotaExecutor interface {
 		Executor
 
-		// Execute dispatches to the aspect manager.
-		Execute(attrs attribute.Bag, mapper expr.Evaluator, qma *QuotaMethodArgs) (rpc.Status, *QuotaMethodResp)
+		// Execute dispatches to the aspect manager. ctx is done once the call is given up on.
+		Execute(ctx context.Context, attrs attribute.Bag, mapper expr.Evaluator, qma *QuotaMethodArgs) (rpc.Status, *QuotaMethodResp)
 	}
 
 	// QuotaMethodArgs is supplied by invocations of the Quota method.
@@ -121,6 +122,10 @@ type (
 		// false, the exact requested amount is returned or 0 if not enough quota
 		// was available.
 		BestEffort bool
+
+		// If true, Amount is given back to the quota rather than allocated from it.
+		// Releases are always best effort, the response holds the amount actually released.
+		Release bool
 	}
 
 	// QuotaMethodResp is returned by invocations of the Quota method.
@@ -130,6 +135,16 @@ type (
 
 		// The total amount of quota returned, may be less than requested.
 		Amount int64
+
+		// The amount of quota left once the operation is done. Only meaningful when HasHints is true.
+		Remaining int64
+
+		// How long until the amount requested but not granted becomes available, 0 when it is not
+		// expected to free up by itself. Only meaningful when HasHints is true.
+		RetryAfter time.Duration
+
+		// HasHints is true when the adapter supplied Remaining and RetryAfter.
+		HasHints bool
 	}
 
 	// PreprocessExecutor encapsulates a single PreprocessManager aspect
@@ -137,8 +152,8 @@ type (
 	PreprocessExecutor interface {
 		Executor
 
-		// Execute dispatches to the aspect manager.
-		Execute(attrs attribute.Bag, mapper expr.Evaluator) (*PreprocessResult, rpc.Status)
+		// Execute dispatches to the aspect manager. ctx is done once the call is given up on.
+		Execute(ctx context.Context, attrs attribute.Bag, mapper expr.Evaluator) (*PreprocessResult, rpc.Status)
 	}
 
 	// PreprocessResult holds the generated data from the preprocess adapters.
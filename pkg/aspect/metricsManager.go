@@ -15,6 +15,7 @@
 package aspect
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -34,7 +35,10 @@ import (
 )
 
 type (
-	metricsManager struct{}
+	metricsManager struct {
+		batch BatchConfig
+		agg   AggregationConfig
+	}
 
 	metricInfo struct {
 		definition *adapter.MetricDefinition
@@ -46,12 +50,14 @@ type (
 		name     string
 		aspect   adapter.MetricsAspect
 		metadata map[string]*metricInfo // metric name -> info
+		batch    *batcher               // nil when values are recorded synchronously
+		agg      *aggregator            // nil when values aren't pre-aggregated
 	}
 )
 
 // newMetricsManager returns a manager for the metric aspect.
-func newMetricsManager() ReportManager {
-	return &metricsManager{}
+func newMetricsManager(batch BatchConfig, agg AggregationConfig) ReportManager {
+	return &metricsManager{batch, agg}
 }
 
 func (m *metricsManager) NewReportExecutor(c *cpb.Combined, a adapter.Builder, env adapter.Env, df descriptor.Finder) (ReportExecutor, error) {
@@ -75,7 +81,23 @@ func (m *metricsManager) NewReportExecutor(c *cpb.Combined, a adapter.Builder, e
 	if err != nil {
 		return nil, fmt.Errorf("failed to construct metrics aspect with config '%v' and err: %s", c, err)
 	}
-	return &metricsExecutor{b.Name(), asp, metadata}, nil
+	e := &metricsExecutor{name: b.Name(), aspect: asp, metadata: metadata}
+
+	if m.batch.enabled() {
+		e.batch = newBatcher(config.MetricsKind.String(), c.Builder.Name, m.batch, env, func(items []interface{}) error {
+			values := make([]adapter.Value, len(items))
+			for i, item := range items {
+				values[i] = item.(adapter.Value)
+			}
+			return asp.Record(values)
+		})
+	}
+
+	if m.agg.enabled() {
+		e.agg = newAggregator(c.Builder.Name, m.agg, env, asp.Record)
+	}
+
+	return e, nil
 }
 
 func (*metricsManager) Kind() config.Kind                  { return config.MetricsKind }
@@ -103,7 +125,7 @@ func (*metricsManager) ValidateConfig(c config.AspectParams, v expr.Validator, d
 	return
 }
 
-func (w *metricsExecutor) Execute(attrs attribute.Bag, mapper expr.Evaluator) rpc.Status {
+func (w *metricsExecutor) Execute(ctx context.Context, attrs attribute.Bag, mapper expr.Evaluator) rpc.Status {
 	result := &multierror.Error{}
 	var values []adapter.Value
 
@@ -131,8 +153,28 @@ func (w *metricsExecutor) Execute(attrs attribute.Bag, mapper expr.Evaluator) rp
 		})
 	}
 
-	if err := w.aspect.Record(values); err != nil {
-		result = multierror.Append(result, fmt.Errorf("failed to record all values with err: %s", err))
+	if w.agg != nil {
+		// aggregates are recorded at the end of the window, only the rest goes through now
+		values = w.agg.absorb(values)
+	}
+
+	if w.batch != nil {
+		// the report is acknowledged now, the values get recorded with the next batch
+		items := make([]interface{}, len(values))
+		for i, v := range values {
+			items[i] = v
+		}
+		if err := w.batch.add(items...); err != nil {
+			result = multierror.Append(result, fmt.Errorf("failed to record all values with err: %s", err))
+		}
+	} else if len(values) > 0 || w.agg == nil {
+		asp, ok := adapter.BindCall(ctx, w.aspect).(adapter.MetricsAspect)
+		if !ok {
+			asp = w.aspect
+		}
+		if err := asp.Record(values); err != nil {
+			result = multierror.Append(result, fmt.Errorf("failed to record all values with err: %s", err))
+		}
 	}
 
 	if glog.V(4) {
@@ -148,6 +190,12 @@ func (w *metricsExecutor) Execute(attrs attribute.Bag, mapper expr.Evaluator) rp
 }
 
 func (w *metricsExecutor) Close() error {
+	if w.agg != nil {
+		w.agg.close()
+	}
+	if w.batch != nil {
+		w.batch.close()
+	}
 	return w.aspect.Close()
 }
 
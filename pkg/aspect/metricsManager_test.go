@@ -15,6 +15,7 @@
 package aspect
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
@@ -102,7 +103,7 @@ var (
 )
 
 func TestNewMetricsManager(t *testing.T) {
-	m := newMetricsManager()
+	m := newMetricsManager(BatchConfig{}, AggregationConfig{})
 	if m.Kind() != config.MetricsKind {
 		t.Errorf("m.Kind() = %s wanted %s", m.Kind(), config.MetricsKind)
 	}
@@ -130,7 +131,7 @@ func TestMetricsManager_NewAspect(t *testing.T) {
 	builder := &fakeBuilder{name: "test", body: func() (adapter.MetricsAspect, error) {
 		return &fakeaspect{body: func([]adapter.Value) error { return nil }}, nil
 	}}
-	if _, err := newMetricsManager().NewReportExecutor(conf, builder, atest.NewEnv(t), df); err != nil {
+	if _, err := newMetricsManager(BatchConfig{}, AggregationConfig{}).NewReportExecutor(conf, builder, atest.NewEnv(t), df); err != nil {
 		t.Errorf("NewExecutor(conf, builder, test.NewEnv(t)) = _, %v; wanted no err", err)
 	}
 }
@@ -251,9 +252,9 @@ func TestMetricsManager_NewAspect_PropagatesError(t *testing.T) {
 		body: func() (adapter.MetricsAspect, error) {
 			return nil, errors.New(errString)
 		}}
-	_, err := newMetricsManager().NewReportExecutor(conf, builder, atest.NewEnv(t), df)
+	_, err := newMetricsManager(BatchConfig{}, AggregationConfig{}).NewReportExecutor(conf, builder, atest.NewEnv(t), df)
 	if err == nil {
-		t.Error("newMetricsManager().NewReportExecutor(conf, builder, test.NewEnv(t)) = _, nil; wanted err")
+		t.Error("newMetricsManager(BatchConfig{}, AggregationConfig{}).NewReportExecutor(conf, builder, test.NewEnv(t)) = _, nil; wanted err")
 	}
 	if !strings.Contains(err.Error(), errString) {
 		t.Errorf("NewExecutor(conf, builder, test.NewEnv(t)) = _, %v; wanted err %s", err, errString)
@@ -347,7 +348,7 @@ func TestMetricsExecutor_Execute(t *testing.T) {
 				}},
 				metadata: c.mdin,
 			}
-			out := executor.Execute(test.NewBag(), c.eval)
+			out := executor.Execute(context.Background(), test.NewBag(), c.eval)
 
 			errString := out.Message
 			if !strings.Contains(errString, c.errString) {
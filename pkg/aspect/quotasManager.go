@@ -15,6 +15,7 @@
 package aspect
 
 import (
+	"context"
 	"fmt"
 
 	ptypes "github.com/gogo/protobuf/types"
@@ -102,7 +103,7 @@ func (*quotasManager) ValidateConfig(c config.AspectParams, v expr.Validator, df
 	return
 }
 
-func (w *quotasExecutor) Execute(attrs attribute.Bag, mapper expr.Evaluator, qma *QuotaMethodArgs) (rpc.Status, *QuotaMethodResp) {
+func (w *quotasExecutor) Execute(ctx context.Context, attrs attribute.Bag, mapper expr.Evaluator, qma *QuotaMethodArgs) (rpc.Status, *QuotaMethodResp) {
 	info, ok := w.metadata[qma.Quota]
 	if !ok {
 		msg := fmt.Sprintf("Unknown quota '%s' requested", qma.Quota)
@@ -124,6 +125,14 @@ func (w *quotasExecutor) Execute(attrs attribute.Bag, mapper expr.Evaluator, qma
 		DeduplicationID: qma.DeduplicationID,
 	}
 
+	asp, ok := adapter.BindCall(ctx, w.aspect).(adapter.QuotasAspect)
+	if !ok {
+		asp = w.aspect
+	}
+	if qma.Release {
+		return w.release(asp, qa)
+	}
+
 	var qr adapter.QuotaResult
 
 	if glog.V(2) {
@@ -131,9 +140,9 @@ func (w *quotasExecutor) Execute(attrs attribute.Bag, mapper expr.Evaluator, qma
 	}
 
 	if qma.BestEffort {
-		qr, err = w.aspect.AllocBestEffort(qa)
+		qr, err = asp.AllocBestEffort(qa)
 	} else {
-		qr, err = w.aspect.Alloc(qa)
+		qr, err = asp.Alloc(qa)
 	}
 
 	if err != nil {
@@ -141,20 +150,41 @@ func (w *quotasExecutor) Execute(attrs attribute.Bag, mapper expr.Evaluator, qma
 		return status.WithError(err), nil
 	}
 
+	qmr := QuotaMethodResp(qr)
+
 	if qr.Amount == 0 {
 		msg := fmt.Sprintf("Unable to allocate %v units from quota %s", qa.QuotaAmount, qa.Definition.Name)
 		glog.Warning(msg)
-		return status.WithResourceExhausted(msg), nil
+
+		// the response is still handed back so callers can see when to retry
+		return status.WithResourceExhausted(msg), &qmr
 	}
 
 	if glog.V(2) {
 		glog.Infof("Allocated %v units from quota %s", qa.QuotaAmount, qa.Definition.Name)
 	}
 
-	qmr := QuotaMethodResp(qr)
 	return status.OK, &qmr
 }
 
+func (w *quotasExecutor) release(asp adapter.QuotasAspect, qa adapter.QuotaArgs) (rpc.Status, *QuotaMethodResp) {
+	if glog.V(2) {
+		glog.Infof("Invoking adapter %s to release %d units of quota %s, labels %v", w.adapter, qa.QuotaAmount, qa.Definition.Name, qa.Labels)
+	}
+
+	amount, err := asp.ReleaseBestEffort(qa)
+	if err != nil {
+		glog.Errorf("Quota release failed: %v", err)
+		return status.WithError(err), nil
+	}
+
+	if glog.V(2) {
+		glog.Infof("Released %v units to quota %s", amount, qa.Definition.Name)
+	}
+
+	return status.OK, &QuotaMethodResp{Amount: amount}
+}
+
 func (w *quotasExecutor) Close() error {
 	return w.aspect.Close()
 }
@@ -15,6 +15,7 @@
 package aspect
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
@@ -24,6 +25,7 @@ import (
 	"time"
 
 	ptypes "github.com/gogo/protobuf/types"
+	rpc "github.com/googleapis/googleapis/google/rpc"
 
 	dpb "istio.io/api/mixer/v1/config/descriptor"
 	"istio.io/mixer/pkg/adapter"
@@ -40,8 +42,9 @@ import (
 
 type fakeQuotaAspect struct {
 	adapter.Aspect
-	closed bool
-	body   func(adapter.QuotaArgs) (adapter.QuotaResult, error)
+	closed  bool
+	body    func(adapter.QuotaArgs) (adapter.QuotaResult, error)
+	release func(adapter.QuotaArgs) (int64, error)
 }
 
 func (a *fakeQuotaAspect) Close() error {
@@ -57,8 +60,11 @@ func (a fakeQuotaAspect) AllocBestEffort(qa adapter.QuotaArgs) (adapter.QuotaRes
 	return a.body(qa)
 }
 
-func (a fakeQuotaAspect) ReleaseBestEffort(adapter.QuotaArgs) (int64, error) {
-	return 0, nil
+func (a fakeQuotaAspect) ReleaseBestEffort(qa adapter.QuotaArgs) (int64, error) {
+	if a.release == nil {
+		return 0, nil
+	}
+	return a.release(qa)
 }
 
 type fakeQuotaBuilder struct {
@@ -326,7 +332,7 @@ func TestQuotaExecutor_Execute(t *testing.T) {
 				}},
 				metadata: c.mdin,
 			}
-			out, resp := executor.Execute(test.NewBag(), c.eval, &QuotaMethodArgs{
+			out, resp := executor.Execute(context.Background(), test.NewBag(), c.eval, &QuotaMethodArgs{
 				Quota:      "request_count",
 				Amount:     1,
 				BestEffort: c.bestEffort,
@@ -358,7 +364,7 @@ func TestQuotaExecutor_Execute(t *testing.T) {
 				if resp.Expiration != c.resp.Expiration {
 					t.Errorf("Got expiration %d, expecting %d", resp.Expiration, c.resp.Expiration)
 				}
-			} else {
+			} else if out.Code != int32(rpc.RESOURCE_EXHAUSTED) {
 				if resp != nil {
 					t.Errorf("Got response %v, expecting nil", resp)
 				}
@@ -367,6 +373,85 @@ func TestQuotaExecutor_Execute(t *testing.T) {
 	}
 }
 
+func TestQuotaExecutor_Hints(t *testing.T) {
+	executor := &quotasExecutor{
+		aspect: &fakeQuotaAspect{body: func(qa adapter.QuotaArgs) (adapter.QuotaResult, error) {
+			return adapter.QuotaResult{Remaining: 2, RetryAfter: 3 * time.Second, HasHints: true}, nil
+		}},
+		metadata: map[string]*quotaInfo{
+			"request_count": {definition: &adapter.QuotaDefinition{Name: "request_count"}},
+		},
+	}
+
+	out, resp := executor.Execute(context.Background(), test.NewBag(), test.NewIDEval(), &QuotaMethodArgs{Quota: "request_count", Amount: 5})
+	if out.Code != int32(rpc.RESOURCE_EXHAUSTED) {
+		t.Errorf("executor.Execute() = %v, wanted RESOURCE_EXHAUSTED", out)
+	}
+	want := QuotaMethodResp{Remaining: 2, RetryAfter: 3 * time.Second, HasHints: true}
+	if resp == nil || *resp != want {
+		t.Errorf("executor.Execute() returned %v, wanted %v", resp, want)
+	}
+}
+
+func TestQuotaExecutor_Release(t *testing.T) {
+	md := map[string]*quotaInfo{
+		"request_count": {definition: &adapter.QuotaDefinition{Name: "request_count"}},
+	}
+
+	cases := []struct {
+		released   int64
+		releaseErr error
+		errString  string
+	}{
+		{3, nil, ""},
+		{0, nil, ""},
+		{0, errors.New("release-forced-error"), "release-forced-error"},
+	}
+	for idx, c := range cases {
+		t.Run(strconv.Itoa(idx), func(t *testing.T) {
+			var receivedArgs adapter.QuotaArgs
+			executor := &quotasExecutor{
+				aspect: &fakeQuotaAspect{
+					body: func(adapter.QuotaArgs) (adapter.QuotaResult, error) {
+						t.Error("Alloc called for a release")
+						return adapter.QuotaResult{}, nil
+					},
+					release: func(qa adapter.QuotaArgs) (int64, error) {
+						receivedArgs = qa
+						return c.released, c.releaseErr
+					},
+				},
+				metadata: md,
+			}
+			out, resp := executor.Execute(context.Background(), test.NewBag(), test.NewIDEval(), &QuotaMethodArgs{
+				Quota:           "request_count",
+				Amount:          5,
+				DeduplicationID: "dedup",
+				Release:         true,
+			})
+
+			if !strings.Contains(out.Message, c.errString) {
+				t.Errorf("executor.Execute() = %v; wanted error containing %s", out, c.errString)
+			}
+			if c.releaseErr != nil {
+				if resp != nil {
+					t.Errorf("Got response %v, expecting nil", resp)
+				}
+				return
+			}
+			if !status.IsOK(out) {
+				t.Errorf("executor.Execute() = %v; wanted OK, releasing nothing is not an error", out)
+			}
+			if resp.Amount != c.released {
+				t.Errorf("Got amount %d, expecting %d", resp.Amount, c.released)
+			}
+			if receivedArgs.QuotaAmount != 5 || receivedArgs.DeduplicationID != "dedup" {
+				t.Errorf("Got args %v, wanted amount 5 and dedup id 'dedup'", receivedArgs)
+			}
+		})
+	}
+}
+
 func TestQuotasExecutor_Close(t *testing.T) {
 	inner := &fakeQuotaAspect{closed: false}
 	executor := &quotasExecutor{aspect: inner}
@@ -16,19 +16,52 @@ package config
 
 import (
 	"crypto/sha1"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"sync"
 	"time"
 
 	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
 
 	"istio.io/mixer/pkg/adapter"
 	"istio.io/mixer/pkg/attribute"
 	"istio.io/mixer/pkg/config/descriptor"
 	pb "istio.io/mixer/pkg/config/proto"
 	"istio.io/mixer/pkg/expr"
+	"istio.io/mixer/pkg/monitoring"
 )
 
+var (
+	configLoads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mixer_config_loads_total",
+		Help: "Number of attempts at loading a changed config, by result: installed or failed.",
+	}, []string{"result"})
+
+	configInstallTime = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "mixer_config_last_install_timestamp_seconds",
+		Help: "Time at which the current config was installed, in seconds since the epoch.",
+	})
+)
+
+func init() {
+	monitoring.MustRegister(configLoads, configInstallTime)
+}
+
+const (
+	// maxRecentErrors is the number of distinct config errors remembered by the manager.
+	maxRecentErrors = 10
+
+	// maxRetryDelay bounds the time before a config that failed to load is tried again,
+	// as long as it doesn't change.
+	maxRetryDelay = 5 * time.Minute
+)
+
+// errRetryPending is returned by fetch when the config is the one that last failed to load,
+// and it isn't time to try it again yet.
+var errRetryPending = errors.New("config failed to load and is yet to be retried")
+
 // Resolver resolves configuration to a list of combined configs.
 type Resolver interface {
 	// Resolve resolves configuration to a list of combined configs.
@@ -36,11 +69,38 @@ type Resolver interface {
 	// ResolveUnconditional resolves configuration for unconditioned rules.
 	// Unconditioned rules are those rules with the empty selector ("").
 	ResolveUnconditional(bag attribute.Bag, kindSet KindSet) ([]*pb.Combined, error)
+	// Combined returns every combined config the rules refer to, whatever their selectors.
+	Combined() []*pb.Combined
+	// ServiceConfig returns the service config being resolved against, for the settings
+	// that apply to a whole API method rather than to individual aspects. It must not be modified.
+	ServiceConfig() *pb.ServiceConfig
 }
 
 // ChangeListener listens for config change notifications.
 type ChangeListener interface {
-	ConfigChange(cfg Resolver, df descriptor.Finder)
+	// ConfigChange is called with every new config. A listener that can't put the config
+	// into effect returns an error, in which case the config is not installed: the
+	// listeners registered after it aren't notified, and the change is retried once it
+	// changes again, or after a delay that grows with each failed attempt.
+	ConfigChange(cfg Resolver, df descriptor.Finder) error
+}
+
+// Snapshot describes the config installed by the manager.
+type Snapshot struct {
+	GlobalConfig  string    `json:"global_config"`
+	GlobalSHA     string    `json:"global_sha"`
+	ServiceConfig string    `json:"service_config"`
+	ServiceSHA    string    `json:"service_sha"`
+	Installed     time.Time `json:"installed"`
+}
+
+// LoadError records a failed attempt at loading config. Consecutive
+// failures with the same message are folded into a single LoadError.
+type LoadError struct {
+	Message string    `json:"message"`
+	First   time.Time `json:"first"`
+	Last    time.Time `json:"last"`
+	Count   int       `json:"count"`
 }
 
 // Manager represents the config Manager.
@@ -58,12 +118,15 @@ type Manager struct {
 	serviceConfig    string
 	ticker           *time.Ticker
 
-	cl    []ChangeListener
-	scSHA [sha1.Size]byte
-	gcSHA [sha1.Size]byte
+	cl     []ChangeListener
+	scSHA  [sha1.Size]byte
+	gcSHA  [sha1.Size]byte
+	failed *failure
 
 	sync.RWMutex
-	lastError error
+	lastError    error
+	current      *Snapshot
+	recentErrors []LoadError
 }
 
 // NewManager returns a config.Manager.
@@ -105,58 +168,133 @@ func read(fname string) ([sha1.Size]byte, string, error) {
 	return sha1.Sum(data), string(data[:]), nil
 }
 
-// fetch config and return runtime if a new one is available.
-func (c *Manager) fetch() (*runtime, descriptor.Finder, error) {
+// candidate is a validated config that is yet to be installed.
+type candidate struct {
+	rt    *runtime
+	df    descriptor.Finder
+	gcSHA [sha1.Size]byte
+	scSHA [sha1.Size]byte
+	gc    string
+	sc    string
+}
+
+// failure remembers the config that last failed to load. Loading it again would most likely
+// fail the same way, after constructing every adapter it uses for nothing, so it is only
+// retried after a delay that doubles with each attempt, unless it changes in the meantime.
+type failure struct {
+	gcSHA [sha1.Size]byte
+	scSHA [sha1.Size]byte
+	delay time.Duration
+	retry time.Time
+}
+
+// fail remembers that the config with the given SHAs failed to load.
+func (c *Manager) fail(gcSHA, scSHA [sha1.Size]byte, now time.Time) {
+	delay := c.loopDelay
+	if f := c.failed; f != nil && f.gcSHA == gcSHA && f.scSHA == scSHA {
+		if delay = 2 * f.delay; delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+	c.failed = &failure{gcSHA: gcSHA, scSHA: scSHA, delay: delay, retry: now.Add(delay)}
+}
+
+// fetch config and return a candidate if a new one is available.
+func (c *Manager) fetch() (*candidate, error) {
 	var vd *Validated
 	var cerr *adapter.ConfigErrors
 
 	gcSHA, gc, err2 := read(c.globalConfig)
 	if err2 != nil {
-		return nil, nil, err2
+		return nil, err2
 	}
 
 	scSHA, sc, err1 := read(c.serviceConfig)
 	if err1 != nil {
-		return nil, nil, err1
+		return nil, err1
 	}
 
 	if gcSHA == c.gcSHA && scSHA == c.scSHA {
-		return nil, nil, nil
+		return nil, nil
+	}
+	if f := c.failed; f != nil && f.gcSHA == gcSHA && f.scSHA == scSHA && time.Now().Before(f.retry) {
+		return nil, errRetryPending
 	}
 
 	v := newValidator(c.aspectFinder, c.builderFinder, c.findAspects, true, c.eval)
 	if vd, cerr = v.validate(sc, gc); cerr != nil {
-		return nil, nil, cerr
+		c.fail(gcSHA, scSHA, time.Now())
+		return nil, cerr
 	}
 
-	c.descriptorFinder = descriptor.NewFinder(v.validated.globalConfig)
-
-	c.gcSHA = gcSHA
-	c.scSHA = scSHA
-	return newRuntime(vd, c.eval), c.descriptorFinder, nil
+	return &candidate{
+		rt:    newRuntime(vd, c.eval),
+		df:    descriptor.NewFinder(v.validated.globalConfig),
+		gcSHA: gcSHA,
+		scSHA: scSHA,
+		gc:    gc,
+		sc:    sc,
+	}, nil
 }
 
 // fetchAndNotify fetches a new config and notifies listeners if something has changed
 func (c *Manager) fetchAndNotify() error {
-	rt, df, err := c.fetch()
+	cd, err := c.fetch()
+	if err == errRetryPending {
+		// nothing new, the last error still stands
+		return nil
+	}
+	if err == nil && cd != nil {
+		err = c.install(cd)
+	}
 	if err != nil {
+		configLoads.WithLabelValues("failed").Inc()
 		c.Lock()
 		c.lastError = err
+		c.recordError(err, time.Now())
 		c.Unlock()
 		return err
 	}
-	if rt == nil {
-		return nil
-	}
 
-	glog.Infof("Installing new config from %s sha=%x ", c.serviceConfig, c.scSHA)
+	c.Lock()
+	c.lastError = nil
+	c.Unlock()
+	return nil
+}
+
+// install notifies the listeners of a candidate config, and makes it the current one if they all accept it.
+func (c *Manager) install(cd *candidate) error {
+	glog.Infof("Installing new config from %s sha=%x ", c.serviceConfig, cd.scSHA)
 	for _, cl := range c.cl {
-		cl.ConfigChange(rt, df)
+		if err := cl.ConfigChange(cd.rt, cd.df); err != nil {
+			c.fail(cd.gcSHA, cd.scSHA, time.Now())
+			return fmt.Errorf("config from %s sha=%x was rejected: %v", c.serviceConfig, cd.scSHA, err)
+		}
 	}
+
+	c.descriptorFinder = cd.df
+	c.gcSHA = cd.gcSHA
+	c.scSHA = cd.scSHA
+	c.failed = nil
+
+	now := time.Now()
+	c.Lock()
+	c.current = &Snapshot{
+		GlobalConfig:  cd.gc,
+		GlobalSHA:     fmt.Sprintf("%x", cd.gcSHA),
+		ServiceConfig: cd.sc,
+		ServiceSHA:    fmt.Sprintf("%x", cd.scSHA),
+		Installed:     now,
+	}
+	c.Unlock()
+
+	configLoads.WithLabelValues("installed").Inc()
+	configInstallTime.Set(float64(now.Unix()))
 	return nil
 }
 
-// LastError returns last error encountered by the manager while processing config.
+// LastError returns the error encountered by the manager the last time it processed config,
+// nil if it succeeded.
 func (c *Manager) LastError() (err error) {
 	c.RLock()
 	err = c.lastError
@@ -164,6 +302,46 @@ func (c *Manager) LastError() (err error) {
 	return err
 }
 
+// Current returns the config currently installed, or nil if none has been installed yet.
+func (c *Manager) Current() *Snapshot {
+	c.RLock()
+	defer c.RUnlock()
+	return c.current
+}
+
+// RecentErrors returns the most recent errors encountered while loading config, oldest first.
+func (c *Manager) RecentErrors() []LoadError {
+	c.RLock()
+	defer c.RUnlock()
+	errs := make([]LoadError, len(c.recentErrors))
+	copy(errs, c.recentErrors)
+	return errs
+}
+
+// RecordError adds an error found while applying the installed config, such as an
+// executor that could not be constructed on first use, to the recent errors. Unlike
+// a failed load, it does not affect LastError.
+func (c *Manager) RecordError(err error) {
+	c.Lock()
+	c.recordError(err, time.Now())
+	c.Unlock()
+}
+
+// recordError adds err to the recent errors. c must be locked.
+func (c *Manager) recordError(err error, now time.Time) {
+	msg := err.Error()
+	if n := len(c.recentErrors); n > 0 && c.recentErrors[n-1].Message == msg {
+		c.recentErrors[n-1].Last = now
+		c.recentErrors[n-1].Count++
+		return
+	}
+
+	if len(c.recentErrors) == maxRecentErrors {
+		c.recentErrors = append(c.recentErrors[:0], c.recentErrors[1:]...)
+	}
+	c.recentErrors = append(c.recentErrors, LoadError{Message: msg, First: now, Last: now, Count: 1})
+}
+
 // Close stops the config manager go routine.
 func (c *Manager) Close() {
 	if c.ticker != nil {
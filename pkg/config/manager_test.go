@@ -15,6 +15,9 @@
 package config
 
 import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"strconv"
@@ -41,15 +44,20 @@ type fakelistener struct {
 	called int
 	rt     Resolver
 	df     descriptor.Finder
+	err    error
 	sync.Mutex
 }
 
-func (f *fakelistener) ConfigChange(cfg Resolver, df descriptor.Finder) {
+func (f *fakelistener) ConfigChange(cfg Resolver, df descriptor.Finder) error {
 	f.Lock()
+	defer f.Unlock()
+	f.called++
+	if f.err != nil {
+		return f.err
+	}
 	f.rt = cfg
 	f.df = df
-	f.called++
-	f.Unlock()
+	return nil
 }
 func (f *fakelistener) Called() int {
 	f.Lock()
@@ -100,6 +108,69 @@ func TestConfigManager(t *testing.T) {
 	}
 }
 
+func TestConfigManager_Rejected(t *testing.T) {
+	vf := newVfinder(map[string]adapter.ConfigValidator{
+		"denyChecker": &lc{},
+		"metrics":     &lc{},
+		"listchecker": &lc{},
+	}, map[Kind]AspectValidator{
+		DenialsKind: &ac{},
+		MetricsKind: &ac{},
+		ListsKind:   &ac{},
+	})
+
+	var files []string
+	for _, content := range []string{sGlobalConfigValid, sSvcConfig2} {
+		tmpfile, _ := ioutil.TempFile("", "config")
+		defer func() { _ = os.Remove(tmpfile.Name()) }()
+		_, _ = tmpfile.Write([]byte(content))
+		_ = tmpfile.Close()
+		files = append(files, tmpfile.Name())
+	}
+
+	mgr := NewManager(newFakeExpr(), vf.FindAspectValidator, vf.FindAdapterValidator, vf.AdapterToAspectMapperFunc, files[0], files[1], time.Hour)
+	rejecting := &fakelistener{err: errors.New("executor construction failed")}
+	other := &fakelistener{}
+	mgr.Register(rejecting)
+	mgr.Register(other)
+
+	if err := mgr.fetchAndNotify(); err == nil || !strings.Contains(err.Error(), "executor construction failed") {
+		t.Fatalf("fetchAndNotify() = %v, want the listener's error", err)
+	}
+	if mgr.Current() != nil || other.Called() != 0 {
+		t.Errorf("Rejected config was installed")
+	}
+	if mgr.LastError() == nil {
+		t.Errorf("LastError() = nil after a rejected config")
+	}
+
+	// the unchanged config isn't tried again right away
+	if err := mgr.fetchAndNotify(); err != nil {
+		t.Fatalf("fetchAndNotify() = %v before the config is retried, want no error", err)
+	}
+	if rejecting.Called() != 1 {
+		t.Errorf("Listener called %d times before the config is retried, want once", rejecting.Called())
+	}
+	if mgr.LastError() == nil {
+		t.Errorf("LastError() = nil before the config is retried, want the rejection")
+	}
+
+	// the config is retried until it is accepted
+	rejecting.Lock()
+	rejecting.err = nil
+	rejecting.Unlock()
+	mgr.failed.retry = time.Now()
+	if err := mgr.fetchAndNotify(); err != nil {
+		t.Fatalf("fetchAndNotify() = %v, want no error", err)
+	}
+	if mgr.Current() == nil || rejecting.Called() != 2 || other.Called() != 1 {
+		t.Errorf("Config not installed once accepted")
+	}
+	if err := mgr.LastError(); err != nil {
+		t.Errorf("LastError() = %v once the config was installed, want nil", err)
+	}
+}
+
 func testConfigManager(t *testing.T, mgr *Manager, mt mtest, loopDelay time.Duration) {
 	fl := &fakelistener{}
 	mgr.Register(fl)
@@ -121,6 +192,12 @@ func testConfigManager(t *testing.T, mgr *Manager, mt mtest, loopDelay time.Dura
 		t.Error("Config listener was not notified")
 	}
 
+	if snap := mgr.Current(); mt.errStr == "" && (snap == nil || snap.ServiceConfig != mt.scContent || snap.GlobalConfig != mt.gcContent) {
+		t.Errorf("Current() = %v, want the installed config", snap)
+	} else if mt.errStr != "" && snap != nil {
+		t.Errorf("Current() = %v, want nil", snap)
+	}
+
 	if mt.errStr == "" && le == nil {
 		called := fl.Called()
 		if le == nil && called != 1 {
@@ -140,4 +217,70 @@ func testConfigManager(t *testing.T, mgr *Manager, mt mtest, loopDelay time.Dura
 	if !strings.Contains(le.Error(), mt.errStr) {
 		t.Fatalf("Unexpected error. Expected %s\nGot: %s\n", mt.errStr, le)
 	}
+
+	if recent := mgr.RecentErrors(); len(recent) == 0 || !strings.Contains(recent[len(recent)-1].Message, mt.errStr) {
+		t.Errorf("RecentErrors() = %v, want the last one to contain %s", recent, mt.errStr)
+	}
+}
+
+func TestManager_RetryDelay(t *testing.T) {
+	mgr := &Manager{loopDelay: time.Second}
+	now := time.Now()
+	a := sha1.Sum([]byte("a"))
+	b := sha1.Sum([]byte("b"))
+
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		mgr.fail(a, b, now)
+		if mgr.failed.delay != want || !mgr.failed.retry.Equal(now.Add(want)) {
+			t.Errorf("retry delay %v, want %v", mgr.failed.delay, want)
+		}
+	}
+
+	// a different config starts over
+	mgr.fail(b, b, now)
+	if mgr.failed.delay != time.Second {
+		t.Errorf("retry delay %v for a changed config, want %v", mgr.failed.delay, time.Second)
+	}
+
+	for i := 0; i < 20; i++ {
+		mgr.fail(b, b, now)
+	}
+	if mgr.failed.delay != maxRetryDelay {
+		t.Errorf("retry delay %v, want at most %v", mgr.failed.delay, maxRetryDelay)
+	}
+}
+
+func TestManager_RecentErrors(t *testing.T) {
+	mgr := &Manager{}
+	now := time.Now()
+
+	mgr.recordError(errors.New("first"), now)
+	mgr.recordError(errors.New("first"), now.Add(time.Second))
+	recent := mgr.RecentErrors()
+	if len(recent) != 1 || recent[0].Count != 2 || !recent[0].First.Equal(now) || !recent[0].Last.Equal(now.Add(time.Second)) {
+		t.Fatalf("RecentErrors() = %v, want a single folded error", recent)
+	}
+
+	for i := 0; i < maxRecentErrors; i++ {
+		mgr.recordError(fmt.Errorf("error %d", i), now)
+	}
+	recent = mgr.RecentErrors()
+	if len(recent) != maxRecentErrors {
+		t.Fatalf("len(RecentErrors()) = %d, want %d", len(recent), maxRecentErrors)
+	}
+	if recent[0].Message != "error 0" || recent[maxRecentErrors-1].Message != fmt.Sprintf("error %d", maxRecentErrors-1) {
+		t.Errorf("RecentErrors() = %v, want the oldest error evicted", recent)
+	}
+}
+
+func TestManager_RecordError(t *testing.T) {
+	mgr := &Manager{}
+	mgr.RecordError(errors.New("unable to configure adapter"))
+
+	if recent := mgr.RecentErrors(); len(recent) != 1 || recent[0].Message != "unable to configure adapter" {
+		t.Errorf("RecentErrors() = %v, want the recorded error", recent)
+	}
+	if err := mgr.LastError(); err != nil {
+		t.Errorf("LastError() = %v, want nil", err)
+	}
 }
@@ -14,15 +14,21 @@ PKG=$(dirname $WD)
 BUILD_DIR=$(dirname $(dirname $(readlink  ${WD}/../../../bazel-mixer)))
 ISTIO_API=${BUILD_DIR}/external/com_github_istio_api
 
-cd ${ISTIO_API}
+# cfg.proto is istio/api's mixer/v1/config/cfg.proto along with the settings the mixer
+# adds to it. It is compiled under its upstream name, against the descriptors of istio/api.
+SRC=$(mktemp -d)
+mkdir -p ${SRC}/mixer/v1/config
+cp ${WD}/cfg.proto ${SRC}/mixer/v1/config/cfg.proto
+
+cd ${SRC}
 CKSUM=$(cksum mixer/v1/config/cfg.proto)
 
 # protoc keeps the directory structure leading up to the proto file, so it creates
 # the dir ${WD}/mixer/v1/config/. We don't want that, so we'll move the pb.go file
 # out and remove the dir.
-protoc mixer/v1/config/cfg.proto --go_out=${WD}
+protoc -I ${SRC} -I ${ISTIO_API} mixer/v1/config/cfg.proto --go_out=${WD}
 mv ${WD}/mixer/v1/config/cfg.pb.go ${WD}/cfg.pb.go
-rm -rd ${WD}/mixer
+rm -rd ${WD}/mixer ${SRC}
 
 cd ${WD}
 TMPF="_cfg.pb.go"
@@ -1,5 +1,5 @@
 // POST PROCESSED USING by build_cfg.sh
-// 84100219 5669 mixer/v1/config/cfg.proto
+// 1481920221 8981 mixer/v1/config/cfg.proto
 // Code generated by protoc-gen-go.
 // source: mixer/v1/config/cfg.proto
 // DO NOT EDIT!
@@ -12,9 +12,11 @@ It is generated from these files:
 
 It has these top-level messages:
 	ServiceConfig
+	ResultPolicy
 	AspectRule
 	Aspect
 	Adapter
+	AdapterConcurrency
 	GlobalConfig
 	ClientConfig
 	Uri
@@ -46,6 +48,64 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
+// CheckMode controls how the aspects selected for a Check call are dispatched.
+type ServiceConfig_CheckMode int32
+
+const (
+	// All check aspects are run concurrently and every result is waited for.
+	ServiceConfig_PARALLEL ServiceConfig_CheckMode = 0
+	// Check aspects are run in the order in which they are declared, stopping
+	// at the first one that does not return OK. Consecutive aspects sharing
+	// the same stage are run concurrently as a group.
+	ServiceConfig_ORDERED ServiceConfig_CheckMode = 1
+)
+
+var ServiceConfig_CheckMode_name = map[int32]string{
+	0: "PARALLEL",
+	1: "ORDERED",
+}
+var ServiceConfig_CheckMode_value = map[string]int32{
+	"PARALLEL": 0,
+	"ORDERED":  1,
+}
+
+func (x ServiceConfig_CheckMode) String() string {
+	return proto.EnumName(ServiceConfig_CheckMode_name, int32(x))
+}
+func (ServiceConfig_CheckMode) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 0} }
+
+// Combine selects how the results of the aspects run for an API method are
+// combined into the status returned to the caller.
+type ResultPolicy_Combine int32
+
+const (
+	// Wait for every aspect to complete. The call fails if any aspect failed,
+	// with the status of the first failed aspect in declaration order.
+	ResultPolicy_REQUIRE_ALL ResultPolicy_Combine = 0
+	// Fail the call as soon as any aspect fails, without waiting for the
+	// remaining aspects to complete.
+	ResultPolicy_FIRST_FAILURE ResultPolicy_Combine = 1
+	// Wait for every aspect to complete. The call fails with the most severe
+	// code returned by any aspect.
+	ResultPolicy_MOST_SEVERE ResultPolicy_Combine = 2
+)
+
+var ResultPolicy_Combine_name = map[int32]string{
+	0: "REQUIRE_ALL",
+	1: "FIRST_FAILURE",
+	2: "MOST_SEVERE",
+}
+var ResultPolicy_Combine_value = map[string]int32{
+	"REQUIRE_ALL":   0,
+	"FIRST_FAILURE": 1,
+	"MOST_SEVERE":   2,
+}
+
+func (x ResultPolicy_Combine) String() string {
+	return proto.EnumName(ResultPolicy_Combine_name, int32(x))
+}
+func (ResultPolicy_Combine) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{1, 0} }
+
 // Configures a set of services
 // following example configures metrics collection and ratelimit for
 // all services
@@ -80,6 +140,12 @@ type ServiceConfig struct {
 	// revision of this config. This is assigned by the server
 	Revision string        `protobuf:"bytes,2,opt,name=revision" json:"revision,omitempty"`
 	Rules    []*AspectRule `protobuf:"bytes,3,rep,name=rules" json:"rules,omitempty"`
+	// check_mode selects how check aspects are dispatched, defaults to PARALLEL.
+	CheckMode ServiceConfig_CheckMode `protobuf:"varint,4,opt,name=check_mode,json=checkMode,enum=istio.mixer.v1.config.ServiceConfig_CheckMode" json:"check_mode,omitempty"`
+	// How the results of the aspects run for each API method are combined.
+	CheckPolicy  *ResultPolicy `protobuf:"bytes,5,opt,name=check_policy,json=checkPolicy" json:"check_policy,omitempty"`
+	ReportPolicy *ResultPolicy `protobuf:"bytes,6,opt,name=report_policy,json=reportPolicy" json:"report_policy,omitempty"`
+	QuotaPolicy  *ResultPolicy `protobuf:"bytes,7,opt,name=quota_policy,json=quotaPolicy" json:"quota_policy,omitempty"`
 }
 
 func (m *ServiceConfig) Reset()                    { *m = ServiceConfig{} }
@@ -108,6 +174,63 @@ func (m *ServiceConfig) GetRules() []*AspectRule {
 	return nil
 }
 
+func (m *ServiceConfig) GetCheckMode() ServiceConfig_CheckMode {
+	if m != nil {
+		return m.CheckMode
+	}
+	return ServiceConfig_PARALLEL
+}
+
+func (m *ServiceConfig) GetCheckPolicy() *ResultPolicy {
+	if m != nil {
+		return m.CheckPolicy
+	}
+	return nil
+}
+
+func (m *ServiceConfig) GetReportPolicy() *ResultPolicy {
+	if m != nil {
+		return m.ReportPolicy
+	}
+	return nil
+}
+
+func (m *ServiceConfig) GetQuotaPolicy() *ResultPolicy {
+	if m != nil {
+		return m.QuotaPolicy
+	}
+	return nil
+}
+
+// ResultPolicy controls how the results of multiple aspects are turned into
+// the single status returned by an API method. The status of every failed
+// aspect is always included in the details of the returned status.
+type ResultPolicy struct {
+	Combine ResultPolicy_Combine `protobuf:"varint,1,opt,name=combine,enum=istio.mixer.v1.config.ResultPolicy_Combine" json:"combine,omitempty"`
+	// Message returned to the caller when the call fails. Defaults to the
+	// message of the aspect whose status was selected.
+	Message string `protobuf:"bytes,2,opt,name=message" json:"message,omitempty"`
+}
+
+func (m *ResultPolicy) Reset()                    { *m = ResultPolicy{} }
+func (m *ResultPolicy) String() string            { return proto.CompactTextString(m) }
+func (*ResultPolicy) ProtoMessage()               {}
+func (*ResultPolicy) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *ResultPolicy) GetCombine() ResultPolicy_Combine {
+	if m != nil {
+		return m.Combine
+	}
+	return ResultPolicy_REQUIRE_ALL
+}
+
+func (m *ResultPolicy) GetMessage() string {
+	if m != nil {
+		return m.Message
+	}
+	return ""
+}
+
 // AspectRules are intent based
 type AspectRule struct {
 	// selector is an attributes based predicate.
@@ -122,7 +245,7 @@ type AspectRule struct {
 func (m *AspectRule) Reset()                    { *m = AspectRule{} }
 func (m *AspectRule) String() string            { return proto.CompactTextString(m) }
 func (*AspectRule) ProtoMessage()               {}
-func (*AspectRule) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+func (*AspectRule) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
 
 func (m *AspectRule) GetSelector() string {
 	if m != nil {
@@ -173,12 +296,24 @@ type Aspect struct {
 	Inputs map[string]string `protobuf:"bytes,3,rep,name=inputs" json:"inputs,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
 	// Struct representation of a proto defined by the aspect
 	Params interface{} `protobuf:"bytes,4,opt,name=params" json:"params,omitempty"`
+	// When the service config uses the ORDERED check mode, consecutive aspects
+	// with the same non-empty stage are run concurrently as one step.
+	Stage string `protobuf:"bytes,5,opt,name=stage" json:"stage,omitempty"`
+	// A shadow aspect is run as usual, but a failure it returns is only logged
+	// and counted, it never affects the outcome of the request. Used to observe
+	// the impact of a new check before enforcing it. Only check aspects (lists
+	// and denials) can be shadow aspects.
+	Shadow bool `protobuf:"varint,6,opt,name=shadow" json:"shadow,omitempty"`
+	// Adapters of the same kind to run the aspect on, in order, when the adapter
+	// fails with an error or times out. The adapter that serves the aspect is
+	// recorded in the mixer_aspect_fallbacks_total metric.
+	Fallbacks []string `protobuf:"bytes,7,rep,name=fallbacks" json:"fallbacks,omitempty"`
 }
 
 func (m *Aspect) Reset()                    { *m = Aspect{} }
 func (m *Aspect) String() string            { return proto.CompactTextString(m) }
 func (*Aspect) ProtoMessage()               {}
-func (*Aspect) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+func (*Aspect) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
 
 func (m *Aspect) GetKind() string {
 	if m != nil {
@@ -208,6 +343,27 @@ func (m *Aspect) GetParams() interface{} {
 	return nil
 }
 
+func (m *Aspect) GetStage() string {
+	if m != nil {
+		return m.Stage
+	}
+	return ""
+}
+
+func (m *Aspect) GetShadow() bool {
+	if m != nil {
+		return m.Shadow
+	}
+	return false
+}
+
+func (m *Aspect) GetFallbacks() []string {
+	if m != nil {
+		return m.Fallbacks
+	}
+	return nil
+}
+
 // Adapter config defines specifics of adapter implementations
 // We define an adapter that provides "metrics" aspect
 // Kind: istio/metrics
@@ -222,12 +378,14 @@ type Adapter struct {
 	Impl string `protobuf:"bytes,3,opt,name=impl" json:"impl,omitempty"`
 	// Struct representation of a proto defined by the implementation
 	Params interface{} `protobuf:"bytes,4,opt,name=params" json:"params,omitempty"`
+	// Bounds the resources the aspects using this adapter can tie up.
+	Concurrency *AdapterConcurrency `protobuf:"bytes,5,opt,name=concurrency" json:"concurrency,omitempty"`
 }
 
 func (m *Adapter) Reset()                    { *m = Adapter{} }
 func (m *Adapter) String() string            { return proto.CompactTextString(m) }
 func (*Adapter) ProtoMessage()               {}
-func (*Adapter) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+func (*Adapter) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
 
 func (m *Adapter) GetName() string {
 	if m != nil {
@@ -257,6 +415,53 @@ func (m *Adapter) GetParams() interface{} {
 	return nil
 }
 
+func (m *Adapter) GetConcurrency() *AdapterConcurrency {
+	if m != nil {
+		return m.Concurrency
+	}
+	return nil
+}
+
+// AdapterConcurrency isolates an adapter from the others, so that a slow
+// adapter can't exhaust the workers every other aspect depends on.
+type AdapterConcurrency struct {
+	// Maximum # of calls to the adapter in flight at once. Calls beyond it are
+	// rejected with UNAVAILABLE. 0 for no limit.
+	MaxConcurrent int32 `protobuf:"varint,1,opt,name=max_concurrent,json=maxConcurrent" json:"max_concurrent,omitempty"`
+	// Number of workers of a pool dedicated to the adapter, on which its
+	// aspects run instead of the shared API pool. 0 to use the shared pool.
+	PoolSize int32 `protobuf:"varint,2,opt,name=pool_size,json=poolSize" json:"pool_size,omitempty"`
+	// Maximum # of calls waiting for a worker of the dedicated pool. Calls
+	// beyond it are rejected with UNAVAILABLE.
+	QueueDepth int32 `protobuf:"varint,3,opt,name=queue_depth,json=queueDepth" json:"queue_depth,omitempty"`
+}
+
+func (m *AdapterConcurrency) Reset()                    { *m = AdapterConcurrency{} }
+func (m *AdapterConcurrency) String() string            { return proto.CompactTextString(m) }
+func (*AdapterConcurrency) ProtoMessage()               {}
+func (*AdapterConcurrency) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+func (m *AdapterConcurrency) GetMaxConcurrent() int32 {
+	if m != nil {
+		return m.MaxConcurrent
+	}
+	return 0
+}
+
+func (m *AdapterConcurrency) GetPoolSize() int32 {
+	if m != nil {
+		return m.PoolSize
+	}
+	return 0
+}
+
+func (m *AdapterConcurrency) GetQueueDepth() int32 {
+	if m != nil {
+		return m.QueueDepth
+	}
+	return 0
+}
+
 // GlobalConfig defines configuration elements that are available
 // for the rest of the config
 // It is used to configure adapters and make them available in AspectRules
@@ -275,7 +480,7 @@ type GlobalConfig struct {
 func (m *GlobalConfig) Reset()                    { *m = GlobalConfig{} }
 func (m *GlobalConfig) String() string            { return proto.CompactTextString(m) }
 func (*GlobalConfig) ProtoMessage()               {}
-func (*GlobalConfig) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+func (*GlobalConfig) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
 
 func (m *GlobalConfig) GetRevision() string {
 	if m != nil {
@@ -345,7 +550,7 @@ type ClientConfig struct {
 func (m *ClientConfig) Reset()                    { *m = ClientConfig{} }
 func (m *ClientConfig) String() string            { return proto.CompactTextString(m) }
 func (*ClientConfig) ProtoMessage()               {}
-func (*ClientConfig) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+func (*ClientConfig) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
 
 func (m *ClientConfig) GetSubject() string {
 	if m != nil {
@@ -376,7 +581,7 @@ type Uri struct {
 func (m *Uri) Reset()                    { *m = Uri{} }
 func (m *Uri) String() string            { return proto.CompactTextString(m) }
 func (*Uri) ProtoMessage()               {}
-func (*Uri) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+func (*Uri) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
 
 func (m *Uri) GetValue() string {
 	if m != nil {
@@ -393,7 +598,7 @@ type IpAddress struct {
 func (m *IpAddress) Reset()                    { *m = IpAddress{} }
 func (m *IpAddress) String() string            { return proto.CompactTextString(m) }
 func (*IpAddress) ProtoMessage()               {}
-func (*IpAddress) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+func (*IpAddress) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
 
 func (m *IpAddress) GetValue() []byte {
 	if m != nil {
@@ -410,7 +615,7 @@ type DnsName struct {
 func (m *DnsName) Reset()                    { *m = DnsName{} }
 func (m *DnsName) String() string            { return proto.CompactTextString(m) }
 func (*DnsName) ProtoMessage()               {}
-func (*DnsName) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+func (*DnsName) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{10} }
 
 func (m *DnsName) GetValue() string {
 	if m != nil {
@@ -427,7 +632,7 @@ type EmailAddress struct {
 func (m *EmailAddress) Reset()                    { *m = EmailAddress{} }
 func (m *EmailAddress) String() string            { return proto.CompactTextString(m) }
 func (*EmailAddress) ProtoMessage()               {}
-func (*EmailAddress) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
+func (*EmailAddress) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{11} }
 
 func (m *EmailAddress) GetValue() string {
 	if m != nil {
@@ -438,61 +643,86 @@ func (m *EmailAddress) GetValue() string {
 
 func init() {
 	proto.RegisterType((*ServiceConfig)(nil), "istio.mixer.v1.config.ServiceConfig")
+	proto.RegisterType((*ResultPolicy)(nil), "istio.mixer.v1.config.ResultPolicy")
 	proto.RegisterType((*AspectRule)(nil), "istio.mixer.v1.config.AspectRule")
 	proto.RegisterType((*Aspect)(nil), "istio.mixer.v1.config.Aspect")
 	proto.RegisterType((*Adapter)(nil), "istio.mixer.v1.config.Adapter")
+	proto.RegisterType((*AdapterConcurrency)(nil), "istio.mixer.v1.config.AdapterConcurrency")
 	proto.RegisterType((*GlobalConfig)(nil), "istio.mixer.v1.config.GlobalConfig")
 	proto.RegisterType((*ClientConfig)(nil), "istio.mixer.v1.config.ClientConfig")
 	proto.RegisterType((*Uri)(nil), "istio.mixer.v1.config.Uri")
 	proto.RegisterType((*IpAddress)(nil), "istio.mixer.v1.config.IpAddress")
 	proto.RegisterType((*DnsName)(nil), "istio.mixer.v1.config.DnsName")
 	proto.RegisterType((*EmailAddress)(nil), "istio.mixer.v1.config.EmailAddress")
+	proto.RegisterEnum("istio.mixer.v1.config.ServiceConfig_CheckMode", ServiceConfig_CheckMode_name, ServiceConfig_CheckMode_value)
+	proto.RegisterEnum("istio.mixer.v1.config.ResultPolicy_Combine", ResultPolicy_Combine_name, ResultPolicy_Combine_value)
 }
 
 func init() { proto.RegisterFile("mixer/v1/config/cfg.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 657 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xc4, 0x94, 0xdf, 0x6e, 0xd3, 0x30,
-	0x14, 0xc6, 0x95, 0xb6, 0x6b, 0xb7, 0xb3, 0x22, 0x21, 0x03, 0x22, 0x94, 0x7f, 0x5b, 0xc5, 0xc5,
-	0xb8, 0x49, 0xd4, 0xc2, 0x34, 0x98, 0x04, 0x52, 0xb5, 0x4d, 0x30, 0x69, 0x20, 0xc8, 0xb4, 0xeb,
-	0xc9, 0x4d, 0xbc, 0xc8, 0xcc, 0x89, 0x83, 0xed, 0x44, 0xec, 0x02, 0x1e, 0x84, 0xf7, 0x43, 0xbc,
-	0x06, 0x8a, 0x63, 0xa7, 0x61, 0xdd, 0xba, 0x8d, 0x1b, 0xee, 0x62, 0xe7, 0xfb, 0x7e, 0xe7, 0xf8,
-	0xd8, 0xe7, 0xc0, 0x83, 0x84, 0x7e, 0x23, 0xc2, 0x2f, 0x46, 0x7e, 0xc8, 0xd3, 0x13, 0x1a, 0xfb,
-	0xe1, 0x49, 0xec, 0x65, 0x82, 0x2b, 0x8e, 0xee, 0x51, 0xa9, 0x28, 0xf7, 0xb4, 0xc0, 0x2b, 0x46,
-	0x5e, 0x25, 0x18, 0x3c, 0x8a, 0x39, 0x8f, 0x19, 0xf1, 0xb5, 0x68, 0x9a, 0x9f, 0xf8, 0x52, 0x89,
-	0x3c, 0x54, 0x95, 0x69, 0xb0, 0x79, 0x9e, 0x17, 0x11, 0x19, 0x0a, 0x9a, 0x29, 0x2e, 0x7c, 0xac,
-	0x94, 0xa0, 0xd3, 0x5c, 0x91, 0xe3, 0xd9, 0xe6, 0x35, 0x6c, 0x8c, 0xc7, 0xc7, 0x24, 0x55, 0xe2,
-	0x6c, 0xde, 0x36, 0x5e, 0x60, 0x4b, 0x88, 0x12, 0x34, 0x9c, 0xf7, 0xbc, 0x5d, 0xe4, 0xe1, 0x29,
-	0x55, 0x5c, 0x90, 0xe8, 0x58, 0x10, 0xc9, 0x73, 0x11, 0xde, 0x30, 0xd5, 0x4c, 0xd0, 0x34, 0xa4,
-	0x19, 0x66, 0xf3, 0xb6, 0xd1, 0x02, 0xdb, 0xd7, 0x9c, 0x2b, 0x3c, 0x67, 0x19, 0xfe, 0x80, 0x5b,
-	0x87, 0x44, 0x14, 0x34, 0x24, 0x3b, 0xda, 0x82, 0x5c, 0xe8, 0xc9, 0x7c, 0xfa, 0x85, 0x84, 0xca,
-	0x75, 0xd6, 0x9c, 0x8d, 0x95, 0xc0, 0x2e, 0xd1, 0x00, 0x96, 0x05, 0x29, 0xa8, 0xa4, 0x3c, 0x75,
-	0x5b, 0xfa, 0x57, 0xbd, 0x46, 0x5b, 0xb0, 0x24, 0x72, 0x46, 0xa4, 0xdb, 0x5e, 0x6b, 0x6f, 0xac,
-	0x8e, 0xd7, 0xbd, 0x0b, 0xef, 0xd5, 0x9b, 0xc8, 0x8c, 0x84, 0x2a, 0xc8, 0x19, 0x09, 0x2a, 0xfd,
-	0xf0, 0xa7, 0x03, 0x30, 0xdb, 0x2d, 0x63, 0x48, 0xc2, 0x48, 0xa8, 0xb8, 0x30, 0xe1, 0xeb, 0x35,
-	0xda, 0x82, 0x1e, 0xd6, 0x4a, 0xe9, 0xb6, 0x74, 0x94, 0xc7, 0x8b, 0xa3, 0x58, 0xf5, 0xbf, 0x27,
-	0xf7, 0xcb, 0x81, 0x6e, 0xb5, 0x8b, 0x10, 0x74, 0x4e, 0x69, 0x1a, 0x99, 0xa4, 0xf4, 0x77, 0x59,
-	0x2a, 0x1c, 0xe1, 0x4c, 0x11, 0x61, 0xea, 0x61, 0x97, 0x68, 0x02, 0x5d, 0x9a, 0x66, 0xb9, 0xb2,
-	0x21, 0x9f, 0x2f, 0x0c, 0xe9, 0xed, 0x6b, 0xed, 0x5e, 0xf9, 0xfe, 0x02, 0x63, 0x44, 0x3e, 0x74,
-	0x33, 0x2c, 0x70, 0x22, 0xdd, 0xce, 0x9a, 0xb3, 0xb1, 0x3a, 0xbe, 0xef, 0x55, 0x3d, 0xe1, 0xd9,
-	0x9e, 0xf0, 0x0e, 0x75, 0x4f, 0x04, 0x46, 0x36, 0x78, 0x0d, 0xab, 0x0d, 0x0e, 0xba, 0x0d, 0xed,
-	0x53, 0x72, 0x66, 0xf2, 0x2d, 0x3f, 0xd1, 0x5d, 0x58, 0x2a, 0x30, 0xcb, 0x89, 0x49, 0xb6, 0x5a,
-	0x6c, 0xb7, 0x5e, 0x39, 0xc3, 0x02, 0x7a, 0x13, 0x93, 0x39, 0x82, 0x4e, 0x8a, 0x13, 0x62, 0xcf,
-	0x59, 0x7e, 0xd7, 0x67, 0x6f, 0x35, 0xce, 0x8e, 0xa0, 0x43, 0x93, 0x8c, 0xb9, 0xed, 0x6a, 0xaf,
-	0xfc, 0xbe, 0x71, 0xca, 0xc3, 0xdf, 0x1d, 0xe8, 0xbf, 0x63, 0x7c, 0x8a, 0x99, 0x79, 0x7c, 0xcd,
-	0x27, 0xe6, 0x9c, 0x7b, 0x62, 0xdb, 0xb0, 0x6c, 0xca, 0x6b, 0xef, 0xff, 0xc9, 0x65, 0x55, 0xad,
-	0x64, 0x41, 0xad, 0x47, 0x47, 0x00, 0xf5, 0x60, 0xb0, 0x77, 0xb2, 0x79, 0x89, 0xbb, 0xd1, 0x22,
-	0x13, 0xeb, 0xd9, 0xad, 0xf7, 0x82, 0x06, 0x08, 0xbd, 0x87, 0x0e, 0xe3, 0x71, 0x79, 0xdc, 0x12,
-	0xf8, 0xf2, 0x6a, 0xe0, 0x01, 0x8f, 0xf5, 0xed, 0x34, 0x78, 0x9a, 0x80, 0x0e, 0xa0, 0x57, 0xcd,
-	0x12, 0xe9, 0x2e, 0x69, 0xd8, 0xf8, 0x6a, 0xd8, 0x07, 0x6d, 0x68, 0xa0, 0x2c, 0x02, 0xa5, 0x70,
-	0x67, 0x7e, 0xca, 0x48, 0xb7, 0xab, 0xc9, 0x6f, 0xae, 0x41, 0xb6, 0xe6, 0xc0, 0x78, 0x1b, 0x41,
-	0x50, 0x72, 0xfe, 0xa7, 0x2e, 0x6f, 0x3d, 0x95, 0xa4, 0xdb, 0xbb, 0x6e, 0x79, 0x3f, 0x59, 0x4f,
-	0xb3, 0xbc, 0x33, 0x10, 0xda, 0x87, 0xae, 0x9e, 0x5a, 0xd2, 0x5d, 0xd6, 0xc8, 0xd1, 0xd5, 0xc8,
-	0xcf, 0xa5, 0xbe, 0x81, 0x33, 0x80, 0xe1, 0x77, 0xe8, 0xef, 0x30, 0x4a, 0x52, 0xf5, 0x7f, 0xa6,
-	0xdc, 0x43, 0x68, 0x1f, 0x09, 0x3a, 0xeb, 0x40, 0xa7, 0xd1, 0x81, 0xc3, 0x75, 0x58, 0xd9, 0xcf,
-	0x26, 0x51, 0x24, 0x88, 0x94, 0x7f, 0x4b, 0xfa, 0x56, 0xf2, 0x14, 0x7a, 0xbb, 0xa9, 0xfc, 0x58,
-	0x36, 0xe3, 0xc5, 0x8c, 0x67, 0xd0, 0xdf, 0x4b, 0x30, 0x65, 0x17, 0x62, 0xac, 0x6a, 0xda, 0xd5,
-	0x8d, 0xf8, 0xe2, 0x4f, 0x00, 0x00, 0x00, 0xff, 0xff, 0x9f, 0xef, 0xc9, 0xd0, 0x91, 0x07, 0x00,
-	0x00,
+	// 1001 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xc4, 0x55, 0xeb, 0x6e, 0xe3, 0x44,
+	0x14, 0xc6, 0xb9, 0x39, 0x39, 0x49, 0x4b, 0x19, 0x6e, 0xa6, 0xbb, 0xb0, 0x59, 0x73, 0x51, 0x10,
+	0x92, 0xa3, 0x06, 0x56, 0x0b, 0x2b, 0xb1, 0x52, 0x94, 0xb8, 0x6c, 0x44, 0xca, 0x76, 0x27, 0x5b,
+	0xfe, 0x46, 0x8e, 0x33, 0x4d, 0x87, 0xda, 0x1e, 0xef, 0xcc, 0x38, 0xb4, 0x2b, 0xf1, 0x22, 0xbc,
+	0x04, 0xe2, 0x19, 0x78, 0x00, 0x1e, 0x83, 0xd7, 0x40, 0x1e, 0x5f, 0xe2, 0x6d, 0xda, 0x34, 0xe5,
+	0x0f, 0xff, 0xe6, 0x1c, 0x7f, 0xdf, 0x37, 0x67, 0xce, 0x1c, 0x7f, 0x03, 0x1f, 0xf9, 0xf4, 0x82,
+	0xf0, 0xee, 0xf2, 0xa0, 0xeb, 0xb2, 0xe0, 0x94, 0x2e, 0xba, 0xee, 0xe9, 0xc2, 0x0a, 0x39, 0x93,
+	0x0c, 0xbd, 0x4f, 0x85, 0xa4, 0xcc, 0x52, 0x00, 0x6b, 0x79, 0x60, 0x25, 0x80, 0xfd, 0xfb, 0x0b,
+	0xc6, 0x16, 0x1e, 0xe9, 0x2a, 0xd0, 0x2c, 0x3a, 0xed, 0x0a, 0xc9, 0x23, 0x57, 0x26, 0xa4, 0xfd,
+	0x47, 0x57, 0xf5, 0xe6, 0x44, 0xb8, 0x9c, 0x86, 0x92, 0xf1, 0xae, 0x23, 0x25, 0xa7, 0xb3, 0x48,
+	0x92, 0xe9, 0x2a, 0xb9, 0x05, 0xcd, 0x63, 0x8b, 0x29, 0x09, 0x24, 0xbf, 0x5c, 0xa7, 0xf5, 0x36,
+	0xd0, 0x7c, 0x22, 0x39, 0x75, 0xd7, 0x39, 0x4f, 0x37, 0x71, 0x58, 0x40, 0x25, 0xe3, 0x64, 0x3e,
+	0xe5, 0x44, 0xb0, 0x88, 0xbb, 0x77, 0x2c, 0x35, 0xe4, 0x34, 0x70, 0x69, 0xe8, 0x78, 0xeb, 0xb4,
+	0x83, 0x0d, 0xb4, 0x57, 0x11, 0x93, 0xce, 0x1a, 0xc5, 0xfc, 0xbb, 0x0c, 0x3b, 0x13, 0xc2, 0x97,
+	0xd4, 0x25, 0x03, 0xc5, 0x41, 0x06, 0xe8, 0x22, 0x9a, 0xfd, 0x42, 0x5c, 0x69, 0x68, 0x6d, 0xad,
+	0xd3, 0xc0, 0x59, 0x88, 0xf6, 0xa1, 0xce, 0xc9, 0x92, 0x0a, 0xca, 0x02, 0xa3, 0xa4, 0x3e, 0xe5,
+	0x31, 0x7a, 0x0c, 0x55, 0x1e, 0x79, 0x44, 0x18, 0xe5, 0x76, 0xb9, 0xd3, 0xec, 0x3d, 0xb4, 0xae,
+	0xbd, 0x58, 0xab, 0x2f, 0x42, 0xe2, 0x4a, 0x1c, 0x79, 0x04, 0x27, 0x78, 0x74, 0x04, 0xe0, 0x9e,
+	0x11, 0xf7, 0x7c, 0xea, 0xb3, 0x39, 0x31, 0x2a, 0x6d, 0xad, 0xb3, 0xdb, 0xb3, 0x6e, 0x60, 0xbf,
+	0x51, 0xa8, 0x35, 0x88, 0x69, 0x47, 0x6c, 0x4e, 0x70, 0xc3, 0xcd, 0x96, 0xe8, 0x10, 0x5a, 0x89,
+	0x5c, 0xc8, 0x3c, 0xea, 0x5e, 0x1a, 0xd5, 0xb6, 0xd6, 0x69, 0xf6, 0x3e, 0xbd, 0x41, 0x10, 0x13,
+	0x11, 0x79, 0xf2, 0x58, 0x41, 0x71, 0x53, 0x11, 0x93, 0x00, 0x3d, 0x83, 0x1d, 0x4e, 0x42, 0xc6,
+	0x65, 0x26, 0x54, 0xdb, 0x5e, 0xa8, 0x95, 0x30, 0x53, 0xa5, 0x43, 0x68, 0x25, 0xbd, 0x4f, 0x85,
+	0xf4, 0x3b, 0x54, 0xa4, 0x88, 0x49, 0x60, 0x7e, 0x01, 0x8d, 0xfc, 0xc4, 0xa8, 0x05, 0xf5, 0xe3,
+	0x3e, 0xee, 0x8f, 0xc7, 0xf6, 0x78, 0xef, 0x2d, 0xd4, 0x04, 0xfd, 0x39, 0x1e, 0xda, 0xd8, 0x1e,
+	0xee, 0x69, 0xe6, 0x1f, 0x1a, 0xb4, 0x8a, 0x2a, 0xc8, 0x06, 0xdd, 0x65, 0xfe, 0x8c, 0x06, 0x44,
+	0x5d, 0xe8, 0x6e, 0xef, 0xab, 0x2d, 0xf6, 0xb6, 0x06, 0x09, 0x05, 0x67, 0xdc, 0x78, 0x2e, 0x7c,
+	0x22, 0x84, 0xb3, 0x20, 0xe9, 0xe5, 0x67, 0xa1, 0xf9, 0x14, 0xf4, 0x14, 0x8d, 0xde, 0x86, 0x26,
+	0xb6, 0x5f, 0x9c, 0x8c, 0xb0, 0x3d, 0xed, 0x8f, 0xe3, 0xd2, 0xde, 0x81, 0x9d, 0xc3, 0x11, 0x9e,
+	0xbc, 0x9c, 0x1e, 0xf6, 0x47, 0xe3, 0x13, 0x6c, 0xef, 0x69, 0x31, 0xe6, 0xe8, 0xf9, 0xe4, 0xe5,
+	0x74, 0x62, 0xff, 0x6c, 0x63, 0x7b, 0xaf, 0x64, 0xfe, 0xae, 0x01, 0xac, 0x06, 0x23, 0x1e, 0x33,
+	0x41, 0x3c, 0xe2, 0x4a, 0xc6, 0xd3, 0x09, 0xcc, 0x63, 0xf4, 0x18, 0x74, 0x47, 0x21, 0x85, 0x51,
+	0x52, 0x83, 0xf6, 0xf1, 0xe6, 0x41, 0xcb, 0xd0, 0xff, 0x79, 0x3e, 0xcd, 0x3f, 0x4b, 0x50, 0x4b,
+	0xb2, 0x08, 0x41, 0xe5, 0x9c, 0x06, 0xf3, 0xb4, 0x28, 0xb5, 0x8e, 0xbb, 0xe2, 0xcc, 0x9d, 0x50,
+	0x12, 0x9e, 0x75, 0x25, 0x0d, 0x51, 0x1f, 0x6a, 0x34, 0x08, 0x23, 0x99, 0x6d, 0xf9, 0xe5, 0xc6,
+	0x2d, 0xad, 0x91, 0xc2, 0xda, 0xb1, 0x07, 0xe1, 0x94, 0x88, 0xba, 0x50, 0x0b, 0x1d, 0xee, 0xf8,
+	0x42, 0xfd, 0x17, 0xcd, 0xde, 0x87, 0x56, 0xe2, 0x8b, 0x56, 0xe6, 0x8b, 0xd6, 0x44, 0xf9, 0x22,
+	0x4e, 0x61, 0xe8, 0x3d, 0xa8, 0x0a, 0x19, 0xdf, 0x50, 0x55, 0xd5, 0x92, 0x04, 0xe8, 0x03, 0xa8,
+	0x89, 0x33, 0x67, 0xce, 0x7e, 0x55, 0x43, 0x5c, 0xc7, 0x69, 0x84, 0xee, 0x43, 0xe3, 0xd4, 0xf1,
+	0xbc, 0x99, 0xe3, 0x9e, 0x0b, 0x43, 0x6f, 0x97, 0x3b, 0x0d, 0xbc, 0x4a, 0xec, 0x7f, 0x07, 0xcd,
+	0x42, 0x4d, 0x68, 0x0f, 0xca, 0xe7, 0xe4, 0x32, 0x3d, 0x7b, 0xbc, 0x8c, 0x37, 0x5b, 0x3a, 0x5e,
+	0x94, 0x8d, 0x43, 0x12, 0x3c, 0x29, 0x7d, 0xab, 0x99, 0x7f, 0x69, 0xa0, 0xf7, 0xd3, 0x36, 0x20,
+	0xa8, 0x04, 0x8e, 0x4f, 0xb2, 0xa6, 0xc5, 0xeb, 0xbc, 0x91, 0xa5, 0x42, 0x23, 0x11, 0x54, 0xa8,
+	0x1f, 0x7a, 0x46, 0x39, 0xc9, 0xc5, 0xeb, 0xbb, 0x9f, 0xff, 0x47, 0x68, 0xba, 0x2c, 0x70, 0x23,
+	0xce, 0x49, 0x90, 0xff, 0xfc, 0x37, 0x36, 0x3e, 0xa9, 0x70, 0xb0, 0x22, 0xe0, 0x22, 0xdb, 0xbc,
+	0x04, 0xb4, 0x0e, 0x41, 0x9f, 0xc3, 0xae, 0xef, 0x5c, 0x4c, 0x73, 0x60, 0xe2, 0x92, 0x55, 0xbc,
+	0xe3, 0x3b, 0x17, 0x39, 0x4e, 0xa2, 0x7b, 0xd0, 0x08, 0x19, 0xf3, 0xa6, 0x82, 0xbe, 0x4e, 0x1a,
+	0x54, 0xc5, 0xf5, 0x38, 0x31, 0xa1, 0xaf, 0x09, 0x7a, 0x00, 0xcd, 0x57, 0x11, 0x89, 0x62, 0xe3,
+	0x0f, 0xe5, 0x99, 0x3a, 0x72, 0x15, 0x83, 0x4a, 0x0d, 0xe3, 0x8c, 0xf9, 0x4f, 0x05, 0x5a, 0x3f,
+	0x78, 0x6c, 0xe6, 0x78, 0xa9, 0x29, 0x17, 0xad, 0x57, 0xbb, 0x62, 0xbd, 0x4f, 0xa0, 0x9e, 0xce,
+	0x5c, 0xf6, 0x53, 0x7c, 0xb2, 0xf9, 0xc4, 0x38, 0xc7, 0xa3, 0x13, 0x80, 0xfc, 0xc5, 0xcc, 0x06,
+	0xf5, 0xd1, 0x0d, 0xec, 0xc2, 0xdb, 0xd1, 0xcf, 0x38, 0xc3, 0x3c, 0x87, 0x0b, 0x42, 0xe8, 0x19,
+	0x54, 0x3c, 0xb6, 0x88, 0xaf, 0x2d, 0x16, 0xfc, 0xe6, 0x76, 0xc1, 0x31, 0x5b, 0xa8, 0x31, 0x2b,
+	0xe8, 0x29, 0x05, 0x34, 0x06, 0x3d, 0x79, 0x64, 0x85, 0x51, 0x55, 0x62, 0xbd, 0xdb, 0xc5, 0x8e,
+	0x14, 0xa1, 0x20, 0x95, 0x49, 0xa0, 0x00, 0xde, 0x5d, 0x7f, 0x7e, 0x85, 0x51, 0x53, 0xca, 0xdf,
+	0x6f, 0xa1, 0x9c, 0x91, 0x71, 0xca, 0x2d, 0x6c, 0x82, 0xfc, 0xab, 0x1f, 0x55, 0x7b, 0xf3, 0xe7,
+	0x3a, 0xf9, 0xc5, 0xb6, 0x6a, 0xef, 0x71, 0xc6, 0x29, 0xb6, 0x77, 0x25, 0x84, 0x46, 0x50, 0x53,
+	0x2f, 0x83, 0x30, 0xea, 0x4a, 0xf2, 0xe0, 0x76, 0xc9, 0x17, 0x31, 0xbe, 0x20, 0x97, 0x0a, 0x98,
+	0xbf, 0x41, 0x6b, 0xe0, 0x51, 0x12, 0xc8, 0xff, 0xe5, 0xf5, 0x37, 0xef, 0x41, 0xf9, 0x84, 0xd3,
+	0x95, 0x95, 0x68, 0x05, 0x2b, 0x31, 0x1f, 0x42, 0x63, 0x14, 0xf6, 0xe7, 0x73, 0x4e, 0x84, 0x78,
+	0x13, 0xd2, 0xca, 0x20, 0x0f, 0x40, 0x1f, 0x06, 0xe2, 0xa7, 0xd8, 0x54, 0xae, 0xd7, 0xf8, 0x0c,
+	0x5a, 0xb6, 0xef, 0x50, 0xef, 0x5a, 0x99, 0x0c, 0x35, 0xab, 0x29, 0x43, 0xf9, 0xfa, 0xdf, 0x01,
+	0x00, 0x97, 0x90, 0x11, 0x51, 0xaa, 0x0a, 0x00, 0x00,
 }
@@ -18,6 +18,9 @@ package istio_mixer_v1_config
 type Combined struct {
 	Builder *Adapter
 	Aspect  *Aspect
+
+	// Fallbacks are the adapters to run the aspect on, in order, when Builder fails.
+	Fallbacks []*Adapter
 }
 
 func (c *Combined) String() (ret string) {
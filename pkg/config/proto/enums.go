@@ -0,0 +1,41 @@
+// Copyright 2017 the Istio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package istio_mixer_v1_config
+
+import proto "github.com/golang/protobuf/proto"
+
+// Config is read from YAML by way of encoding/json, while protoc-gen-go only lets
+// proto3 enums be unmarshalled from their numbers. The methods below also accept
+// the names of the values.
+
+// UnmarshalJSON sets x from the name or the number of a check mode.
+func (x *ServiceConfig_CheckMode) UnmarshalJSON(data []byte) error {
+	value, err := proto.UnmarshalJSONEnum(ServiceConfig_CheckMode_value, data, "ServiceConfig_CheckMode")
+	if err != nil {
+		return err
+	}
+	*x = ServiceConfig_CheckMode(value)
+	return nil
+}
+
+// UnmarshalJSON sets x from the name or the number of a way of combining results.
+func (x *ResultPolicy_Combine) UnmarshalJSON(data []byte) error {
+	value, err := proto.UnmarshalJSONEnum(ResultPolicy_Combine_value, data, "ResultPolicy_Combine")
+	if err != nil {
+		return err
+	}
+	*x = ResultPolicy_Combine(value)
+	return nil
+}
@@ -73,6 +73,47 @@ func (r *runtime) ResolveUnconditional(bag attribute.Bag, set KindSet) (out []*p
 	return r.resolveRules(bag, set, r.serviceConfig.GetRules(), "/", out, true /* unconditional resolve */)
 }
 
+// Combined returns every combined config the rules refer to, whatever their selectors. An aspect
+// with fallbacks adds a combined config per fallback adapter, after its own.
+func (r *runtime) Combined() []*pb.Combined {
+	return r.combineRules(r.serviceConfig.GetRules(), make([]*pb.Combined, 0, r.numAspects))
+}
+
+func (r *runtime) combineRules(rules []*pb.AspectRule, dlist []*pb.Combined) []*pb.Combined {
+	for _, rule := range rules {
+		for _, aa := range rule.GetAspects() {
+			k, ok := ParseKind(aa.Kind)
+			if !ok {
+				continue
+			}
+			c := r.combine(k, aa)
+			dlist = append(dlist, c)
+			for _, fb := range c.Fallbacks {
+				dlist = append(dlist, &pb.Combined{Builder: fb, Aspect: aa})
+			}
+		}
+		dlist = r.combineRules(rule.GetRules(), dlist)
+	}
+	return dlist
+}
+
+// combine returns the combined config of an aspect of kind k.
+func (r *runtime) combine(k Kind, aa *pb.Aspect) *pb.Combined {
+	c := &pb.Combined{Builder: r.adapterByName[adapterKey{k, aa.Adapter}], Aspect: aa}
+	if len(aa.Fallbacks) > 0 {
+		c.Fallbacks = make([]*pb.Adapter, len(aa.Fallbacks))
+		for i, name := range aa.Fallbacks {
+			c.Fallbacks[i] = r.adapterByName[adapterKey{k, name}]
+		}
+	}
+	return c
+}
+
+// ServiceConfig returns the validated service config.
+func (r *runtime) ServiceConfig() *pb.ServiceConfig {
+	return r.serviceConfig
+}
+
 func (r *runtime) evalPredicate(selector string, bag attribute.Bag) (bool, error) {
 	// empty selector always selects
 	if selector == "" {
@@ -112,9 +153,9 @@ func (r *runtime) resolveRules(bag attribute.Bag, kindSet KindSet, rules []*pb.A
 				glog.V(3).Infof("Aspect %s not selected [%v]", aa.Kind, kindSet)
 				continue
 			}
-			adp := r.adapterByName[adapterKey{k, aa.Adapter}]
-			glog.V(2).Infof("selected aspect %s -> %s", aa.Kind, adp)
-			dlist = append(dlist, &pb.Combined{Builder: adp, Aspect: aa})
+			c := r.combine(k, aa)
+			glog.V(2).Infof("selected aspect %s -> %s", aa.Kind, c.Builder)
+			dlist = append(dlist, c)
 		}
 		rs := rule.GetRules()
 		if len(rs) == 0 {
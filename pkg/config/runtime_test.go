@@ -229,6 +229,77 @@ func TestRuntime_ResolveUnconditional(t *testing.T) {
 	}
 }
 
+func TestRuntime_Combined(t *testing.T) {
+	a1 := &pb.Adapter{Name: "a1", Kind: ListsKindName}
+	ag := &pb.Adapter{Name: "ag", Kind: AttributeGenerationKindName}
+
+	v := &Validated{
+		adapterByName: map[adapterKey]*pb.Adapter{
+			{ListsKind, "a1"}:               a1,
+			{AttributeGenerationKind, "ag"}: ag,
+		},
+		serviceConfig: &pb.ServiceConfig{
+			Rules: []*pb.AspectRule{
+				{
+					Selector: "never",
+					Aspects:  []*pb.Aspect{{Adapter: "a1", Kind: ListsKindName}},
+					Rules: []*pb.AspectRule{
+						{Aspects: []*pb.Aspect{{Adapter: "ag", Kind: AttributeGenerationKindName}}},
+					},
+				},
+				{
+					Aspects: []*pb.Aspect{{Adapter: "a1", Kind: "unknown"}},
+				},
+			},
+		},
+		numAspects: 2,
+	}
+
+	// selectors are never evaluated
+	rt := newRuntime(v, &trueEval{errors.New("unexpected call"), 0, false})
+
+	got := rt.Combined()
+	if len(got) != 2 || got[0].Builder != a1 || got[1].Builder != ag {
+		t.Errorf("Combined() = %v, want the configs for a1 and ag", got)
+	}
+}
+
+func TestRuntime_Fallbacks(t *testing.T) {
+	a1 := &pb.Adapter{Name: "a1", Kind: ListsKindName}
+	a2 := &pb.Adapter{Name: "a2", Kind: ListsKindName}
+	a3 := &pb.Adapter{Name: "a3", Kind: ListsKindName}
+
+	v := &Validated{
+		adapterByName: map[adapterKey]*pb.Adapter{
+			{ListsKind, "a1"}: a1,
+			{ListsKind, "a2"}: a2,
+			{ListsKind, "a3"}: a3,
+		},
+		serviceConfig: &pb.ServiceConfig{
+			Rules: []*pb.AspectRule{
+				{
+					Aspects: []*pb.Aspect{{Adapter: "a1", Kind: ListsKindName, Fallbacks: []string{"a2", "a3"}}},
+				},
+			},
+		},
+		numAspects: 1,
+	}
+	rt := newRuntime(v, &trueEval{nil, 0, true})
+
+	al, err := rt.Resolve(attribute.GetMutableBag(nil), KindSet(0).Set(ListsKind))
+	if err != nil || len(al) != 1 {
+		t.Fatalf("Resolve() = %v, %v, want a single config", al, err)
+	}
+	if fb := al[0].Fallbacks; len(fb) != 2 || fb[0] != a2 || fb[1] != a3 {
+		t.Errorf("Resolve() fallbacks = %v, want a2 and a3", fb)
+	}
+
+	got := rt.Combined()
+	if len(got) != 3 || got[0].Builder != a1 || got[1].Builder != a2 || got[2].Builder != a3 {
+		t.Errorf("Combined() = %v, want the configs for a1, a2 and a3", got)
+	}
+}
+
 func init() {
 	// bump up the log level so log-only logic runs during the tests, for correctness and coverage.
 	_ = flag.Lookup("v").Value.Set("99")
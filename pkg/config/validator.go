@@ -129,6 +129,10 @@ func (p *validator) validateGlobalConfig(cfg string) (ce *adapter.ConfigErrors)
 			continue
 		}
 		aa.Params = acfg
+		if cerr := validateConcurrency("Adapter: "+aa.Impl+":Concurrency", aa.Concurrency); cerr != nil {
+			ce = ce.Extend(cerr)
+			continue
+		}
 		// check which kinds aa.Impl provides
 		// Then register it for all of them.
 		kinds := p.findAspects(aa.Impl)
@@ -142,6 +146,25 @@ func (p *validator) validateGlobalConfig(cfg string) (ce *adapter.ConfigErrors)
 	return
 }
 
+// validateConcurrency ensures the concurrency limits of an adapter are consistent.
+func validateConcurrency(path string, c *pb.AdapterConcurrency) (ce *adapter.ConfigErrors) {
+	if c == nil {
+		return nil
+	}
+	if c.MaxConcurrent < 0 {
+		ce = ce.Appendf(path+".MaxConcurrent", "must not be negative, got %d", c.MaxConcurrent)
+	}
+	if c.PoolSize < 0 {
+		ce = ce.Appendf(path+".PoolSize", "must not be negative, got %d", c.PoolSize)
+	}
+	if c.QueueDepth < 0 {
+		ce = ce.Appendf(path+".QueueDepth", "must not be negative, got %d", c.QueueDepth)
+	} else if c.QueueDepth > 0 && c.PoolSize == 0 {
+		ce = ce.Appendf(path+".QueueDepth", "only applies to a dedicated pool, set PoolSize")
+	}
+	return
+}
+
 // ValidateSelector ensures that the selector is valid per expression language.
 func (p *validator) validateSelector(selector string) (err error) {
 	// empty selector always selects
@@ -168,6 +191,9 @@ func (p *validator) validateAspectRules(rules []*pb.AspectRule, path string, val
 			}
 			aa.Params = acfg
 			p.validated.numAspects++
+			if aa.Shadow {
+				ce = ce.Extend(validateShadow(aa, fmt.Sprintf("%s:%s[%d]", path, aa.Kind, idx)))
+			}
 			if validatePresence {
 				if aa.Adapter == "" {
 					aa.Adapter = "default"
@@ -181,6 +207,7 @@ func (p *validator) validateAspectRules(rules []*pb.AspectRule, path string, val
 					if p.validated.adapterByName[ak] == nil {
 						ce = ce.Appendf("NamedAdapter", "%s not available", ak)
 					}
+					ce = ce.Extend(p.validateFallbacks(k, aa))
 				}
 			}
 		}
@@ -195,6 +222,31 @@ func (p *validator) validateAspectRules(rules []*pb.AspectRule, path string, val
 	return ce
 }
 
+// validateShadow ensures that a shadow aspect is a check aspect. A quota aspect would grant
+// nothing while reported as OK, and report aspects don't fail requests anyway.
+func validateShadow(aa *pb.Aspect, path string) (ce *adapter.ConfigErrors) {
+	if k, ok := ParseKind(aa.Kind); ok && k != ListsKind && k != DenialsKind {
+		ce = ce.Appendf(path+".Shadow", "only applies to %s and %s aspects", ListsKindName, DenialsKindName)
+	}
+	return
+}
+
+// validateFallbacks ensures that the fallbacks of an aspect are available adapters of its kind,
+// each named once.
+func (p *validator) validateFallbacks(k Kind, aa *pb.Aspect) (ce *adapter.ConfigErrors) {
+	seen := map[string]bool{aa.Adapter: true}
+	for _, name := range aa.Fallbacks {
+		ak := adapterKey{k, name}
+		if p.validated.adapterByName[ak] == nil {
+			ce = ce.Appendf("Fallbacks", "%s not available", ak)
+		} else if seen[name] {
+			ce = ce.Appendf("Fallbacks", "%s is already part of the chain", ak)
+		}
+		seen[name] = true
+	}
+	return
+}
+
 // validate validates a single serviceConfig and globalConfig together.
 // It returns a fully validated Config if no errors are found.
 func (p *validator) validate(serviceCfg string, globalCfg string) (rt *Validated, ce *adapter.ConfigErrors) {
@@ -16,6 +16,7 @@ package config
 
 import (
 	"fmt"
+	"reflect"
 	"strconv"
 	"strings"
 	"testing"
@@ -25,6 +26,7 @@ import (
 	listcheckerpb "istio.io/mixer/pkg/aspect/config"
 	"istio.io/mixer/pkg/attribute"
 	"istio.io/mixer/pkg/config/descriptor"
+	pb "istio.io/mixer/pkg/config/proto"
 	"istio.io/mixer/pkg/expr"
 )
 
@@ -267,6 +269,140 @@ func TestConfigParseError(t *testing.T) {
 	}
 }
 
+func TestServiceConfigCheckMode(t *testing.T) {
+	cases := []struct {
+		cfg       string
+		want      pb.ServiceConfig_CheckMode
+		wantStage string
+		wantErr   bool
+	}{
+		{sSvcConfig2, pb.ServiceConfig_PARALLEL, "", false},
+		{sSvcConfigOrdered, pb.ServiceConfig_ORDERED, "lookups", false},
+		{"check_mode: SOMETIMES", pb.ServiceConfig_PARALLEL, "", true},
+	}
+
+	for idx, c := range cases {
+		mgr := newVfinder(nil, map[Kind]AspectValidator{ListsKind: &ac{}})
+		p := newValidator(mgr.FindAspectValidator, mgr.FindAdapterValidator, mgr.AdapterToAspectMapperFunc, false, newFakeExpr())
+		ce := p.validateServiceConfig(c.cfg, false)
+		if (ce != nil) != c.wantErr {
+			t.Errorf("[%d] validateServiceConfig() = %v, wanted error: %t", idx, ce, c.wantErr)
+			continue
+		}
+		if c.wantErr {
+			continue
+		}
+		sc := p.validated.serviceConfig
+		if sc.GetCheckMode() != c.want {
+			t.Errorf("[%d] check mode = %v, wanted %v", idx, sc.GetCheckMode(), c.want)
+		}
+		if c.want == pb.ServiceConfig_ORDERED && sc.GetCheckPolicy().GetCombine() != pb.ResultPolicy_MOST_SEVERE {
+			t.Errorf("[%d] check policy = %v, wanted MOST_SEVERE", idx, sc.GetCheckPolicy())
+		}
+		if stage := sc.GetRules()[0].GetAspects()[0].GetStage(); stage != c.wantStage {
+			t.Errorf("[%d] stage = '%s', wanted '%s'", idx, stage, c.wantStage)
+		}
+	}
+}
+
+func TestGlobalConfigConcurrency(t *testing.T) {
+	cases := []struct {
+		concurrency string
+		want        *pb.AdapterConcurrency
+		nerrors     int
+	}{
+		{"", nil, 0},
+		{"{max_concurrent: 10}", &pb.AdapterConcurrency{MaxConcurrent: 10}, 0},
+		{"{pool_size: 4, queue_depth: 16}", &pb.AdapterConcurrency{PoolSize: 4, QueueDepth: 16}, 0},
+		{"{max_concurrent: -1, pool_size: -1}", nil, 2},
+		{"{queue_depth: 16}", nil, 1},
+	}
+
+	for idx, c := range cases {
+		cfg := sGlobalConfigValid
+		if c.concurrency != "" {
+			cfg += "    concurrency: " + c.concurrency + "\n"
+		}
+
+		mgr := newVfinder(map[string]adapter.ConfigValidator{"denyChecker": &lc{}}, nil)
+		p := newValidator(mgr.FindAspectValidator, mgr.FindAdapterValidator, mgr.AdapterToAspectMapperFunc, false, newFakeExpr())
+		ce := p.validateGlobalConfig(cfg)
+		if c.nerrors > 0 {
+			if ce == nil || len(ce.Multi.Errors) != c.nerrors {
+				t.Errorf("[%d] validateGlobalConfig() = %v, wanted %d errors", idx, ce, c.nerrors)
+			}
+			continue
+		}
+		if ce != nil {
+			t.Errorf("[%d] validateGlobalConfig() = %v, wanted no error", idx, ce)
+			continue
+		}
+		if got := p.validated.globalConfig.GetAdapters()[0].GetConcurrency(); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("[%d] concurrency = %v, wanted %v", idx, got, c.want)
+		}
+	}
+}
+
+func TestAspectFallbacks(t *testing.T) {
+	cases := []struct {
+		fallbacks string
+		want      []string
+		nerrors   int
+	}{
+		{"[backup]", []string{"backup"}, 0},
+		{"[backup, last]", []string{"backup", "last"}, 0},
+		{"[missing]", nil, 1},
+		{"[default]", nil, 1},
+		{"[backup, missing, backup]", nil, 2},
+	}
+
+	for idx, c := range cases {
+		mgr := newVfinder(map[string]adapter.ConfigValidator{"denyChecker": &lc{}}, map[Kind]AspectValidator{DenialsKind: &ac{}})
+		p := newValidator(mgr.FindAspectValidator, mgr.FindAdapterValidator, mgr.AdapterToAspectMapperFunc, false, newFakeExpr())
+		if ce := p.validateGlobalConfig(sGlobalConfigFallbacks); ce != nil {
+			t.Fatalf("validateGlobalConfig() = %v, wanted no error", ce)
+		}
+		ce := p.validateServiceConfig(sSvcConfigFallbacks+c.fallbacks+"\n", true)
+		if c.nerrors > 0 {
+			if ce == nil || len(ce.Multi.Errors) != c.nerrors {
+				t.Errorf("[%d] validateServiceConfig() = %v, wanted %d errors", idx, ce, c.nerrors)
+			}
+			continue
+		}
+		if ce != nil {
+			t.Errorf("[%d] validateServiceConfig() = %v, wanted no error", idx, ce)
+			continue
+		}
+		if got := p.validated.serviceConfig.GetRules()[0].GetAspects()[0].GetFallbacks(); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("[%d] fallbacks = %v, wanted %v", idx, got, c.want)
+		}
+	}
+}
+
+func TestAspectShadow(t *testing.T) {
+	cases := []struct {
+		kind    string
+		nerrors int
+	}{
+		{DenialsKindName, 0},
+		{ListsKindName, 0},
+		{QuotasKindName, 1},
+		{AccessLogsKindName, 1},
+	}
+
+	for idx, c := range cases {
+		mgr := newVfinder(nil, map[Kind]AspectValidator{DenialsKind: &ac{}, ListsKind: &ac{}, QuotasKind: &ac{}, AccessLogsKind: &ac{}})
+		p := newValidator(mgr.FindAspectValidator, mgr.FindAdapterValidator, mgr.AdapterToAspectMapperFunc, false, newFakeExpr())
+		ce := p.validateServiceConfig(fmt.Sprintf(sSvcConfigShadow, c.kind), false)
+		if c.nerrors == 0 && ce != nil {
+			t.Errorf("[%d] validateServiceConfig() = %v for a shadow %s aspect, wanted no error", idx, ce, c.kind)
+		}
+		if c.nerrors > 0 && (ce == nil || len(ce.Multi.Errors) != c.nerrors || !strings.Contains(ce.Error(), "Shadow")) {
+			t.Errorf("[%d] validateServiceConfig() = %v for a shadow %s aspect, wanted %d errors", idx, ce, c.kind, c.nerrors)
+		}
+	}
+}
+
 func TestDecoderError(t *testing.T) {
 	err := decode(make(chan int), nil, true)
 	if err == nil {
@@ -289,6 +425,38 @@ const sGlobalConfig = sGlobalConfigValid + `
       unknown_field: true
 `
 
+const sGlobalConfigFallbacks = sGlobalConfigValid + `
+  - name: backup
+    kind: denials
+    impl: denyChecker
+    params:
+  - name: last
+    kind: denials
+    impl: denyChecker
+    params:
+`
+
+const sSvcConfigFallbacks = `
+subject: namespace:ns
+revision: "2022"
+rules:
+- selector: service.name == “*”
+  aspects:
+  - kind: denials
+    params:
+    fallbacks: `
+
+const sSvcConfigShadow = `
+subject: namespace:ns
+revision: "2022"
+rules:
+- selector: service.name == “*”
+  aspects:
+  - kind: %s
+    params:
+    shadow: true
+`
+
 const sSvcConfig1 = `
 subject: "namespace:ns"
 revision: "2022"
@@ -325,6 +493,20 @@ rules:
     params:
     adapter: denychecker.2
 `
+const sSvcConfigOrdered = `
+subject: namespace:ns
+revision: "2022"
+check_mode: ORDERED
+check_policy:
+  combine: MOST_SEVERE
+  message: request rejected
+rules:
+- selector: service.name == “*”
+  aspects:
+  - kind: lists
+    stage: lookups
+    params:
+`
 const sSvcConfig = `
 subject: namespace:ns
 revision: "2022"
@@ -0,0 +1,50 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package monitoring holds the metrics the mixer exports about itself.
+//
+// These are kept apart from the metrics adapters produce on behalf of the services the mixer
+// fronts, so that they can be scraped and retained independently.
+package monitoring
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// registry holds the mixer's own metrics.
+var registry = prometheus.NewRegistry()
+
+func init() {
+	registry.MustRegister(prometheus.NewGoCollector())
+}
+
+// MustRegister registers collectors of the mixer's own metrics, and panics if any of them
+// can't be registered.
+func MustRegister(cs ...prometheus.Collector) {
+	registry.MustRegister(cs...)
+}
+
+// Register registers a collector of the mixer's own metrics, and returns an error if it can't
+// be registered, for example because its metrics are invalid or clash with existing ones.
+func Register(c prometheus.Collector) error {
+	return registry.Register(c)
+}
+
+// Handler returns an http.Handler exposing the mixer's own metrics in the Prometheus formats.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
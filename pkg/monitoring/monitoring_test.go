@@ -0,0 +1,51 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitoring
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestHandler(t *testing.T) {
+	c := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "mixer_monitoring_test_total",
+		Help: "Counter used to test the monitoring handler.",
+	})
+	MustRegister(c)
+	c.Inc()
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := w.Body.String()
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /metrics = %d, wanted 200", w.Code)
+	}
+	for _, want := range []string{"mixer_monitoring_test_total 1", "go_goroutines"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("GET /metrics did not return %q:\n%s", want, body)
+		}
+	}
+
+	// the mixer's metrics are kept apart from the default registry
+	if err := prometheus.Register(c); err != nil {
+		t.Errorf("prometheus.Register() = %v, wanted the default registry to be unaffected", err)
+	}
+}
@@ -16,6 +16,12 @@ package pool
 
 import (
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"istio.io/mixer/pkg/monitoring"
 )
 
 // WorkFunc represents a function to invoke from a worker.
@@ -23,9 +29,38 @@ type WorkFunc func()
 
 // GoroutinePool represents a set of reusable goroutines onto which work can be scheduled.
 type GoroutinePool struct {
+	completed      int64          // Number of work items the workers completed, first for 64-bit alignment
 	queue          chan WorkFunc  // Channel providing the work that needs to be executed
 	wg             sync.WaitGroup // Used to block shutdown until all workers complete
 	singleThreaded bool           // Whether to actually use goroutines or not
+	name           string         // Label of the pool's metrics, metrics are only exported for named pools
+	workers        int32          // Number of workers
+	busy           int32          // Number of workers running a work item
+}
+
+// probeInterval is how often Responsive checks on the progress of the workers.
+const probeInterval = 5 * time.Millisecond
+
+var (
+	poolQueueLength = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mixer_pool_queue_length",
+		Help: "Number of work items waiting for a worker.",
+	}, []string{"pool"})
+
+	poolWaitTime = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mixer_pool_wait_seconds",
+		Help:    "Time work items spend waiting for a worker.",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 8),
+	}, []string{"pool"})
+
+	poolRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mixer_pool_rejected_total",
+		Help: "Number of work items turned away because the queue was full.",
+	}, []string{"pool"})
+)
+
+func init() {
+	monitoring.MustRegister(poolQueueLength, poolWaitTime, poolRejected)
 }
 
 // NewGoroutinePool creates a new pool of goroutines to schedule async work.
@@ -39,6 +74,14 @@ func NewGoroutinePool(queueDepth int, singleThreaded bool) *GoroutinePool {
 	return gp
 }
 
+// NewNamedGoroutinePool creates a new pool of goroutines to schedule async work, whose queue
+// length, wait time and rejections are exported as metrics labeled with name.
+func NewNamedGoroutinePool(name string, queueDepth int, singleThreaded bool) *GoroutinePool {
+	gp := NewGoroutinePool(queueDepth, singleThreaded)
+	gp.name = name
+	return gp
+}
+
 // Close waits for all goroutines to terminate
 func (gp *GoroutinePool) Close() {
 	if !gp.singleThreaded {
@@ -52,18 +95,74 @@ func (gp *GoroutinePool) ScheduleWork(fn WorkFunc) {
 	if gp.singleThreaded {
 		fn()
 	} else {
-		gp.queue <- fn
+		gp.queue <- gp.wrap(fn)
+		gp.updateQueueLength()
+	}
+}
+
+// TrySchedule registers the given function to be executed at some point, unless the pool's
+// queue is full. It returns false if the function was turned away.
+func (gp *GoroutinePool) TrySchedule(fn WorkFunc) bool {
+	if gp.singleThreaded {
+		fn()
+		return true
+	}
+
+	select {
+	case gp.queue <- gp.wrap(fn):
+		gp.updateQueueLength()
+		return true
+	default:
+		if gp.name != "" {
+			poolRejected.WithLabelValues(gp.name).Inc()
+		}
+		return false
 	}
 }
 
+// Responsive returns true if the workers of the pool make progress: one of them is idle, or one
+// of them completes a work item within timeout. The probe doesn't take a place in the queue, so
+// a pool that keeps up with a full queue is responsive.
+func (gp *GoroutinePool) Responsive(timeout time.Duration) bool {
+	if gp.singleThreaded {
+		return true
+	}
+
+	completed := atomic.LoadInt64(&gp.completed)
+	deadline := time.Now().Add(timeout)
+	for {
+		if atomic.LoadInt32(&gp.busy) < atomic.LoadInt32(&gp.workers) || atomic.LoadInt64(&gp.completed) != completed {
+			return true
+		}
+		left := deadline.Sub(time.Now())
+		if left <= 0 {
+			return false
+		}
+		if left > probeInterval {
+			left = probeInterval
+		}
+		time.Sleep(left)
+	}
+}
+
+// SingleThreaded returns true if work scheduled on the pool runs inline instead of on a goroutine.
+func (gp *GoroutinePool) SingleThreaded() bool {
+	return gp.singleThreaded
+}
+
 // AddWorkers introduces more goroutines in the worker pool, increasing potential parallelism.
 func (gp *GoroutinePool) AddWorkers(numWorkers int) {
 	if !gp.singleThreaded {
 		gp.wg.Add(numWorkers)
+		atomic.AddInt32(&gp.workers, int32(numWorkers))
 		for i := 0; i < numWorkers; i++ {
 			go func() {
 				for fn := range gp.queue {
+					gp.updateQueueLength()
+					atomic.AddInt32(&gp.busy, 1)
 					fn()
+					atomic.AddInt32(&gp.busy, -1)
+					atomic.AddInt64(&gp.completed, 1)
 				}
 
 				gp.wg.Done()
@@ -71,3 +170,22 @@ func (gp *GoroutinePool) AddWorkers(numWorkers int) {
 		}
 	}
 }
+
+// wrap records how long fn waits for a worker.
+func (gp *GoroutinePool) wrap(fn WorkFunc) WorkFunc {
+	if gp.name == "" {
+		return fn
+	}
+
+	queued := time.Now()
+	return func() {
+		poolWaitTime.WithLabelValues(gp.name).Observe(time.Since(queued).Seconds())
+		fn()
+	}
+}
+
+func (gp *GoroutinePool) updateQueueLength() {
+	if gp.name != "" {
+		poolQueueLength.WithLabelValues(gp.name).Set(float64(len(gp.queue)))
+	}
+}
@@ -17,6 +17,7 @@ package pool
 import (
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestWorkerPool(t *testing.T) {
@@ -43,3 +44,91 @@ func TestWorkerPool(t *testing.T) {
 		gp.Close()
 	}
 }
+
+func TestTrySchedule(t *testing.T) {
+	for _, name := range []string{"", "test"} {
+		gp := NewNamedGoroutinePool(name, 1, false)
+
+		started := make(chan struct{})
+		release := make(chan struct{})
+		gp.ScheduleWork(func() {
+			close(started)
+			<-release
+		})
+		<-started
+
+		// the single worker is busy, so the queue holds one more item
+		ran := make(chan struct{})
+		if !gp.TrySchedule(func() { close(ran) }) {
+			t.Errorf("TrySchedule() = false with room in the queue, wanted true")
+		}
+		if gp.TrySchedule(func() { t.Error("turned away work was executed") }) {
+			t.Errorf("TrySchedule() = true with a full queue, wanted false")
+		}
+
+		close(release)
+		<-ran
+		gp.Close()
+	}
+}
+
+func TestResponsive(t *testing.T) {
+	gp := NewGoroutinePool(1, false)
+	if !gp.Responsive(time.Second) {
+		t.Error("Responsive() = false for an idle pool, wanted true")
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	gp.ScheduleWork(func() {
+		close(started)
+		<-release
+	})
+	<-started
+
+	if gp.Responsive(10 * time.Millisecond) {
+		t.Error("Responsive() = true for a stuck pool, wanted false")
+	}
+
+	close(release)
+	if !gp.Responsive(time.Second) {
+		t.Error("Responsive() = false once the pool recovered, wanted true")
+	}
+	gp.Close()
+}
+
+func TestResponsive_Saturated(t *testing.T) {
+	gp := NewGoroutinePool(1, false)
+
+	// keep the queue full with work that completes
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				gp.ScheduleWork(func() { time.Sleep(time.Millisecond) })
+			}
+		}
+	}()
+
+	if !gp.Responsive(time.Second) {
+		t.Error("Responsive() = false for a saturated pool that keeps up, wanted true")
+	}
+	close(stop)
+	<-done
+	gp.Close()
+}
+
+func TestTrySchedule_SingleThreaded(t *testing.T) {
+	gp := NewGoroutinePool(0, true)
+	defer gp.Close()
+
+	ran := false
+	if !gp.TrySchedule(func() { ran = true }) || !ran {
+		t.Error("TrySchedule() did not execute the function inline")
+	}
+}
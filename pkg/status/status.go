@@ -16,6 +16,8 @@
 package status
 
 import (
+	"net/http"
+
 	"github.com/gogo/protobuf/proto"
 	"github.com/gogo/protobuf/types"
 	rpc "github.com/googleapis/googleapis/google/rpc"
@@ -70,6 +72,11 @@ func WithDeadlineExceeded(message string) rpc.Status {
 	return rpc.Status{Code: int32(rpc.DEADLINE_EXCEEDED), Message: message}
 }
 
+// WithUnavailable returns an initialized status with the rpc.UNAVAILABLE code and the given message.
+func WithUnavailable(message string) rpc.Status {
+	return rpc.Status{Code: int32(rpc.UNAVAILABLE), Message: message}
+}
+
 // IsOK returns true is the given status has the code rpc.OK
 func IsOK(status rpc.Status) bool {
 	return status.Code == int32(rpc.OK)
@@ -104,3 +111,34 @@ func NewBadRequest(field string, err error) *rpc.BadRequest {
 	}
 	return &rpc.BadRequest{FieldViolations: fvs}
 }
+
+// httpCodes maps google.rpc.Code values to their HTTP equivalent, following the mapping
+// documented in google/rpc/code.proto.
+var httpCodes = map[rpc.Code]int{
+	rpc.OK:                  http.StatusOK,
+	rpc.CANCELLED:           499, // Client Closed Request
+	rpc.UNKNOWN:             http.StatusInternalServerError,
+	rpc.INVALID_ARGUMENT:    http.StatusBadRequest,
+	rpc.DEADLINE_EXCEEDED:   http.StatusGatewayTimeout,
+	rpc.NOT_FOUND:           http.StatusNotFound,
+	rpc.ALREADY_EXISTS:      http.StatusConflict,
+	rpc.PERMISSION_DENIED:   http.StatusForbidden,
+	rpc.UNAUTHENTICATED:     http.StatusUnauthorized,
+	rpc.RESOURCE_EXHAUSTED:  http.StatusTooManyRequests,
+	rpc.FAILED_PRECONDITION: http.StatusBadRequest,
+	rpc.ABORTED:             http.StatusConflict,
+	rpc.OUT_OF_RANGE:        http.StatusBadRequest,
+	rpc.UNIMPLEMENTED:       http.StatusNotImplemented,
+	rpc.INTERNAL:            http.StatusInternalServerError,
+	rpc.UNAVAILABLE:         http.StatusServiceUnavailable,
+	rpc.DATA_LOSS:           http.StatusInternalServerError,
+}
+
+// HTTPStatusCode returns the HTTP status code corresponding to the status' code. Unknown codes
+// map to 500.
+func HTTPStatusCode(status rpc.Status) int {
+	if c, ok := httpCodes[rpc.Code(status.Code)]; ok {
+		return c
+	}
+	return http.StatusInternalServerError
+}
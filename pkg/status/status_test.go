@@ -73,12 +73,40 @@ func TestStatus(t *testing.T) {
 		t.Errorf("Got %v %v, expected rpc.DEADLINE_EXCEEDED Aborted!", s.Code, s.Message)
 	}
 
+	s = WithUnavailable("Aborted!")
+	if s.Code != int32(rpc.UNAVAILABLE) || s.Message != "Aborted!" {
+		t.Errorf("Got %v %v, expected rpc.UNAVAILABLE Aborted!", s.Code, s.Message)
+	}
+
 	s = InvalidWithDetails("Invalid", NewBadRequest("test", errors.New("error")))
 	if s.Code != int32(rpc.INVALID_ARGUMENT) && s.Message != "Invalid" && len(s.Details) != 1 {
 		t.Errorf("Got %v, expected status with code = rpc.INVALID_ARGUMENT and populated details", s)
 	}
 }
 
+func TestHTTPStatusCode(t *testing.T) {
+	cases := []struct {
+		code rpc.Code
+		want int
+	}{
+		{rpc.OK, 200},
+		{rpc.INVALID_ARGUMENT, 400},
+		{rpc.UNAUTHENTICATED, 401},
+		{rpc.PERMISSION_DENIED, 403},
+		{rpc.RESOURCE_EXHAUSTED, 429},
+		{rpc.CANCELLED, 499},
+		{rpc.INTERNAL, 500},
+		{rpc.UNAVAILABLE, 503},
+		{rpc.Code(1000), 500},
+	}
+
+	for _, c := range cases {
+		if got := HTTPStatusCode(New(c.code)); got != c.want {
+			t.Errorf("HTTPStatusCode(%v) = %d, wanted %d", c.code, got, c.want)
+		}
+	}
+}
+
 func TestNewBadRequest(t *testing.T) {
 	me := multierror.Append(errors.New("error one"), errors.New("error two"))
 